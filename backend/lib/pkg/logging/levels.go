@@ -0,0 +1,62 @@
+package logging
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Levels holds the default log level and overrides for single packages
+type Levels struct {
+	Default  logrus.Level
+	Packages map[string]logrus.Level
+}
+
+// ParseLevels parses a level specification such as "info,minio=debug,app=warn".
+// Entries without a package set the default level, which is info when omitted.
+func ParseLevels(spec string) (Levels, error) {
+	levels := Levels{Default: logrus.InfoLevel, Packages: make(map[string]logrus.Level)}
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		pkg, name, found := strings.Cut(part, "=")
+		if !found {
+			pkg, name = "", part
+		}
+		level, err := logrus.ParseLevel(strings.TrimSpace(name))
+		if err != nil {
+			return Levels{}, fmt.Errorf("invalid log level %q: %w", part, err)
+		}
+		if pkg = strings.TrimSpace(pkg); pkg == "" {
+			levels.Default = level
+		} else {
+			levels.Packages[pkg] = level
+		}
+	}
+	return levels, nil
+}
+
+// Level returns the level of a package, the default when it has no override
+func (l Levels) Level(pkg string) logrus.Level {
+	if level, ok := l.Packages[pkg]; ok {
+		return level
+	}
+	return l.Default
+}
+
+// WithLevel returns a logger sharing the output, formatter and hooks of
+// logger but logging at level. It is used to give packages their own level.
+func WithLevel(logger *logrus.Logger, level logrus.Level) *logrus.Logger {
+	return &logrus.Logger{
+		Out:          logger.Out,
+		Hooks:        logger.Hooks,
+		Formatter:    logger.Formatter,
+		ReportCaller: logger.ReportCaller,
+		Level:        level,
+		ExitFunc:     logger.ExitFunc,
+	}
+}
@@ -0,0 +1,46 @@
+package logging
+
+import (
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseLevels(t *testing.T) {
+	tests := []struct {
+		spec     string
+		def      logrus.Level
+		packages map[string]logrus.Level
+		wantErr  bool
+	}{
+		{spec: "", def: logrus.InfoLevel, packages: map[string]logrus.Level{}},
+		{spec: "debug", def: logrus.DebugLevel, packages: map[string]logrus.Level{}},
+		{spec: "warn, minio=debug ,app=error", def: logrus.WarnLevel,
+			packages: map[string]logrus.Level{"minio": logrus.DebugLevel, "app": logrus.ErrorLevel}},
+		{spec: "minio=trace", def: logrus.InfoLevel, packages: map[string]logrus.Level{"minio": logrus.TraceLevel}},
+		{spec: "verbose", wantErr: true},
+		{spec: "minio=loud", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.spec, func(t *testing.T) {
+			levels, err := ParseLevels(tt.spec)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.def, levels.Default)
+			assert.Equal(t, tt.packages, levels.Packages)
+		})
+	}
+}
+
+func TestLevelsLevel(t *testing.T) {
+	levels, err := ParseLevels("warn,minio=debug")
+	require.NoError(t, err)
+	assert.Equal(t, logrus.DebugLevel, levels.Level("minio"))
+	assert.Equal(t, logrus.WarnLevel, levels.Level("app"))
+}
@@ -5,11 +5,29 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path"
+	"runtime"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/sirupsen/logrus"
 )
 
+// Output formats supported by the logger
+const (
+	FormatText = "text" // MyFormatter lines
+	FormatJSON = "json" // one JSON object per line, see NewJSONFormatter
+)
+
+// Stable field names of the JSON format
+const (
+	FieldTime   = "time"
+	FieldLevel  = "level"
+	FieldCaller = "caller"
+	FieldMsg    = "msg"
+)
+
 type MyFormatter struct{}
 
 var levelList = []string{
@@ -24,7 +42,9 @@ var levelList = []string{
 
 // Format implements the logrus.Formatter interface.
 // It formats log entries with the following pattern:
-// "timestamp - filename - [line:number] - LEVEL - message"
+// "timestamp - filename - [line:number] - LEVEL - message key=value..."
+//
+// Fields attached to the entry are appended sorted by key.
 //
 // Parameters:
 //   - entry: A pointer to the logrus.Entry to be formatted
@@ -42,12 +62,99 @@ func (mf *MyFormatter) Format(entry *logrus.Entry) ([]byte, error) {
 	level := levelList[int(entry.Level)]
 	strList := strings.Split(entry.Caller.File, "/")
 	fileName := strList[len(strList)-1]
-	b.WriteString(fmt.Sprintf("%s - %s - [line:%d] - %s - %s\n",
+	b.WriteString(fmt.Sprintf("%s - %s - [line:%d] - %s - %s",
 		entry.Time.Format("2006-01-02 15:04:05,678"), fileName,
 		entry.Caller.Line, level, entry.Message))
+
+	keys := make([]string, 0, len(entry.Data))
+	for key := range entry.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		b.WriteString(fmt.Sprintf(" %s=%v", key, entry.Data[key]))
+	}
+	b.WriteByte('\n')
 	return b.Bytes(), nil
 }
 
+// NewJSONFormatter returns a formatter writing every entry as a JSON object
+// with the fields time (RFC 3339), level, caller ("dir/file.go:line"), msg
+// and every field attached to the entry. Attached fields clashing with these
+// names are prefixed with "fields.".
+func NewJSONFormatter() logrus.Formatter {
+	return &logrus.JSONFormatter{
+		TimestampFormat: time.RFC3339Nano,
+		FieldMap: logrus.FieldMap{
+			logrus.FieldKeyTime:  FieldTime,
+			logrus.FieldKeyLevel: FieldLevel,
+			logrus.FieldKeyMsg:   FieldMsg,
+			logrus.FieldKeyFile:  FieldCaller,
+		},
+		CallerPrettyfier: func(frame *runtime.Frame) (string, string) {
+			dir := path.Base(path.Dir(frame.File))
+			return "", fmt.Sprintf("%s/%s:%d", dir, path.Base(frame.File), frame.Line)
+		},
+	}
+}
+
+// NewFormatter returns the formatter for an output format, FormatText when empty
+func NewFormatter(format string) (logrus.Formatter, error) {
+	switch format {
+	case "", FormatText:
+		return &MyFormatter{}, nil
+	case FormatJSON:
+		return NewJSONFormatter(), nil
+	default:
+		return nil, fmt.Errorf("unknown log format %q", format)
+	}
+}
+
+// Options configures a logger created by New
+type Options struct {
+	// File is the path of the log file, opened in append mode
+	File string
+	// Output is an additional writer for log entries, nil to write to the file only
+	Output io.Writer
+	// Format is FormatText (default) or FormatJSON
+	Format string
+	// Level is the minimum level of logged entries, the zero value is logrus.PanicLevel
+	Level logrus.Level
+	// Rotate controls the rotation of the log file
+	Rotate RotateOptions
+}
+
+// Logger is a logrus logger writing to a rotating log file
+type Logger struct {
+	*logrus.Logger
+	// File is the log file, reopen it after external rotation
+	File *RotatingFile
+}
+
+// New creates a logger from the options. It reports the caller of every
+// entry and returns an error when the log file can't be opened or the
+// format is unknown.
+func New(opts Options) (*Logger, error) {
+	formatter, err := NewFormatter(opts.Format)
+	if err != nil {
+		return nil, err
+	}
+	f, err := OpenRotatingFile(opts.File, opts.Rotate)
+	if err != nil {
+		return nil, err
+	}
+	logger := logrus.New()
+	if opts.Output != nil {
+		logger.SetOutput(io.MultiWriter(opts.Output, f))
+	} else {
+		logger.SetOutput(f)
+	}
+	logger.SetReportCaller(true)
+	logger.SetFormatter(formatter)
+	logger.SetLevel(opts.Level)
+	return &Logger{Logger: logger, File: f}, nil
+}
+
 // MakeLogger creates and configures a new logrus.Logger instance.
 //
 // Parameters:
@@ -61,17 +168,25 @@ func (mf *MyFormatter) Format(entry *logrus.Entry) ([]byte, error) {
 // sets up the logger to write to this file, and optionally to stdout as well.
 // It also configures the logger to use a custom formatter (MyFormatter) and to report the caller.
 func MakeLogger(filename string, display bool) *logrus.Logger {
-	f, err := os.OpenFile(filename, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0644)
+	if display {
+		return MakeLoggerWithOutput(filename, os.Stdout)
+	}
+	return MakeLoggerWithOutput(filename, nil)
+}
+
+// MakeLoggerWithOutput creates a logger like MakeLogger, but mirrors log
+// entries to the given writer instead of stdout.
+//
+// Parameters:
+//   - filename: The path to the log file where logs will be written.
+//   - output: An additional writer for log entries, nil to write to the file only.
+//
+// Returns:
+//   - *logrus.Logger: A configured logger instance.
+func MakeLoggerWithOutput(filename string, output io.Writer) *logrus.Logger {
+	logger, err := New(Options{File: filename, Output: output, Level: logrus.InfoLevel})
 	if err != nil {
 		panic(err.Error())
 	}
-	logger := logrus.New()
-	if display {
-		logger.SetOutput(io.MultiWriter(os.Stdout, f))
-	} else {
-		logger.SetOutput(io.MultiWriter(f))
-	}
-	logger.SetReportCaller(true)
-	logger.SetFormatter(&MyFormatter{})
-	return logger
+	return logger.Logger
 }
@@ -0,0 +1,247 @@
+package logging
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// backupTimeFormat is the timestamp appended to rotated file names, it sorts chronologically
+const backupTimeFormat = "20060102-150405.000000000"
+
+// RotateOptions controls when a RotatingFile is rotated and how many
+// rotated files are kept. Zero values disable the respective limit.
+type RotateOptions struct {
+	// MaxSize is the size in bytes after which the file is rotated
+	MaxSize int64
+	// MaxAge is the time after which the file is rotated
+	MaxAge time.Duration
+	// MaxBackups is the number of rotated files kept, older ones are removed
+	MaxBackups int
+	// Compress gzips rotated files
+	Compress bool
+}
+
+// RotatingFile is an io.Writer appending to a log file that is rotated by
+// size and age. Rotated files are renamed to "<name>.<timestamp>" and
+// optionally compressed in the background. It is safe for concurrent use.
+type RotatingFile struct {
+	path string
+	opts RotateOptions
+
+	mu       sync.Mutex
+	file     *os.File
+	size     int64
+	openedAt time.Time
+	// now returns the current time, replaced in tests
+	now func() time.Time
+	// compressing tracks background compression of rotated files,
+	// background serializes it with pruning
+	compressing sync.WaitGroup
+	background  sync.Mutex
+}
+
+// OpenRotatingFile opens or creates the log file at path in append mode
+func OpenRotatingFile(path string, opts RotateOptions) (*RotatingFile, error) {
+	f := &RotatingFile{path: path, opts: opts, now: time.Now}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Write appends p to the file, rotating it first when p would exceed
+// MaxSize or the file is older than MaxAge.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file == nil {
+		return 0, os.ErrClosed
+	}
+	if f.shouldRotate(int64(len(p))) {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+// Reopen closes and reopens the file at its path. It is used after an
+// external tool such as logrotate moved the file away.
+func (f *RotatingFile) Reopen() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.file != nil {
+		if err := f.file.Close(); err != nil {
+			return err
+		}
+	}
+	return f.open()
+}
+
+// Rotate rotates the file regardless of its size and age
+func (f *RotatingFile) Rotate() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rotate()
+}
+
+// Close closes the file and waits for background compression to finish
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	var err error
+	if f.file != nil {
+		err = f.file.Close()
+		f.file = nil
+	}
+	f.mu.Unlock()
+
+	f.compressing.Wait()
+	return err
+}
+
+// Backups returns the rotated files of the log file, oldest first
+func (f *RotatingFile) Backups() ([]string, error) {
+	matches, err := filepath.Glob(f.path + ".*")
+	if err != nil {
+		return nil, err
+	}
+	var backups []string
+	for _, match := range matches {
+		stamp := strings.TrimSuffix(strings.TrimPrefix(match, f.path+"."), ".gz")
+		if _, err := time.Parse(backupTimeFormat, stamp); err == nil {
+			backups = append(backups, match)
+		}
+	}
+	sort.Strings(backups)
+	return backups, nil
+}
+
+// shouldRotate reports whether writing n more bytes requires a rotation
+func (f *RotatingFile) shouldRotate(n int64) bool {
+	if f.size == 0 {
+		return false
+	}
+	if f.opts.MaxSize > 0 && f.size+n > f.opts.MaxSize {
+		return true
+	}
+	return f.opts.MaxAge > 0 && f.now().Sub(f.openedAt) >= f.opts.MaxAge
+}
+
+// open opens the log file and records its size
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	f.file = file
+	f.size = info.Size()
+	f.openedAt = f.now()
+	return nil
+}
+
+// rotate renames the current file to a backup, opens a new one and
+// compresses and prunes the backups. When the rename fails the current
+// file is opened again.
+func (f *RotatingFile) rotate() error {
+	if f.file != nil {
+		if err := f.file.Close(); err != nil {
+			return err
+		}
+		f.file = nil
+	}
+
+	backup := f.path + "." + f.now().Format(backupTimeFormat)
+	if err := os.Rename(f.path, backup); err != nil && !os.IsNotExist(err) {
+		// Keep writing to the current file, the next write tries again
+		err = fmt.Errorf("failed to rotate log file: %w", err)
+		if openErr := f.open(); openErr != nil {
+			return errors.Join(err, openErr)
+		}
+		return err
+	}
+	if err := f.open(); err != nil {
+		return err
+	}
+
+	f.compressing.Add(1)
+	go func() {
+		defer f.compressing.Done()
+		f.background.Lock()
+		defer f.background.Unlock()
+		if f.opts.Compress {
+			if err := compressFile(backup); err != nil {
+				fmt.Fprintf(os.Stderr, "failed to compress log file %s: %v\n", backup, err)
+			}
+		}
+		if err := f.prune(); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to remove old log files: %v\n", err)
+		}
+	}()
+	return nil
+}
+
+// prune removes the oldest backups exceeding MaxBackups
+func (f *RotatingFile) prune() error {
+	if f.opts.MaxBackups <= 0 {
+		return nil
+	}
+	backups, err := f.Backups()
+	if err != nil {
+		return err
+	}
+	for len(backups) > f.opts.MaxBackups {
+		if err := os.Remove(backups[0]); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+// compressFile gzips path to path.gz and removes the original. A file
+// already removed by pruning is skipped.
+func compressFile(path string) error {
+	src, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(path+".gz", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
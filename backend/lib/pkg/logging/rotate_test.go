@@ -0,0 +1,131 @@
+package logging
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// clock is a controllable time source for rotation tests
+type clock struct{ now time.Time }
+
+func (c *clock) Now() time.Time { return c.now }
+
+func (c *clock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func openTestFile(t *testing.T, opts RotateOptions) (*RotatingFile, *clock) {
+	c := &clock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	f, err := OpenRotatingFile(filepath.Join(t.TempDir(), "app.log"), opts)
+	require.NoError(t, err)
+	f.now = c.Now
+	f.openedAt = c.Now()
+	t.Cleanup(func() { f.Close() })
+	return f, c
+}
+
+func write(t *testing.T, f *RotatingFile, c *clock, line string) {
+	c.Advance(time.Second)
+	_, err := f.Write([]byte(line))
+	require.NoError(t, err)
+}
+
+func readFile(t *testing.T, path string) string {
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestRotateBySize(t *testing.T) {
+	f, c := openTestFile(t, RotateOptions{MaxSize: 11})
+
+	write(t, f, c, "12345\n")
+	write(t, f, c, "1234\n")
+	write(t, f, c, "next\n")
+	require.NoError(t, f.Close())
+
+	backups, err := f.Backups()
+	require.NoError(t, err)
+	require.Len(t, backups, 1)
+	assert.Equal(t, "12345\n1234\n", readFile(t, backups[0]))
+	assert.Equal(t, "next\n", readFile(t, f.path))
+}
+
+func TestRotateRenameFailure(t *testing.T) {
+	f, c := openTestFile(t, RotateOptions{MaxSize: 11})
+	write(t, f, c, "12345\n")
+
+	// A directory in the way of the backup fails the rename
+	c.Advance(time.Second)
+	blocker := f.path + "." + c.Now().Format(backupTimeFormat)
+	require.NoError(t, os.MkdirAll(filepath.Join(blocker, "keep"), 0755))
+	_, err := f.Write([]byte("123456789\n"))
+	require.Error(t, err)
+	require.NoError(t, os.RemoveAll(blocker))
+
+	write(t, f, c, "123456789\n")
+	require.NoError(t, f.Close())
+	backups, err := f.Backups()
+	require.NoError(t, err)
+	require.Len(t, backups, 1, "the file is rotated once the rename succeeds")
+	assert.Equal(t, "12345\n", readFile(t, backups[0]))
+	assert.Equal(t, "123456789\n", readFile(t, f.path))
+}
+
+func TestRotateByAge(t *testing.T) {
+	f, c := openTestFile(t, RotateOptions{MaxAge: time.Hour})
+
+	write(t, f, c, "first\n")
+	c.Advance(time.Hour)
+	write(t, f, c, "second\n")
+	require.NoError(t, f.Close())
+
+	backups, err := f.Backups()
+	require.NoError(t, err)
+	require.Len(t, backups, 1)
+	assert.Equal(t, "first\n", readFile(t, backups[0]))
+}
+
+func TestRotateRetentionAndCompression(t *testing.T) {
+	f, c := openTestFile(t, RotateOptions{MaxSize: 1, MaxBackups: 2, Compress: true})
+
+	for _, line := range []string{"a\n", "b\n", "c\n", "d\n"} {
+		write(t, f, c, line)
+	}
+	require.NoError(t, f.Close())
+
+	backups, err := f.Backups()
+	require.NoError(t, err)
+	require.Len(t, backups, 2)
+	for i, want := range []string{"b\n", "c\n"} {
+		require.True(t, strings.HasSuffix(backups[i], ".gz"), backups[i])
+		file, err := os.Open(backups[i])
+		require.NoError(t, err)
+		zr, err := gzip.NewReader(file)
+		require.NoError(t, err)
+		data, err := io.ReadAll(zr)
+		require.NoError(t, err)
+		file.Close()
+		assert.Equal(t, want, string(data))
+	}
+	assert.Equal(t, "d\n", readFile(t, f.path))
+}
+
+func TestReopen(t *testing.T) {
+	f, c := openTestFile(t, RotateOptions{})
+
+	write(t, f, c, "before\n")
+	// Simulate logrotate moving the file away
+	require.NoError(t, os.Rename(f.path, f.path+".1"))
+	require.NoError(t, f.Reopen())
+	write(t, f, c, "after\n")
+
+	assert.Equal(t, "before\n", readFile(t, f.path+".1"))
+	assert.Equal(t, "after\n", readFile(t, f.path))
+}
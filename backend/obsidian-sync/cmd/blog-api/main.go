@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/savabush/obsidian-sync/internal/blog"
+	"github.com/savabush/obsidian-sync/internal/config"
+	"github.com/savabush/obsidian-sync/internal/database/postgres"
+	"github.com/savabush/obsidian-sync/internal/transport/rest"
+)
+
+// shutdownTimeout limits the time in-flight requests get to finish on shutdown
+const shutdownTimeout = 10 * time.Second
+
+// main is the entry point of the blog API. It loads and validates the
+// configuration, then serves the posts, articles and pages synchronized
+// to MinIO on api.listen_addr until it receives SIGINT or SIGTERM. Search
+// and paginated listings are served from the Postgres catalog when
+// postgres.host is set.
+func main() {
+	cfg, err := config.Load(config.LoadOptions{EnvFile: os.Getenv("ENV_FILE")})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	logger, err := config.NewLogger(cfg.LOGGING, os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	defer logger.Close()
+	if err := cfg.ValidateAPI(); err != nil {
+		logger.Fatal(err)
+	}
+
+	content, err := blog.New(cfg, logger)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if cfg.Postgres.HOST != "" {
+		db, err := postgres.Connect(context.Background(), cfg.Postgres, logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer db.Close()
+		content.SetIndex(db)
+		content.SetCatalog(db)
+	} else {
+		logger.Warn("POSTGRES_HOST is not set, search is disabled and listings read the whole buckets")
+	}
+	lis, err := net.Listen("tcp", cfg.API.LISTEN_ADDR)
+	if err != nil {
+		logger.Fatalf("Failed to listen on %s: %v", cfg.API.LISTEN_ADDR, err)
+	}
+	srv, errc := rest.NewServer(cfg.API, content, logger).Serve(lis)
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case err := <-errc:
+		logger.Fatalf("Blog API stopped: %v", err)
+	case sig := <-quit:
+		logger.Infof("Received %s, shutting down", sig)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		logger.Errorf("Failed to shut down the blog API: %v", err)
+	}
+	if err := <-errc; err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Errorf("Blog API stopped: %v", err)
+	}
+}
@@ -0,0 +1,353 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/savabush/obsidian-sync/internal/app"
+	"github.com/savabush/obsidian-sync/internal/config"
+	"github.com/savabush/obsidian-sync/internal/database/postgres"
+	obsidian "github.com/savabush/obsidian-sync/internal/services"
+	"github.com/savabush/obsidian-sync/internal/transport/kafka/producer"
+	"gopkg.in/yaml.v3"
+)
+
+// sourceFlags registers the flags selecting the vault to read
+func sourceFlags(fs *flag.FlagSet, src *app.Source) {
+	fs.StringVar(&src.Path, "vault", "", "use a local vault checkout instead of cloning GIT_URL")
+	fs.StringVar(&src.Ref, "ref", "", "git branch, tag or commit to check out")
+}
+
+// progress returns the writer for git clone progress
+func (c *cli) progress() io.Writer {
+	if c.verbose && !c.json {
+		return c.stderr
+	}
+	return nil
+}
+
+func runSync(c *cli, args []string) int {
+	var opts app.Options
+	var sections stringList
+	fs := c.flagSet("sync")
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "compute and print the sync plan without writing")
+	fs.Var(&sections, "section", "section to sync, repeatable (default all)")
+	sourceFlags(fs, &opts.Source)
+	if code, ok := c.parse(fs, args); !ok {
+		return code
+	}
+	opts.Sections = sections
+	opts.Progress = c.progress()
+	opts.Trigger = app.TriggerCLI
+	if c.cfg.Kafka.BROKERS != "" && !opts.DryRun {
+		publisher, err := producer.New(c.cfg.Kafka, c.logger)
+		if err != nil {
+			return c.fail(err)
+		}
+		defer publisher.Close()
+		c.app.SetPublisher(publisher)
+	}
+	var db *postgres.Repository
+	if c.cfg.Postgres.HOST != "" {
+		// Dry runs are recorded in the run history but leave the catalog alone
+		var err error
+		db, err = postgres.Connect(context.Background(), c.cfg.Postgres, c.logger)
+		if err != nil {
+			return c.fail(err)
+		}
+		defer db.Close()
+		c.app.SetCatalog(db)
+		c.app.SetHistory(db)
+	}
+	locker, err := app.NewLocker(c.cfg, c.logger, db)
+	if err != nil {
+		return c.fail(err)
+	}
+	if locker != nil {
+		c.app.SetLocker(locker)
+	}
+
+	report, err := c.app.Run(context.Background(), opts)
+	return c.printRun(report, err)
+}
+
+// printRun prints the report of a sync run and its error, if any. A failed
+// run with a partial report is printed as a single JSON document holding
+// both, so scripts can still parse it.
+func (c *cli) printRun(report *app.Report, err error) int {
+	if report == nil {
+		return c.fail(err)
+	}
+	if err != nil && c.json {
+		fmt.Fprintf(c.stderr, "error: %v\n", err)
+		c.printJSON(struct {
+			*app.Report
+			Error string `json:"error"`
+		}{report, err.Error()})
+		return exitError
+	}
+	c.print(report, func(w io.Writer) {
+		fmt.Fprintf(w, "Run: %s\n", report.RunID)
+		if report.Commit != "" {
+			fmt.Fprintf(w, "Commit: %s\n", report.Commit)
+		}
+		for _, section := range report.Sections {
+			printPlan(w, section.Section, section.Plan)
+		}
+		mode := ""
+		if report.DryRun {
+			mode = " (dry run, nothing was written)"
+		}
+		fmt.Fprintf(w, "Done in %v%s\n", report.Duration.Round(time.Millisecond), mode)
+	})
+	if err != nil {
+		return c.fail(err)
+	}
+	return exitOK
+}
+
+func runStatus(c *cli, args []string) int {
+	var sections stringList
+	fs := c.flagSet("status")
+	fs.Var(&sections, "section", "section to report, repeatable (default all)")
+	if code, ok := c.parse(fs, args); !ok {
+		return code
+	}
+
+	statuses, err := c.app.Status(sections)
+	if err != nil {
+		return c.fail(err)
+	}
+	c.print(statuses, func(w io.Writer) {
+		tw := newTable(w)
+		fmt.Fprintln(tw, "SECTION\tBUCKET\tEXISTS\tOBJECTS\tSIZE\tLAST MODIFIED")
+		for _, status := range statuses {
+			fmt.Fprintf(tw, "%s\t%s\t%t\t%d\t%d\t%s\n", status.Section, status.Bucket, status.Exists,
+				status.Objects, status.Size, formatTime(status.LastModified))
+		}
+		tw.Flush()
+	})
+	return exitOK
+}
+
+func runDiff(c *cli, args []string) int {
+	var src app.Source
+	var sections stringList
+	fs := c.flagSet("diff")
+	fs.Var(&sections, "section", "section to compare, repeatable (default all)")
+	sourceFlags(fs, &src)
+	if code, ok := c.parse(fs, args); !ok {
+		return code
+	}
+	src.Progress = c.progress()
+
+	diffs, err := c.app.Diff(src, sections)
+	if err != nil {
+		return c.fail(err)
+	}
+	changed := false
+	for _, diff := range diffs {
+		changed = changed || diff.Changed()
+	}
+	c.print(diffs, func(w io.Writer) {
+		for _, diff := range diffs {
+			fmt.Fprintf(w, "%s (%s): %d added, %d modified, %d deleted, %d unchanged\n", diff.Section, diff.Bucket,
+				len(diff.Added), len(diff.Modified), len(diff.Deleted), diff.Unchanged)
+			for _, name := range diff.Added {
+				fmt.Fprintf(w, "  + %s\n", name)
+			}
+			for _, name := range diff.Modified {
+				fmt.Fprintf(w, "  ~ %s\n", name)
+			}
+			for _, name := range diff.Deleted {
+				fmt.Fprintf(w, "  - %s\n", name)
+			}
+		}
+	})
+	if changed {
+		return exitChanges
+	}
+	return exitOK
+}
+
+func runList(c *cli, args []string) int {
+	var section, prefix string
+	fs := c.flagSet("list")
+	fs.StringVar(&section, "section", "", "section to list (required)")
+	fs.StringVar(&prefix, "prefix", "", "only list objects with this key prefix")
+	if code, ok := c.parse(fs, args); !ok {
+		return code
+	}
+	if section == "" {
+		fmt.Fprintln(c.stderr, "list: --section is required")
+		return exitUsage
+	}
+
+	objects, err := c.app.List(section, prefix)
+	if err != nil {
+		return c.fail(err)
+	}
+	c.print(objects, func(w io.Writer) {
+		tw := newTable(w)
+		fmt.Fprintln(tw, "KEY\tSIZE\tLAST MODIFIED\tMETADATA")
+		for _, object := range objects {
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%s\n", object.Key, object.Size, formatTime(object.LastModified),
+				formatMetadata(object.Metadata))
+		}
+		tw.Flush()
+	})
+	return exitOK
+}
+
+func runValidate(c *cli, args []string) int {
+	var src app.Source
+	var sections stringList
+	fs := c.flagSet("validate")
+	fs.Var(&sections, "section", "section to lint, repeatable (default all)")
+	sourceFlags(fs, &src)
+	if code, ok := c.parse(fs, args); !ok {
+		return code
+	}
+	src.Progress = c.progress()
+
+	issues, err := c.app.Validate(src, sections)
+	if err != nil {
+		return c.fail(err)
+	}
+	if issues == nil {
+		issues = []obsidian.VaultIssue{}
+	}
+	c.print(issues, func(w io.Writer) {
+		for _, issue := range issues {
+			fmt.Fprintf(w, "%s: %s: %s\n", issue.Severity, issue.Path, issue.Message)
+		}
+		fmt.Fprintf(w, "%d issue(s) found\n", len(issues))
+	})
+	if obsidian.HasErrors(issues) {
+		return exitChanges
+	}
+	return exitOK
+}
+
+func runRuns(c *cli, args []string) int {
+	if len(args) == 0 || (args[0] != "list" && args[0] != "show") || (args[0] == "show" && len(args) < 2) {
+		fmt.Fprintln(c.stderr, "Usage: obsidian-sync-cli runs <list [--limit n]|show <id>> [--json]")
+		return exitUsage
+	}
+	var runID string
+	rest := args[1:]
+	if args[0] == "show" {
+		runID, rest = args[1], args[2:]
+	}
+	limit := 20
+	fs := c.flagSet("runs " + args[0])
+	if args[0] == "list" {
+		fs.IntVar(&limit, "limit", limit, "maximum number of runs to list, 0 lists all")
+	}
+	if code, ok := c.parse(fs, rest); !ok {
+		return code
+	}
+	if c.cfg.Postgres.HOST == "" {
+		return c.fail(app.ErrNoHistory)
+	}
+	db, err := postgres.Connect(context.Background(), c.cfg.Postgres, c.logger)
+	if err != nil {
+		return c.fail(err)
+	}
+	defer db.Close()
+	c.app.SetHistory(db)
+
+	if args[0] == "show" {
+		run, err := c.app.RunByID(context.Background(), runID)
+		if err != nil {
+			return c.fail(err)
+		}
+		c.print(run, func(w io.Writer) { printRun(w, run) })
+		return exitOK
+	}
+
+	runs, err := c.app.Runs(context.Background(), limit)
+	if err != nil {
+		return c.fail(err)
+	}
+	c.print(runs, func(w io.Writer) {
+		tw := newTable(w)
+		fmt.Fprintln(tw, "RUN\tSTATE\tTRIGGER\tSTARTED\tDURATION\tCOMMIT\tCHANGES\tFAILED")
+		for _, run := range runs {
+			changes, failed := 0, 0
+			for _, section := range run.Sections {
+				changes += section.Create + section.Update + section.Delete
+				failed += section.Failed
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%d\t%d\n", run.RunID, run.State, run.Trigger,
+				formatTime(run.StartedAt), formatDuration(run), shortCommit(run.Commit), changes, failed)
+		}
+		tw.Flush()
+	})
+	return exitOK
+}
+
+func runConfig(c *cli, args []string) int {
+	if len(args) == 0 || (args[0] != "print" && args[0] != "validate") {
+		fmt.Fprintln(c.stderr, "Usage: obsidian-sync-cli config <print|validate> [--json]")
+		return exitUsage
+	}
+	fs := c.flagSet("config " + args[0])
+	if code, ok := c.parse(fs, args[1:]); !ok {
+		return code
+	}
+
+	if args[0] == "validate" {
+		return c.validateConfig()
+	}
+
+	settings := c.cfg.Masked()
+	c.print(settings, func(w io.Writer) {
+		enc := yaml.NewEncoder(w)
+		enc.SetIndent(2)
+		if err := enc.Encode(settings); err != nil {
+			fmt.Fprintf(c.stderr, "error: failed to encode config: %v\n", err)
+		}
+	})
+	return exitOK
+}
+
+// validateConfig reports every configuration problem, exiting with
+// exitChanges when the configuration is invalid
+func (c *cli) validateConfig() int {
+	problems := []config.FieldError{}
+	err := c.cfg.Validate()
+	var validationErr *config.ValidationError
+	if errors.As(err, &validationErr) {
+		problems = validationErr.Problems
+	}
+	c.print(problems, func(w io.Writer) {
+		for _, problem := range problems {
+			fmt.Fprintf(w, "error: %s\n", problem.Error())
+		}
+		fmt.Fprintf(w, "%d problem(s) found\n", len(problems))
+	})
+	if len(problems) > 0 {
+		return exitChanges
+	}
+	return exitOK
+}
+
+// formatMetadata renders object metadata as sorted key=value pairs
+func formatMetadata(metadata map[string]string) string {
+	if len(metadata) == 0 {
+		return "-"
+	}
+	pairs := make([]string, 0, len(metadata))
+	for key, value := range metadata {
+		pairs = append(pairs, strings.ToLower(key)+"="+value)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, " ")
+}
@@ -1,9 +1,176 @@
 package main
 
 import (
-	. "github.com/savabush/obsidian-sync/internal/app"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/savabush/obsidian-sync/internal/app"
+	"github.com/savabush/obsidian-sync/internal/config"
+	grpcserver "github.com/savabush/obsidian-sync/internal/transport/grpc"
+)
+
+// Exit codes returned by the CLI
+const (
+	exitOK      = 0 // command succeeded
+	exitError   = 1 // command failed
+	exitUsage   = 2 // invalid command line
+	exitChanges = 3 // diff found differences, validate found errors or the config is invalid
 )
 
+// command is a single CLI subcommand
+type command struct {
+	name    string
+	summary string
+	run     func(cli *cli, args []string) int
+}
+
+var commands = []command{
+	{"sync", "Synchronize the vault with MinIO", runSync},
+	{"status", "Show the state of the section buckets", runStatus},
+	{"diff", "Compare the vault with the bucket contents", runDiff},
+	{"list", "List objects of a section with their metadata", runList},
+	{"validate", "Lint the vault structure without uploading", runValidate},
+	{"runs", "List (runs list) or show (runs show <id>) recorded sync runs", runRuns},
+	{"config", "Print (config print) or check (config validate) the configuration", runConfig},
+}
+
+// cli holds the output streams, flags and application shared by all subcommands
+type cli struct {
+	stdout     io.Writer
+	stderr     io.Writer
+	json       bool
+	verbose    bool
+	configFile string
+
+	cfg    config.Config
+	logger *config.Logger
+	app    *app.App
+}
+
+// main is the entry point of the obsidian-sync command line tool.
+// It dispatches to a subcommand and exits with its exit code.
 func main() {
-	App()
+	c := &cli{stdout: os.Stdout, stderr: os.Stderr}
+	code := c.run(os.Args[1:])
+	if c.logger != nil {
+		c.logger.Close()
+	}
+	os.Exit(code)
+}
+
+// run dispatches args to the matching subcommand and returns the exit code
+func (c *cli) run(args []string) int {
+	if len(args) == 0 {
+		c.usage()
+		return exitUsage
+	}
+
+	name := args[0]
+	if name == "help" || name == "-h" || name == "--help" {
+		c.usage()
+		return exitOK
+	}
+	for _, cmd := range commands {
+		if cmd.name == name {
+			return cmd.run(c, args[1:])
+		}
+	}
+
+	fmt.Fprintf(c.stderr, "unknown command %q\n\n", name)
+	c.usage()
+	return exitUsage
+}
+
+// usage prints the list of subcommands
+func (c *cli) usage() {
+	fmt.Fprintln(c.stderr, "Usage: obsidian-sync-cli <command> [flags]")
+	fmt.Fprintln(c.stderr)
+	fmt.Fprintln(c.stderr, "Commands:")
+	for _, cmd := range commands {
+		fmt.Fprintf(c.stderr, "  %-10s %s\n", cmd.name, cmd.summary)
+	}
+	fmt.Fprintln(c.stderr)
+	fmt.Fprintln(c.stderr, "Run 'obsidian-sync-cli <command> -h' for command flags.")
+	fmt.Fprintf(c.stderr, "Exit codes: %d ok, %d error, %d usage, %d changes found.\n",
+		exitOK, exitError, exitUsage, exitChanges)
+}
+
+// flagSet creates a flag set for a subcommand with the common flags registered
+func (c *cli) flagSet(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.BoolVar(&c.json, "json", false, "print machine readable JSON output")
+	fs.BoolVar(&c.verbose, "verbose", false, "mirror log entries to stderr")
+	fs.StringVar(&c.configFile, "config", "", "YAML config file (default $CONFIG_FILE or ./config.yaml)")
+	return fs
+}
+
+// parse parses subcommand flags, loads the configuration and creates the
+// application. It returns false with the exit code to use when parsing or
+// loading failed or help was requested.
+func (c *cli) parse(fs *flag.FlagSet, args []string) (int, bool) {
+	if err := fs.Parse(args); err != nil {
+		if err == flag.ErrHelp {
+			return exitOK, false
+		}
+		return exitUsage, false
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(c.stderr, "unexpected arguments: %s\n", strings.Join(fs.Args(), " "))
+		return exitUsage, false
+	}
+
+	cfg, err := config.Load(config.LoadOptions{
+		EnvFile:    os.Getenv("ENV_FILE"),
+		ConfigFile: c.configFile,
+	})
+	if err != nil {
+		return c.fail(err), false
+	}
+
+	// Keep stdout clean for command output, logs go to the log file
+	var display io.Writer
+	if c.verbose {
+		display = c.stderr
+	}
+	logger, err := config.NewLogger(cfg.LOGGING, display)
+	if err != nil {
+		return c.fail(err), false
+	}
+	c.cfg = cfg
+	c.logger = logger
+	c.app = app.New(cfg, logger)
+	if cfg.GRPC.ORCHESTRATOR_ADDR != "" {
+		c.app.SetReporter(grpcserver.NewReporter(cfg.GRPC.ORCHESTRATOR_ADDR, cfg.GRPC.REPORT_TIMEOUT))
+	}
+	return exitOK, true
+}
+
+// fail reports an error and returns the error exit code
+func (c *cli) fail(err error) int {
+	if c.json {
+		c.printJSON(map[string]string{"error": err.Error()})
+	} else {
+		fmt.Fprintf(c.stderr, "error: %v\n", err)
+	}
+	return exitError
+}
+
+// stringList is a flag that can be repeated or given as a comma separated list
+type stringList []string
+
+func (s *stringList) String() string {
+	return strings.Join(*s, ",")
+}
+
+func (s *stringList) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*s = append(*s, item)
+		}
+	}
+	return nil
 }
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/savabush/obsidian-sync/internal/app"
+	"github.com/savabush/obsidian-sync/internal/config"
+	"github.com/savabush/obsidian-sync/internal/database/minio"
+)
+
+// runCLI runs the CLI with args and returns the exit code and outputs
+func runCLI(args ...string) (int, string, string) {
+	var stdout, stderr bytes.Buffer
+	c := &cli{stdout: &stdout, stderr: &stderr}
+	code := c.run(args)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestRunUsage(t *testing.T) {
+	code, _, stderr := runCLI()
+	assert.Equal(t, exitUsage, code)
+	assert.Contains(t, stderr, "Usage: obsidian-sync-cli")
+
+	code, _, _ = runCLI("help")
+	assert.Equal(t, exitOK, code)
+
+	code, _, stderr = runCLI("unknown")
+	assert.Equal(t, exitUsage, code)
+	assert.Contains(t, stderr, `unknown command "unknown"`)
+
+	code, _, _ = runCLI("sync", "--no-such-flag")
+	assert.Equal(t, exitUsage, code)
+
+	code, _, _ = runCLI("list")
+	assert.Equal(t, exitUsage, code)
+
+	code, _, _ = runCLI("config")
+	assert.Equal(t, exitUsage, code)
+
+	code, _, _ = runCLI("runs", "show")
+	assert.Equal(t, exitUsage, code)
+}
+
+func TestRunsRequireHistory(t *testing.T) {
+	t.Setenv("POSTGRES_HOST", "")
+
+	code, _, stderr := runCLI("runs", "list", "--limit", "5")
+	assert.Equal(t, exitError, code)
+	assert.Contains(t, stderr, "the run history requires POSTGRES_HOST")
+
+	code, stdout, _ := runCLI("runs", "show", "abc", "--json")
+	assert.Equal(t, exitError, code)
+	assert.Contains(t, stdout, `"error"`)
+}
+
+func TestConfigPrintMasksSecrets(t *testing.T) {
+	t.Setenv("MINIO_SECRET_KEY", "super-secret")
+	t.Setenv("MINIO_ACCESS_KEY", "")
+
+	code, stdout, _ := runCLI("config", "print", "--json")
+	require.Equal(t, exitOK, code)
+	assert.NotContains(t, stdout, "super-secret")
+
+	var printed config.Config
+	require.NoError(t, json.Unmarshal([]byte(stdout), &printed))
+	assert.Equal(t, "********", printed.Minio.SECRET_KEY)
+	assert.Equal(t, "", printed.Minio.ACCESS_KEY)
+
+	code, stdout, _ = runCLI("config", "print")
+	require.Equal(t, exitOK, code)
+	assert.Contains(t, stdout, "secret_key: '********'\n")
+}
+
+func TestConfigValidate(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.yaml")
+	require.NoError(t, os.WriteFile(configFile, []byte("app:\n  schedule: 0\n"), 0644))
+	t.Setenv("GIT_URL", "")
+	t.Setenv("MINIO_ENDPOINT", "")
+
+	code, stdout, _ := runCLI("config", "validate", "--json", "--config", configFile)
+	assert.Equal(t, exitChanges, code)
+	assert.Contains(t, stdout, `"field": "git.url"`)
+	assert.Contains(t, stdout, `"field": "minio.endpoint"`)
+	assert.Contains(t, stdout, `"field": "app.schedule"`)
+}
+
+func TestValidateExitCodes(t *testing.T) {
+	root := t.TempDir()
+	note := filepath.Join(root, config.Blog, "Post", "Post.md")
+	require.NoError(t, os.MkdirAll(filepath.Dir(note), 0755))
+	require.NoError(t, os.WriteFile(note, []byte("![[Missing.png]]"), 0644))
+
+	code, stdout, _ := runCLI("validate", "--vault", root, "--section", "blog", "--json")
+	assert.Equal(t, exitChanges, code)
+	assert.Contains(t, stdout, "embedded resource not found: Missing.png")
+
+	require.NoError(t, os.WriteFile(note, []byte("# Post"), 0644))
+	code, stdout, _ = runCLI("validate", "--vault", root, "--section", "blog")
+	assert.Equal(t, exitOK, code)
+	assert.Contains(t, stdout, "0 issue(s) found")
+
+	code, _, _ = runCLI("validate", "--vault", root, "--section", "nope")
+	assert.Equal(t, exitError, code)
+}
+
+func TestStringList(t *testing.T) {
+	var list stringList
+	require.NoError(t, list.Set("blog, articles"))
+	require.NoError(t, list.Set("blog"))
+	assert.Equal(t, stringList{"blog", "articles", "blog"}, list)
+}
+
+func TestPrintRunFailure(t *testing.T) {
+	report := &app.Report{RunID: "run1", Sections: []app.SectionResult{
+		{Section: config.Blog, Plan: &minio.Plan{Bucket: "blog"}},
+	}}
+	failure := errors.New("failed to upload files")
+
+	var stdout, stderr bytes.Buffer
+	c := &cli{stdout: &stdout, stderr: &stderr, json: true}
+	assert.Equal(t, exitError, c.printRun(report, failure))
+	assert.Equal(t, "error: failed to upload files\n", stderr.String())
+
+	var out map[string]interface{}
+	dec := json.NewDecoder(&stdout)
+	require.NoError(t, dec.Decode(&out))
+	assert.False(t, dec.More(), "stdout holds a single JSON document")
+	assert.Equal(t, "run1", out["run_id"])
+	assert.Equal(t, "failed to upload files", out["error"])
+	assert.Len(t, out["sections"], 1)
+
+	stdout.Reset()
+	stderr.Reset()
+	c.json = false
+	assert.Equal(t, exitError, c.printRun(report, failure))
+	assert.Contains(t, stdout.String(), "Run: run1")
+	assert.Equal(t, "error: failed to upload files\n", stderr.String())
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/savabush/obsidian-sync/internal/app"
+	"github.com/savabush/obsidian-sync/internal/database/minio"
+)
+
+// print writes v as JSON when --json is set, otherwise calls human
+func (c *cli) print(v interface{}, human func(w io.Writer)) {
+	if c.json {
+		c.printJSON(v)
+		return
+	}
+	human(c.stdout)
+}
+
+// printJSON writes v as indented JSON to stdout
+func (c *cli) printJSON(v interface{}) {
+	enc := json.NewEncoder(c.stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		fmt.Fprintf(c.stderr, "error: failed to encode output: %v\n", err)
+	}
+}
+
+// newTable creates a tab writer for aligned human output
+func newTable(w io.Writer) *tabwriter.Writer {
+	return tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+}
+
+// formatTime renders a timestamp for human output, "-" when unset
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+// printPlan renders a sync plan, listing every operation except skips
+func printPlan(w io.Writer, section string, plan *minio.Plan) {
+	fmt.Fprintf(w, "%s (%s): %d to create, %d to update, %d to delete, %d unchanged, %d bytes to upload\n",
+		section, plan.Bucket, plan.Summary.Create, plan.Summary.Update, plan.Summary.Delete,
+		plan.Summary.Skip, plan.Summary.UploadBytes)
+
+	tw := newTable(w)
+	for _, item := range plan.Items {
+		if item.Action == minio.ActionSkip {
+			continue
+		}
+		reason := item.Reason
+		if item.Error != "" {
+			reason += " (failed: " + item.Error + ")"
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%d\t%s\n", item.Action, item.Key, item.Size, reason)
+	}
+	tw.Flush()
+}
+
+// printRun renders a recorded run with its section counts and errors
+func printRun(w io.Writer, run app.RunStatus) {
+	fmt.Fprintf(w, "Run: %s\n", run.RunID)
+	fmt.Fprintf(w, "State: %s\n", run.State)
+	fmt.Fprintf(w, "Trigger: %s\n", run.Trigger)
+	if run.DryRun {
+		fmt.Fprintln(w, "Dry run: true")
+	}
+	if run.Commit != "" {
+		fmt.Fprintf(w, "Commit: %s\n", run.Commit)
+	}
+	fmt.Fprintf(w, "Started: %s\n", formatTime(run.StartedAt))
+	fmt.Fprintf(w, "Finished: %s (%s)\n", formatTime(run.FinishedAt), formatDuration(run))
+	if run.Error != "" {
+		fmt.Fprintf(w, "Error: %s\n", run.Error)
+	}
+	for _, section := range run.Sections {
+		fmt.Fprintf(w, "%s (%s): %d created, %d updated, %d deleted, %d unchanged, %d failed\n", section.Section,
+			section.Bucket, section.Create, section.Update, section.Delete, section.Skip, section.Failed)
+		for _, message := range section.Errors {
+			fmt.Fprintf(w, "  ! %s\n", message)
+		}
+	}
+}
+
+// formatDuration renders how long a run took, "-" while it is running
+func formatDuration(run app.RunStatus) string {
+	if run.FinishedAt.IsZero() {
+		return "-"
+	}
+	return run.FinishedAt.Sub(run.StartedAt).Round(time.Millisecond).String()
+}
+
+// shortCommit abbreviates a commit hash, "-" when unset
+func shortCommit(commit string) string {
+	if commit == "" {
+		return "-"
+	}
+	if len(commit) > 8 {
+		return commit[:8]
+	}
+	return commit
+}
@@ -1,11 +1,20 @@
 package main
 
 import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
 	"sync"
+	"syscall"
 	"time"
 
 	app "github.com/savabush/obsidian-sync/internal/app"
-	. "github.com/savabush/obsidian-sync/internal/config"
+	"github.com/savabush/obsidian-sync/internal/config"
+	"github.com/savabush/obsidian-sync/internal/database/postgres"
+	grpcserver "github.com/savabush/obsidian-sync/internal/transport/grpc"
+	"github.com/savabush/obsidian-sync/internal/transport/kafka/producer"
 )
 
 // AppFunc represents a function that can be scheduled
@@ -18,6 +27,16 @@ type Scheduler struct {
 	quit     chan struct{}
 	mu       sync.Mutex
 	running  bool
+
+	// pending holds an update waiting for the next run boundary
+	pending *schedulerUpdate
+	updated chan struct{}
+}
+
+// schedulerUpdate is a new interval and function for the scheduler
+type schedulerUpdate struct {
+	interval time.Duration
+	appFunc  AppFunc
 }
 
 // NewScheduler creates a new scheduler with the given interval and function
@@ -27,6 +46,7 @@ func NewScheduler(interval time.Duration, fn AppFunc) *Scheduler {
 		appFunc:  fn,
 		quit:     make(chan struct{}),
 		running:  false,
+		updated:  make(chan struct{}, 1),
 	}
 }
 
@@ -47,6 +67,9 @@ func (s *Scheduler) Start() {
 		select {
 		case <-ticker.C:
 			s.appFunc()
+			s.applyUpdate(ticker)
+		case <-s.updated:
+			s.applyUpdate(ticker)
 		case <-s.quit:
 			s.mu.Lock()
 			s.running = false
@@ -56,6 +79,42 @@ func (s *Scheduler) Start() {
 	}
 }
 
+// Update replaces the interval and function of the scheduler. A run in
+// progress is never interrupted: the update is applied once it finishes,
+// or right away when the scheduler is idle. Only the latest update is kept.
+func (s *Scheduler) Update(interval time.Duration, fn AppFunc) {
+	s.mu.Lock()
+	s.pending = &schedulerUpdate{interval: interval, appFunc: fn}
+	s.mu.Unlock()
+
+	select {
+	case s.updated <- struct{}{}:
+	default:
+	}
+}
+
+// applyUpdate applies a pending update, restarting the ticker when the interval changed
+func (s *Scheduler) applyUpdate(ticker *time.Ticker) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.pending == nil {
+		return
+	}
+	if s.pending.interval != s.interval {
+		ticker.Reset(s.pending.interval)
+	}
+	s.interval = s.pending.interval
+	s.appFunc = s.pending.appFunc
+	s.pending = nil
+}
+
+// Interval returns the current interval of the scheduler
+func (s *Scheduler) Interval() time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.interval
+}
+
 // Stop stops the scheduler
 func (s *Scheduler) Stop() {
 	s.mu.Lock()
@@ -75,13 +134,125 @@ func (s *Scheduler) IsRunning() bool {
 }
 
 // main is the entry point of the obsidian-sync scheduler application.
-// It sets up a ticker to run the App() function at regular intervals
-// defined by Settings.APP.SCHEDULE. The scheduler can be gracefully
-// stopped by sending a signal to the quit channel.
+// It loads and validates the configuration, then sets up a ticker to run
+// the application at regular intervals defined by app.schedule. The
+// configuration is reloaded when the config file changes or on SIGHUP and
+// applied at the next run boundary. The scheduler can be gracefully stopped
+// by sending a signal to the quit channel.
 func main() {
-	interval := time.Duration(Settings.APP.SCHEDULE) * time.Minute
-	Logger.Infof("Starting obsidian-sync scheduler. Starts every %v minutes", Settings.APP.SCHEDULE)
-	
-	scheduler := NewScheduler(interval, app.App)
+	opts := config.LoadOptions{EnvFile: os.Getenv("ENV_FILE")}
+	cfg, err := config.Load(opts)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	logger, err := config.NewLogger(cfg.LOGGING, os.Stdout)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	if err := cfg.Validate(); err != nil {
+		logger.Fatal(err)
+	}
+
+	logger.Infof("Starting obsidian-sync scheduler. Starts every %v minutes", cfg.APP.SCHEDULE)
+	// Connections outlive config reloads, Kafka, Postgres and lock settings require a restart
+	var conns connections
+	if cfg.Kafka.BROKERS != "" {
+		publisher, err := producer.New(cfg.Kafka, logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer publisher.Close()
+		conns.publisher = publisher
+	}
+	var db *postgres.Repository
+	if cfg.Postgres.HOST != "" {
+		db, err = postgres.Connect(context.Background(), cfg.Postgres, logger)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		defer db.Close()
+		conns.catalog = db
+		conns.history = db
+	}
+	if conns.locker, err = app.NewLocker(cfg, logger, db); err != nil {
+		logger.Fatal(err)
+	}
+
+	// Scheduled and triggered runs share the runner so they never overlap
+	runner := app.NewRunner(newApp(cfg, logger, conns), app.DefaultHistorySize)
+	scheduler := NewScheduler(scheduleInterval(cfg), runner.RunScheduled)
+
+	if cfg.GRPC.LISTEN_ADDR != "" {
+		lis, err := net.Listen("tcp", cfg.GRPC.LISTEN_ADDR)
+		if err != nil {
+			logger.Fatalf("Failed to listen on %s: %v", cfg.GRPC.LISTEN_ADDR, err)
+		}
+		_, errc := grpcserver.NewServer(runner, logger).Serve(lis)
+		go func() {
+			logger.Fatalf("gRPC server stopped: %v", <-errc)
+		}()
+	}
+
+	reloader := NewReloader(opts, cfg, logger, func(cfg config.Config) {
+		runner.SetApp(newApp(cfg, logger, conns))
+		scheduler.Update(scheduleInterval(cfg), runner.RunScheduled)
+	})
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go reloader.Watch(hangup, scheduler.quit)
+
+	// Reopen the log file after external rotation by logrotate
+	reopen := make(chan os.Signal, 1)
+	signal.Notify(reopen, syscall.SIGUSR1)
+	go reopenOnSignal(logger, reopen)
+
 	scheduler.Start()
 }
+
+// connections are the optional backends opened once at startup
+type connections struct {
+	publisher app.EventPublisher
+	catalog   app.PostCatalog
+	history   app.RunHistory
+	locker    app.Locker
+}
+
+// newApp creates the application, reporting runs to the orchestrator when
+// configured and using the opened connections
+func newApp(cfg config.Config, logger config.LoggerInterface, conns connections) *app.App {
+	a := app.New(cfg, logger)
+	if cfg.GRPC.ORCHESTRATOR_ADDR != "" {
+		a.SetReporter(grpcserver.NewReporter(cfg.GRPC.ORCHESTRATOR_ADDR, cfg.GRPC.REPORT_TIMEOUT))
+	}
+	if conns.publisher != nil {
+		a.SetPublisher(conns.publisher)
+	}
+	if conns.catalog != nil {
+		a.SetCatalog(conns.catalog)
+	}
+	if conns.history != nil {
+		a.SetHistory(conns.history)
+	}
+	if conns.locker != nil {
+		a.SetLocker(conns.locker)
+	}
+	return a
+}
+
+// reopenOnSignal reopens the log file on every signal received
+func reopenOnSignal(logger *config.Logger, signals <-chan os.Signal) {
+	for range signals {
+		if err := logger.Reopen(); err != nil {
+			logger.Errorf("Failed to reopen log file: %v", err)
+			continue
+		}
+		logger.Info("Log file reopened")
+	}
+}
+
+// scheduleInterval returns the time between runs configured by app.schedule
+func scheduleInterval(cfg config.Config) time.Duration {
+	return time.Duration(cfg.APP.SCHEDULE) * time.Minute
+}
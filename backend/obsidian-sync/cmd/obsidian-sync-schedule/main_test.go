@@ -87,3 +87,35 @@ func TestNewScheduler(t *testing.T) {
 	assert.NotNil(t, scheduler.quit, "Quit channel should not be nil")
 	assert.NotNil(t, scheduler.appFunc, "AppFunc should not be nil")
 }
+
+func TestSchedulerUpdate(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	updated := &mockCounter{}
+
+	// The first run blocks until released to simulate an in-flight sync
+	scheduler := NewScheduler(20*time.Millisecond, func() {
+		close(started)
+		<-release
+	})
+	go scheduler.Start()
+	defer scheduler.Stop()
+
+	<-started
+	scheduler.Update(time.Hour, updated.increment)
+	assert.Equal(t, 20*time.Millisecond, scheduler.Interval(), "Update should wait for the running sync")
+
+	close(release)
+	assert.Eventually(t, func() bool { return scheduler.Interval() == time.Hour }, time.Second, 5*time.Millisecond)
+	assert.Zero(t, updated.getCount(), "New interval should apply to the next run")
+}
+
+func TestSchedulerUpdateWhenIdle(t *testing.T) {
+	scheduler := NewScheduler(time.Hour, mockApp)
+	go scheduler.Start()
+	defer scheduler.Stop()
+
+	counter = &mockCounter{}
+	scheduler.Update(20*time.Millisecond, mockApp)
+	assert.Eventually(t, func() bool { return counter.getCount() > 0 }, time.Second, 5*time.Millisecond)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"time"
+
+	"github.com/savabush/obsidian-sync/internal/config"
+)
+
+// defaultPollInterval is how often the config file is checked for changes
+const defaultPollInterval = 5 * time.Second
+
+// Reloader reloads the configuration when the config file changes or when
+// it is asked to, and hands every valid, changed configuration to apply.
+// Invalid configurations are rejected and the current one is kept.
+type Reloader struct {
+	opts         config.LoadOptions
+	current      config.Config
+	logger       config.LoggerInterface
+	apply        func(config.Config)
+	pollInterval time.Duration
+
+	// modTime and size identify the last seen version of the config file
+	modTime time.Time
+	size    int64
+}
+
+// NewReloader creates a reloader starting from the current configuration
+func NewReloader(opts config.LoadOptions, current config.Config, logger config.LoggerInterface,
+	apply func(config.Config)) *Reloader {
+	r := &Reloader{
+		opts:         opts,
+		current:      current,
+		logger:       logger,
+		apply:        apply,
+		pollInterval: defaultPollInterval,
+	}
+	r.fileChanged()
+	return r
+}
+
+// Watch reloads the configuration on every value received from signals and
+// whenever the config file changes, until quit is closed.
+func (r *Reloader) Watch(signals <-chan os.Signal, quit <-chan struct{}) {
+	ticker := time.NewTicker(r.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case sig := <-signals:
+			r.logger.Infof("Received %v, reloading config", sig)
+			r.Reload()
+		case <-ticker.C:
+			if r.fileChanged() {
+				r.logger.Infof("Config file %s changed, reloading config", r.current.File())
+				r.Reload()
+			}
+		case <-quit:
+			return
+		}
+	}
+}
+
+// Reload loads and validates the configuration and applies it when it
+// differs from the current one. It returns whether the configuration was applied.
+func (r *Reloader) Reload() bool {
+	cfg, err := config.Load(r.opts)
+	if err != nil {
+		r.logger.Errorf("Failed to reload config, keeping the current one: %v", err)
+		return false
+	}
+	if err := cfg.Validate(); err != nil {
+		r.logger.Errorf("Rejected invalid config, keeping the current one: %v", err)
+		return false
+	}
+
+	changes := config.Diff(r.current, cfg)
+	if len(changes) == 0 {
+		r.logger.Info("Config reloaded without changes")
+		return false
+	}
+	for _, change := range changes {
+		r.logger.Infof("Config changed %s", change)
+		if restartRequired(change.Field) {
+			r.logger.Warnf("Change of %s takes effect after a restart", change.Field)
+		}
+	}
+
+	r.current = cfg
+	r.fileChanged()
+	r.apply(cfg)
+	r.logger.Info("Config reloaded, changes apply from the next run")
+	return true
+}
+
+// restartRequired reports whether a changed field is only read at startup.
+// The run retention is read by every run.
+func restartRequired(field string) bool {
+	if field == "postgres.run_retention" {
+		return false
+	}
+	return strings.HasPrefix(field, "logging.") || strings.HasPrefix(field, "kafka.") ||
+		strings.HasPrefix(field, "postgres.") || strings.HasPrefix(field, "lock.") || field == "grpc.listen_addr"
+}
+
+// fileChanged reports whether the config file changed since it was last seen
+func (r *Reloader) fileChanged() bool {
+	path := r.current.File()
+	if path == "" {
+		return false
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	if info.ModTime().Equal(r.modTime) && info.Size() == r.size {
+		return false
+	}
+	r.modTime, r.size = info.ModTime(), info.Size()
+	return true
+}
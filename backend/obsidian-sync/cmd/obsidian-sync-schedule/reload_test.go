@@ -0,0 +1,118 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/savabush/obsidian-sync/internal/config"
+	"github.com/savabush/obsidian-sync/internal/lib"
+)
+
+// writeConfig writes a valid config file with the given schedule and workers
+func writeConfig(t *testing.T, path string, schedule, workers int) {
+	certPath := filepath.Join(filepath.Dir(path), "id_rsa")
+	require.NoError(t, os.WriteFile(certPath, []byte("key"), 0600))
+	data := fmt.Sprintf(`git:
+  url: git@example.com:vault.git
+  cert_path: %s
+app:
+  schedule: %d
+minio:
+  endpoint: localhost:9000
+  access_key: access
+  secret_key: secret
+workers:
+  num_workers: %d
+`, certPath, schedule, workers)
+	require.NoError(t, os.WriteFile(path, []byte(data), 0644))
+}
+
+func newTestReloader(t *testing.T, path string, apply func(config.Config)) *Reloader {
+	opts := config.LoadOptions{
+		ConfigFile: path,
+		LookupEnv:  func(string) (string, bool) { return "", false },
+	}
+	cfg, err := config.Load(opts)
+	require.NoError(t, err)
+	require.NoError(t, cfg.Validate())
+	return NewReloader(opts, cfg, lib.TestLog, apply)
+}
+
+func TestReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, 60, 5)
+
+	var applied []config.Config
+	r := newTestReloader(t, path, func(cfg config.Config) { applied = append(applied, cfg) })
+
+	// Nothing changed
+	assert.False(t, r.Reload())
+	assert.Empty(t, applied)
+
+	// A valid change is applied
+	writeConfig(t, path, 15, 10)
+	assert.True(t, r.Reload())
+	require.Len(t, applied, 1)
+	assert.Equal(t, 15, applied[0].APP.SCHEDULE)
+	assert.Equal(t, 10, applied[0].Workers.NumWorkers)
+
+	// An invalid config is rejected and the last valid one kept
+	writeConfig(t, path, 0, 10)
+	assert.False(t, r.Reload())
+	assert.Len(t, applied, 1)
+	assert.Equal(t, 15, r.current.APP.SCHEDULE)
+}
+
+func TestWatchConfigFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, 60, 5)
+
+	applied := make(chan config.Config, 1)
+	r := newTestReloader(t, path, func(cfg config.Config) { applied <- cfg })
+	r.pollInterval = 10 * time.Millisecond
+
+	quit := make(chan struct{})
+	defer close(quit)
+	go r.Watch(nil, quit)
+
+	writeConfig(t, path, 30, 5)
+	// Make sure the modification time differs on coarse grained file systems
+	require.NoError(t, os.Chtimes(path, time.Now().Add(time.Second), time.Now().Add(time.Second)))
+
+	select {
+	case cfg := <-applied:
+		assert.Equal(t, 30, cfg.APP.SCHEDULE)
+	case <-time.After(time.Second):
+		t.Fatal("config change was not picked up")
+	}
+}
+
+func TestWatchSignal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	writeConfig(t, path, 60, 5)
+
+	applied := make(chan config.Config, 1)
+	r := newTestReloader(t, path, func(cfg config.Config) { applied <- cfg })
+	r.pollInterval = time.Hour
+
+	signals := make(chan os.Signal, 1)
+	quit := make(chan struct{})
+	defer close(quit)
+	go r.Watch(signals, quit)
+
+	writeConfig(t, path, 45, 5)
+	signals <- os.Interrupt
+
+	select {
+	case cfg := <-applied:
+		assert.Equal(t, 45, cfg.APP.SCHEDULE)
+	case <-time.After(time.Second):
+		t.Fatal("signal did not trigger a reload")
+	}
+}
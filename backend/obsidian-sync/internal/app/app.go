@@ -5,18 +5,155 @@
 package app
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/transport/ssh"
-	. "github.com/savabush/obsidian-sync/internal/config"
-	. "github.com/savabush/obsidian-sync/internal/database/minio"
-	. "github.com/savabush/obsidian-sync/internal/services"
+	"github.com/savabush/obsidian-sync/internal/config"
+	"github.com/savabush/obsidian-sync/internal/database/minio"
+	"github.com/savabush/obsidian-sync/internal/markdown"
+	obsidian "github.com/savabush/obsidian-sync/internal/services"
 )
 
-// App is the main function of the Obsidian-Sync application.
+// vaultDir is the directory the obsidian repository is cloned into
+const vaultDir = "obsidian"
+
+// Source describes where the vault is read from.
+type Source struct {
+	// Path is a local vault checkout. When empty the vault is cloned from GIT_URL.
+	Path string
+	// Ref is the git branch, tag or commit to check out after cloning
+	Ref string
+	// Progress receives git clone progress output (nil discards it)
+	Progress io.Writer
+}
+
+// Options controls a single synchronization run.
+type Options struct {
+	Source
+	// DryRun computes the sync plan without writing to or removing from MinIO
+	DryRun bool
+	// Trigger records what started the run in its status
+	Trigger Trigger
+	// Sections limits the run to the given vault sections (empty means all)
+	Sections []string
+	// OnEvent receives the progress events of the run (nil ignores them)
+	OnEvent func(Event)
+}
+
+// SectionResult describes the outcome of syncing a single vault section.
+type SectionResult struct {
+	Section string `json:"section"`
+	// Plan lists the operations planned (dry run) or applied for the section
+	Plan *minio.Plan `json:"plan"`
+}
+
+// Timings records how long the phases of a run took.
+type Timings struct {
+	// Vault is the time spent cloning or opening the vault
+	Vault time.Duration `json:"vault"`
+	Plan  time.Duration `json:"plan"`
+	Apply time.Duration `json:"apply"`
+}
+
+// Report summarizes a synchronization run.
+type Report struct {
+	// RunID identifies the run in log lines
+	RunID    string          `json:"run_id"`
+	Commit   string          `json:"commit,omitempty"`
+	DryRun   bool            `json:"dry_run"`
+	Sections []SectionResult `json:"sections"`
+	Timings  Timings         `json:"timings"`
+	Duration time.Duration   `json:"duration"`
+}
+
+// Totals sums the plan summaries of all sections and counts the plan
+// items that failed to apply.
+func (r *Report) Totals() (minio.PlanSummary, int) {
+	var total minio.PlanSummary
+	failed := 0
+	for _, section := range r.Sections {
+		s := section.Plan.Summary
+		total.Create += s.Create
+		total.Update += s.Update
+		total.Delete += s.Delete
+		total.Skip += s.Skip
+		total.UploadBytes += s.UploadBytes
+		total.DeleteBytes += s.DeleteBytes
+		for _, item := range section.Plan.Items {
+			if item.Error != "" {
+				failed++
+			}
+		}
+	}
+	return total, failed
+}
+
+// App is the Obsidian-Sync application. It holds the configuration and
+// logger every operation uses, so differently configured applications can
+// live in one process.
+type App struct {
+	cfg    config.Config
+	logger config.LoggerInterface
+	vault  *obsidian.Service
+	// markdown renders the notes to HTML
+	markdown *markdown.Renderer
+	// redaction removes the private content of the notes
+	redaction obsidian.Redaction
+	// reporter receives the final status of every run
+	reporter StatusReporter
+	// publisher receives the changes of every run that is not a dry run
+	publisher EventPublisher
+	// catalog indexes the posts of every applied section
+	catalog PostCatalog
+	// history records the status of every run
+	history RunHistory
+	// locker guards runs across replicas
+	locker Locker
+
+	// newRepository creates MinIO repositories, replaced in tests
+	newRepository func(minio.RepositoryConfig, config.LoggerInterface) (*minio.Repository, error)
+}
+
+// New creates an application with the given configuration and logger.
+func New(cfg config.Config, logger config.LoggerInterface) *App {
+	logger = config.ForPackage(logger, "app")
+	return &App{
+		cfg:           cfg,
+		logger:        logger,
+		vault:         obsidian.NewService(logger),
+		markdown:      markdown.New(),
+		redaction:     obsidian.NewRedaction(cfg.Redact),
+		newRepository: minio.NewRepositoryFunc,
+	}
+}
+
+// Config returns the configuration of the application
+func (a *App) Config() config.Config {
+	return a.cfg
+}
+
+// SetReporter sets the reporter the final status of every run is sent to.
+func (a *App) SetReporter(reporter StatusReporter) {
+	a.reporter = reporter
+}
+
+// SetPublisher sets the publisher the changes of every run are sent to.
+func (a *App) SetPublisher(publisher EventPublisher) {
+	a.publisher = publisher
+}
+
+// RunScheduled is the scheduled entry point of the Obsidian-Sync application.
 // It performs the following steps:
 //  1. Initializes a MinIO repository with proper configuration
 //  2. Sets up SSH authentication for Git operations
@@ -24,56 +161,108 @@ import (
 //  4. Processes the cloned repository's directory structure
 //  5. Uploads relevant files to MinIO storage
 //
-// The function uses environment variables for configuration (see .env file)
-// and implements proper error handling and logging throughout the process.
-// It also measures and logs the total execution time.
-func App() {
+// Errors are logged as fatal, a run skipped because another one holds the
+// sync lock is not an error. It also measures and logs the total execution time.
+func (a *App) RunScheduled() {
+	_, err := a.Run(context.Background(), Options{Source: Source{Progress: os.Stdout}, Trigger: TriggerSchedule})
+	if err != nil && !errors.Is(err, ErrLocked) {
+		a.logger.Fatal(err)
+	}
+}
+
+// Run performs a synchronization run with the given options and returns
+// a report of what was done. Unlike RunScheduled it returns errors to the caller.
+// Every run has a run ID, taken from ctx or generated, which is added to
+// all of its log lines. A run ends with a summary line and its final
+// status is sent to the reporter and its changes to the publisher. The run
+// is recorded in the run history when it starts and when it finishes. The
+// report is nil when the run failed before any section was planned.
+//
+// With a locker set a run that is not a dry run holds the sync lock while
+// it runs. When another holder is active the run is skipped: it returns
+// ErrLocked and is neither recorded, reported nor published.
+func (a *App) Run(ctx context.Context, opts Options) (*Report, error) {
 	start := time.Now()
+	if config.RunID(ctx) == "" {
+		ctx = config.WithRunID(ctx, config.NewID(8))
+	}
+	logger := config.ContextLogger(a.logger, ctx)
+	events := &emitter{runID: config.RunID(ctx), fn: opts.OnEvent}
+	events.emit(Event{Type: EventStarted})
 
-	// Initialize MinIO repository with configuration
-	minioConfig := RepositoryConfig{
-		Endpoint:        Settings.Minio.ENDPOINT,
-		AccessKey:       Settings.Minio.ACCESS_KEY,
-		SecretKey:       Settings.Minio.SECRET_KEY,
-		MaxRetries:      3,
-		RetryDelay:      time.Second * 2,
-		ContentLanguage: "ru-RU",
-		ContentType:     "application/octet-stream",
+	lock, err := a.acquireLock(ctx, logger, opts.DryRun)
+	if errors.Is(err, ErrLocked) {
+		status := RunStatus{RunID: config.RunID(ctx), State: RunSkipped, Trigger: opts.Trigger, DryRun: opts.DryRun,
+			StartedAt: start, FinishedAt: time.Now(), Error: err.Error()}
+		events.emit(Event{Type: EventFinished, Status: &status})
+		return nil, err
+	}
+	if a.history != nil {
+		a.recordRun(ctx, logger, RunStatus{RunID: config.RunID(ctx), State: RunRunning, Trigger: opts.Trigger,
+			DryRun: opts.DryRun, StartedAt: start})
 	}
 
-	minioRepo, err := NewRepository(minioConfig)
-	if err != nil {
-		Logger.Fatalf("Failed to initialize MinIO repository: %v", err)
+	report := &Report{RunID: config.RunID(ctx), DryRun: opts.DryRun}
+	if err == nil {
+		err = a.runLocked(ctx, logger, lock, opts, report, events)
+	}
+	report.Duration = time.Since(start)
+	a.logSummary(logger, report, err)
+
+	status := newRunStatus(report, opts.Trigger, start, err)
+	if a.history != nil {
+		a.recordRun(ctx, logger, status)
+		a.pruneRuns(ctx, logger)
+	}
+	if a.reporter != nil {
+		// The status is reported even when the run was canceled
+		if err := a.reporter.ReportRun(context.WithoutCancel(ctx), status); err != nil {
+			logger.Errorf("Failed to report run status: %v", err)
+		}
+	}
+	if a.publisher != nil && !opts.DryRun {
+		if err := a.publisher.PublishRun(context.WithoutCancel(ctx), report, status); err != nil {
+			logger.Errorf("Failed to publish run events: %v", err)
+		}
+	}
+	events.emit(Event{Type: EventFinished, Status: &status})
+
+	if err != nil && len(report.Sections) == 0 {
+		return nil, err
 	}
+	return report, err
+}
 
-	Logger.Infof("Starting obsidian-sync. Time start: %v", start)
+// run performs the steps of Run, filling in the report
+func (a *App) run(ctx context.Context, logger config.LoggerInterface, opts Options, report *Report, events *emitter) error {
+	if err := a.cfg.Validate(); err != nil {
+		return err
+	}
 
-	Logger.Info("Getting auth method SSH agent")
-	_, err = os.Stat(Settings.GIT.CERT_PATH)
+	sections, err := a.ResolveSections(opts.Sections)
 	if err != nil {
-		Logger.Fatal(err)
+		return err
 	}
 
-	publicKeys, err := ssh.NewPublicKeysFromFile("git", Settings.GIT.CERT_PATH, "")
+	minioRepo, err := a.newMinioRepository(logger, opts.DryRun)
 	if err != nil {
-		Logger.Fatal(err)
+		return fmt.Errorf("failed to initialize MinIO repository: %w", err)
 	}
+	minioRepo.SetContext(ctx)
 
-	RemoveObsidianDirIfExists()
+	logger.Infof("Starting obsidian-sync. Time start: %v", time.Now())
 
-	Logger.Info("Git clone obsidian")
-	_, err = git.PlainClone("obsidian", false, &git.CloneOptions{
-		URL:               Settings.GIT.URL,
-		Progress:          os.Stdout,
-		RecurseSubmodules: git.DefaultSubmoduleRecursionDepth,
-		Auth:              publicKeys,
-	})
+	phase := time.Now()
+	root, commit, err := a.prepareVault(ctx, opts.Source, sections)
 	if err != nil {
-		Logger.Fatal(err)
+		return err
 	}
-	Logger.Info("Git clone obsidian done")
-
-	RemoveUselessDirs()
+	report.Commit = commit
+	dates, err := historyDates(ctx, root, sectionDirs(sections))
+	if err != nil {
+		logger.Warnf("Failed to read the note dates from the vault history: %v", err)
+	}
+	report.Timings.Vault = time.Since(phase)
 
 	/*
 		Struct of dirs in obsidian:
@@ -97,28 +286,285 @@ func App() {
 					NewArticle2.md
 
 	*/
-	entries, err := os.ReadDir("obsidian")
+	for _, section := range sections {
+		// A missing section is skipped rather than planned as fully deleted
+		if _, err := os.Stat(filepath.Join(root, section.Dir)); err != nil {
+			logger.Warnf("Section %s not found in vault, skipping", section.Dir)
+			continue
+		}
+
+		// Set the bucket for this upload operation
+		minioRepo.SetBucket(section.Bucket)
+
+		phase = time.Now()
+		plan, err := a.planSection(ctx, logger, minioRepo, root, section, dates)
+		if err != nil {
+			return err
+		}
+		report.Timings.Plan += time.Since(phase)
+		report.Sections = append(report.Sections, SectionResult{Section: section.Dir, Plan: plan})
+
+		total := plan.Summary.Create + plan.Summary.Update + plan.Summary.Delete
+		events.emit(Event{Type: EventPlanned, Section: section.Dir, Total: total})
+		var done atomic.Int32
+		minioRepo.SetProgress(func(item minio.PlanItem) {
+			events.emit(Event{Type: EventApplied, Section: section.Dir, Key: item.Key, Action: item.Action,
+				Error: item.Error, Done: int(done.Add(1)), Total: total})
+		})
+
+		// A canceled run, e.g. one that lost the sync lock, writes nothing more
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		phase = time.Now()
+		err = minioRepo.Apply(plan)
+		report.Timings.Apply += time.Since(phase)
+		if err != nil {
+			return fmt.Errorf("failed to upload files from %s: %w", section.Dir, err)
+		}
+
+		updateCatalog := a.catalog != nil && !opts.DryRun
+		if !updateCatalog && a.cfg.Site.URL == "" {
+			continue
+		}
+		// The catalog, feeds and sitemap share the posts read once
+		posts, err := a.sectionPosts(logger, root, section, dates)
+		if err != nil {
+			return err
+		}
+		if updateCatalog {
+			if err := a.updateCatalog(ctx, minioRepo, commit, section, posts); err != nil {
+				return err
+			}
+		}
+		if a.cfg.Site.URL != "" {
+			if err := a.updateFeeds(logger, minioRepo, root, section, posts); err != nil {
+				return err
+			}
+			if err := a.updateSitemap(logger, minioRepo, section, posts); err != nil {
+				return err
+			}
+		}
+	}
+
+	if a.cfg.Site.URL != "" {
+		if err := a.updateSiteIndex(logger, minioRepo); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// emitter sends the progress events of a run one at a time
+type emitter struct {
+	runID string
+	fn    func(Event)
+	mu    sync.Mutex
+}
+
+func (e *emitter) emit(event Event) {
+	if e.fn == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	event.RunID = e.runID
+	event.Time = time.Now()
+	e.fn(event)
+}
+
+// logSummary logs the final line of a run with its counts and durations
+func (a *App) logSummary(logger config.LoggerInterface, report *Report, err error) {
+	totals, failed := report.Totals()
+	status := "ok"
 	if err != nil {
-		Logger.Fatal(err)
+		status = "failed"
 	}
-	for _, entry := range entries {
-		if entry.IsDir() {
-			switch entry.Name() {
-			case Articles, Blog:
-				// Extract bucket name from directory name
-				bucketName := strings.ToLower(strings.Split(entry.Name(), " - ")[1])
+	logger.WithFields(config.Fields{
+		"status":       status,
+		"commit":       report.Commit,
+		"dry_run":      report.DryRun,
+		"sections":     len(report.Sections),
+		"created":      totals.Create,
+		"updated":      totals.Update,
+		"deleted":      totals.Delete,
+		"unchanged":    totals.Skip,
+		"failed":       failed,
+		"upload_bytes": totals.UploadBytes,
+		"duration_ms":  report.Duration.Milliseconds(),
+		"vault_ms":     report.Timings.Vault.Milliseconds(),
+		"plan_ms":      report.Timings.Plan.Milliseconds(),
+		"apply_ms":     report.Timings.Apply.Milliseconds(),
+	}).Infof("Done obsidian-sync. Run %s %s: %d created, %d updated, %d deleted, %d unchanged, %d failed. Time execution: %v",
+		report.RunID, status, totals.Create, totals.Update, totals.Delete, totals.Skip, failed, report.Duration)
+}
 
-				// Set the bucket for this upload operation
-				minioRepo.SetBucket(bucketName)
+// ResolveSections maps section names given by the user to the configured
+// sections. Both directory names ("05 - Blog") and bucket names ("blog") are
+// accepted. An empty list resolves to all configured sections.
+func (a *App) ResolveSections(names []string) ([]config.SectionConfig, error) {
+	if len(names) == 0 {
+		return a.cfg.Sections, nil
+	}
 
-				if err := minioRepo.UploadFiles("obsidian/" + entry.Name()); err != nil {
-					Logger.Fatalf("Failed to upload files from %s: %v", entry.Name(), err)
-				}
+	var sections []config.SectionConfig
+	for _, name := range names {
+		found := false
+		for _, section := range a.cfg.Sections {
+			if strings.EqualFold(name, section.Dir) || strings.EqualFold(name, section.Bucket) {
+				sections = append(sections, section)
+				found = true
+				break
 			}
 		}
+		if !found {
+			return nil, fmt.Errorf("unknown section %q", name)
+		}
 	}
+	return sections, nil
+}
 
-	// TODO: send success status to orchestrator (GRPC)
+// sectionDirs returns the vault directories of the sections
+func sectionDirs(sections []config.SectionConfig) []string {
+	dirs := make([]string, 0, len(sections))
+	for _, section := range sections {
+		dirs = append(dirs, section.Dir)
+	}
+	return dirs
+}
 
-	Logger.Infof("Done obsidian-sync. Time execution: %v", time.Since(start))
+// planSection computes the sync plan of a vault section against the current
+// bucket, with the dates of its notes attached as metadata, their private
+// content removed, the post folders named after their slugs and their HTML
+// renderings and slug state added
+func (a *App) planSection(ctx context.Context, logger config.LoggerInterface, minioRepo *minio.Repository, root string,
+	section config.SectionConfig, dates map[string]NoteDates) (*minio.Plan, error) {
+	files, err := minio.CollectFiles(filepath.Join(root, section.Dir))
+	if err != nil {
+		return nil, err
+	}
+	slugs, err := obsidian.PostSlugs(root, section.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to slug the posts of %s: %w", section.Dir, err)
+	}
+	noteMetadata(logger, section.Dir, files, dates)
+	files, err = a.redactNotes(logger, section.Dir, files)
+	if err != nil {
+		return nil, err
+	}
+	posts, err := slugFiles(section.Dir, files, slugs)
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, a.renderNotes(logger, section, files)...)
+	files = a.stripImages(logger, section.Dir, files)
+	files = append(files, a.optimizeImages(logger, section.Dir, files)...)
+	redirects, err := slugsFile(ctx, logger, minioRepo, section.Dir, posts)
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, redirects)
+
+	plan, err := minioRepo.Plan(files)
+	if err != nil {
+		return nil, fmt.Errorf("failed to plan sync of %s: %w", section.Dir, err)
+	}
+	logger.WithFields(config.Fields{"bucket": plan.Bucket, "section": section.Dir}).Infof("Plan for %s: %d to create, %d to update, %d to delete, %d unchanged", plan.Bucket,
+		plan.Summary.Create, plan.Summary.Update, plan.Summary.Delete, plan.Summary.Skip)
+	return plan, nil
+}
+
+// newMinioRepository creates a MinIO repository from the application config logging to logger
+func (a *App) newMinioRepository(logger config.LoggerInterface, dryRun bool) (*minio.Repository, error) {
+	return a.newRepository(minio.RepositoryConfig{
+		Endpoint:        a.cfg.Minio.ENDPOINT,
+		AccessKey:       a.cfg.Minio.ACCESS_KEY,
+		SecretKey:       a.cfg.Minio.SECRET_KEY,
+		UseSSL:          a.cfg.Minio.USE_SSL,
+		MaxRetries:      a.cfg.Workers.MaxRetries,
+		RetryDelay:      a.cfg.Workers.RetryDelay,
+		NumWorkers:      a.cfg.Workers.NumWorkers,
+		ContentLanguage: "ru-RU",
+		ContentType:     "application/octet-stream",
+		DryRun:          dryRun,
+	}, logger)
+}
+
+// prepareVault makes the vault available on disk and returns its root
+// directory together with the checked out commit hash. A local source is
+// used as is; otherwise the repository is cloned into vaultDir and every
+// directory except the given sections is removed.
+func (a *App) prepareVault(ctx context.Context, src Source, sections []config.SectionConfig) (string, string, error) {
+	logger := config.ContextLogger(a.logger, ctx)
+	vault := a.vault.WithContext(ctx)
+	if src.Path != "" {
+		if _, err := os.Stat(src.Path); err != nil {
+			return "", "", fmt.Errorf("vault path is not accessible: %w", err)
+		}
+		return src.Path, "", nil
+	}
+
+	logger.Info("Getting auth method SSH agent")
+	if _, err := os.Stat(a.cfg.GIT.CERT_PATH); err != nil {
+		return "", "", err
+	}
+
+	publicKeys, err := ssh.NewPublicKeysFromFile("git", a.cfg.GIT.CERT_PATH, "")
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := vault.RemoveObsidianDirIfExists(); err != nil {
+		return "", "", err
+	}
+
+	logger.Info("Git clone obsidian")
+	repo, err := git.PlainClone(vaultDir, false, &git.CloneOptions{
+		URL:               a.cfg.GIT.URL,
+		Progress:          src.Progress,
+		RecurseSubmodules: git.DefaultSubmoduleRecursionDepth,
+		Auth:              publicKeys,
+	})
+	if err != nil {
+		return "", "", err
+	}
+	logger.Info("Git clone obsidian done")
+
+	if src.Ref != "" {
+		if err := checkoutRef(logger, repo, src.Ref); err != nil {
+			return "", "", err
+		}
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return "", "", err
+	}
+
+	if err := vault.RemoveUselessDirs(sectionDirs(sections)); err != nil {
+		return "", "", err
+	}
+
+	return vaultDir, head.Hash().String(), nil
+}
+
+// checkoutRef checks out a branch, tag or commit in a freshly cloned repository.
+// Branch names that only exist on the remote are resolved against origin.
+func checkoutRef(logger config.LoggerInterface, repo *git.Repository, ref string) error {
+	logger.Infof("Checking out git ref %s", ref)
+	hash, err := repo.ResolveRevision(plumbing.Revision(ref))
+	if err != nil {
+		hash, err = repo.ResolveRevision(plumbing.Revision("refs/remotes/origin/" + ref))
+		if err != nil {
+			return fmt.Errorf("unknown git ref %q: %w", ref, err)
+		}
+	}
+
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return err
+	}
+	return worktree.Checkout(&git.CheckoutOptions{Hash: *hash, Force: true})
 }
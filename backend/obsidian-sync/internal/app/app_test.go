@@ -0,0 +1,870 @@
+package app
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	miniogo "github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/savabush/obsidian-sync/internal/config"
+	"github.com/savabush/obsidian-sync/internal/database/minio"
+	"github.com/savabush/obsidian-sync/internal/database/postgres"
+	"github.com/savabush/obsidian-sync/internal/lib"
+	"github.com/savabush/obsidian-sync/internal/markdown"
+	obsidian "github.com/savabush/obsidian-sync/internal/services"
+)
+
+// fakeMinio is an in-memory MinIO client keeping objects per bucket
+type fakeMinio struct {
+	mu      sync.Mutex
+	buckets map[string]map[string][]byte
+	// metadata holds the user metadata of the objects by bucket/key
+	metadata map[string]map[string]string
+	// modified holds the upload times of the objects by bucket/key
+	modified map[string]time.Time
+	puts     int
+	// reader reads the objects for GetObject
+	reader     *miniogo.Client
+	readerErr  error
+	serverOnce sync.Once
+	removes    int
+	// policies holds the policies set on the buckets
+	policies map[string]string
+}
+
+func newFakeMinio(buckets ...string) *fakeMinio {
+	f := &fakeMinio{buckets: make(map[string]map[string][]byte), metadata: make(map[string]map[string]string),
+		modified: make(map[string]time.Time)}
+	for _, bucket := range buckets {
+		f.buckets[bucket] = make(map[string][]byte)
+	}
+	return f
+}
+
+func (f *fakeMinio) PutObject(ctx context.Context, bucketName, objectName string, reader io.Reader, objectSize int64,
+	opts miniogo.PutObjectOptions) (miniogo.UploadInfo, error) {
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return miniogo.UploadInfo{}, err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.buckets[bucketName][objectName] = data
+	f.metadata[bucketName+"/"+objectName] = opts.UserMetadata
+	f.modified[bucketName+"/"+objectName] = time.Now()
+	f.puts++
+	return miniogo.UploadInfo{Size: int64(len(data))}, nil
+}
+
+func (f *fakeMinio) StatObject(ctx context.Context, bucketName, objectName string, opts miniogo.StatObjectOptions) (miniogo.ObjectInfo, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	data, ok := f.buckets[bucketName][objectName]
+	if !ok {
+		return miniogo.ObjectInfo{}, miniogo.ErrorResponse{Code: "NoSuchKey"}
+	}
+	info := f.objectInfo(bucketName, objectName, data)
+	info.UserMetadata = f.metadata[bucketName+"/"+objectName]
+	return info, nil
+}
+
+// GetObject reads through a client of an S3 server serving the objects,
+// since a *miniogo.Object cannot be made otherwise. The server is started
+// on the first read and lives as long as the test binary.
+func (f *fakeMinio) GetObject(ctx context.Context, bucketName, objectName string, opts miniogo.GetObjectOptions) (*miniogo.Object, error) {
+	f.serverOnce.Do(func() {
+		srv := httptest.NewServer(http.HandlerFunc(f.serveObject))
+		f.reader, f.readerErr = miniogo.New(strings.TrimPrefix(srv.URL, "http://"),
+			&miniogo.Options{Creds: credentials.NewStaticV4("test", "test", "")})
+	})
+	if f.readerErr != nil {
+		return nil, f.readerErr
+	}
+	return f.reader.GetObject(ctx, bucketName, objectName, opts)
+}
+
+// serveObject serves an object over the S3 API
+func (f *fakeMinio) serveObject(w http.ResponseWriter, r *http.Request) {
+	if _, ok := r.URL.Query()["location"]; ok {
+		io.WriteString(w, `<LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/">us-east-1</LocationConstraint>`)
+		return
+	}
+	bucketName, key, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	f.mu.Lock()
+	data, ok := f.buckets[bucketName][key]
+	info := f.objectInfo(bucketName, key, data)
+	f.mu.Unlock()
+	if !ok {
+		w.Header().Set("Content-Type", "application/xml")
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprintf(w, `<Error><Code>NoSuchKey</Code><Key>%s</Key><BucketName>%s</BucketName></Error>`, key, bucketName)
+		return
+	}
+	w.Header().Set("ETag", `"`+info.ETag+`"`)
+	w.Header().Set("Last-Modified", info.LastModified.UTC().Format(http.TimeFormat))
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Write(data)
+}
+
+func (f *fakeMinio) ListObjects(ctx context.Context, bucketName string, opts miniogo.ListObjectsOptions) <-chan miniogo.ObjectInfo {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	ch := make(chan miniogo.ObjectInfo, len(f.buckets[bucketName]))
+	for key, data := range f.buckets[bucketName] {
+		if !strings.HasPrefix(key, opts.Prefix) {
+			continue
+		}
+		info := f.objectInfo(bucketName, key, data)
+		if opts.WithMetadata {
+			// Listings name the metadata by its header
+			info.UserMetadata = make(miniogo.StringMap)
+			for name, value := range f.metadata[bucketName+"/"+key] {
+				info.UserMetadata["X-Amz-Meta-"+name] = value
+			}
+		}
+		ch <- info
+	}
+	close(ch)
+	return ch
+}
+
+func (f *fakeMinio) BucketExists(ctx context.Context, bucketName string) (bool, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, ok := f.buckets[bucketName]
+	return ok, nil
+}
+
+func (f *fakeMinio) MakeBucket(ctx context.Context, bucketName string, opts miniogo.MakeBucketOptions) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if _, ok := f.buckets[bucketName]; ok {
+		return miniogo.ErrorResponse{Code: "BucketAlreadyOwnedByYou"}
+	}
+	f.buckets[bucketName] = make(map[string][]byte)
+	return nil
+}
+
+func (f *fakeMinio) SetBucketPolicy(ctx context.Context, bucketName, policy string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.policies == nil {
+		f.policies = make(map[string]string)
+	}
+	f.policies[bucketName] = policy
+	return nil
+}
+
+func (f *fakeMinio) RemoveObject(ctx context.Context, bucketName, objectName string, opts miniogo.RemoveObjectOptions) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.buckets[bucketName], objectName)
+	delete(f.metadata, bucketName+"/"+objectName)
+	delete(f.modified, bucketName+"/"+objectName)
+	f.removes++
+	return nil
+}
+
+// objectInfo describes an object, which was last modified on upload
+func (f *fakeMinio) objectInfo(bucketName, key string, data []byte) miniogo.ObjectInfo {
+	sum := md5.Sum(data)
+	return miniogo.ObjectInfo{Key: key, Size: int64(len(data)), ETag: hex.EncodeToString(sum[:]),
+		LastModified: f.modified[bucketName+"/"+key]}
+}
+
+// testConfig returns a valid configuration for tests
+func testConfig(t *testing.T) config.Config {
+	certPath := filepath.Join(t.TempDir(), "id_rsa")
+	require.NoError(t, os.WriteFile(certPath, []byte("key"), 0600))
+
+	cfg := config.DefaultConfig()
+	cfg.GIT.URL = "git@example.com:vault.git"
+	cfg.GIT.CERT_PATH = certPath
+	cfg.Minio.ENDPOINT = "localhost:9000"
+	cfg.Minio.ACCESS_KEY = "access"
+	cfg.Minio.SECRET_KEY = "secret"
+	cfg.Workers.RetryDelay = time.Millisecond
+	return cfg
+}
+
+// newTestApp creates an application backed by the fake MinIO client
+func newTestApp(cfg config.Config, client minio.MinioClient) *App {
+	return newTestAppWithLogger(cfg, client, lib.TestLog)
+}
+
+// newTestAppWithLogger creates an application backed by the fake MinIO client logging to logger
+func newTestAppWithLogger(cfg config.Config, client minio.MinioClient, logger config.LoggerInterface) *App {
+	a := New(cfg, logger)
+	a.newRepository = func(repoCfg minio.RepositoryConfig, logger config.LoggerInterface) (*minio.Repository, error) {
+		repo, err := minio.NewRepository(repoCfg, logger)
+		if err != nil {
+			return nil, err
+		}
+		repo.SetClient(client)
+		return repo, nil
+	}
+	return a
+}
+
+// writeVault creates a vault with one blog post
+func writeVault(t *testing.T) string {
+	root := t.TempDir()
+	post := filepath.Join(root, config.Blog, "Post")
+	require.NoError(t, os.MkdirAll(filepath.Join(post, "Resources"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(post, "Post.md"), []byte("# Post"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(post, "Resources", "Image.png"), []byte("png"), 0644))
+	return root
+}
+
+func TestRun(t *testing.T) {
+	root := writeVault(t)
+	client := newFakeMinio("blog")
+	client.buckets["blog"]["Old/Old.md"] = []byte("old")
+	a := newTestApp(testConfig(t), client)
+
+	// A dry run plans everything but writes nothing
+	report, err := a.Run(context.Background(), Options{Source: Source{Path: root}, DryRun: true, Sections: []string{"blog"}})
+	require.NoError(t, err)
+	require.Len(t, report.Sections, 1)
+	plan := report.Sections[0].Plan
+	assert.Equal(t, []string{"post/Resources/Image.png", "post/post.html", "post/post.json", "post/post.md", "redirects.json"},
+		plan.Keys(minio.ActionCreate), "the post is slugged and its note rendered to HTML and its info next to it")
+	assert.Equal(t, []string{"Old/Old.md"}, plan.Keys(minio.ActionDelete))
+	assert.Zero(t, client.puts)
+	assert.Zero(t, client.removes)
+
+	// The real run applies the same plan
+	report, err = a.Run(context.Background(), Options{Source: Source{Path: root}, Sections: []string{"blog"}})
+	require.NoError(t, err)
+	assert.Equal(t, plan.Summary, report.Sections[0].Plan.Summary)
+	assert.Equal(t, 5, client.puts)
+	assert.Equal(t, 1, client.removes)
+	assert.Equal(t, "<h1 id=\"post\">Post</h1>\n", string(client.buckets["blog"]["post/post.html"]))
+
+	// Nothing changes on the next run
+	diffs, err := a.Diff(Source{Path: root}, []string{"blog"})
+	require.NoError(t, err)
+	require.Len(t, diffs, 1)
+	assert.False(t, diffs[0].Changed())
+	assert.Equal(t, 5, diffs[0].Unchanged)
+}
+
+func TestAppsAreIndependent(t *testing.T) {
+	root := writeVault(t)
+
+	valid := newTestApp(testConfig(t), newFakeMinio("blog"))
+	invalidCfg := testConfig(t)
+	invalidCfg.GIT.URL = ""
+	invalid := newTestApp(invalidCfg, newFakeMinio("blog"))
+
+	_, err := invalid.Run(context.Background(), Options{Source: Source{Path: root}})
+	assert.ErrorContains(t, err, "git.url (GIT_URL): is required")
+
+	_, err = valid.Run(context.Background(), Options{Source: Source{Path: root}})
+	assert.NoError(t, err)
+	assert.Equal(t, "git@example.com:vault.git", valid.Config().GIT.URL)
+}
+
+func TestResolveSections(t *testing.T) {
+	a := newTestApp(testConfig(t), newFakeMinio())
+
+	sections, err := a.ResolveSections(nil)
+	require.NoError(t, err)
+	assert.Equal(t, config.DefaultSections(), sections)
+
+	sections, err = a.ResolveSections([]string{"Articles", "05 - Blog"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{config.Articles, config.Blog}, sectionDirs(sections))
+
+	_, err = a.ResolveSections([]string{"drafts"})
+	assert.EqualError(t, err, `unknown section "drafts"`)
+}
+
+func TestConfiguredSections(t *testing.T) {
+	root := writeVault(t)
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "07 - Notes", "Note"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "07 - Notes", "Note", "Note.md"), []byte("# Note"), 0644))
+
+	cfg := testConfig(t)
+	cfg.Sections = []config.SectionConfig{{Dir: "07 - Notes", Bucket: "notes"}}
+	client := newFakeMinio("notes")
+	a := newTestApp(cfg, client)
+
+	report, err := a.Run(context.Background(), Options{Source: Source{Path: root}})
+	require.NoError(t, err)
+	require.Len(t, report.Sections, 1)
+	assert.Equal(t, "07 - Notes", report.Sections[0].Section)
+	assert.Contains(t, client.buckets["notes"], "note/note.md")
+
+	_, err = a.ResolveSections([]string{"blog"})
+	assert.EqualError(t, err, `unknown section "blog"`)
+}
+
+// fakeCatalog records the posts stored per bucket
+type fakeCatalog struct {
+	posts map[string][]postgres.Post
+}
+
+func (f *fakeCatalog) SyncPosts(ctx context.Context, bucket string, posts []postgres.Post) error {
+	f.posts[bucket] = posts
+	return nil
+}
+
+func TestRunUpdatesCatalog(t *testing.T) {
+	root := writeVault(t)
+	require.NoError(t, os.WriteFile(filepath.Join(root, config.Blog, "Post", "Post.md"),
+		[]byte("---\ntitle: A post\ntags: [go]\ncreated: 2024-05-01\n---\n## Intro\nSome **text**"), 0644))
+	catalog := &fakeCatalog{posts: make(map[string][]postgres.Post)}
+	client := newFakeMinio("blog")
+	a := newTestApp(testConfig(t), client)
+	a.SetCatalog(catalog)
+
+	_, err := a.Run(context.Background(), Options{Source: Source{Path: root}, DryRun: true, Sections: []string{"blog"}})
+	require.NoError(t, err)
+	assert.Empty(t, catalog.posts, "dry runs leave the catalog alone")
+
+	broken := filepath.Join(root, config.Blog, "Broken")
+	require.NoError(t, os.MkdirAll(broken, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(broken, "Broken.md"), []byte("---\ncreated: soon\n---\n# Broken"), 0644))
+	_, err = a.Run(context.Background(), Options{Source: Source{Path: root}, Sections: []string{"blog"}})
+	require.NoError(t, err, "an invalid note does not fail the catalog")
+	require.Len(t, catalog.posts["blog"], 1, "the invalid note is left out")
+	post := catalog.posts["blog"][0]
+	assert.Equal(t, "post", post.Slug)
+	assert.Equal(t, config.Blog, post.Section)
+	assert.Equal(t, "A post", post.Title)
+	assert.Equal(t, []string{"go"}, post.Tags)
+	require.NotNil(t, post.CreatedAt)
+	assert.Equal(t, "2024-05-01", post.CreatedAt.Format(time.DateOnly))
+	require.NotNil(t, post.UpdatedAt)
+	assert.Equal(t, client.modified["blog/post/post.md"], *post.UpdatedAt,
+		"a missing date is the time the note was written, like the blog reads it")
+	assert.Equal(t, "post/post.md", post.ObjectKey)
+	assert.Equal(t, []string{"post/Resources/Image.png"}, post.ResourceKeys)
+	assert.True(t, post.Published)
+	assert.Equal(t, "Intro", post.Headings)
+	assert.Equal(t, "Intro\nSome text", post.Body)
+}
+
+// commitFile writes a vault file and commits it at the given author date
+func commitFile(t *testing.T, repo *git.Repository, root, name, content string, when time.Time) {
+	require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(root, name)), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, name), []byte(content), 0644))
+	commitAll(t, repo, "Update "+name, when)
+}
+
+// commitAll commits every change of the work tree at the given author date
+func commitAll(t *testing.T, repo *git.Repository, message string, when time.Time) {
+	worktree, err := repo.Worktree()
+	require.NoError(t, err)
+	require.NoError(t, worktree.AddWithOptions(&git.AddOptions{All: true}))
+	signature := &object.Signature{Name: "Author", Email: "author@example.com", When: when}
+	_, err = worktree.Commit(message, &git.CommitOptions{Author: signature, Committer: signature})
+	require.NoError(t, err)
+}
+
+func TestHistoryDates(t *testing.T) {
+	root := t.TempDir()
+	repo, err := git.PlainInit(root, false)
+	require.NoError(t, err)
+	day := func(month int) time.Time { return time.Date(2024, time.Month(month), 1, 0, 0, 0, 0, time.UTC) }
+
+	commitFile(t, repo, root, config.Blog+"/Old/Old.md", "# Post\n\nFirst draft of the post.", day(1))
+	commitFile(t, repo, root, config.Blog+"/Old/Old.md", "# Post\n\nFirst draft of the post, edited.", day(2))
+	require.NoError(t, os.Rename(filepath.Join(root, config.Blog, "Old", "Old.md"), filepath.Join(root, config.Blog, "Old", "New.md")))
+	require.NoError(t, os.Rename(filepath.Join(root, config.Blog, "Old"), filepath.Join(root, config.Blog, "New")))
+	commitAll(t, repo, "Rename the post", day(3))
+	commitFile(t, repo, root, config.Blog+"/Other/Other.md", "# Other", day(4))
+	commitFile(t, repo, root, "Notes/Note.md", "# Not synced", day(5))
+
+	dates, err := historyDates(context.Background(), root, []string{config.Blog})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]NoteDates{
+		config.Blog + "/New/New.md":     {Created: day(1), Updated: day(3)},
+		config.Blog + "/Other/Other.md": {Created: day(4), Updated: day(4)},
+	}, dates, "renames are followed")
+
+	dates, err = historyDates(context.Background(), t.TempDir(), []string{config.Blog})
+	require.NoError(t, err)
+	assert.Nil(t, dates, "a vault outside git has no history")
+}
+
+func TestRunNoteDates(t *testing.T) {
+	root := t.TempDir()
+	repo, err := git.PlainInit(root, false)
+	require.NoError(t, err)
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	commitFile(t, repo, root, config.Blog+"/Post/Post.md", "# Post", created)
+	commitFile(t, repo, root, config.Blog+"/Dated/Dated.md", "---\ncreated: 2023-05-01\n---\n# Dated", created)
+	commitFile(t, repo, root, config.Blog+"/Post/Resources/Image.png", "png", created.Add(time.Hour))
+
+	client := newFakeMinio("blog")
+	a := newTestApp(testConfig(t), client)
+	_, err = a.Run(context.Background(), Options{Source: Source{Path: root}, Sections: []string{"blog"}})
+	require.NoError(t, err)
+	assert.Equal(t, "2024-01-01T00:00:00Z", client.metadata["blog/post/post.md"][minio.MetaNoteCreated])
+	assert.Equal(t, "2024-01-01T00:00:00Z", client.metadata["blog/post/post.md"][minio.MetaNoteUpdated])
+	assert.Equal(t, "2023-05-01T00:00:00Z", client.metadata["blog/dated/dated.md"][minio.MetaNoteCreated],
+		"frontmatter dates take precedence")
+	assert.Empty(t, client.metadata["blog/post/Resources/Image.png"][minio.MetaNoteCreated])
+
+	puts := client.puts
+	report, err := a.Run(context.Background(), Options{Source: Source{Path: root}, Sections: []string{"blog"}})
+	require.NoError(t, err)
+	assert.Equal(t, puts, client.puts, "unchanged dates are not uploaded again")
+	assert.False(t, report.Sections[0].Plan.Changed())
+}
+
+// writeSSHKey writes a private key for the clone auth and returns its path
+func writeSSHKey(t *testing.T) string {
+	_, key, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	block, err := ssh.MarshalPrivateKey(key, "")
+	require.NoError(t, err)
+	keyPath := filepath.Join(t.TempDir(), "id_ed25519")
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(block), 0600))
+	return keyPath
+}
+
+func TestRunClonedNoteDates(t *testing.T) {
+	remote := t.TempDir()
+	repo, err := git.PlainInit(remote, false)
+	require.NoError(t, err)
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	commitFile(t, repo, remote, config.Blog+"/Post/Post.md", "# Post", created)
+	commitFile(t, repo, remote, "99 - Private/Diary.md", "# Diary", created)
+	// The vault is cloned into the working directory
+	defer os.RemoveAll(vaultDir)
+
+	cfg := testConfig(t)
+	cfg.GIT.URL = remote
+	cfg.GIT.CERT_PATH = writeSSHKey(t)
+	client := newFakeMinio("blog")
+	report, err := newTestApp(cfg, client).Run(context.Background(), Options{Sections: []string{"blog"}})
+	require.NoError(t, err)
+	assert.NotEmpty(t, report.Commit)
+	assert.NoDirExists(t, filepath.Join(vaultDir, "99 - Private"), "directories besides the sections are removed")
+	assert.Equal(t, "2024-01-01T00:00:00Z", client.metadata["blog/post/post.md"][minio.MetaNoteCreated],
+		"the history of the clone dates the notes")
+}
+
+func TestRunFeeds(t *testing.T) {
+	root := t.TempDir()
+	write := func(name, content string) {
+		path := filepath.Join(root, config.Blog, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	write("English/English.md", "---\nlang: en\nsummary: In English\ncreated: 2024-05-02\n---\n# English")
+	write("English/Resources/Cover Image.png", "png")
+	write("Russian/Russian.md", "---\nlang: ru\ncreated: 2024-05-01\n---\n# Русский")
+	write("Draft/Draft.md", "---\ndraft: true\n---\n# Draft")
+
+	cfg := testConfig(t)
+	cfg.Site.URL = "https://example.com/"
+	cfg.Feeds.PUBLIC_URL = "https://cdn.example.com/feeds"
+	client := newFakeMinio("blog", "feeds", "site")
+	client.buckets["feeds"]["articles/rss.xml"] = []byte("other section")
+	a := newTestApp(cfg, client)
+
+	_, err := a.Run(context.Background(), Options{Source: Source{Path: root}, Sections: []string{"blog"}})
+	require.NoError(t, err)
+	var keys []string
+	for key := range client.buckets["feeds"] {
+		keys = append(keys, key)
+	}
+	assert.ElementsMatch(t, []string{
+		"articles/rss.xml",
+		"blog/rss.xml", "blog/atom.xml", "blog/feed.json",
+		"blog/en/rss.xml", "blog/en/atom.xml", "blog/en/feed.json",
+		"blog/ru/rss.xml", "blog/ru/atom.xml", "blog/ru/feed.json",
+	}, keys, "feeds of other sections are kept")
+
+	var doc struct {
+		Title   string `json:"title"`
+		FeedURL string `json:"feed_url"`
+		Items   []struct {
+			URL         string `json:"url"`
+			Image       string `json:"image"`
+			Attachments []struct {
+				MimeType string `json:"mime_type"`
+				Size     int64  `json:"size_in_bytes"`
+			} `json:"attachments"`
+		} `json:"items"`
+	}
+	require.NoError(t, json.Unmarshal(client.buckets["feeds"]["blog/feed.json"], &doc))
+	assert.Equal(t, "https://cdn.example.com/feeds/blog/feed.json", doc.FeedURL)
+	require.Len(t, doc.Items, 2, "drafts are left out")
+	assert.Equal(t, "https://example.com/posts/english", doc.Items[0].URL)
+	assert.Equal(t, "https://example.com/api/v1/posts/english/resources/Cover%20Image.png", doc.Items[0].Image)
+	require.Len(t, doc.Items[0].Attachments, 1)
+	assert.Equal(t, "image/png", doc.Items[0].Attachments[0].MimeType)
+	assert.EqualValues(t, 3, doc.Items[0].Attachments[0].Size)
+	assert.Equal(t, "https://example.com/posts/russian", doc.Items[1].URL)
+	require.NoError(t, json.Unmarshal(client.buckets["feeds"]["blog/ru/feed.json"], &doc))
+	assert.Equal(t, "Blog: posts (ru)", doc.Title)
+	assert.Len(t, doc.Items, 1)
+
+	// Feeds are only uploaded again when their posts change
+	puts := client.puts
+	_, err = a.Run(context.Background(), Options{Source: Source{Path: root}, Sections: []string{"blog"}})
+	require.NoError(t, err)
+	assert.Equal(t, puts, client.puts)
+
+	write("Russian/Russian.md", "---\nlang: ru\ncreated: 2024-05-01\nsummary: Changed\n---\n# Русский")
+	_, err = a.Run(context.Background(), Options{Source: Source{Path: root}, Sections: []string{"blog"}})
+	require.NoError(t, err)
+	assert.Equal(t, puts+2+6, client.puts, "the note, its info and the feeds of all posts and of its language")
+	assert.Contains(t, string(client.buckets["feeds"]["blog/ru/rss.xml"]), "Changed")
+}
+
+func TestRunSitemap(t *testing.T) {
+	root := t.TempDir()
+	write := func(name, content string) {
+		path := filepath.Join(root, config.Blog, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+	write("Hello/Hello.md", "---\nlang: en\ntranslationKey: hello\ncreated: 2024-05-02\n---\n# Hello")
+	write("Privet/Privet.md", "---\nlang: ru\ntranslationKey: hello\ncreated: 2024-05-01\nupdated: 2024-05-03\n---\n# Привет")
+	write("Draft/Draft.md", "---\ndraft: true\n---\n# Draft")
+
+	cfg := testConfig(t)
+	cfg.Site.URL = "https://example.com"
+	client := newFakeMinio("blog", "feeds", "site")
+	client.buckets["site"]["sitemaps/articles/sitemap-1.xml"] = []byte("other section")
+	a := newTestApp(cfg, client)
+
+	_, err := a.Run(context.Background(), Options{Source: Source{Path: root}, Sections: []string{"blog"}})
+	require.NoError(t, err)
+	var keys []string
+	for key := range client.buckets["site"] {
+		keys = append(keys, key)
+	}
+	assert.ElementsMatch(t, []string{
+		"robots.txt", "sitemap.xml", "sitemaps/home.xml",
+		"sitemaps/articles/sitemap-1.xml", "sitemaps/blog/sitemap-1.xml",
+	}, keys, "sitemaps of other sections are kept")
+
+	part := string(client.buckets["site"]["sitemaps/blog/sitemap-1.xml"])
+	assert.Contains(t, part, "<loc>https://example.com/posts</loc>\n    <lastmod>2024-05-03T00:00:00Z</lastmod>")
+	assert.Contains(t, part, "<loc>https://example.com/posts/privet</loc>\n    <lastmod>2024-05-03T00:00:00Z</lastmod>")
+	assert.Contains(t, part, `<xhtml:link rel="alternate" hreflang="en" href="https://example.com/posts/hello"></xhtml:link>`)
+	assert.NotContains(t, part, "Draft", "drafts are left out")
+
+	index := string(client.buckets["site"]["sitemap.xml"])
+	for _, loc := range []string{"sitemaps/home.xml", "sitemaps/articles/sitemap-1.xml", "sitemaps/blog/sitemap-1.xml"} {
+		assert.Contains(t, index, "<loc>https://example.com/"+loc+"</loc>")
+	}
+	assert.Contains(t, string(client.buckets["site"]["robots.txt"]), "Sitemap: https://example.com/sitemap.xml\n")
+
+	// Nothing is uploaded again while the posts do not change
+	puts := client.puts
+	_, err = a.Run(context.Background(), Options{Source: Source{Path: root}, Sections: []string{"blog"}})
+	require.NoError(t, err)
+	assert.Equal(t, puts, client.puts)
+}
+
+func TestRunCreatesSiteBuckets(t *testing.T) {
+	root := writeVault(t)
+	cfg := testConfig(t)
+	cfg.Site.URL = "https://example.com"
+	client := newFakeMinio("blog")
+	a := newTestApp(cfg, client)
+
+	_, err := a.Run(context.Background(), Options{Source: Source{Path: root}, Sections: []string{"blog"}, DryRun: true})
+	require.NoError(t, err)
+	assert.NotContains(t, client.buckets, "site", "dry runs create no bucket")
+	assert.NotContains(t, client.buckets, "feeds")
+
+	_, err = a.Run(context.Background(), Options{Source: Source{Path: root}, Sections: []string{"blog"}})
+	require.NoError(t, err)
+	assert.Contains(t, client.buckets["site"], "sitemap.xml")
+	assert.Contains(t, client.policies["site"], `"Action":["s3:GetObject"],"Resource":["arn:aws:s3:::site/*"]`)
+	assert.Contains(t, client.buckets["feeds"], "blog/rss.xml")
+	assert.Contains(t, client.policies["feeds"], `"Resource":["arn:aws:s3:::feeds/*"]`)
+	assert.NotContains(t, client.policies, "blog", "existing buckets are left as they are")
+}
+
+func TestRunRendersNotes(t *testing.T) {
+	root := writeVault(t)
+	note := filepath.Join(root, config.Blog, "Post", "Post.md")
+	require.NoError(t, os.WriteFile(note, []byte("# Post\n\n![Image](Resources/Image.png)"), 0644))
+	cfg := testConfig(t)
+	cfg.API.PUBLIC_URL = "https://api.example.com"
+	client := newFakeMinio("blog")
+	a := newTestApp(cfg, client)
+
+	_, err := a.Run(context.Background(), Options{Source: Source{Path: root}, Sections: []string{"blog"}})
+	require.NoError(t, err)
+	assert.Contains(t, string(client.buckets["blog"]["post/post.html"]),
+		`<img src="https://api.example.com/api/v1/posts/post/resources/Image.png" alt="Image">`)
+	var info obsidian.PostInfo
+	require.NoError(t, json.Unmarshal(client.buckets["blog"]["post/post.json"], &info))
+	assert.Equal(t, obsidian.PostInfo{
+		TOC:       []markdown.Heading{{Level: 1, Text: "Post", ID: "post"}},
+		WordCount: 2, ReadingTime: 1,
+	}, info)
+
+	// The HTML is removed with its note
+	require.NoError(t, os.Remove(note))
+	_, err = a.Run(context.Background(), Options{Source: Source{Path: root}, Sections: []string{"blog"}})
+	require.NoError(t, err)
+	assert.NotContains(t, client.buckets["blog"], "post/post.html")
+	assert.NotContains(t, client.buckets["blog"], "post/post.json")
+}
+
+func TestRunStripsComments(t *testing.T) {
+	root := writeVault(t)
+	note := filepath.Join(root, config.Blog, "Post", "Post.md")
+	require.NoError(t, os.WriteFile(note, []byte("# Post\n\nPublic %%private%% text\n\n%%\nDraft\n%%\n\n`%%code%%`"), 0644))
+	client := newFakeMinio("blog")
+	a := newTestApp(testConfig(t), client)
+
+	_, err := a.Run(context.Background(), Options{Source: Source{Path: root}, Sections: []string{"blog"}})
+	require.NoError(t, err)
+	for _, key := range []string{"post/post.md", "post/post.html"} {
+		content := string(client.buckets["blog"][key])
+		assert.Contains(t, content, "Public  text", key)
+		assert.Contains(t, content, "%%code%%", key)
+		assert.NotContains(t, content, "private", key)
+		assert.NotContains(t, content, "Draft", key)
+	}
+
+	// The note on disk keeps its comments
+	content, err := os.ReadFile(note)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), "%%private%%")
+}
+
+func TestRunRedactsPrivateContent(t *testing.T) {
+	root := writeVault(t)
+	note := "---\ntitle: Post\nsummary: Public summary\nnotes: SECRET front\n---\n# Post\n\n" +
+		"Public <!-- private -->SECRET marked<!-- /private --> text %%SECRET comment%%\n\n" +
+		"SECRET tagged #private\n\n## SECRET heading #private\n\nSECRET section\n\n## Public heading\n\nEnd"
+	require.NoError(t, os.WriteFile(filepath.Join(root, config.Blog, "Post", "Post.md"), []byte(note), 0644))
+	cfg := testConfig(t)
+	cfg.Site.URL = "https://example.com"
+	cfg.Redact.FRONTMATTER = "notes"
+	client := newFakeMinio("blog", "feeds", "site")
+	catalog := &fakeCatalog{posts: make(map[string][]postgres.Post)}
+	a := newTestApp(cfg, client)
+	a.SetCatalog(catalog)
+
+	_, err := a.Run(context.Background(), Options{Source: Source{Path: root}, Sections: []string{"blog"}})
+	require.NoError(t, err)
+	for bucket, objects := range client.buckets {
+		for key, data := range objects {
+			assert.NotContains(t, string(data), "SECRET", bucket+"/"+key)
+		}
+	}
+	assert.Contains(t, string(client.buckets["blog"]["post/post.md"]), "Public  text")
+	assert.Contains(t, string(client.buckets["blog"]["post/post.html"]), `<h2 id="public-heading">Public heading</h2>`)
+	assert.Contains(t, string(client.buckets["feeds"]["blog/feed.json"]), "Public summary")
+
+	require.Len(t, catalog.posts["blog"], 1)
+	assert.NotContains(t, fmt.Sprintf("%+v", catalog.posts["blog"][0]), "SECRET")
+	assert.Equal(t, "Post\nPublic heading", catalog.posts["blog"][0].Headings)
+}
+
+func TestRunRefusesUnredactableNotes(t *testing.T) {
+	root := writeVault(t)
+	for _, note := range []string{
+		"---\ntitle: Post\nnotes: SECRET\ntags: [a\n---\n# Post",
+		"---\ntitle: Post: bad\nnotes: SECRET\n---\n# Post",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(root, config.Blog, "Post", "Post.md"), []byte(note), 0644))
+		cfg := testConfig(t)
+		cfg.Site.URL = "https://example.com"
+		cfg.Redact.FRONTMATTER = "notes"
+		client := newFakeMinio("blog", "feeds", "site")
+		a := newTestApp(cfg, client)
+
+		_, err := a.Run(context.Background(), Options{Source: Source{Path: root}, Sections: []string{"blog"}})
+		require.NoError(t, err, "one invalid note does not fail the run")
+		for bucket, objects := range client.buckets {
+			for key, data := range objects {
+				assert.NotContains(t, string(data), "SECRET", bucket+"/"+key)
+			}
+		}
+		assert.NotContains(t, client.buckets["blog"], "post/post.md", "the note is not uploaded")
+	}
+}
+
+func TestRunRedirectsRenamedPosts(t *testing.T) {
+	root := writeVault(t)
+	client := newFakeMinio("blog")
+	a := newTestApp(testConfig(t), client)
+	slugs := func() obsidian.Slugs {
+		var slugs obsidian.Slugs
+		require.NoError(t, json.Unmarshal(client.buckets["blog"][obsidian.RedirectsKey], &slugs))
+		return slugs
+	}
+
+	_, err := a.Run(context.Background(), Options{Source: Source{Path: root}, Sections: []string{"blog"}})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"Post": "post"}, slugs().Redirects, "the folder name redirects to the slug")
+
+	blog := filepath.Join(root, config.Blog)
+	require.NoError(t, os.Rename(filepath.Join(blog, "Post", "Post.md"), filepath.Join(blog, "Post", "Новый пост.md")))
+	require.NoError(t, os.Rename(filepath.Join(blog, "Post"), filepath.Join(blog, "Новый пост")))
+	report, err := a.Run(context.Background(), Options{Source: Source{Path: root}, Sections: []string{"blog"}})
+	require.NoError(t, err)
+	assert.Contains(t, client.buckets["blog"], "novyy-post/novyy-post.md")
+	assert.Contains(t, report.Sections[0].Plan.Keys(minio.ActionDelete), "post/post.md")
+	assert.Equal(t, map[string]string{"Post": "novyy-post", "post": "novyy-post"}, slugs().Redirects,
+		"a renamed folder is followed by its note")
+
+	note := filepath.Join(blog, "Новый пост", "Новый пост.md")
+	require.NoError(t, os.WriteFile(note, []byte("---\nslug: Fresh Start\n---\n# Post"), 0644))
+	_, err = a.Run(context.Background(), Options{Source: Source{Path: root}, Sections: []string{"blog"}})
+	require.NoError(t, err)
+	assert.Contains(t, client.buckets["blog"], "fresh-start/fresh-start.html")
+	assert.Equal(t, map[string]string{"Post": "fresh-start", "post": "fresh-start", "novyy-post": "fresh-start"},
+		slugs().Redirects)
+	assert.Equal(t, map[string]string{"Новый пост": "fresh-start"}, slugs().Posts)
+}
+
+// writePhoto writes a JPEG photo with camera metadata to the resources of the vault post
+func writePhoto(t *testing.T, root string) {
+	img := image.NewRGBA(image.Rect(0, 0, 1200, 600))
+	for y := 0; y < 600; y++ {
+		for x := 0; x < 1200; x++ {
+			img.Set(x, y, color.RGBA{R: uint8(x), G: uint8(y), B: uint8(x ^ y), A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, img, &jpeg.Options{Quality: 95}))
+	exif := "Exif\x00\x00MM\x00\x2a\x00\x00\x00\x08\x00\x00\x00\x00\x00\x00GPS 52.3676N"
+	photo := append([]byte{0xff, 0xd8, 0xff, 0xe1, 0, byte(len(exif) + 2)}, exif...)
+	photo = append(photo, buf.Bytes()[2:]...)
+	require.NoError(t, os.WriteFile(filepath.Join(root, config.Blog, "Post", "Resources", "Photo.jpg"), photo, 0644))
+}
+
+func TestRunOptimizesImages(t *testing.T) {
+	root := writeVault(t)
+	writePhoto(t, root)
+	client := newFakeMinio("blog")
+	cfg := testConfig(t)
+	cfg.Images.WIDTHS = "480,960,2000"
+	a := newTestApp(cfg, client)
+
+	_, err := a.Run(context.Background(), Options{Source: Source{Path: root}, Sections: []string{"blog"}})
+	require.NoError(t, err)
+	bucket := client.buckets["blog"]
+	assert.NotContains(t, string(bucket["post/Resources/Photo.jpg"]), "GPS", "the metadata is stripped")
+	assert.Equal(t, "1200", client.metadata["blog/post/Resources/Photo.jpg"][minio.MetaImageWidth])
+	assert.Equal(t, "600", client.metadata["blog/post/Resources/Photo.jpg"][minio.MetaImageHeight])
+	for _, size := range [][2]string{{"480", "240"}, {"960", "480"}} {
+		key := "post/Variants/Photo.jpg/" + size[0] + "w.jpg"
+		require.Contains(t, bucket, key)
+		assert.Equal(t, size[1], client.metadata["blog/"+key][minio.MetaImageHeight])
+	}
+	assert.NotContains(t, bucket, "post/Variants/Photo.jpg/2000w.jpg", "images are not enlarged")
+	assert.Empty(t, client.metadata["blog/post/Resources/Image.png"][minio.MetaImageWidth],
+		"files that are not images are uploaded as is")
+
+	report, err := a.Run(context.Background(), Options{Source: Source{Path: root}, Sections: []string{"blog"}})
+	require.NoError(t, err)
+	assert.False(t, report.Sections[0].Plan.Changed(), "the variants of unchanged images are not uploaded again")
+
+	require.NoError(t, os.Remove(filepath.Join(root, config.Blog, "Post", "Resources", "Photo.jpg")))
+	report, err = a.Run(context.Background(), Options{Source: Source{Path: root}, Sections: []string{"blog"}})
+	require.NoError(t, err)
+	assert.Contains(t, report.Sections[0].Plan.Keys(minio.ActionDelete), "post/Variants/Photo.jpg/480w.jpg")
+}
+
+func TestRunSkipsUnstrippableImages(t *testing.T) {
+	root := writeVault(t)
+	resources := filepath.Join(root, config.Blog, "Post", "Resources")
+	heic := "\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heicExif\x00\x00GPS 52.3676N"
+	require.NoError(t, os.WriteFile(filepath.Join(resources, "Photo.heic"), []byte(heic), 0644))
+	var out bytes.Buffer
+	logger := &lib.TestLogger{Logger: log.New(&out, "", 0)}
+
+	client := newFakeMinio("blog")
+	_, err := newTestAppWithLogger(testConfig(t), client, logger).Run(context.Background(),
+		Options{Source: Source{Path: root}, Sections: []string{"blog"}})
+	require.NoError(t, err)
+	assert.NotContains(t, client.buckets["blog"], "post/Resources/Photo.heic", "its GPS position is not published")
+	assert.Contains(t, client.buckets["blog"], "post/Resources/Image.png", "files that are no images are kept")
+	assert.Contains(t, out.String(), "Skipping image "+config.Blog+"/post/Resources/Photo.heic")
+
+	cfg := testConfig(t)
+	cfg.Images.STRIP_METADATA = false
+	client = newFakeMinio("blog")
+	_, err = newTestApp(cfg, client).Run(context.Background(), Options{Source: Source{Path: root}, Sections: []string{"blog"}})
+	require.NoError(t, err)
+	assert.Contains(t, client.buckets["blog"], "post/Resources/Photo.heic", "images are uploaded as they are without stripping")
+}
+
+func TestRunCorrelationIDs(t *testing.T) {
+	root := writeVault(t)
+	cfg := testConfig(t)
+	var out bytes.Buffer
+	logger, err := config.NewLogger(config.LoggingConfig{
+		FILE_PATH: filepath.Join(t.TempDir(), "sync.log"),
+		FORMAT:    "json",
+	}, &out)
+	require.NoError(t, err)
+	defer logger.Close()
+
+	a := newTestAppWithLogger(cfg, newFakeMinio("blog"), logger)
+	report, err := a.Run(context.Background(), Options{Source: Source{Path: root}, Sections: []string{"blog"}})
+	require.NoError(t, err)
+	require.NotEmpty(t, report.RunID)
+
+	var entries []map[string]interface{}
+	scanner := bufio.NewScanner(&out)
+	for scanner.Scan() {
+		var entry map[string]interface{}
+		require.NoError(t, json.Unmarshal(scanner.Bytes(), &entry))
+		entries = append(entries, entry)
+	}
+
+	spans := make(map[interface{}]bool)
+	var summary map[string]interface{}
+	for _, entry := range entries {
+		assert.Equal(t, report.RunID, entry["run_id"], entry["msg"])
+		if entry["package"] == "minio" && entry["object"] != nil {
+			require.NotEmpty(t, entry["span_id"], entry["msg"])
+			spans[entry["span_id"]] = true
+		}
+		if entry["status"] != nil {
+			summary = entry
+		}
+	}
+	assert.Len(t, spans, 5, "every upload has its own span")
+	require.NotNil(t, summary)
+	assert.Equal(t, "ok", summary["status"])
+	assert.EqualValues(t, 5, summary["created"])
+	assert.EqualValues(t, 0, summary["failed"])
+	assert.Contains(t, summary, "duration_ms")
+}
@@ -0,0 +1,76 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/savabush/obsidian-sync/internal/config"
+	"github.com/savabush/obsidian-sync/internal/database/minio"
+	"github.com/savabush/obsidian-sync/internal/database/postgres"
+	obsidian "github.com/savabush/obsidian-sync/internal/services"
+)
+
+// PostCatalog indexes the posts of every synced section, see postgres.Repository.
+type PostCatalog interface {
+	SyncPosts(ctx context.Context, bucket string, posts []postgres.Post) error
+}
+
+// SetCatalog sets the catalog the posts of every applied section are stored in.
+func (a *App) SetCatalog(catalog PostCatalog) {
+	a.catalog = catalog
+}
+
+// updateCatalog stores the posts of a section, read by sectionPosts, after
+// they were uploaded to the current bucket of minioRepo. Posts without
+// dates get the time their note object was written, the dates the blog
+// reads for them from the bucket.
+func (a *App) updateCatalog(ctx context.Context, minioRepo *minio.Repository, commit string,
+	section config.SectionConfig, posts []obsidian.Post) error {
+	rows := make([]postgres.Post, 0, len(posts))
+	for _, post := range posts {
+		if post.Created.IsZero() || post.Updated.IsZero() {
+			object, err := minioRepo.StatObject(ctx, post.Key)
+			if err != nil {
+				return fmt.Errorf("failed to date post %s/%s: %w", section.Dir, post.Slug, err)
+			}
+			if post.Created.IsZero() {
+				post.Created = object.LastModified
+			}
+			if post.Updated.IsZero() {
+				post.Updated = object.LastModified
+			}
+		}
+		rows = append(rows, postgres.Post{
+			Bucket:       section.Bucket,
+			Slug:         post.Slug,
+			Section:      section.Dir,
+			Title:        post.Title,
+			Language:     post.Language,
+			Tags:         post.Tags,
+			CreatedAt:    optionalTime(post.Created),
+			UpdatedAt:    optionalTime(post.Updated),
+			ObjectKey:    post.Key,
+			ResourceKeys: post.Resources,
+			Checksum:     post.Checksum,
+			Commit:       commit,
+			Draft:        post.Draft,
+			Published:    post.Publish,
+			Headings:     strings.Join(post.Headings(), "\n"),
+			Body:         post.PlainText(),
+		})
+	}
+	if err := a.catalog.SyncPosts(ctx, section.Bucket, rows); err != nil {
+		return fmt.Errorf("failed to update the post catalog of %s: %w", section.Dir, err)
+	}
+	return nil
+}
+
+// optionalTime returns nil for the zero time
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
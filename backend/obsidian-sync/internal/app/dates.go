@@ -0,0 +1,236 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/storer"
+
+	"github.com/savabush/obsidian-sync/internal/config"
+	"github.com/savabush/obsidian-sync/internal/database/minio"
+	obsidian "github.com/savabush/obsidian-sync/internal/services"
+)
+
+// renameOptions detect the renames of a commit, bounding the comparisons
+// so commits adding and removing many resources stay cheap
+var renameOptions = &object.DiffTreeOptions{DetectRenames: true, RenameScore: 60, RenameLimit: 1000}
+
+// NoteDates are the author dates of the first and the last commit that
+// touched a note.
+type NoteDates struct {
+	Created time.Time
+	Updated time.Time
+}
+
+// historyDates returns the dates of the markdown notes of the section
+// directories under root, keyed by their slash-separated path relative to
+// root. Renames are followed, so a moved note keeps the date it was
+// created at. A root outside a git repository has no dates.
+func historyDates(ctx context.Context, root string, dirs []string) (map[string]NoteDates, error) {
+	repo, err := git.PlainOpenWithOptions(root, &git.PlainOpenOptions{DetectDotGit: true})
+	if errors.Is(err, git.ErrRepositoryNotExists) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	prefix, err := repoPrefix(repo, root)
+	if err != nil {
+		return nil, err
+	}
+	head, err := repo.Head()
+	if err != nil {
+		return nil, err
+	}
+	headCommit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+	headTree, err := headCommit.Tree()
+	if err != nil {
+		return nil, err
+	}
+
+	// tracked maps the path a note had in the commit being visited to the
+	// path it has in HEAD; notes leave it at the commit that added them
+	tracked := make(map[string]string)
+	err = headTree.Files().ForEach(func(f *object.File) error {
+		rel, ok := strings.CutPrefix(f.Name, prefix)
+		if ok && path.Ext(rel) == ".md" && inDirs(rel, dirs) {
+			tracked[f.Name] = rel
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	dates := make(map[string]NoteDates, len(tracked))
+	commits, err := repo.Log(&git.LogOptions{From: head.Hash(), Order: git.LogOrderCommitterTime})
+	if err != nil {
+		return nil, err
+	}
+	defer commits.Close()
+	err = commits.ForEach(func(commit *object.Commit) error {
+		if len(tracked) == 0 {
+			return storer.ErrStop
+		}
+		changes, err := commitChanges(ctx, commit)
+		if err != nil {
+			return err
+		}
+		renamed := make(map[string]string)
+		for _, change := range changes {
+			note, ok := tracked[change.To.Name]
+			if !ok {
+				continue
+			}
+			d := dates[note]
+			// Commits are visited newest first
+			if d.Updated.IsZero() {
+				d.Updated = commit.Author.When.UTC()
+			}
+			d.Created = commit.Author.When.UTC()
+			dates[note] = d
+
+			delete(tracked, change.To.Name)
+			if change.From.Name != "" {
+				renamed[change.From.Name] = note
+			}
+		}
+		for from, note := range renamed {
+			tracked[from] = note
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return dates, nil
+}
+
+// commitChanges returns the changes of a commit against its first parent,
+// with renames detected
+func commitChanges(ctx context.Context, commit *object.Commit) (object.Changes, error) {
+	tree, err := commit.Tree()
+	if err != nil {
+		return nil, err
+	}
+	var parentTree *object.Tree
+	if commit.NumParents() > 0 {
+		parent, err := commit.Parent(0)
+		if err != nil {
+			return nil, err
+		}
+		if parentTree, err = parent.Tree(); err != nil {
+			return nil, err
+		}
+	}
+	changes, err := object.DiffTreeWithOptions(ctx, parentTree, tree, renameOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to diff commit %s: %w", commit.Hash, err)
+	}
+	return changes, nil
+}
+
+// repoPrefix returns the slash-separated path of root inside the work tree
+// of repo, empty or ending with a slash
+func repoPrefix(repo *git.Repository, root string) (string, error) {
+	worktree, err := repo.Worktree()
+	if err != nil {
+		return "", err
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	if resolved, err := filepath.EvalSymlinks(absRoot); err == nil {
+		absRoot = resolved
+	}
+	base := worktree.Filesystem.Root()
+	if resolved, err := filepath.EvalSymlinks(base); err == nil {
+		base = resolved
+	}
+	rel, err := filepath.Rel(base, absRoot)
+	if err != nil {
+		return "", err
+	}
+	if rel == "." {
+		return "", nil
+	}
+	return filepath.ToSlash(rel) + "/", nil
+}
+
+// inDirs reports whether the slash-separated path is inside one of dirs
+func inDirs(name string, dirs []string) bool {
+	for _, dir := range dirs {
+		if strings.HasPrefix(name, dir+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// noteMetadata sets the date metadata of the notes among the files of a
+// section. The frontmatter dates take precedence over the history dates.
+func noteMetadata(logger config.LoggerInterface, section string, files []minio.File, dates map[string]NoteDates) {
+	for i, file := range files {
+		if path.Ext(file.Name) != ".md" {
+			continue
+		}
+		d := dates[section+"/"+file.Name]
+		if data, err := os.ReadFile(file.Path); err != nil {
+			logger.Warnf("Failed to read %s/%s for its dates: %v", section, file.Name, err)
+		} else if note, err := obsidian.ParseNote(data); err == nil {
+			if !note.Created.IsZero() {
+				d.Created = note.Created
+			}
+			if !note.Updated.IsZero() {
+				d.Updated = note.Updated
+			}
+		}
+		metadata := make(map[string]string)
+		if !d.Created.IsZero() {
+			metadata[minio.MetaNoteCreated] = d.Created.UTC().Format(time.RFC3339)
+		}
+		if !d.Updated.IsZero() {
+			metadata[minio.MetaNoteUpdated] = d.Updated.UTC().Format(time.RFC3339)
+		}
+		if len(metadata) > 0 {
+			files[i].Metadata = metadata
+		}
+	}
+}
+
+// sectionPosts reads the posts of a section from the vault at root. Posts
+// are redacted and those without frontmatter dates get the dates of their
+// vault history. A note that cannot be parsed is logged and left out, as
+// it is left without HTML.
+func (a *App) sectionPosts(logger config.LoggerInterface, root string, section config.SectionConfig,
+	dates map[string]NoteDates) ([]obsidian.Post, error) {
+	posts, invalid, err := obsidian.ReadPosts(root, section.Dir, a.redaction)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read posts of %s: %w", section.Dir, err)
+	}
+	for _, err := range invalid {
+		logger.Warnf("Skipping post %v", err)
+	}
+	for i, post := range posts {
+		history := dates[path.Join(section.Dir, post.Dir, post.Dir+".md")]
+		if post.Created.IsZero() {
+			posts[i].Created = history.Created
+		}
+		if post.Updated.IsZero() {
+			posts[i].Updated = history.Updated
+		}
+	}
+	return posts, nil
+}
@@ -0,0 +1,157 @@
+package app
+
+import (
+	"fmt"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/savabush/obsidian-sync/internal/config"
+	"github.com/savabush/obsidian-sync/internal/database/minio"
+	"github.com/savabush/obsidian-sync/internal/feed"
+	obsidian "github.com/savabush/obsidian-sync/internal/services"
+)
+
+// blogAPIPrefix is the path the blog API serves the post resources under
+const blogAPIPrefix = "/api/v1"
+
+// feedLanguageRe matches the languages that get feeds of their own
+var feedLanguageRe = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})*$`)
+
+// updateFeeds renders the feeds of a section and syncs them to the feeds
+// bucket under the bucket name of the section, creating the bucket as a
+// public one when it is missing. The documents of unchanged
+// posts render to the same bytes, so only feeds whose posts changed are
+// uploaded, and the feeds of languages without posts are removed.
+func (a *App) updateFeeds(logger config.LoggerInterface, minioRepo *minio.Repository, root string,
+	section config.SectionConfig, posts []obsidian.Post) error {
+	files, err := a.feedFiles(root, section, posts)
+	if err != nil {
+		return fmt.Errorf("failed to render the feeds of %s: %w", section.Dir, err)
+	}
+
+	minioRepo.SetBucket(a.cfg.Feeds.BUCKET)
+	if err := minioRepo.EnsurePublicBucket(); err != nil {
+		return err
+	}
+	return applyGenerated(logger, minioRepo, "feeds of "+section.Dir, files, func(files []minio.File) (*minio.Plan, error) {
+		return minioRepo.PlanPrefix(section.Bucket+"/", files)
+	})
+}
+
+// sectionURL returns the URL of the page of a section on the site
+func (a *App) sectionURL(section config.SectionConfig) string {
+	return strings.TrimRight(a.cfg.Site.URL, "/") + "/" + config.SitePath(section)
+}
+
+// postURL returns the canonical URL of a post of the section at sectionURL
+func postURL(sectionURL, slug string) string {
+	return sectionURL + "/" + url.PathEscape(slug)
+}
+
+// applyGenerated plans the generated files named what with plan against
+// the current bucket and applies the plan
+func applyGenerated(logger config.LoggerInterface, minioRepo *minio.Repository, what string, files []minio.File,
+	plan func([]minio.File) (*minio.Plan, error)) error {
+	minioRepo.SetProgress(nil)
+	p, err := plan(files)
+	if err != nil {
+		return fmt.Errorf("failed to plan the %s: %w", what, err)
+	}
+	logger.WithField("bucket", p.Bucket).Infof("Plan for the %s: %d to create, %d to update, %d to delete, %d unchanged",
+		what, p.Summary.Create, p.Summary.Update, p.Summary.Delete, p.Summary.Skip)
+	if err := minioRepo.Apply(p); err != nil {
+		return fmt.Errorf("failed to upload the %s: %w", what, err)
+	}
+	return nil
+}
+
+// feedFiles renders the feed of all published posts of a section and the
+// feeds of each of their languages in every format, keyed
+// <bucket>/<format> and <bucket>/<language>/<format>
+func (a *App) feedFiles(root string, section config.SectionConfig, posts []obsidian.Post) ([]minio.File, error) {
+	cfg := a.cfg.Feeds
+	link := a.sectionURL(section)
+
+	// groups holds the items of every language, "" holds all items
+	groups := make(map[string][]feed.Item)
+	for _, post := range posts {
+		if post.Draft || !post.Publish {
+			continue
+		}
+		item, err := a.feedItem(root, section, link, post)
+		if err != nil {
+			return nil, err
+		}
+		groups[""] = append(groups[""], item)
+		if language := strings.ToLower(post.Language); feedLanguageRe.MatchString(language) {
+			groups[language] = append(groups[language], item)
+		}
+	}
+
+	var files []minio.File
+	for language, items := range groups {
+		feed.Sort(items)
+		f := feed.Feed{
+			Title:       cfg.TITLE + ": " + config.SitePath(section),
+			Description: fmt.Sprintf("The latest %s of %s", config.SitePath(section), cfg.TITLE),
+			Link:        link,
+			Language:    language,
+			Items:       items[:min(len(items), cfg.LIMIT)],
+		}
+		if language != "" {
+			f.Title += " (" + language + ")"
+		}
+		for _, format := range feed.Formats {
+			key := path.Join(section.Bucket, language, format.Name)
+			self := ""
+			if cfg.PUBLIC_URL != "" {
+				self = strings.TrimRight(cfg.PUBLIC_URL, "/") + "/" + key
+			}
+			data, err := format.Render(f, self)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", key, err)
+			}
+			files = append(files, minio.File{Name: key, Content: data, ContentType: format.ContentType})
+		}
+	}
+	return files, nil
+}
+
+// feedItem converts a post to a feed item linking to the post under link
+// and to its cover served by the blog API
+func (a *App) feedItem(root string, section config.SectionConfig, link string, post obsidian.Post) (feed.Item, error) {
+	item := feed.Item{
+		Title:     post.Title,
+		Summary:   post.Summary,
+		URL:       postURL(link, post.Slug),
+		Tags:      post.Tags,
+		Published: post.Created,
+		Updated:   post.Updated,
+	}
+
+	prefix := post.Slug + "/" + obsidian.ResourcesDir + "/"
+	names := make([]string, 0, len(post.Resources))
+	for _, key := range post.Resources {
+		names = append(names, strings.TrimPrefix(key, prefix))
+	}
+	cover := obsidian.CoverResource(post.Cover, names)
+	if cover == "" {
+		return item, nil
+	}
+	info, err := os.Stat(filepath.Join(root, section.Dir, post.Dir, obsidian.ResourcesDir, filepath.FromSlash(cover)))
+	if err != nil {
+		return item, err
+	}
+	contentType, _, _ := strings.Cut(mime.TypeByExtension(path.Ext(cover)), ";")
+	item.Image = &feed.Enclosure{
+		URL:    a.resourceURL(section, post.Slug, cover),
+		Type:   contentType,
+		Length: info.Size(),
+	}
+	return item, nil
+}
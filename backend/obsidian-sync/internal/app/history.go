@@ -0,0 +1,143 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/savabush/obsidian-sync/internal/config"
+	"github.com/savabush/obsidian-sync/internal/database/minio"
+	"github.com/savabush/obsidian-sync/internal/database/postgres"
+)
+
+// ErrNoHistory is returned when the run history is queried but not configured.
+var ErrNoHistory = errors.New("the run history requires POSTGRES_HOST")
+
+// ErrRunNotFound is returned when a run is not in the run history.
+var ErrRunNotFound = postgres.ErrRunNotFound
+
+// RunHistory stores the status of every run, see postgres.Repository.
+type RunHistory interface {
+	RecordRun(ctx context.Context, run postgres.Run) error
+	PruneRuns(ctx context.Context, before time.Time) (int64, error)
+	ListRuns(ctx context.Context, limit int) ([]postgres.Run, error)
+	GetRun(ctx context.Context, runID string) (postgres.Run, error)
+}
+
+// SetHistory sets the run history every run is recorded in.
+func (a *App) SetHistory(history RunHistory) {
+	a.history = history
+}
+
+// Runs returns up to limit runs of the run history, newest first. A limit
+// of zero returns all recorded runs.
+func (a *App) Runs(ctx context.Context, limit int) ([]RunStatus, error) {
+	if a.history == nil {
+		return nil, ErrNoHistory
+	}
+	runs, err := a.history.ListRuns(ctx, limit)
+	if err != nil {
+		return nil, err
+	}
+	statuses := make([]RunStatus, 0, len(runs))
+	for _, run := range runs {
+		statuses = append(statuses, fromHistoryRun(run))
+	}
+	return statuses, nil
+}
+
+// RunByID returns a run of the run history, or ErrRunNotFound.
+func (a *App) RunByID(ctx context.Context, runID string) (RunStatus, error) {
+	if a.history == nil {
+		return RunStatus{}, ErrNoHistory
+	}
+	run, err := a.history.GetRun(ctx, runID)
+	if err != nil {
+		return RunStatus{}, err
+	}
+	return fromHistoryRun(run), nil
+}
+
+// recordRun stores the status of a run. A failure is logged rather than
+// failing the run.
+func (a *App) recordRun(ctx context.Context, logger config.LoggerInterface, status RunStatus) {
+	if err := a.history.RecordRun(context.WithoutCancel(ctx), toHistoryRun(status)); err != nil {
+		logger.Errorf("Failed to record run in the run history: %v", err)
+	}
+}
+
+// pruneRuns removes the runs older than the configured retention
+func (a *App) pruneRuns(ctx context.Context, logger config.LoggerInterface) {
+	retention := a.cfg.Postgres.RUN_RETENTION
+	if retention <= 0 {
+		return
+	}
+	pruned, err := a.history.PruneRuns(context.WithoutCancel(ctx), time.Now().Add(-retention))
+	if err != nil {
+		logger.Errorf("Failed to prune the run history: %v", err)
+		return
+	}
+	if pruned > 0 {
+		logger.Infof("Pruned %d runs older than %v from the run history", pruned, retention)
+	}
+}
+
+// toHistoryRun converts a run status to its run history row
+func toHistoryRun(status RunStatus) postgres.Run {
+	run := postgres.Run{
+		ID:         status.RunID,
+		Trigger:    string(status.Trigger),
+		State:      string(status.State),
+		DryRun:     status.DryRun,
+		Commit:     status.Commit,
+		StartedAt:  status.StartedAt,
+		FinishedAt: optionalTime(status.FinishedAt),
+		Error:      status.Error,
+	}
+	for _, section := range status.Sections {
+		run.Sections = append(run.Sections, postgres.RunSection{
+			Section:     section.Section,
+			Bucket:      section.Bucket,
+			Created:     section.Create,
+			Updated:     section.Update,
+			Deleted:     section.Delete,
+			Unchanged:   section.Skip,
+			Failed:      section.Failed,
+			UploadBytes: section.UploadBytes,
+			Errors:      section.Errors,
+		})
+	}
+	return run
+}
+
+// fromHistoryRun converts a run history row to a run status
+func fromHistoryRun(run postgres.Run) RunStatus {
+	status := RunStatus{
+		RunID:     run.ID,
+		State:     RunState(run.State),
+		Trigger:   Trigger(run.Trigger),
+		DryRun:    run.DryRun,
+		Commit:    run.Commit,
+		StartedAt: run.StartedAt,
+		Error:     run.Error,
+	}
+	if run.FinishedAt != nil {
+		status.FinishedAt = *run.FinishedAt
+	}
+	for _, section := range run.Sections {
+		status.Sections = append(status.Sections, SectionSummary{
+			Section: section.Section,
+			Bucket:  section.Bucket,
+			PlanSummary: minio.PlanSummary{
+				Create:      section.Created,
+				Update:      section.Updated,
+				Delete:      section.Deleted,
+				Skip:        section.Unchanged,
+				UploadBytes: section.UploadBytes,
+			},
+			Failed: section.Failed,
+			Errors: section.Errors,
+		})
+	}
+	return status
+}
@@ -0,0 +1,105 @@
+package app
+
+import (
+	"bytes"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/savabush/obsidian-sync/internal/config"
+	"github.com/savabush/obsidian-sync/internal/database/minio"
+	"github.com/savabush/obsidian-sync/internal/images"
+	obsidian "github.com/savabush/obsidian-sync/internal/services"
+)
+
+// stripImages strips the metadata of the images of the post Resources
+// folders among the files of a section when IMAGES_STRIP_METADATA is set.
+// Stripped images are uploaded from memory. An image whose metadata cannot
+// be removed, as its format is not supported or it cannot be parsed, is
+// logged and left out, so its GPS position is never published.
+func (a *App) stripImages(logger config.LoggerInterface, section string, files []minio.File) []minio.File {
+	if !a.cfg.Images.STRIP_METADATA {
+		return files
+	}
+	kept := files[:0]
+	for _, file := range files {
+		slug, resource, ok := strings.Cut(file.Name, "/"+obsidian.ResourcesDir+"/")
+		if !ok || strings.Contains(slug, "/") || !images.HoldsMetadata(resource) {
+			kept = append(kept, file)
+			continue
+		}
+		data, err := fileContent(file)
+		if err != nil {
+			logger.Warnf("Skipping image %s/%s, it cannot be read to strip its metadata: %v", section, file.Name, err)
+			continue
+		}
+		stripped, err := images.Strip(data)
+		if err != nil {
+			logger.Warnf("Skipping image %s/%s, its metadata cannot be removed: %v", section, file.Name, err)
+			continue
+		}
+		if !bytes.Equal(stripped, data) {
+			file.Content = stripped
+		}
+		kept = append(kept, file)
+	}
+	return kept
+}
+
+// optimizeImages attaches their size to the images of the post Resources
+// folders among the files of a section and returns their resized variants
+// as <slug>/Variants/<resource>/<width>w.<ext>. The variants are planned
+// with the section, so they are only uploaded when the image changed and
+// removed with it. An image that cannot be decoded is logged and uploaded
+// without a size or variants.
+func (a *App) optimizeImages(logger config.LoggerInterface, section string, files []minio.File) []minio.File {
+	opts := images.Options{Widths: a.cfg.Images.WidthList(), Quality: a.cfg.Images.QUALITY}
+	var variants []minio.File
+	for i, file := range files {
+		slug, resource, ok := strings.Cut(file.Name, "/"+obsidian.ResourcesDir+"/")
+		if !ok || strings.Contains(slug, "/") || !images.Supported(resource) {
+			continue
+		}
+		data, err := fileContent(file)
+		if err != nil {
+			logger.Warnf("Failed to read %s/%s to optimize it: %v", section, file.Name, err)
+			continue
+		}
+		width, height, err := images.Size(data)
+		if err != nil {
+			logger.Warnf("Skipping the variants of %s/%s: %v", section, file.Name, err)
+			continue
+		}
+		files[i].Metadata = withImageSize(file.Metadata, width, height)
+		if len(opts.Widths) == 0 {
+			continue
+		}
+
+		resized, err := images.Variants(data, opts)
+		if err != nil {
+			logger.Warnf("Skipping the variants of %s/%s: %v", section, file.Name, err)
+			continue
+		}
+		for _, variant := range resized {
+			variants = append(variants, minio.File{
+				Name:        obsidian.VariantKey(slug, resource, variant.Width, variant.Ext),
+				Content:     variant.Data,
+				ContentType: variant.ContentType,
+				Metadata:    withImageSize(nil, variant.Width, variant.Height),
+			})
+		}
+		logger.Debugf("Made %d variants of %s", len(resized), path.Join(section, file.Name))
+	}
+	return variants
+}
+
+// withImageSize returns a copy of metadata with the size of an image
+func withImageSize(metadata map[string]string, width, height int) map[string]string {
+	sized := make(map[string]string, len(metadata)+2)
+	for key, value := range metadata {
+		sized[key] = value
+	}
+	sized[minio.MetaImageWidth] = strconv.Itoa(width)
+	sized[minio.MetaImageHeight] = strconv.Itoa(height)
+	return sized
+}
@@ -0,0 +1,160 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/savabush/obsidian-sync/internal/database/minio"
+	obsidian "github.com/savabush/obsidian-sync/internal/services"
+)
+
+// SectionStatus describes the current state of a section bucket.
+type SectionStatus struct {
+	Section string `json:"section"`
+	Bucket  string `json:"bucket"`
+	Exists  bool   `json:"exists"`
+	Objects int    `json:"objects"`
+	Size    int64  `json:"size"`
+	// LastModified is the newest object modification time in the bucket
+	LastModified time.Time `json:"last_modified,omitempty"`
+}
+
+// SectionDiff lists the differences between a vault section and its bucket.
+type SectionDiff struct {
+	Section   string   `json:"section"`
+	Bucket    string   `json:"bucket"`
+	Added     []string `json:"added"`
+	Modified  []string `json:"modified"`
+	Deleted   []string `json:"deleted"`
+	Unchanged int      `json:"unchanged"`
+}
+
+// Changed reports whether the section differs from its bucket.
+func (d SectionDiff) Changed() bool {
+	return len(d.Added)+len(d.Modified)+len(d.Deleted) > 0
+}
+
+// newSectionDiff describes a sync plan as a diff
+func newSectionDiff(section string, plan *minio.Plan) SectionDiff {
+	return SectionDiff{
+		Section:   section,
+		Bucket:    plan.Bucket,
+		Added:     nonNil(plan.Keys(minio.ActionCreate)),
+		Modified:  nonNil(plan.Keys(minio.ActionUpdate)),
+		Deleted:   nonNil(plan.Keys(minio.ActionDelete)),
+		Unchanged: plan.Summary.Skip,
+	}
+}
+
+// nonNil keeps empty lists as [] in JSON output
+func nonNil(keys []string) []string {
+	if keys == nil {
+		return []string{}
+	}
+	return keys
+}
+
+// Status reports the state of the buckets of the given sections.
+func (a *App) Status(sectionNames []string) ([]SectionStatus, error) {
+	sections, err := a.ResolveSections(sectionNames)
+	if err != nil {
+		return nil, err
+	}
+	minioRepo, err := a.newMinioRepository(a.logger, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []SectionStatus
+	for _, section := range sections {
+		status := SectionStatus{Section: section.Dir, Bucket: section.Bucket}
+		minioRepo.SetBucket(status.Bucket)
+
+		status.Exists, err = minioRepo.BucketExists()
+		if err != nil {
+			return nil, fmt.Errorf("failed to check bucket %s: %w", status.Bucket, err)
+		}
+		if status.Exists {
+			objects, err := minioRepo.ListObjects("", false)
+			if err != nil {
+				return nil, err
+			}
+			status.Objects = len(objects)
+			for _, object := range objects {
+				status.Size += object.Size
+				if object.LastModified.After(status.LastModified) {
+					status.LastModified = object.LastModified
+				}
+			}
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// List returns the objects stored for a section, including their metadata.
+func (a *App) List(sectionName, prefix string) ([]minio.Object, error) {
+	sections, err := a.ResolveSections([]string{sectionName})
+	if err != nil {
+		return nil, err
+	}
+	minioRepo, err := a.newMinioRepository(a.logger, true)
+	if err != nil {
+		return nil, err
+	}
+	minioRepo.SetBucket(sections[0].Bucket)
+	return minioRepo.ListObjects(prefix, true)
+}
+
+// Diff compares the files of the vault with the objects in their buckets.
+// It is the sync plan of every section expressed as added, modified and
+// deleted objects; nothing is written.
+func (a *App) Diff(src Source, sectionNames []string) ([]SectionDiff, error) {
+	sections, err := a.ResolveSections(sectionNames)
+	if err != nil {
+		return nil, err
+	}
+	minioRepo, err := a.newMinioRepository(a.logger, true)
+	if err != nil {
+		return nil, err
+	}
+	root, _, err := a.prepareVault(context.Background(), src, sections)
+	if err != nil {
+		return nil, err
+	}
+	dates, err := historyDates(context.Background(), root, sectionDirs(sections))
+	if err != nil {
+		a.logger.Warnf("Failed to read the note dates from the vault history: %v", err)
+	}
+
+	var diffs []SectionDiff
+	for _, section := range sections {
+		if _, err := os.Stat(filepath.Join(root, section.Dir)); err != nil {
+			a.logger.Warnf("Section %s not found in vault, skipping", section.Dir)
+			continue
+		}
+		minioRepo.SetBucket(section.Bucket)
+		plan, err := a.planSection(context.Background(), a.logger, minioRepo, root, section, dates)
+		if err != nil {
+			return nil, err
+		}
+		diffs = append(diffs, newSectionDiff(section.Dir, plan))
+	}
+	return diffs, nil
+}
+
+// Validate lints the vault sections without touching MinIO.
+func (a *App) Validate(src Source, sectionNames []string) ([]obsidian.VaultIssue, error) {
+	sections, err := a.ResolveSections(sectionNames)
+	if err != nil {
+		return nil, err
+	}
+	root, _, err := a.prepareVault(context.Background(), src, sections)
+	if err != nil {
+		return nil, err
+	}
+	return obsidian.ValidateVault(root, sectionDirs(sections)), nil
+}
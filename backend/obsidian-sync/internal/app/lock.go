@@ -0,0 +1,151 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/savabush/obsidian-sync/internal/config"
+	"github.com/savabush/obsidian-sync/internal/database/minio"
+	"github.com/savabush/obsidian-sync/internal/database/postgres"
+)
+
+// ErrLocked is returned when a run is skipped because another run holds the sync lock.
+var ErrLocked = errors.New("another sync run holds the lock")
+
+// ErrLockLost is the cause of the cancellation of a run that lost the sync lock.
+var ErrLockLost = errors.New("the sync lock was lost")
+
+// Lock is a held sync lock.
+type Lock interface {
+	// Lost is closed when the lock was lost, e.g. when a lease could not be renewed
+	Lost() <-chan struct{}
+	Release(ctx context.Context) error
+}
+
+// Locker guards runs across processes so that a single sync runs at a
+// time, see postgres.Locker and minio.Lease.
+type Locker interface {
+	// TryLock takes the lock for owner without waiting. When another
+	// holder is active it returns a nil lock and describes the holder.
+	TryLock(ctx context.Context, owner string) (Lock, string, error)
+}
+
+// SetLocker sets the lock every run holds while it runs.
+func (a *App) SetLocker(locker Locker) {
+	a.locker = locker
+}
+
+// NewLocker creates the locker selected by lock.backend, nil when runs are
+// not locked. The postgres backend takes its lock on db.
+func NewLocker(cfg config.Config, logger config.LoggerInterface, db *postgres.Repository) (Locker, error) {
+	interval := cfg.Lock.TTL / 3
+	switch cfg.Lock.BACKEND {
+	case config.LockNone:
+		return nil, nil
+	case config.LockPostgres:
+		if db == nil {
+			return nil, errors.New("the postgres lock requires POSTGRES_HOST")
+		}
+		return postgresLocker{db.Locker(cfg.Lock.KEY, interval)}, nil
+	case config.LockMinio:
+		repo, err := minio.NewRepository(minio.RepositoryConfig{
+			Endpoint:  cfg.Minio.ENDPOINT,
+			AccessKey: cfg.Minio.ACCESS_KEY,
+			SecretKey: cfg.Minio.SECRET_KEY,
+			UseSSL:    cfg.Minio.USE_SSL,
+			Bucket:    cfg.Lock.BUCKET,
+		}, logger)
+		if err != nil {
+			return nil, fmt.Errorf("failed to initialize the lock: %w", err)
+		}
+		return minioLocker{repo.Lease(cfg.Lock.KEY, cfg.Lock.TTL)}, nil
+	default:
+		return nil, fmt.Errorf("unknown lock backend %q", cfg.Lock.BACKEND)
+	}
+}
+
+// postgresLocker adapts postgres.Locker to Locker
+type postgresLocker struct {
+	locker *postgres.Locker
+}
+
+func (l postgresLocker) TryLock(ctx context.Context, owner string) (Lock, string, error) {
+	lock, holder, err := l.locker.TryLock(ctx, owner)
+	if lock == nil {
+		return nil, holder, err
+	}
+	return lock, "", nil
+}
+
+// minioLocker adapts minio.Lease to Locker
+type minioLocker struct {
+	lease *minio.Lease
+}
+
+func (l minioLocker) TryLock(ctx context.Context, owner string) (Lock, string, error) {
+	lock, holder, err := l.lease.TryLock(ctx, owner)
+	if lock == nil {
+		return nil, holder, err
+	}
+	return lock, "", nil
+}
+
+// acquireLock takes the sync lock for a run. It returns a nil lock when
+// runs are not locked or the run is a dry run, which writes nothing, and
+// ErrLocked when another holder is active.
+func (a *App) acquireLock(ctx context.Context, logger config.LoggerInterface, dryRun bool) (Lock, error) {
+	if a.locker == nil || dryRun {
+		return nil, nil
+	}
+	lock, holder, err := a.locker.TryLock(ctx, lockOwner(config.RunID(ctx)))
+	if err != nil {
+		return nil, err
+	}
+	if lock == nil {
+		logger.WithField("lock_holder", holder).Infof("Skipping run, the sync lock is held by %s", holder)
+		return nil, fmt.Errorf("%w: held by %s", ErrLocked, holder)
+	}
+	logger.Debug("Sync lock acquired")
+	return lock, nil
+}
+
+// runLocked performs the steps of Run while holding lock. A lost lock
+// cancels the run.
+func (a *App) runLocked(ctx context.Context, logger config.LoggerInterface, lock Lock, opts Options, report *Report, events *emitter) error {
+	if lock == nil {
+		return a.run(ctx, logger, opts, report, events)
+	}
+	defer func() {
+		if err := lock.Release(context.WithoutCancel(ctx)); err != nil {
+			logger.Errorf("Failed to release the sync lock: %v", err)
+		}
+	}()
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	go func() {
+		select {
+		case <-lock.Lost():
+			logger.Error("Lost the sync lock, canceling the run")
+			cancel(ErrLockLost)
+		case <-ctx.Done():
+		}
+	}()
+
+	err := a.run(ctx, logger, opts, report, events)
+	if err != nil && errors.Is(context.Cause(ctx), ErrLockLost) {
+		return fmt.Errorf("%w: %w", ErrLockLost, err)
+	}
+	return err
+}
+
+// lockOwner identifies the holder of the sync lock in the logs of other replicas
+func lockOwner(runID string) string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s/%d/%s", host, os.Getpid(), runID)
+}
@@ -0,0 +1,119 @@
+package app
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/savabush/obsidian-sync/internal/config"
+	"github.com/savabush/obsidian-sync/internal/database/minio"
+	obsidian "github.com/savabush/obsidian-sync/internal/services"
+)
+
+// Content types of the files rendered from the notes
+const (
+	htmlContentType = "text/html; charset=utf-8"
+	jsonContentType = "application/json"
+)
+
+// redactNotes removes the private content of the markdown notes among the
+// files of a section, so the uploaded notes and everything rendered from
+// them never contain it, and returns the files to upload. Redacted notes
+// are uploaded from memory. A note whose denied frontmatter keys cannot be
+// removed is logged and not uploaded; a note that cannot be read fails the
+// section rather than being uploaded as is.
+func (a *App) redactNotes(logger config.LoggerInterface, section string, files []minio.File) ([]minio.File, error) {
+	kept := files[:0]
+	for _, file := range files {
+		if path.Ext(file.Name) != ".md" {
+			kept = append(kept, file)
+			continue
+		}
+		data, err := os.ReadFile(file.Path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s/%s to redact it: %w", section, file.Name, err)
+		}
+		if err := a.redaction.Check(data); err != nil {
+			logger.Warnf("Skipping note %s/%s: %v", section, file.Name, err)
+			continue
+		}
+		if redacted := a.redaction.Apply(data); !bytes.Equal(redacted, data) {
+			file.Content = redacted
+		}
+		kept = append(kept, file)
+	}
+	return kept, nil
+}
+
+// fileContent returns the content of a file to upload
+func fileContent(file minio.File) ([]byte, error) {
+	if file.Content != nil {
+		return file.Content, nil
+	}
+	return os.ReadFile(file.Path)
+}
+
+// renderNotes renders the note of every post among the files of a section
+// to sanitized HTML stored next to it as <slug>/<slug>.html, with its table
+// of contents, reading time and excerpt as <slug>/<slug>.json. The rendered
+// files are planned with the section, so they are only uploaded when the
+// note changed and removed with it. A note that cannot be parsed is logged
+// and left without them.
+func (a *App) renderNotes(logger config.LoggerInterface, section config.SectionConfig, files []minio.File) []minio.File {
+	var rendered []minio.File
+	for _, file := range files {
+		slug, name := path.Split(file.Name)
+		slug = strings.TrimSuffix(slug, "/")
+		if strings.Contains(slug, "/") || name != slug+".md" {
+			continue
+		}
+		data, err := fileContent(file)
+		if err != nil {
+			logger.Warnf("Failed to read %s/%s to render it: %v", section.Dir, file.Name, err)
+			continue
+		}
+		note, err := obsidian.ParseNote(data)
+		if err != nil {
+			logger.Warnf("Skipping HTML of %s/%s: %v", section.Dir, file.Name, err)
+			continue
+		}
+		doc, err := a.markdown.RenderDocument(note.Body, func(destination string) string {
+			if name, ok := strings.CutPrefix(path.Clean(destination), obsidian.ResourcesDir+"/"); ok {
+				return a.resourceURL(section, slug, name)
+			}
+			return ""
+		})
+		if err != nil {
+			logger.Warnf("Failed to render %s/%s: %v", section.Dir, file.Name, err)
+			continue
+		}
+		info, err := json.Marshal(obsidian.NewPostInfo(note, doc.TOC))
+		if err != nil {
+			logger.Warnf("Failed to encode the info of %s/%s: %v", section.Dir, file.Name, err)
+			continue
+		}
+		rendered = append(rendered,
+			minio.File{Name: obsidian.HTMLKey(slug), Content: doc.HTML, ContentType: htmlContentType},
+			minio.File{Name: obsidian.InfoKey(slug), Content: info, ContentType: jsonContentType})
+	}
+	return rendered
+}
+
+// resourceURL returns the URL the blog API serves a resource of a post at,
+// on API_PUBLIC_URL, else on the site, else relative to the host
+func (a *App) resourceURL(section config.SectionConfig, slug, name string) string {
+	base := a.cfg.API.PUBLIC_URL
+	if base == "" {
+		base = a.cfg.Site.URL
+	}
+	apiPath := config.SitePath(section)
+	if section.Bucket == a.cfg.API.PAGES_BUCKET {
+		apiPath = "pages"
+	}
+	return strings.TrimRight(base, "/") + blogAPIPrefix + "/" + apiPath + "/" + url.PathEscape(slug) +
+		"/resources/" + (&url.URL{Path: name}).EscapedPath()
+}
@@ -0,0 +1,243 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/savabush/obsidian-sync/internal/config"
+)
+
+// DefaultHistorySize is the number of finished runs a Runner keeps
+const DefaultHistorySize = 50
+
+// subscriberBuffer is the number of events buffered for a subscriber
+const subscriberBuffer = 256
+
+// ErrRunInProgress is returned when a run is started while another one is in progress.
+var ErrRunInProgress = errors.New("a sync run is already in progress")
+
+// Runner runs synchronizations of an application one at a time, keeps the
+// status of the recent runs and broadcasts their progress events. It is
+// shared by the scheduler and the status API so that scheduled and
+// triggered runs never overlap.
+type Runner struct {
+	mu          sync.Mutex
+	app         *App
+	current     *RunStatus
+	history     []RunStatus // oldest first
+	historySize int
+	subscribers map[chan Event]struct{}
+}
+
+// NewRunner creates a runner for the application keeping historySize finished runs.
+func NewRunner(a *App, historySize int) *Runner {
+	if historySize <= 0 {
+		historySize = DefaultHistorySize
+	}
+	return &Runner{
+		app:         a,
+		historySize: historySize,
+		subscribers: make(map[chan Event]struct{}),
+	}
+}
+
+// SetApp replaces the application used by the next runs, e.g. after a
+// configuration reload. A run in progress keeps its application.
+func (r *Runner) SetApp(a *App) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.app = a
+}
+
+// Run performs a run and waits for it to finish. It returns
+// ErrRunInProgress when another run is in progress.
+func (r *Runner) Run(ctx context.Context, opts Options) (*Report, error) {
+	if config.RunID(ctx) == "" {
+		ctx = config.WithRunID(ctx, config.NewID(8))
+	}
+	a, err := r.begin(config.RunID(ctx), opts)
+	if err != nil {
+		return nil, err
+	}
+	return r.run(ctx, a, opts)
+}
+
+// Start starts a run in the background and returns its ID. It returns
+// ErrRunInProgress when another run is in progress.
+func (r *Runner) Start(opts Options) (string, error) {
+	ctx := config.WithRunID(context.Background(), config.NewID(8))
+	a, err := r.begin(config.RunID(ctx), opts)
+	if err != nil {
+		return "", err
+	}
+	go r.run(ctx, a, opts)
+	return config.RunID(ctx), nil
+}
+
+// RunScheduled is the scheduled entry point. Unlike App.RunScheduled a
+// failed run is logged instead of stopping the process, its status stays
+// available from the runner. A run in progress skips the scheduled one.
+func (r *Runner) RunScheduled() {
+	_, err := r.Run(context.Background(), Options{Source: Source{Progress: os.Stdout}, Trigger: TriggerSchedule})
+	if errors.Is(err, ErrRunInProgress) {
+		r.App().logger.Info("Skipping scheduled run, another run is in progress")
+		return
+	}
+	if errors.Is(err, ErrLocked) {
+		// Logged by the run with the lock holder
+		return
+	}
+	if err != nil {
+		r.App().logger.Errorf("Scheduled run failed: %v", err)
+	}
+}
+
+// App returns the application used by the next runs
+func (r *Runner) App() *App {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.app
+}
+
+// Status returns the status of the run with the given ID.
+func (r *Runner) Status(runID string) (RunStatus, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.current != nil && r.current.RunID == runID {
+		return *r.current, true
+	}
+	for _, status := range r.history {
+		if status.RunID == runID {
+			return status, true
+		}
+	}
+	return RunStatus{}, false
+}
+
+// Last returns the status of the latest run, which may still be running.
+func (r *Runner) Last() (RunStatus, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.current != nil {
+		return *r.current, true
+	}
+	if len(r.history) == 0 {
+		return RunStatus{}, false
+	}
+	return r.history[len(r.history)-1], true
+}
+
+// List returns up to limit recent runs, newest first. A limit of zero
+// returns all kept runs.
+func (r *Runner) List(limit int) []RunStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var runs []RunStatus
+	if r.current != nil {
+		runs = append(runs, *r.current)
+	}
+	for i := len(r.history) - 1; i >= 0; i-- {
+		runs = append(runs, r.history[i])
+	}
+	if limit > 0 && len(runs) > limit {
+		runs = runs[:limit]
+	}
+	return runs
+}
+
+// History returns up to limit runs, newest first, from the run history of
+// the application or, when it has none, from the runs kept in memory.
+func (r *Runner) History(ctx context.Context, limit int) ([]RunStatus, error) {
+	runs, err := r.App().Runs(ctx, limit)
+	if errors.Is(err, ErrNoHistory) {
+		return r.List(limit), nil
+	}
+	return runs, err
+}
+
+// Find returns the status of a run kept in memory or recorded in the run
+// history of the application.
+func (r *Runner) Find(ctx context.Context, runID string) (RunStatus, bool, error) {
+	if status, ok := r.Status(runID); ok {
+		return status, true, nil
+	}
+	status, err := r.App().RunByID(ctx, runID)
+	if errors.Is(err, ErrNoHistory) || errors.Is(err, ErrRunNotFound) {
+		return RunStatus{}, false, nil
+	}
+	if err != nil {
+		return RunStatus{}, false, err
+	}
+	return status, true, nil
+}
+
+// Subscribe returns a channel receiving the progress events of all runs
+// and a function to unsubscribe. The channel is closed when unsubscribing
+// or when the subscriber falls too far behind.
+func (r *Runner) Subscribe() (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+	r.mu.Lock()
+	r.subscribers[ch] = struct{}{}
+	r.mu.Unlock()
+
+	return ch, func() {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if _, ok := r.subscribers[ch]; ok {
+			delete(r.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// begin marks a run as in progress and returns the application to run
+func (r *Runner) begin(runID string, opts Options) (*App, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.current != nil {
+		return nil, ErrRunInProgress
+	}
+	r.current = &RunStatus{RunID: runID, State: RunRunning, Trigger: opts.Trigger, DryRun: opts.DryRun,
+		StartedAt: time.Now()}
+	return r.app, nil
+}
+
+// run performs the run, recording its events and final status
+func (r *Runner) run(ctx context.Context, a *App, opts Options) (*Report, error) {
+	onEvent := opts.OnEvent
+	opts.OnEvent = func(event Event) {
+		r.record(event)
+		if onEvent != nil {
+			onEvent(event)
+		}
+	}
+	return a.Run(ctx, opts)
+}
+
+// record updates the run status by an event and broadcasts it
+func (r *Runner) record(event Event) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if event.Type == EventFinished && event.Status != nil {
+		r.current = nil
+		r.history = append(r.history, *event.Status)
+		if len(r.history) > r.historySize {
+			r.history = r.history[len(r.history)-r.historySize:]
+		}
+	}
+
+	for ch := range r.subscribers {
+		select {
+		case ch <- event:
+		default:
+			// Drop subscribers that fall behind rather than blocking the run
+			delete(r.subscribers, ch)
+			close(ch)
+		}
+	}
+}
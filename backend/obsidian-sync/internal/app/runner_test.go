@@ -0,0 +1,402 @@
+package app
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	miniogo "github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/savabush/obsidian-sync/internal/config"
+	"github.com/savabush/obsidian-sync/internal/database/postgres"
+)
+
+// fakeReporter records the reported statuses, blocking until release is
+// closed when it is set
+type fakeReporter struct {
+	mu       sync.Mutex
+	statuses []RunStatus
+	release  chan struct{}
+}
+
+func (f *fakeReporter) ReportRun(ctx context.Context, status RunStatus) error {
+	if f.release != nil {
+		<-f.release
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.statuses = append(f.statuses, status)
+	return nil
+}
+
+// fakePublisher records the published runs
+type fakePublisher struct {
+	reports []*Report
+}
+
+func (f *fakePublisher) PublishRun(ctx context.Context, report *Report, status RunStatus) error {
+	f.reports = append(f.reports, report)
+	return nil
+}
+
+func TestRunPublishesChanges(t *testing.T) {
+	root := writeVault(t)
+	publisher := &fakePublisher{}
+	a := newTestApp(testConfig(t), newFakeMinio("blog"))
+	a.SetPublisher(publisher)
+
+	_, err := a.Run(context.Background(), Options{Source: Source{Path: root}, DryRun: true, Sections: []string{"blog"}})
+	require.NoError(t, err)
+	assert.Empty(t, publisher.reports, "dry runs publish nothing")
+
+	report, err := a.Run(context.Background(), Options{Source: Source{Path: root}, Sections: []string{"blog"}})
+	require.NoError(t, err)
+	require.Len(t, publisher.reports, 1)
+	assert.Same(t, report, publisher.reports[0])
+}
+
+func TestRunnerEvents(t *testing.T) {
+	root := writeVault(t)
+	client := newFakeMinio("blog")
+	client.buckets["blog"]["Old/Old.md"] = []byte("old")
+	reporter := &fakeReporter{}
+	a := newTestApp(testConfig(t), client)
+	a.SetReporter(reporter)
+	runner := NewRunner(a, 0)
+
+	events, unsubscribe := runner.Subscribe()
+	defer unsubscribe()
+
+	report, err := runner.Run(context.Background(), Options{Source: Source{Path: root}, Sections: []string{"blog"}})
+	require.NoError(t, err)
+
+	var types []EventType
+	var last Event
+	for event := range events {
+		assert.Equal(t, report.RunID, event.RunID)
+		types = append(types, event.Type)
+		last = event
+		if event.Type == EventFinished {
+			break
+		}
+	}
+	assert.Equal(t, []EventType{EventStarted, EventPlanned, EventApplied, EventApplied, EventApplied, EventApplied, EventApplied, EventApplied, EventFinished}, types)
+
+	require.NotNil(t, last.Status)
+	status := *last.Status
+	assert.Equal(t, RunSucceeded, status.State)
+	require.Len(t, status.Sections, 1)
+	assert.Equal(t, "blog", status.Sections[0].Bucket)
+	assert.Equal(t, 5, status.Sections[0].Create)
+	assert.Equal(t, 1, status.Sections[0].Delete)
+
+	require.Len(t, reporter.statuses, 1)
+	assert.Equal(t, status, reporter.statuses[0])
+	kept, ok := runner.Status(report.RunID)
+	require.True(t, ok)
+	assert.Equal(t, status, kept)
+}
+
+func TestRunnerOneRunAtATime(t *testing.T) {
+	root := writeVault(t)
+	reporter := &fakeReporter{release: make(chan struct{})}
+	a := newTestApp(testConfig(t), newFakeMinio("blog"))
+	a.SetReporter(reporter)
+	runner := NewRunner(a, 0)
+
+	events, unsubscribe := runner.Subscribe()
+	defer unsubscribe()
+
+	runID, err := runner.Start(Options{Source: Source{Path: root}, Sections: []string{"blog"}})
+	require.NoError(t, err)
+
+	// The run waits for the reporter, so it is still in progress
+	_, err = runner.Start(Options{Source: Source{Path: root}})
+	assert.ErrorIs(t, err, ErrRunInProgress)
+	_, err = runner.Run(context.Background(), Options{Source: Source{Path: root}})
+	assert.ErrorIs(t, err, ErrRunInProgress)
+
+	status, ok := runner.Last()
+	require.True(t, ok)
+	assert.Equal(t, runID, status.RunID)
+	assert.Equal(t, RunRunning, status.State)
+
+	close(reporter.release)
+	for event := range events {
+		if event.Type == EventFinished {
+			break
+		}
+	}
+	status, ok = runner.Status(runID)
+	require.True(t, ok)
+	assert.Equal(t, RunSucceeded, status.State)
+
+	_, err = runner.Run(context.Background(), Options{Source: Source{Path: root}, Sections: []string{"blog"}})
+	assert.NoError(t, err, "the next run starts once the previous one finished")
+}
+
+func TestRunnerHistory(t *testing.T) {
+	root := writeVault(t)
+	runner := NewRunner(newTestApp(testConfig(t), newFakeMinio("blog")), 2)
+
+	_, ok := runner.Last()
+	assert.False(t, ok)
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		report, err := runner.Run(context.Background(), Options{Source: Source{Path: root}, Sections: []string{"blog"}})
+		require.NoError(t, err)
+		ids = append(ids, report.RunID)
+	}
+
+	runs := runner.List(0)
+	require.Len(t, runs, 2, "only the last two runs are kept")
+	assert.Equal(t, ids[2], runs[0].RunID)
+	assert.Equal(t, ids[1], runs[1].RunID)
+	assert.Len(t, runner.List(1), 1)
+
+	last, ok := runner.Last()
+	require.True(t, ok)
+	assert.Equal(t, ids[2], last.RunID)
+	_, ok = runner.Status(ids[0])
+	assert.False(t, ok)
+
+	// A failed run is recorded with its error
+	invalidCfg := testConfig(t)
+	invalidCfg.GIT.URL = ""
+	runner.SetApp(newTestApp(invalidCfg, newFakeMinio("blog")))
+	_, err := runner.Run(context.Background(), Options{Source: Source{Path: root}})
+	require.Error(t, err)
+	last, _ = runner.Last()
+	assert.Equal(t, RunFailed, last.State)
+	assert.Contains(t, last.Error, "git.url")
+}
+
+// fakeHistory keeps the recorded runs in memory
+type fakeHistory struct {
+	mu      sync.Mutex
+	records []postgres.Run // every recorded version, oldest first
+	pruned  []time.Time
+}
+
+func (f *fakeHistory) RecordRun(ctx context.Context, run postgres.Run) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.records = append(f.records, run)
+	return nil
+}
+
+func (f *fakeHistory) PruneRuns(ctx context.Context, before time.Time) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.pruned = append(f.pruned, before)
+	return 0, nil
+}
+
+func (f *fakeHistory) ListRuns(ctx context.Context, limit int) ([]postgres.Run, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var runs []postgres.Run
+	seen := make(map[string]bool)
+	for i := len(f.records) - 1; i >= 0; i-- {
+		if !seen[f.records[i].ID] {
+			seen[f.records[i].ID] = true
+			runs = append(runs, f.records[i])
+		}
+	}
+	if limit > 0 && len(runs) > limit {
+		runs = runs[:limit]
+	}
+	return runs, nil
+}
+
+func (f *fakeHistory) GetRun(ctx context.Context, runID string) (postgres.Run, error) {
+	runs, _ := f.ListRuns(ctx, 0)
+	for _, run := range runs {
+		if run.ID == runID {
+			return run, nil
+		}
+	}
+	return postgres.Run{}, postgres.ErrRunNotFound
+}
+
+func TestRunRecordsHistory(t *testing.T) {
+	root := writeVault(t)
+	history := &fakeHistory{}
+	cfg := testConfig(t)
+	cfg.Postgres.RUN_RETENTION = 24 * time.Hour
+	a := newTestApp(cfg, newFakeMinio("blog"))
+
+	_, err := a.Runs(context.Background(), 0)
+	assert.ErrorIs(t, err, ErrNoHistory)
+
+	a.SetHistory(history)
+	report, err := a.Run(context.Background(), Options{Source: Source{Path: root}, Sections: []string{"blog"},
+		Trigger: TriggerCLI})
+	require.NoError(t, err)
+
+	require.Len(t, history.records, 2, "a run is recorded when it starts and when it finishes")
+	started := history.records[0]
+	assert.Equal(t, report.RunID, started.ID)
+	assert.Equal(t, "running", started.State)
+	assert.Nil(t, started.FinishedAt)
+	finished := history.records[1]
+	assert.Equal(t, "succeeded", finished.State)
+	assert.Equal(t, "cli", finished.Trigger)
+	require.NotNil(t, finished.FinishedAt)
+	require.Len(t, finished.Sections, 1)
+	assert.Equal(t, postgres.RunSection{Section: config.Blog, Bucket: "blog", Created: 5, UploadBytes: 178},
+		finished.Sections[0])
+
+	require.Len(t, history.pruned, 1)
+	assert.WithinDuration(t, time.Now().Add(-24*time.Hour), history.pruned[0], time.Minute)
+
+	status, err := a.RunByID(context.Background(), report.RunID)
+	require.NoError(t, err)
+	assert.Equal(t, RunSucceeded, status.State)
+	assert.Equal(t, TriggerCLI, status.Trigger)
+	assert.Equal(t, 5, status.Sections[0].Create)
+	_, err = a.RunByID(context.Background(), "unknown")
+	assert.ErrorIs(t, err, ErrRunNotFound)
+}
+
+func TestRunnerReadsHistory(t *testing.T) {
+	root := writeVault(t)
+	history := &fakeHistory{records: []postgres.Run{{ID: "old", State: "failed", Trigger: "schedule", Error: "boom"}}}
+	a := newTestApp(testConfig(t), newFakeMinio("blog"))
+	a.SetHistory(history)
+	runner := NewRunner(a, DefaultHistorySize)
+
+	report, err := runner.Run(context.Background(), Options{Source: Source{Path: root}, Sections: []string{"blog"}})
+	require.NoError(t, err)
+
+	runs, err := runner.History(context.Background(), 0)
+	require.NoError(t, err)
+	require.Len(t, runs, 2)
+	assert.Equal(t, report.RunID, runs[0].RunID)
+	assert.Equal(t, "old", runs[1].RunID)
+
+	status, ok, err := runner.Find(context.Background(), "old")
+	require.NoError(t, err)
+	require.True(t, ok, "runs not kept in memory are read from the history")
+	assert.Equal(t, RunFailed, status.State)
+	assert.Equal(t, "boom", status.Error)
+
+	_, ok, err = runner.Find(context.Background(), "unknown")
+	require.NoError(t, err)
+	assert.False(t, ok)
+
+	// Without a history the runs kept in memory are listed
+	runner.SetApp(newTestApp(testConfig(t), newFakeMinio("blog")))
+	runs, err = runner.History(context.Background(), 0)
+	require.NoError(t, err)
+	require.Len(t, runs, 1)
+	assert.Equal(t, report.RunID, runs[0].RunID)
+}
+
+// fakeLock is a held lock that is lost when lost is closed
+type fakeLock struct {
+	lost     chan struct{}
+	released bool
+}
+
+func (l *fakeLock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+func (l *fakeLock) Release(ctx context.Context) error {
+	l.released = true
+	return nil
+}
+
+// fakeLocker hands out its lock unless holder is set
+type fakeLocker struct {
+	lock   *fakeLock
+	holder string
+	owners []string
+}
+
+func (f *fakeLocker) TryLock(ctx context.Context, owner string) (Lock, string, error) {
+	f.owners = append(f.owners, owner)
+	if f.holder != "" {
+		return nil, f.holder, nil
+	}
+	return f.lock, "", nil
+}
+
+func TestRunHoldsLock(t *testing.T) {
+	root := writeVault(t)
+	locker := &fakeLocker{lock: &fakeLock{lost: make(chan struct{})}}
+	a := newTestApp(testConfig(t), newFakeMinio("blog"))
+	a.SetLocker(locker)
+
+	_, err := a.Run(context.Background(), Options{Source: Source{Path: root}, DryRun: true, Sections: []string{"blog"}})
+	require.NoError(t, err)
+	assert.Empty(t, locker.owners, "dry runs write nothing and run without the lock")
+
+	report, err := a.Run(context.Background(), Options{Source: Source{Path: root}, Sections: []string{"blog"}})
+	require.NoError(t, err)
+	require.Len(t, locker.owners, 1)
+	assert.Contains(t, locker.owners[0], "/"+report.RunID, "the owner names the run")
+	assert.True(t, locker.lock.released)
+}
+
+func TestRunSkippedWhenLocked(t *testing.T) {
+	root := writeVault(t)
+	client := newFakeMinio("blog")
+	reporter := &fakeReporter{}
+	history := &fakeHistory{}
+	a := newTestApp(testConfig(t), client)
+	a.SetLocker(&fakeLocker{holder: "replica-2/7/abc"})
+	a.SetReporter(reporter)
+	a.SetHistory(history)
+	runner := NewRunner(a, DefaultHistorySize)
+
+	report, err := runner.Run(context.Background(), Options{Source: Source{Path: root}, Sections: []string{"blog"}})
+	assert.ErrorIs(t, err, ErrLocked)
+	assert.EqualError(t, err, "another sync run holds the lock: held by replica-2/7/abc")
+	assert.Nil(t, report)
+	assert.Zero(t, client.puts)
+	assert.Empty(t, reporter.statuses, "skipped runs are not reported")
+	assert.Empty(t, history.records, "skipped runs are not recorded")
+
+	last, ok := runner.Last()
+	require.True(t, ok)
+	assert.Equal(t, RunSkipped, last.State)
+	assert.Contains(t, last.Error, "replica-2/7/abc")
+
+	a.SetLocker(nil)
+	_, err = runner.Run(context.Background(), Options{Source: Source{Path: root}, Sections: []string{"blog"}})
+	assert.NoError(t, err, "a skipped run does not block the runner")
+}
+
+// losingMinio loses the lock while the sync is planned and waits for the
+// run to be canceled
+type losingMinio struct {
+	*fakeMinio
+	lock *fakeLock
+	once sync.Once
+}
+
+func (m *losingMinio) ListObjects(ctx context.Context, bucketName string, opts miniogo.ListObjectsOptions) <-chan miniogo.ObjectInfo {
+	m.once.Do(func() { close(m.lock.lost) })
+	<-ctx.Done()
+	return m.fakeMinio.ListObjects(ctx, bucketName, opts)
+}
+
+func TestRunCanceledWhenLockLost(t *testing.T) {
+	root := writeVault(t)
+	lock := &fakeLock{lost: make(chan struct{})}
+	client := &losingMinio{fakeMinio: newFakeMinio("blog"), lock: lock}
+	a := newTestApp(testConfig(t), client)
+	a.SetLocker(&fakeLocker{lock: lock})
+
+	_, err := a.Run(context.Background(), Options{Source: Source{Path: root}, Sections: []string{"blog"}})
+	assert.ErrorIs(t, err, ErrLockLost)
+	assert.ErrorIs(t, err, context.Canceled)
+	assert.Zero(t, client.puts, "nothing is written after the lock was lost")
+	assert.True(t, lock.released)
+}
@@ -0,0 +1,136 @@
+package app
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/savabush/obsidian-sync/internal/config"
+	"github.com/savabush/obsidian-sync/internal/database/minio"
+	obsidian "github.com/savabush/obsidian-sync/internal/services"
+	"github.com/savabush/obsidian-sync/internal/sitemap"
+)
+
+// Keys of the site files in the site bucket, which mirror their paths on the site
+const (
+	sitemapIndexKey = "sitemap.xml"
+	robotsKey       = "robots.txt"
+	// sitemapsDir holds the sitemaps listed in the index
+	sitemapsDir = "sitemaps/"
+	// homeSitemapKey is the sitemap of the pages outside of the sections
+	homeSitemapKey = sitemapsDir + "home.xml"
+)
+
+// sitemapContentType is the content type of sitemaps and the sitemap index
+const sitemapContentType = "application/xml; charset=utf-8"
+
+// updateSitemap renders the sitemaps of a section, split every
+// sitemap.MaxURLs URLs, and syncs them to the site bucket under
+// sitemaps/<bucket>/, creating the bucket as a public one when it is
+// missing. The pages bucket is served on the home page and
+// has no sitemap.
+func (a *App) updateSitemap(logger config.LoggerInterface, minioRepo *minio.Repository,
+	section config.SectionConfig, posts []obsidian.Post) error {
+	if section.Bucket == a.cfg.API.PAGES_BUCKET {
+		return nil
+	}
+
+	prefix := sitemapsDir + section.Bucket + "/"
+	var files []minio.File
+	for i, part := range sitemap.Split(a.sitemapURLs(section, posts), sitemap.MaxURLs) {
+		data, err := sitemap.Render(part)
+		if err != nil {
+			return fmt.Errorf("failed to render the sitemap of %s: %w", section.Dir, err)
+		}
+		files = append(files, minio.File{Name: fmt.Sprintf("%ssitemap-%d.xml", prefix, i+1), Content: data,
+			ContentType: sitemapContentType})
+	}
+
+	minioRepo.SetBucket(a.cfg.Site.BUCKET)
+	if err := minioRepo.EnsurePublicBucket(); err != nil {
+		return err
+	}
+	return applyGenerated(logger, minioRepo, "sitemaps of "+section.Dir, files, func(files []minio.File) (*minio.Plan, error) {
+		return minioRepo.PlanPrefix(prefix, files)
+	})
+}
+
+// sitemapURLs returns the URLs of the section page and of its published
+// posts. Posts sharing a translation key list each other as alternates.
+func (a *App) sitemapURLs(section config.SectionConfig, posts []obsidian.Post) []sitemap.URL {
+	link := a.sectionURL(section)
+
+	var published []obsidian.Post
+	translations := make(map[string][]sitemap.Alternate)
+	for _, post := range posts {
+		if post.Draft || !post.Publish {
+			continue
+		}
+		published = append(published, post)
+		if post.Translation != "" && post.Language != "" {
+			translations[post.Translation] = append(translations[post.Translation],
+				sitemap.Alternate{Language: post.Language, Href: postURL(link, post.Slug)})
+		}
+	}
+
+	urls := []sitemap.URL{{Loc: link}}
+	for _, post := range published {
+		u := sitemap.URL{Loc: postURL(link, post.Slug), LastMod: post.Updated}
+		if u.LastMod.IsZero() {
+			u.LastMod = post.Created
+		}
+		if u.LastMod.After(urls[0].LastMod) {
+			urls[0].LastMod = u.LastMod
+		}
+		if alternates := translations[post.Translation]; post.Language != "" && len(alternates) > 1 {
+			u.Alternates = alternates
+		}
+		urls = append(urls, u)
+	}
+	return urls
+}
+
+// updateSiteIndex writes the sitemap of the home page, the sitemap index
+// listing every sitemap in the site bucket and robots.txt pointing to the
+// index. The sitemaps of sections outside of the run are kept.
+func (a *App) updateSiteIndex(logger config.LoggerInterface, minioRepo *minio.Repository) error {
+	site := strings.TrimRight(a.cfg.Site.URL, "/")
+	minioRepo.SetBucket(a.cfg.Site.BUCKET)
+	if err := minioRepo.EnsurePublicBucket(); err != nil {
+		return err
+	}
+
+	home, err := sitemap.Render([]sitemap.URL{{Loc: site + "/"}})
+	if err != nil {
+		return fmt.Errorf("failed to render the home sitemap: %w", err)
+	}
+	entries := []sitemap.Entry{{Loc: site + "/" + homeSitemapKey}}
+	exists, err := minioRepo.BucketExists()
+	if err != nil {
+		return fmt.Errorf("failed to check bucket %s: %w", a.cfg.Site.BUCKET, err)
+	}
+	if exists {
+		objects, err := minioRepo.ListObjects(sitemapsDir, false)
+		if err != nil {
+			return err
+		}
+		sort.Slice(objects, func(i, j int) bool { return objects[i].Key < objects[j].Key })
+		for _, object := range objects {
+			if object.Key != homeSitemapKey && path.Ext(object.Key) == ".xml" {
+				entries = append(entries, sitemap.Entry{Loc: site + "/" + object.Key, LastMod: object.LastModified})
+			}
+		}
+	}
+	index, err := sitemap.RenderIndex(entries)
+	if err != nil {
+		return fmt.Errorf("failed to render the sitemap index: %w", err)
+	}
+
+	files := []minio.File{
+		{Name: homeSitemapKey, Content: home, ContentType: sitemapContentType},
+		{Name: sitemapIndexKey, Content: index, ContentType: sitemapContentType},
+		{Name: robotsKey, Content: sitemap.Robots(site + "/" + sitemapIndexKey), ContentType: "text/plain; charset=utf-8"},
+	}
+	return applyGenerated(logger, minioRepo, "sitemap index", files, minioRepo.PlanFiles)
+}
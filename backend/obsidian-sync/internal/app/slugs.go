@@ -0,0 +1,84 @@
+package app
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/savabush/obsidian-sync/internal/config"
+	"github.com/savabush/obsidian-sync/internal/database/minio"
+	obsidian "github.com/savabush/obsidian-sync/internal/services"
+)
+
+// slugFiles names the files of the post folders among the files of a
+// section after the slugs of their posts, <slug>/<slug>.md for the notes,
+// and returns the posts with the checksums of their notes as uploaded.
+// The other files keep their names.
+func slugFiles(section string, files []minio.File, slugs map[string]string) ([]obsidian.Post, error) {
+	var posts []obsidian.Post
+	for i, file := range files {
+		dir, name, ok := strings.Cut(file.Name, "/")
+		slug, found := slugs[dir]
+		if !ok || !found {
+			continue
+		}
+		files[i].Name = obsidian.SlugKey(dir, slug, name)
+		if name != dir+".md" {
+			continue
+		}
+		data, err := fileContent(files[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s/%s: %w", section, file.Name, err)
+		}
+		sum := md5.Sum(data)
+		posts = append(posts, obsidian.Post{Slug: slug, Dir: dir, Checksum: hex.EncodeToString(sum[:])})
+	}
+	return posts, nil
+}
+
+// slugsFile returns the slug state of the posts of a section as the file
+// it is stored in, following the state stored in the section bucket and
+// matching renamed posts by the checksums of the notes in the bucket. A
+// bucket without a state, or with an invalid one, starts over.
+func slugsFile(ctx context.Context, logger config.LoggerInterface, minioRepo *minio.Repository, section string,
+	posts []obsidian.Post) (minio.File, error) {
+	var former obsidian.Slugs
+	checksums := make(map[string]string)
+	exists, err := minioRepo.BucketExists()
+	if err != nil {
+		return minio.File{}, fmt.Errorf("failed to check the bucket of %s: %w", section, err)
+	}
+	if exists {
+		data, _, err := minioRepo.ReadObject(ctx, obsidian.RedirectsKey)
+		switch {
+		case errors.Is(err, minio.ErrObjectNotFound):
+		case err != nil:
+			return minio.File{}, fmt.Errorf("failed to read the slugs of %s: %w", section, err)
+		default:
+			if err := json.Unmarshal(data, &former); err != nil {
+				logger.Warnf("Ignoring the invalid slugs of %s: %v", section, err)
+				former = obsidian.Slugs{}
+			}
+		}
+
+		objects, err := minioRepo.ListObjectsContext(ctx, "", false)
+		if err != nil {
+			return minio.File{}, err
+		}
+		for _, object := range objects {
+			if slug, name, ok := strings.Cut(object.Key, "/"); ok && name == slug+".md" {
+				checksums[slug] = object.ETag
+			}
+		}
+	}
+
+	data, err := json.Marshal(former.Next(posts, checksums))
+	if err != nil {
+		return minio.File{}, fmt.Errorf("failed to encode the slugs of %s: %w", section, err)
+	}
+	return minio.File{Name: obsidian.RedirectsKey, Content: data, ContentType: jsonContentType}, nil
+}
@@ -0,0 +1,123 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/savabush/obsidian-sync/internal/database/minio"
+)
+
+// RunState is the state of a synchronization run.
+type RunState string
+
+const (
+	RunRunning   RunState = "running"
+	RunSucceeded RunState = "succeeded"
+	RunFailed    RunState = "failed"
+	// RunSkipped is the state of a run skipped because another run held the sync lock
+	RunSkipped RunState = "skipped"
+)
+
+// Trigger is what started a synchronization run.
+type Trigger string
+
+const (
+	TriggerSchedule Trigger = "schedule"
+	TriggerCLI      Trigger = "cli"
+	TriggerAPI      Trigger = "api"
+)
+
+// RunStatus describes a running or finished synchronization run.
+type RunStatus struct {
+	RunID      string           `json:"run_id"`
+	State      RunState         `json:"state"`
+	Trigger    Trigger          `json:"trigger,omitempty"`
+	DryRun     bool             `json:"dry_run"`
+	Commit     string           `json:"commit,omitempty"`
+	StartedAt  time.Time        `json:"started_at"`
+	FinishedAt time.Time        `json:"finished_at,omitempty"`
+	Sections   []SectionSummary `json:"sections"`
+	// Error describes why a failed run failed
+	Error string `json:"error,omitempty"`
+}
+
+// SectionSummary counts the operations of a run on one section bucket.
+type SectionSummary struct {
+	Section string `json:"section"`
+	Bucket  string `json:"bucket"`
+	minio.PlanSummary
+	Failed int `json:"failed"`
+	// Errors are the messages of the failed operations
+	Errors []string `json:"errors,omitempty"`
+}
+
+// newRunStatus describes a finished run by its report and error
+func newRunStatus(report *Report, trigger Trigger, startedAt time.Time, err error) RunStatus {
+	status := RunStatus{
+		RunID:      report.RunID,
+		State:      RunSucceeded,
+		Trigger:    trigger,
+		DryRun:     report.DryRun,
+		Commit:     report.Commit,
+		StartedAt:  startedAt,
+		FinishedAt: startedAt.Add(report.Duration),
+	}
+	if err != nil {
+		status.State = RunFailed
+		status.Error = err.Error()
+	}
+	for _, section := range report.Sections {
+		summary := SectionSummary{Section: section.Section, Bucket: section.Plan.Bucket, PlanSummary: section.Plan.Summary}
+		for _, item := range section.Plan.Items {
+			if item.Error != "" {
+				summary.Failed++
+				summary.Errors = append(summary.Errors, item.Key+": "+item.Error)
+			}
+		}
+		status.Sections = append(status.Sections, summary)
+	}
+	return status
+}
+
+// EventType is the type of a run progress event.
+type EventType string
+
+const (
+	// EventStarted is sent when a run starts
+	EventStarted EventType = "started"
+	// EventPlanned is sent when the plan of a section is computed
+	EventPlanned EventType = "planned"
+	// EventApplied is sent for every uploaded or removed object
+	EventApplied EventType = "applied"
+	// EventFinished is the last event of a run and carries its status
+	EventFinished EventType = "finished"
+)
+
+// Event is a progress event of a run.
+type Event struct {
+	RunID   string    `json:"run_id"`
+	Type    EventType `json:"type"`
+	Time    time.Time `json:"time"`
+	Section string    `json:"section,omitempty"`
+	// Key, Action and Error describe the applied object
+	Key    string `json:"key,omitempty"`
+	Action string `json:"action,omitempty"`
+	Error  string `json:"error,omitempty"`
+	// Done and Total count the applied and planned changes of the section
+	Done  int `json:"done,omitempty"`
+	Total int `json:"total,omitempty"`
+	// Status is set on EventFinished
+	Status *RunStatus `json:"status,omitempty"`
+}
+
+// StatusReporter receives the final status of every run, for example to
+// forward it to an orchestrator.
+type StatusReporter interface {
+	ReportRun(ctx context.Context, status RunStatus) error
+}
+
+// EventPublisher receives the report and final status of every run that
+// is not a dry run, for example to publish the changed posts to Kafka.
+type EventPublisher interface {
+	PublishRun(ctx context.Context, report *Report, status RunStatus) error
+}
@@ -0,0 +1,488 @@
+// Package blog reads the posts synchronized to MinIO for the blog API.
+//
+// A section bucket holds one folder per post, laid out like the vault with
+// the post folders and notes named after the post slugs:
+//
+//	<slug>/<slug>.md
+//	<slug>/<slug>.html
+//	<slug>/<slug>.json
+//	<slug>/Resources/<files>
+//	<slug>/Variants/<resource>/<width>w.<ext>
+//	redirects.json
+//
+// The HTML is the note rendered and sanitized by the sync, the JSON its
+// table of contents, reading time and excerpt. The variants are the image
+// resources resized by the sync. redirects.json maps the former slugs of
+// renamed posts to their current slug.
+// Drafts and notes with publish: false are not part of the blog.
+package blog
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/savabush/obsidian-sync/internal/config"
+	"github.com/savabush/obsidian-sync/internal/database/minio"
+	"github.com/savabush/obsidian-sync/internal/markdown"
+	obsidian "github.com/savabush/obsidian-sync/internal/services"
+)
+
+// ErrNotFound is returned for a post or resource that does not exist or is not published
+var ErrNotFound = errors.New("not found")
+
+// Source reads the objects of a section bucket, implemented by *minio.Repository
+type Source interface {
+	ListObjectsContext(ctx context.Context, prefix string, withMetadata bool) ([]minio.Object, error)
+	ReadObject(ctx context.Context, key string) ([]byte, minio.Object, error)
+	OpenObject(ctx context.Context, key string) (io.ReadCloser, minio.Object, error)
+	StatObject(ctx context.Context, key string) (minio.Object, error)
+	BucketExists() (bool, error)
+}
+
+// Post is a published post of a section.
+type Post struct {
+	// ID is the post slug
+	ID       string
+	Title    string
+	Summary  string
+	Language string
+	Tags     []string
+	// CreatedAt and UpdatedAt are the frontmatter dates, else the dates of
+	// the vault history attached by the sync, else the time the note was
+	// last synchronized
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	// Cover is the name of the resource shown as the post image, empty when there is none
+	Cover string
+	// Content is the markdown body of the note
+	Content string
+	// HTML is the body rendered by the sync, only read by Get and empty
+	// when the sync did not render the note
+	HTML string
+	// TOC is the table of contents of the HTML, only read by Get
+	TOC []markdown.Heading
+	// Excerpt is the summary, else the text of the first paragraph
+	Excerpt   string
+	WordCount int
+	// ReadingTime is in minutes
+	ReadingTime int
+	// Metadata holds all frontmatter fields
+	Metadata map[string]interface{}
+	// Resources are the files of the post's Resources folder
+	Resources []Resource
+}
+
+// Resource is a file of a post's Resources folder.
+type Resource struct {
+	// Name is the path inside the Resources folder
+	Name        string
+	Size        int64
+	ContentType string
+	// Width and Height are the size of an image in pixels, 0 for other files
+	Width  int
+	Height int
+	// Variants are the resized copies of an image, ordered by width
+	Variants []Variant
+}
+
+// Variant is an image resource resized by the sync.
+type Variant struct {
+	// Name is the path inside the Variants folder, <resource>/<width>w.<ext>
+	Name        string
+	Size        int64
+	ContentType string
+	Width       int
+	Height      int
+}
+
+// Collection reads the posts of one section bucket. Parsed notes are
+// cached by their ETag, so listing only downloads notes that changed.
+type Collection struct {
+	bucket string
+	source Source
+	logger config.LoggerInterface
+	// catalog selects the posts of listings, nil to list the bucket
+	catalog Catalog
+
+	mu    sync.Mutex
+	notes map[string]cachedNote
+}
+
+// cachedNote is a parsed note and the ETag of the object it was read
+// from. A note that cannot be parsed is cached as nil.
+type cachedNote struct {
+	etag string
+	note *obsidian.Note
+}
+
+// postObjects are the objects of a post folder
+type postObjects struct {
+	note      *minio.Object
+	resources []minio.Object
+	variants  []minio.Object
+}
+
+// NewCollection creates a collection of the posts stored in bucket.
+func NewCollection(bucket string, source Source, logger config.LoggerInterface) *Collection {
+	return &Collection{
+		bucket: bucket,
+		source: source,
+		logger: config.ForPackage(logger, "blog").WithField("bucket", bucket),
+		notes:  make(map[string]cachedNote),
+	}
+}
+
+// Bucket returns the name of the section bucket
+func (c *Collection) Bucket() string {
+	return c.bucket
+}
+
+// List returns the published posts, newest first.
+func (c *Collection) List(ctx context.Context) ([]Post, error) {
+	page, err := c.Query(ctx, ListOptions{})
+	return page.Posts, err
+}
+
+// Get returns a published post by its ID.
+func (c *Collection) Get(ctx context.Context, id string) (Post, error) {
+	if !validID(id) {
+		return Post{}, ErrNotFound
+	}
+	posts, err := c.read(ctx, id+"/")
+	if err != nil {
+		return Post{}, err
+	}
+	for _, post := range posts {
+		if post.ID == id {
+			if post.HTML, err = c.html(ctx, id); err != nil {
+				return post, err
+			}
+			post.TOC, err = c.toc(ctx, id)
+			return post, err
+		}
+	}
+	return Post{}, ErrNotFound
+}
+
+// html reads the rendered HTML of a post, empty when there is none
+func (c *Collection) html(ctx context.Context, id string) (string, error) {
+	data, _, err := c.source.ReadObject(ctx, obsidian.HTMLKey(id))
+	if errors.Is(err, minio.ErrObjectNotFound) {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// toc reads the table of contents of a post from its info, empty when the
+// sync did not store it
+func (c *Collection) toc(ctx context.Context, id string) ([]markdown.Heading, error) {
+	data, _, err := c.source.ReadObject(ctx, obsidian.InfoKey(id))
+	if errors.Is(err, minio.ErrObjectNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var info obsidian.PostInfo
+	if err := json.Unmarshal(data, &info); err != nil {
+		config.ContextLogger(c.logger, ctx).WithField("object", obsidian.InfoKey(id)).
+			Warnf("Skipping the info of post %s: %v", id, err)
+		return nil, nil
+	}
+	return info.TOC, nil
+}
+
+// Redirect returns the current ID of a post that was published under
+// another ID before it was renamed, ErrNotFound when id never was one.
+func (c *Collection) Redirect(ctx context.Context, id string) (string, error) {
+	if !validID(id) {
+		return "", ErrNotFound
+	}
+	data, _, err := c.source.ReadObject(ctx, obsidian.RedirectsKey)
+	if errors.Is(err, minio.ErrObjectNotFound) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	var slugs obsidian.Slugs
+	if err := json.Unmarshal(data, &slugs); err != nil {
+		config.ContextLogger(c.logger, ctx).WithField("object", obsidian.RedirectsKey).
+			Warnf("Skipping the redirects: %v", err)
+		return "", ErrNotFound
+	}
+	if to, ok := slugs.Redirects[id]; ok {
+		return to, nil
+	}
+	return "", ErrNotFound
+}
+
+// OpenResource opens a resource of a published post. The object is opened
+// directly, without listing the post folder. The caller closes the
+// returned reader.
+func (c *Collection) OpenResource(ctx context.Context, id, name string) (io.ReadCloser, minio.Object, error) {
+	if !validName(name) {
+		return nil, minio.Object{}, ErrNotFound
+	}
+	if err := c.published(ctx, id); err != nil {
+		return nil, minio.Object{}, err
+	}
+	return c.open(ctx, path.Join(id, obsidian.ResourcesDir, name))
+}
+
+// OpenVariant opens a resized image resource of a published post. Variants
+// left behind by a removed resource are not served. The caller closes the
+// returned reader.
+func (c *Collection) OpenVariant(ctx context.Context, id, name string) (io.ReadCloser, minio.Object, error) {
+	if !validName(name) || path.Dir(name) == "." {
+		return nil, minio.Object{}, ErrNotFound
+	}
+	if err := c.published(ctx, id); err != nil {
+		return nil, minio.Object{}, err
+	}
+	if _, err := c.stat(ctx, path.Join(id, obsidian.ResourcesDir, path.Dir(name))); err != nil {
+		return nil, minio.Object{}, err
+	}
+	return c.open(ctx, path.Join(id, obsidian.VariantsDir, name))
+}
+
+// published returns ErrNotFound unless id is a published post. Its note
+// is only read when it changed since it was cached.
+func (c *Collection) published(ctx context.Context, id string) error {
+	if !validID(id) {
+		return ErrNotFound
+	}
+	object, err := c.stat(ctx, path.Join(id, id+".md"))
+	if err != nil {
+		return err
+	}
+	note, err := c.note(ctx, object)
+	if errors.Is(err, minio.ErrObjectNotFound) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	if note == nil || note.Draft || !note.Publish {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// stat returns the information of an object of the bucket
+func (c *Collection) stat(ctx context.Context, key string) (minio.Object, error) {
+	object, err := c.source.StatObject(ctx, key)
+	if errors.Is(err, minio.ErrObjectNotFound) {
+		return minio.Object{}, ErrNotFound
+	}
+	return object, err
+}
+
+// open opens an object of the bucket
+func (c *Collection) open(ctx context.Context, key string) (io.ReadCloser, minio.Object, error) {
+	reader, object, err := c.source.OpenObject(ctx, key)
+	if errors.Is(err, minio.ErrObjectNotFound) {
+		return nil, minio.Object{}, ErrNotFound
+	}
+	return reader, object, err
+}
+
+// Ping checks that the section bucket exists
+func (c *Collection) Ping() error {
+	exists, err := c.source.BucketExists()
+	if err != nil {
+		return fmt.Errorf("failed to check bucket %s: %w", c.bucket, err)
+	}
+	if !exists {
+		return fmt.Errorf("bucket %s does not exist", c.bucket)
+	}
+	return nil
+}
+
+// read returns the published posts of the folders under prefix
+func (c *Collection) read(ctx context.Context, prefix string) ([]Post, error) {
+	objects, err := c.source.ListObjectsContext(ctx, prefix, true)
+	if err != nil {
+		return nil, err
+	}
+
+	folders := make(map[string]*postObjects)
+	for i, object := range objects {
+		id, rest, ok := strings.Cut(object.Key, "/")
+		if !ok {
+			continue
+		}
+		folder := folders[id]
+		if folder == nil {
+			folder = &postObjects{}
+			folders[id] = folder
+		}
+		switch {
+		case rest == id+".md":
+			folder.note = &objects[i]
+		case strings.HasPrefix(rest, obsidian.ResourcesDir+"/"):
+			folder.resources = append(folder.resources, object)
+		case strings.HasPrefix(rest, obsidian.VariantsDir+"/"):
+			folder.variants = append(folder.variants, object)
+		}
+	}
+
+	var posts []Post
+	seen := make(map[string]bool)
+	for id, folder := range folders {
+		if folder.note == nil {
+			continue
+		}
+		seen[folder.note.Key] = true
+		note, err := c.note(ctx, *folder.note)
+		if errors.Is(err, minio.ErrObjectNotFound) {
+			// Removed by a sync since it was listed
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if note == nil || note.Draft || !note.Publish {
+			continue
+		}
+		posts = append(posts, newPost(id, *note, *folder))
+	}
+	if prefix == "" {
+		c.prune(seen)
+	}
+	return posts, nil
+}
+
+// note returns the parsed note of an object, reading it when it changed
+// since it was cached. A note that cannot be parsed is logged once and nil.
+func (c *Collection) note(ctx context.Context, object minio.Object) (*obsidian.Note, error) {
+	c.mu.Lock()
+	cached, ok := c.notes[object.Key]
+	c.mu.Unlock()
+	if ok && cached.etag == object.ETag {
+		return cached.note, nil
+	}
+
+	data, read, err := c.source.ReadObject(ctx, object.Key)
+	if err != nil {
+		return nil, err
+	}
+	cached = cachedNote{etag: read.ETag}
+	if note, err := obsidian.ParseNote(data); err != nil {
+		config.ContextLogger(c.logger, ctx).WithField("object", object.Key).
+			Warnf("Skipping post %s: %v", object.Key, err)
+	} else {
+		cached.note = &note
+	}
+	c.mu.Lock()
+	c.notes[object.Key] = cached
+	c.mu.Unlock()
+	return cached.note, nil
+}
+
+// prune drops the cached notes that are no longer in the bucket
+func (c *Collection) prune(keys map[string]bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for key := range c.notes {
+		if !keys[key] {
+			delete(c.notes, key)
+		}
+	}
+}
+
+// newPost builds a post from its note and the objects of its folder
+func newPost(id string, note obsidian.Note, folder postObjects) Post {
+	object := *folder.note
+	post := Post{
+		ID:        id,
+		Title:     note.Title,
+		Summary:   note.Summary,
+		Language:  note.Language,
+		Tags:      note.Tags,
+		CreatedAt: note.Created,
+		UpdatedAt: note.Updated,
+		Content:   note.Body,
+		Metadata:  note.Frontmatter,
+		// Computed like the info stored by the sync, so listings need not read it
+		Excerpt:     note.Excerpt(),
+		WordCount:   note.WordCount(),
+		ReadingTime: note.ReadingTime(),
+	}
+	if post.Title == "" {
+		post.Title = id
+	}
+	if post.CreatedAt.IsZero() {
+		post.CreatedAt = objectDate(object, minio.MetaNoteCreated)
+	}
+	if post.UpdatedAt.IsZero() {
+		post.UpdatedAt = objectDate(object, minio.MetaNoteUpdated)
+	}
+
+	variants := make(map[string][]Variant)
+	for _, object := range folder.variants {
+		name := strings.TrimPrefix(object.Key, id+"/"+obsidian.VariantsDir+"/")
+		width, height := objectSize(object)
+		variants[path.Dir(name)] = append(variants[path.Dir(name)], Variant{
+			Name:        name,
+			Size:        object.Size,
+			ContentType: object.ContentType,
+			Width:       width,
+			Height:      height,
+		})
+	}
+	for _, object := range folder.resources {
+		name := strings.TrimPrefix(object.Key, id+"/"+obsidian.ResourcesDir+"/")
+		resource := Resource{Name: name, Size: object.Size, ContentType: object.ContentType, Variants: variants[name]}
+		resource.Width, resource.Height = objectSize(object)
+		sort.Slice(resource.Variants, func(i, j int) bool { return resource.Variants[i].Width < resource.Variants[j].Width })
+		post.Resources = append(post.Resources, resource)
+	}
+	sort.Slice(post.Resources, func(i, j int) bool { return post.Resources[i].Name < post.Resources[j].Name })
+	names := make([]string, 0, len(post.Resources))
+	for _, resource := range post.Resources {
+		names = append(names, resource.Name)
+	}
+	post.Cover = obsidian.CoverResource(note.Cover, names)
+	return post
+}
+
+// objectDate returns the date the sync attached to a note object as the
+// metadata name, else the time the object was written
+func objectDate(object minio.Object, name string) time.Time {
+	if date, err := time.Parse(time.RFC3339, object.MetadataValue(name)); err == nil {
+		return date
+	}
+	return object.LastModified
+}
+
+// objectSize returns the image size the sync attached to an object, 0 when
+// it is not an image
+func objectSize(object minio.Object) (int, int) {
+	width, _ := strconv.Atoi(object.MetadataValue(minio.MetaImageWidth))
+	height, _ := strconv.Atoi(object.MetadataValue(minio.MetaImageHeight))
+	return width, height
+}
+
+// validID reports whether id can be a post slug
+func validID(id string) bool {
+	return id != "" && id != "." && id != ".." && !strings.Contains(id, "/")
+}
+
+// validName reports whether name is a path inside a post folder
+func validName(name string) bool {
+	return name != "" && name != "." && name == path.Clean(name) && !path.IsAbs(name) &&
+		name != ".." && !strings.HasPrefix(name, "../")
+}
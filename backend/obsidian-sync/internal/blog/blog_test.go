@@ -0,0 +1,434 @@
+package blog
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/savabush/obsidian-sync/internal/database/minio"
+	"github.com/savabush/obsidian-sync/internal/database/postgres"
+	"github.com/savabush/obsidian-sync/internal/lib"
+	"github.com/savabush/obsidian-sync/internal/markdown"
+)
+
+// fakeSource is an in-memory section bucket counting note reads
+type fakeSource struct {
+	objects  map[string]string
+	metadata map[string]map[string]string
+	modified time.Time
+	reads    int
+	// prefixes are the listed prefixes
+	prefixes []string
+}
+
+func newFakeSource(objects map[string]string) *fakeSource {
+	return &fakeSource{objects: objects, modified: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (s *fakeSource) object(key string) minio.Object {
+	sum := md5.Sum([]byte(s.objects[key]))
+	return minio.Object{Key: key, Size: int64(len(s.objects[key])), ETag: hex.EncodeToString(sum[:]), LastModified: s.modified,
+		Metadata: s.metadata[key]}
+}
+
+func (s *fakeSource) ListObjectsContext(ctx context.Context, prefix string, withMetadata bool) ([]minio.Object, error) {
+	s.prefixes = append(s.prefixes, prefix)
+	var objects []minio.Object
+	for key := range s.objects {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, s.object(key))
+		}
+	}
+	return objects, nil
+}
+
+func (s *fakeSource) ReadObject(ctx context.Context, key string) ([]byte, minio.Object, error) {
+	content, ok := s.objects[key]
+	if !ok {
+		return nil, minio.Object{}, minio.ErrObjectNotFound
+	}
+	s.reads++
+	return []byte(content), s.object(key), nil
+}
+
+func (s *fakeSource) OpenObject(ctx context.Context, key string) (io.ReadCloser, minio.Object, error) {
+	content, ok := s.objects[key]
+	if !ok {
+		return nil, minio.Object{}, minio.ErrObjectNotFound
+	}
+	return io.NopCloser(bytes.NewReader([]byte(content))), s.object(key), nil
+}
+
+func (s *fakeSource) StatObject(ctx context.Context, key string) (minio.Object, error) {
+	if _, ok := s.objects[key]; !ok {
+		return minio.Object{}, minio.ErrObjectNotFound
+	}
+	return s.object(key), nil
+}
+
+func (s *fakeSource) BucketExists() (bool, error) {
+	return true, nil
+}
+
+func TestList(t *testing.T) {
+	ctx := context.Background()
+	source := newFakeSource(map[string]string{
+		"Old/Old.md":                "---\ncreated: 2024-01-01\n---\n# Old post",
+		"New/New.md":                "---\ntitle: New post\ncreated: 2024-05-01\nsummary: What is new\ncover: \"[[cover.png]]\"\n---\nBody",
+		"New/Resources/cover.png":   "png",
+		"New/Resources/diagram.svg": "svg",
+		"Synced/Synced.md":          "No frontmatter",
+		"History/History.md":        "Dated by the vault history",
+		"Draft/Draft.md":            "---\ndraft: true\n---\n",
+		"Hidden/Hidden.md":          "---\npublish: false\n---\n",
+		"Broken/Broken.md":          "---\ncreated: yesterday\n---\n",
+		"Folder/notes.txt":          "not a post",
+	})
+	source.metadata = map[string]map[string]string{"History/History.md": {
+		"X-Amz-Meta-Note-Created": "2024-03-01T00:00:00Z",
+		"X-Amz-Meta-Note-Updated": "2024-04-01T00:00:00Z",
+	}}
+	c := NewCollection("blog", source, lib.TestLog)
+
+	posts, err := c.List(ctx)
+	require.NoError(t, err)
+	var ids []string
+	for _, post := range posts {
+		ids = append(ids, post.ID)
+	}
+	assert.Equal(t, []string{"Synced", "New", "History", "Old"}, ids, "published posts, newest first")
+	assert.Equal(t, time.Date(2024, 4, 1, 0, 0, 0, 0, time.UTC), posts[2].UpdatedAt, "the history dates come before the sync time")
+
+	synced := posts[0]
+	assert.Equal(t, "Synced", synced.Title, "the folder name is the fallback title")
+	assert.Equal(t, source.modified, synced.CreatedAt, "the sync time is the fallback date")
+
+	post := posts[1]
+	assert.Equal(t, "New post", post.Title)
+	assert.Equal(t, "What is new", post.Summary)
+	assert.Equal(t, "cover.png", post.Cover)
+	assert.Equal(t, "Body", post.Content)
+	assert.Equal(t, []Resource{{Name: "cover.png", Size: 3}, {Name: "diagram.svg", Size: 3}}, post.Resources)
+	assert.Equal(t, "Old post", posts[3].Title)
+
+	// Unchanged notes are not read again
+	reads := source.reads
+	_, err = c.List(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, reads, source.reads)
+	source.objects["Old/Old.md"] += "\nEdited"
+	posts, err = c.List(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, reads+1, source.reads)
+	assert.Contains(t, posts[3].Content, "Edited")
+}
+
+func TestQuery(t *testing.T) {
+	ctx := context.Background()
+	source := newFakeSource(map[string]string{
+		"A/A.md": "---\ntitle: beta\ntags: [Go]\nlang: en-US\ncreated: 2024-01-01\nupdated: 2024-06-01\n---\n",
+		"B/B.md": "---\ntitle: Alpha\ntags: [go, k8s]\nlang: en\ncreated: 2024-02-01\nupdated: 2024-02-01\n---\n",
+		"C/C.md": "---\ntitle: Гамма\nlang: ru\ncreated: 2024-03-01\nupdated: 2024-03-01\n---\n",
+		"D/D.md": "---\ntitle: Delta\ntags: [go]\nlang: en\ncreated: 2024-03-01\nupdated: 2024-03-01\n---\n",
+	})
+	c := NewCollection("blog", source, lib.TestLog)
+	ids := func(opts ListOptions) ([]string, string) {
+		page, err := c.Query(ctx, opts)
+		require.NoError(t, err)
+		ids := []string{}
+		for _, post := range page.Posts {
+			ids = append(ids, post.ID)
+		}
+		return ids, page.NextCursor
+	}
+
+	got, next := ids(ListOptions{})
+	assert.Equal(t, []string{"C", "D", "B", "A"}, got, "newest first, then by ID")
+	assert.Empty(t, next)
+	got, _ = ids(ListOptions{Sort: SortCreated, Order: OrderAsc})
+	assert.Equal(t, []string{"A", "B", "C", "D"}, got)
+	got, _ = ids(ListOptions{Sort: SortUpdated})
+	assert.Equal(t, []string{"A", "C", "D", "B"}, got)
+	got, _ = ids(ListOptions{Sort: SortTitle, Order: OrderAsc})
+	assert.Equal(t, []string{"B", "A", "D", "C"}, got, "titles compare case-insensitively")
+	got, _ = ids(ListOptions{Tag: "#GO", Language: "en"})
+	assert.Equal(t, []string{"D", "B", "A"}, got)
+	got, _ = ids(ListOptions{Language: "ru"})
+	assert.Equal(t, []string{"C"}, got)
+
+	// Pages continue after the cursor, even when posts are added meanwhile
+	got, next = ids(ListOptions{Sort: SortTitle, Limit: 2})
+	assert.Equal(t, []string{"C", "D"}, got)
+	require.NotEmpty(t, next)
+	source.objects["E/E.md"] = "---\ntitle: Zeta\n---\n"
+	got, last := ids(ListOptions{Sort: SortTitle, Limit: 2, Cursor: next})
+	assert.Equal(t, []string{"A", "B"}, got)
+	assert.Empty(t, last, "B is the last post")
+
+	for _, opts := range []ListOptions{
+		{Sort: "size"},
+		{Order: "up"},
+		{Limit: -1},
+		{Cursor: "not a cursor"},
+		{Sort: SortCreated, Cursor: next},
+	} {
+		_, err := c.Query(ctx, opts)
+		assert.ErrorIs(t, err, ErrInvalidQuery, "%+v", opts)
+	}
+}
+
+// fakeCatalog returns its posts, recording the last query
+type fakeCatalog struct {
+	posts []postgres.Post
+	err   error
+	query postgres.PostQuery
+}
+
+func (f *fakeCatalog) QueryPosts(ctx context.Context, q postgres.PostQuery) ([]postgres.Post, error) {
+	f.query = q
+	return f.posts, f.err
+}
+
+func TestQueryCatalog(t *testing.T) {
+	ctx := context.Background()
+	source := newFakeSource(map[string]string{
+		"A/A.md": "---\ntitle: Alpha\ncreated: 2024-01-01\n---\n",
+		"B/B.md": "---\ntitle: Beta\ncreated: 2024-02-01\n---\n",
+		"C/C.md": "---\ntitle: Gamma\ncreated: 2024-03-01\n---\n",
+	})
+	c := NewCollection("blog", source, lib.TestLog)
+	created := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	catalog := &fakeCatalog{posts: []postgres.Post{
+		{Slug: "C", Title: "Gamma", CreatedAt: &created},
+		{Slug: "Removed", Title: "Removed"},
+		{Slug: "B", Title: "Beta"},
+	}}
+	c.SetCatalog(catalog)
+
+	page, err := c.Query(ctx, ListOptions{Tag: "#go", Language: "en", Limit: 2})
+	require.NoError(t, err)
+	assert.Equal(t, postgres.PostQuery{Bucket: "blog", Sort: SortCreated, Desc: true, Tag: "go", Language: "en",
+		Limit: 3}, catalog.query, "one more post tells whether another page follows")
+	require.Len(t, page.Posts, 1, "posts missing from the bucket are left out")
+	assert.Equal(t, "Gamma", page.Posts[0].Title)
+	assert.Equal(t, []string{"C/", "Removed/"}, source.prefixes, "only the folders of the page are read")
+	require.NotEmpty(t, page.NextCursor)
+
+	catalog.posts = catalog.posts[2:]
+	page, err = c.Query(ctx, ListOptions{Limit: 2, Cursor: page.NextCursor})
+	require.NoError(t, err)
+	assert.Equal(t, &postgres.PostKey{Slug: "Removed"}, catalog.query.After)
+	require.Len(t, page.Posts, 1)
+	assert.Equal(t, "B", page.Posts[0].ID)
+	assert.Empty(t, page.NextCursor)
+
+	// Unlimited listings and failed catalog queries list the bucket
+	source.prefixes = nil
+	catalog.err = errors.New("connection refused")
+	page, err = c.Query(ctx, ListOptions{Limit: 10})
+	require.NoError(t, err)
+	assert.Len(t, page.Posts, 3)
+	page, err = c.Query(ctx, ListOptions{})
+	require.NoError(t, err)
+	assert.Len(t, page.Posts, 3)
+	assert.Equal(t, []string{"", ""}, source.prefixes)
+}
+
+func TestGet(t *testing.T) {
+	ctx := context.Background()
+	source := newFakeSource(map[string]string{
+		"Post/Post.md":              "# Post\n\nFirst paragraph",
+		"Post/Post.html":            "<h1 id=\"post\">Post</h1>\n<p>First paragraph</p>\n",
+		"Post/Post.json":            `{"toc":[{"level":1,"text":"Post","id":"post"}],"word_count":3,"reading_time":1}`,
+		"Post/Resources/image.jpg":  "jpg",
+		"Post 2/Post 2.md":          "# Post 2",
+		"Draft/Draft.md":            "---\ndraft: true\n---\n",
+		"Draft/Resources/image.jpg": "jpg",
+	})
+	c := NewCollection("blog", source, lib.TestLog)
+
+	post, err := c.Get(ctx, "Post")
+	require.NoError(t, err)
+	assert.Equal(t, "Post", post.Title)
+	assert.Equal(t, "image.jpg", post.Cover, "the first image is the fallback cover")
+	assert.Equal(t, "<h1 id=\"post\">Post</h1>\n<p>First paragraph</p>\n", post.HTML)
+	assert.Equal(t, []markdown.Heading{{Level: 1, Text: "Post", ID: "post"}}, post.TOC)
+	assert.Equal(t, "First paragraph", post.Excerpt)
+	assert.Equal(t, 3, post.WordCount)
+	assert.Equal(t, 1, post.ReadingTime)
+	post, err = c.Get(ctx, "Post 2")
+	require.NoError(t, err)
+	assert.Empty(t, post.HTML, "notes synced before rendering have no HTML")
+	assert.Empty(t, post.TOC)
+
+	for _, id := range []string{"Missing", "Draft", "..", "Post/Resources"} {
+		_, err = c.Get(ctx, id)
+		assert.ErrorIs(t, err, ErrNotFound, id)
+	}
+
+	reader, object, err := c.OpenResource(ctx, "Post", "image.jpg")
+	require.NoError(t, err)
+	data, _ := io.ReadAll(reader)
+	reader.Close()
+	assert.Equal(t, "jpg", string(data))
+	assert.Equal(t, "Post/Resources/image.jpg", object.Key)
+
+	_, _, err = c.OpenResource(ctx, "Draft", "image.jpg")
+	assert.ErrorIs(t, err, ErrNotFound, "resources of drafts are not served")
+	_, _, err = c.OpenResource(ctx, "Post", "../Post.md")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, _, err = c.OpenResource(ctx, "Post", "missing.jpg")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestOpenResourceReadsNoteOnce(t *testing.T) {
+	ctx := context.Background()
+	source := newFakeSource(map[string]string{
+		"Post/Post.md":              "# Post",
+		"Post/Post.html":            "<h1>Post</h1>",
+		"Post/Post.json":            `{"toc":[]}`,
+		"Post/Resources/image.jpg":  "jpg",
+		"Draft/Draft.md":            "---\ndraft: true\n---\n",
+		"Draft/Resources/image.jpg": "jpg",
+	})
+	c := NewCollection("blog", source, lib.TestLog)
+
+	for i := 0; i < 3; i++ {
+		reader, _, err := c.OpenResource(ctx, "Post", "image.jpg")
+		require.NoError(t, err)
+		reader.Close()
+	}
+	assert.Equal(t, 1, source.reads, "only the note is read, once")
+
+	source.objects["Post/Post.md"] = "---\npublish: false\n---\n# Post"
+	_, _, err := c.OpenResource(ctx, "Post", "image.jpg")
+	assert.ErrorIs(t, err, ErrNotFound, "a changed note is read again")
+	_, _, err = c.OpenResource(ctx, "Draft", "image.jpg")
+	assert.ErrorIs(t, err, ErrNotFound)
+	_, _, err = c.OpenResource(ctx, "Missing", "image.jpg")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestVariants(t *testing.T) {
+	ctx := context.Background()
+	source := newFakeSource(map[string]string{
+		"post/post.md":                       "# Post",
+		"post/Resources/photo.jpg":           "original",
+		"post/Resources/notes.pdf":           "pdf",
+		"post/Variants/photo.jpg/960w.jpg":   "960",
+		"post/Variants/photo.jpg/480w.jpg":   "480",
+		"post/Variants/removed.jpg/480w.jpg": "480",
+	})
+	size := func(width, height string) map[string]string {
+		return map[string]string{"X-Amz-Meta-Image-Width": width, "X-Amz-Meta-Image-Height": height}
+	}
+	source.metadata = map[string]map[string]string{
+		"post/Resources/photo.jpg":         size("1200", "800"),
+		"post/Variants/photo.jpg/960w.jpg": size("960", "640"),
+		"post/Variants/photo.jpg/480w.jpg": size("480", "320"),
+	}
+	c := NewCollection("blog", source, lib.TestLog)
+
+	post, err := c.Get(ctx, "post")
+	require.NoError(t, err)
+	assert.Equal(t, []Resource{
+		{Name: "notes.pdf", Size: 3},
+		{Name: "photo.jpg", Size: 8, Width: 1200, Height: 800, Variants: []Variant{
+			{Name: "photo.jpg/480w.jpg", Size: 3, Width: 480, Height: 320},
+			{Name: "photo.jpg/960w.jpg", Size: 3, Width: 960, Height: 640},
+		}},
+	}, post.Resources, "the variants are listed with their image")
+
+	reader, object, err := c.OpenVariant(ctx, "post", "photo.jpg/480w.jpg")
+	require.NoError(t, err)
+	reader.Close()
+	assert.Equal(t, "post/Variants/photo.jpg/480w.jpg", object.Key)
+	_, _, err = c.OpenVariant(ctx, "post", "removed.jpg/480w.jpg")
+	assert.ErrorIs(t, err, ErrNotFound, "variants of removed resources are not served")
+	_, _, err = c.OpenResource(ctx, "post", "../Variants/photo.jpg/480w.jpg")
+	assert.ErrorIs(t, err, ErrNotFound)
+}
+
+func TestRedirect(t *testing.T) {
+	ctx := context.Background()
+	source := newFakeSource(map[string]string{
+		"post/post.md":   "# Post",
+		"redirects.json": `{"posts":{"Post":"post"},"redirects":{"Post":"post"}}`,
+	})
+	c := NewCollection("blog", source, lib.TestLog)
+
+	to, err := c.Redirect(ctx, "Post")
+	require.NoError(t, err)
+	assert.Equal(t, "post", to)
+	for _, id := range []string{"post", "Missing", ".."} {
+		_, err = c.Redirect(ctx, id)
+		assert.ErrorIs(t, err, ErrNotFound, id)
+	}
+	posts, err := c.List(ctx)
+	require.NoError(t, err)
+	assert.Len(t, posts, 1, "the redirects are not a post")
+
+	_, err = NewCollection("blog", newFakeSource(nil), lib.TestLog).Redirect(ctx, "Post")
+	assert.ErrorIs(t, err, ErrNotFound, "buckets synced before slugs have no redirects")
+}
+
+// fakeIndex returns hits and records the last query
+type fakeIndex struct {
+	query postgres.SearchQuery
+	hits  []postgres.SearchHit
+}
+
+func (f *fakeIndex) SearchPosts(ctx context.Context, q postgres.SearchQuery) (postgres.SearchResults, error) {
+	f.query = q
+	return postgres.SearchResults{Hits: f.hits, Total: 21}, nil
+}
+
+func TestSearch(t *testing.T) {
+	ctx := context.Background()
+	content := &Content{
+		Posts:    NewCollection("blog", newFakeSource(nil), lib.TestLog),
+		Articles: NewCollection("articles", newFakeSource(nil), lib.TestLog),
+	}
+	_, err := content.Search(ctx, SearchQuery{Text: "go"})
+	assert.ErrorIs(t, err, ErrNoIndex)
+
+	created := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	synced := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	index := &fakeIndex{hits: []postgres.SearchHit{
+		{Post: postgres.Post{Bucket: "articles", Slug: "Go", Title: "Go", CreatedAt: &created}, Snippet: "<mark>Go</mark>"},
+		{Post: postgres.Post{Bucket: "blog", Slug: "Undated", Title: "Undated", SyncedAt: synced}},
+	}}
+	content.SetIndex(index)
+
+	results, err := content.Search(ctx, SearchQuery{Text: "go", Language: "en", Page: 3, Limit: 100})
+	require.NoError(t, err)
+	assert.Equal(t, postgres.SearchQuery{Text: "go", Buckets: []string{"blog", "articles"}, Language: "en",
+		Limit: MaxSearchLimit, Offset: 2 * MaxSearchLimit}, index.query)
+	assert.Equal(t, 21, results.Total)
+	assert.Equal(t, 3, results.Page)
+	assert.Equal(t, MaxSearchLimit, results.Limit)
+	require.Len(t, results.Hits, 2)
+	assert.Equal(t, SearchHit{Section: ArticlesSection, ID: "Go", Title: "Go", CreatedAt: created,
+		Snippet: "<mark>Go</mark>"}, results.Hits[0])
+	assert.Equal(t, PostsSection, results.Hits[1].Section)
+	assert.Equal(t, synced, results.Hits[1].CreatedAt, "the sync time is the fallback date")
+
+	results, err = content.Search(ctx, SearchQuery{Text: "go", Section: ArticlesSection})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"articles"}, index.query.Buckets)
+	assert.Equal(t, 1, results.Page)
+	assert.Equal(t, DefaultSearchLimit, index.query.Limit)
+	assert.Zero(t, index.query.Offset)
+
+	_, err = content.Search(ctx, SearchQuery{Text: "go", Section: "notes"})
+	assert.EqualError(t, err, `unknown section "notes"`)
+}
@@ -0,0 +1,76 @@
+package blog
+
+import (
+	"github.com/savabush/obsidian-sync/internal/config"
+	"github.com/savabush/obsidian-sync/internal/database/minio"
+)
+
+// IDs of the pages in the pages bucket
+const (
+	IntroPage   = "intro"
+	AboutMePage = "about-me"
+)
+
+// Content holds the collections served by the blog API.
+type Content struct {
+	Posts    *Collection
+	Articles *Collection
+	// Pages holds the intro and about me pages
+	Pages *Collection
+
+	// index answers Search, nil when the blog has no search index
+	index SearchIndex
+}
+
+// New opens the collections of the blog and articles sections and of the
+// pages bucket on the configured MinIO.
+func New(cfg config.Config, logger config.LoggerInterface) (*Content, error) {
+	open := func(bucket string) (*Collection, error) {
+		repo, err := minio.NewRepository(minio.RepositoryConfig{
+			Endpoint:  cfg.Minio.ENDPOINT,
+			AccessKey: cfg.Minio.ACCESS_KEY,
+			SecretKey: cfg.Minio.SECRET_KEY,
+			UseSSL:    cfg.Minio.USE_SSL,
+			Bucket:    bucket,
+		}, logger)
+		if err != nil {
+			return nil, err
+		}
+		return NewCollection(bucket, repo, logger), nil
+	}
+
+	var content Content
+	var err error
+	if content.Posts, err = open(sectionBucket(cfg.Sections, config.Blog)); err != nil {
+		return nil, err
+	}
+	if content.Articles, err = open(sectionBucket(cfg.Sections, config.Articles)); err != nil {
+		return nil, err
+	}
+	if content.Pages, err = open(cfg.API.PAGES_BUCKET); err != nil {
+		return nil, err
+	}
+	return &content, nil
+}
+
+// SetCatalog sets the catalog the listings of the posts and articles are
+// selected from. The pages are always read from their bucket.
+func (c *Content) SetCatalog(catalog Catalog) {
+	c.Posts.SetCatalog(catalog)
+	c.Articles.SetCatalog(catalog)
+}
+
+// Collections returns all collections of the blog
+func (c *Content) Collections() []*Collection {
+	return []*Collection{c.Posts, c.Articles, c.Pages}
+}
+
+// sectionBucket returns the bucket a vault directory is synchronized to
+func sectionBucket(sections []config.SectionConfig, dir string) string {
+	for _, section := range sections {
+		if section.Dir == dir {
+			return section.Bucket
+		}
+	}
+	return config.BucketName(dir)
+}
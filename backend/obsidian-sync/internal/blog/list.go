@@ -0,0 +1,279 @@
+package blog
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/savabush/obsidian-sync/internal/config"
+	"github.com/savabush/obsidian-sync/internal/database/postgres"
+)
+
+// Sort keys of a listing
+const (
+	SortCreated = postgres.SortCreated
+	SortUpdated = postgres.SortUpdated
+	SortTitle   = postgres.SortTitle
+)
+
+// Sort orders of a listing
+const (
+	OrderAsc  = "asc"
+	OrderDesc = "desc"
+)
+
+// MaxListLimit caps the page size of a listing
+const MaxListLimit = 100
+
+// ErrInvalidQuery is wrapped by the errors of listing options that cannot be used
+var ErrInvalidQuery = errors.New("invalid query")
+
+// ListOptions sorts, filters and paginates a listing.
+type ListOptions struct {
+	// Sort is SortCreated, SortUpdated or SortTitle, SortCreated by default
+	Sort string
+	// Order is OrderAsc or OrderDesc, OrderDesc by default
+	Order string
+	// Tag keeps the posts with the tag, compared case-insensitively
+	Tag string
+	// Language keeps the posts of a language and its regional variants
+	Language string
+	// Cursor is the NextCursor of the previous page, empty for the first page
+	Cursor string
+	// Limit is the page size, zero returns all posts after the cursor. It is
+	// capped at MaxListLimit.
+	Limit int
+}
+
+// Page is a page of a listing.
+type Page struct {
+	Posts []Post
+	// NextCursor continues the listing, empty on the last page
+	NextCursor string
+}
+
+// cursor is the position of the last post of a page: its sort key and ID.
+// Listings continue after the position, so posts added or removed since
+// the previous page do not shift the following pages.
+type cursor struct {
+	Sort  string    `json:"s"`
+	Order string    `json:"o"`
+	Time  time.Time `json:"t,omitempty"`
+	Title string    `json:"n,omitempty"`
+	ID    string    `json:"id"`
+}
+
+// Catalog lists the published posts of a bucket, implemented by
+// *postgres.Repository
+type Catalog interface {
+	QueryPosts(ctx context.Context, q postgres.PostQuery) ([]postgres.Post, error)
+}
+
+// SetCatalog sets the catalog pages of listings are selected from.
+func (c *Collection) SetCatalog(catalog Catalog) {
+	c.catalog = catalog
+}
+
+// Query returns a page of the published posts matching opts.
+//
+// With a catalog, the posts of a page are selected from it and only their
+// folders are read from the bucket. Otherwise, and for listings without a
+// limit or when the catalog fails, the whole bucket is listed and the
+// posts are filtered, sorted and paginated in memory, which reads every
+// note that changed since it was cached.
+func (c *Collection) Query(ctx context.Context, opts ListOptions) (Page, error) {
+	opts, err := normalize(opts)
+	if err != nil {
+		return Page{}, err
+	}
+	var after *cursor
+	if opts.Cursor != "" {
+		if after, err = decodeCursor(opts.Cursor, opts); err != nil {
+			return Page{}, err
+		}
+	}
+
+	if c.catalog != nil && opts.Limit > 0 {
+		rows, err := c.catalog.QueryPosts(ctx, catalogQuery(c.bucket, opts, after))
+		if err == nil {
+			return c.catalogPage(ctx, rows, opts)
+		}
+		config.ContextLogger(c.logger, ctx).Warnf("Listing the bucket, the post catalog failed: %v", err)
+	}
+
+	posts, err := c.read(ctx, "")
+	if err != nil {
+		return Page{}, err
+	}
+	less := lessFunc(opts)
+	sort.Slice(posts, func(i, j int) bool { return less(posts[i], posts[j]) })
+
+	page := Page{Posts: []Post{}}
+	for _, post := range posts {
+		if !matches(post, opts) || (after != nil && !less(after.post(), post)) {
+			continue
+		}
+		if opts.Limit > 0 && len(page.Posts) == opts.Limit {
+			page.NextCursor = encodeCursor(page.Posts[len(page.Posts)-1], opts)
+			break
+		}
+		page.Posts = append(page.Posts, post)
+	}
+	return page, nil
+}
+
+// catalogQuery returns the catalog query of a page, one post longer to
+// tell whether another page follows
+func catalogQuery(bucket string, opts ListOptions, after *cursor) postgres.PostQuery {
+	q := postgres.PostQuery{
+		Bucket:   bucket,
+		Sort:     opts.Sort,
+		Desc:     opts.Order == OrderDesc,
+		Tag:      strings.TrimPrefix(opts.Tag, "#"),
+		Language: opts.Language,
+		Limit:    opts.Limit + 1,
+	}
+	if after != nil {
+		q.After = &postgres.PostKey{Time: after.Time, Title: after.Title, Slug: after.ID}
+	}
+	return q
+}
+
+// catalogPage reads the posts of the catalog rows of a page from the
+// bucket. Posts the catalog lists but the bucket no longer holds are left
+// out.
+func (c *Collection) catalogPage(ctx context.Context, rows []postgres.Post, opts ListOptions) (Page, error) {
+	page := Page{Posts: []Post{}}
+	if len(rows) > opts.Limit {
+		rows = rows[:opts.Limit]
+		key := rows[len(rows)-1].Key(opts.Sort)
+		page.NextCursor = encodeCursor(Post{ID: key.Slug, CreatedAt: key.Time, UpdatedAt: key.Time, Title: key.Title}, opts)
+	}
+	for _, row := range rows {
+		if !validID(row.Slug) {
+			continue
+		}
+		posts, err := c.read(ctx, row.Slug+"/")
+		if err != nil {
+			return Page{}, err
+		}
+		for _, post := range posts {
+			if post.ID == row.Slug {
+				page.Posts = append(page.Posts, post)
+			}
+		}
+	}
+	return page, nil
+}
+
+// normalize applies the defaults of opts and checks its values
+func normalize(opts ListOptions) (ListOptions, error) {
+	if opts.Sort == "" {
+		opts.Sort = SortCreated
+	}
+	if opts.Order == "" {
+		opts.Order = OrderDesc
+	}
+	switch opts.Sort {
+	case SortCreated, SortUpdated, SortTitle:
+	default:
+		return opts, fmt.Errorf("%w: sort must be created, updated or title", ErrInvalidQuery)
+	}
+	if opts.Order != OrderAsc && opts.Order != OrderDesc {
+		return opts, fmt.Errorf("%w: order must be asc or desc", ErrInvalidQuery)
+	}
+	if opts.Limit < 0 {
+		return opts, fmt.Errorf("%w: limit must not be negative", ErrInvalidQuery)
+	}
+	opts.Limit = min(opts.Limit, MaxListLimit)
+	return opts, nil
+}
+
+// lessFunc orders posts by the sort key of opts, then by ID
+func lessFunc(opts ListOptions) func(a, b Post) bool {
+	return func(a, b Post) bool {
+		var cmp int
+		switch opts.Sort {
+		case SortCreated:
+			cmp = a.CreatedAt.Compare(b.CreatedAt)
+		case SortUpdated:
+			cmp = a.UpdatedAt.Compare(b.UpdatedAt)
+		case SortTitle:
+			cmp = strings.Compare(strings.ToLower(a.Title), strings.ToLower(b.Title))
+		}
+		if opts.Order == OrderDesc {
+			cmp = -cmp
+		}
+		if cmp != 0 {
+			return cmp < 0
+		}
+		return a.ID < b.ID
+	}
+}
+
+// matches reports whether a post passes the filters of opts
+func matches(post Post, opts ListOptions) bool {
+	if opts.Tag != "" && !containsFold(post.Tags, strings.TrimPrefix(opts.Tag, "#")) {
+		return false
+	}
+	return opts.Language == "" || matchLanguage(post.Language, opts.Language)
+}
+
+// matchLanguage reports whether language is want or one of its regional
+// variants, en matches en-US
+func matchLanguage(language, want string) bool {
+	language, want = strings.ToLower(language), strings.ToLower(want)
+	return language == want || strings.HasPrefix(language, want+"-")
+}
+
+// containsFold reports whether values contains value, ignoring case
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// encodeCursor returns the cursor continuing after post
+func encodeCursor(post Post, opts ListOptions) string {
+	c := cursor{Sort: opts.Sort, Order: opts.Order, ID: post.ID}
+	switch opts.Sort {
+	case SortCreated:
+		c.Time = post.CreatedAt
+	case SortUpdated:
+		c.Time = post.UpdatedAt
+	case SortTitle:
+		c.Title = post.Title
+	}
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeCursor parses a cursor, which must come from a listing with the
+// same sort and order
+func decodeCursor(s string, opts ListOptions) (*cursor, error) {
+	var c cursor
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err == nil {
+		err = json.Unmarshal(data, &c)
+	}
+	if err != nil || c.ID == "" {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidQuery)
+	}
+	if c.Sort != opts.Sort || c.Order != opts.Order {
+		return nil, fmt.Errorf("%w: the cursor belongs to a listing with another sort order", ErrInvalidQuery)
+	}
+	return &c, nil
+}
+
+// post returns a post with the sort key and ID of the cursor
+func (c *cursor) post() Post {
+	return Post{ID: c.ID, CreatedAt: c.Time, UpdatedAt: c.Time, Title: c.Title}
+}
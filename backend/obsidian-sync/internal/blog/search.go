@@ -0,0 +1,129 @@
+package blog
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/savabush/obsidian-sync/internal/database/postgres"
+)
+
+// Sections of the blog that can be searched
+const (
+	PostsSection    = "posts"
+	ArticlesSection = "articles"
+)
+
+// Page sizes of search results
+const (
+	DefaultSearchLimit = 10
+	MaxSearchLimit     = 50
+)
+
+// ErrNoIndex is returned by Search when the blog has no search index
+var ErrNoIndex = errors.New("search is not available")
+
+// SearchIndex finds published posts by full-text queries, implemented by
+// *postgres.Repository
+type SearchIndex interface {
+	SearchPosts(ctx context.Context, q postgres.SearchQuery) (postgres.SearchResults, error)
+}
+
+// SearchQuery is a full-text query over the posts and articles.
+type SearchQuery struct {
+	Text string
+	// Section is PostsSection or ArticlesSection, empty searches both
+	Section string
+	// Language keeps the posts of a language and its regional variants
+	Language string
+	// Page starts at 1. Limit defaults to DefaultSearchLimit and is capped
+	// at MaxSearchLimit.
+	Page  int
+	Limit int
+}
+
+// SearchHit is a post matching a search query.
+type SearchHit struct {
+	Section   string
+	ID        string
+	Title     string
+	Language  string
+	Tags      []string
+	CreatedAt time.Time
+	Rank      float32
+	// Snippet is an HTML excerpt with the matched words in <mark> tags
+	Snippet string
+}
+
+// SearchResults are a page of search hits.
+type SearchResults struct {
+	Hits []SearchHit
+	// Total counts the hits of all pages
+	Total int
+	Page  int
+	Limit int
+}
+
+// SetIndex sets the index Search queries.
+func (c *Content) SetIndex(index SearchIndex) {
+	c.index = index
+}
+
+// Search returns a page of the published posts and articles matching q,
+// best matches first.
+func (c *Content) Search(ctx context.Context, q SearchQuery) (SearchResults, error) {
+	if c.index == nil {
+		return SearchResults{}, ErrNoIndex
+	}
+	sections := map[string]string{
+		c.Posts.Bucket():    PostsSection,
+		c.Articles.Bucket(): ArticlesSection,
+	}
+	var buckets []string
+	switch q.Section {
+	case "":
+		buckets = []string{c.Posts.Bucket(), c.Articles.Bucket()}
+	case PostsSection:
+		buckets = []string{c.Posts.Bucket()}
+	case ArticlesSection:
+		buckets = []string{c.Articles.Bucket()}
+	default:
+		return SearchResults{}, fmt.Errorf("unknown section %q", q.Section)
+	}
+
+	results := SearchResults{Hits: []SearchHit{}, Page: max(q.Page, 1), Limit: q.Limit}
+	if results.Limit <= 0 {
+		results.Limit = DefaultSearchLimit
+	}
+	results.Limit = min(results.Limit, MaxSearchLimit)
+	found, err := c.index.SearchPosts(ctx, postgres.SearchQuery{
+		Text:     q.Text,
+		Buckets:  buckets,
+		Language: q.Language,
+		Limit:    results.Limit,
+		Offset:   (results.Page - 1) * results.Limit,
+	})
+	if err != nil {
+		return SearchResults{}, err
+	}
+
+	results.Total = found.Total
+	for _, hit := range found.Hits {
+		created := hit.SyncedAt
+		if hit.CreatedAt != nil {
+			created = *hit.CreatedAt
+		}
+		results.Hits = append(results.Hits, SearchHit{
+			Section:   sections[hit.Bucket],
+			ID:        hit.Slug,
+			Title:     hit.Title,
+			Language:  hit.Language,
+			Tags:      hit.Tags,
+			CreatedAt: created,
+			Rank:      hit.Rank,
+			Snippet:   hit.Snippet,
+		})
+	}
+	return results, nil
+}
@@ -1,39 +1,295 @@
 package config
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
 	"os"
+	"reflect"
+	"regexp"
+	"runtime"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
-	"runtime"
-
 	"github.com/joho/godotenv"
+	"github.com/savabush/lib/pkg/logging"
+	"gopkg.in/yaml.v3"
 )
 
+// DefaultConfigFile is read when CONFIG_FILE is not set and the file exists
+const DefaultConfigFile = "config.yaml"
+
+// Config is the effective application configuration.
+//
+// Values are layered: defaults, then the YAML config file, then environment
+// variables named in the env tags. Every env variable can also be given as
+// <NAME>_FILE pointing to a file holding the value (Docker secrets).
 type Config struct {
-	GIT struct {
-		URL       string
-		CERT_PATH string
+	GIT      GitConfig      `yaml:"git" json:"git"`
+	LOGGING  LoggingConfig  `yaml:"logging" json:"logging"`
+	APP      AppConfig      `yaml:"app" json:"app"`
+	Minio    MinioConfig    `yaml:"minio" json:"minio"`
+	Workers  WorkerConfig   `yaml:"workers" json:"workers"`
+	GRPC     GRPCConfig     `yaml:"grpc" json:"grpc"`
+	Kafka    KafkaConfig    `yaml:"kafka" json:"kafka"`
+	Postgres PostgresConfig `yaml:"postgres" json:"postgres"`
+	Lock     LockConfig     `yaml:"lock" json:"lock"`
+	API      APIConfig      `yaml:"api" json:"api"`
+	Site     SiteConfig     `yaml:"site" json:"site"`
+	Feeds    FeedsConfig    `yaml:"feeds" json:"feeds"`
+	Redact   RedactConfig   `yaml:"redact" json:"redact"`
+	Images   ImagesConfig   `yaml:"images" json:"images"`
+	// Sections maps the synchronized vault directories to their buckets
+	Sections []SectionConfig `yaml:"sections" json:"sections"`
+
+	// problems found while loading, reported by Validate
+	problems []FieldError
+	// file is the config file the values were read from
+	file string
+}
+
+// GitConfig holds the obsidian repository settings
+type GitConfig struct {
+	URL       string `yaml:"url" json:"url" env:"GIT_URL"`
+	CERT_PATH string `yaml:"cert_path" json:"cert_path" env:"GIT_CERT_PATH"`
+}
+
+// LoggingConfig holds the logging settings
+type LoggingConfig struct {
+	FILE_PATH string `yaml:"file_path" json:"file_path" env:"LOGGING_FILE_PATH"`
+	// FORMAT is "text" or "json"
+	FORMAT string `yaml:"format" json:"format" env:"LOGGING_FORMAT"`
+	// LEVEL is the default level followed by package overrides, e.g. "info,minio=debug"
+	LEVEL string `yaml:"level" json:"level" env:"LOGGING_LEVEL"`
+	// MAX_SIZE_MB rotates the log file when it grows beyond this size (0 disables)
+	MAX_SIZE_MB int `yaml:"max_size_mb" json:"max_size_mb" env:"LOGGING_MAX_SIZE_MB"`
+	// MAX_AGE rotates the log file when it is older than this (0 disables)
+	MAX_AGE time.Duration `yaml:"max_age" json:"max_age" env:"LOGGING_MAX_AGE"`
+	// MAX_BACKUPS is the number of rotated files kept (0 keeps all)
+	MAX_BACKUPS int `yaml:"max_backups" json:"max_backups" env:"LOGGING_MAX_BACKUPS"`
+	// COMPRESS gzips rotated log files
+	COMPRESS bool `yaml:"compress" json:"compress" env:"LOGGING_COMPRESS"`
+}
+
+// AppConfig holds the scheduler settings
+type AppConfig struct {
+	// SCHEDULE is the interval between scheduled runs in minutes
+	SCHEDULE int `yaml:"schedule" json:"schedule" env:"APP_SCHEDULE"`
+}
+
+// MinioConfig holds the MinIO connection settings
+type MinioConfig struct {
+	ACCESS_KEY string `yaml:"access_key" json:"access_key" env:"MINIO_ACCESS_KEY"`
+	SECRET_KEY string `yaml:"secret_key" json:"secret_key" env:"MINIO_SECRET_KEY"`
+	ENDPOINT   string `yaml:"endpoint" json:"endpoint" env:"MINIO_ENDPOINT"`
+	USE_SSL    bool   `yaml:"use_ssl" json:"use_ssl" env:"MINIO_USE_SSL"`
+}
+
+// GRPCConfig holds the settings of the gRPC status API and orchestrator reporting
+type GRPCConfig struct {
+	// LISTEN_ADDR is the address the status API listens on (empty disables it)
+	LISTEN_ADDR string `yaml:"listen_addr" json:"listen_addr" env:"GRPC_LISTEN_ADDR"`
+	// ORCHESTRATOR_ADDR is the orchestrator finished runs are reported to (empty disables reporting)
+	ORCHESTRATOR_ADDR string `yaml:"orchestrator_addr" json:"orchestrator_addr" env:"GRPC_ORCHESTRATOR_ADDR"`
+	// REPORT_TIMEOUT limits a single report to the orchestrator
+	REPORT_TIMEOUT time.Duration `yaml:"report_timeout" json:"report_timeout" env:"GRPC_REPORT_TIMEOUT"`
+}
+
+// KafkaConfig holds the settings of the domain events published to Kafka
+type KafkaConfig struct {
+	// BROKERS is a comma separated list of host:port addresses (empty disables publishing)
+	BROKERS string `yaml:"brokers" json:"brokers" env:"KAFKA_BROKERS"`
+	TOPIC   string `yaml:"topic" json:"topic" env:"KAFKA_TOPIC"`
+	// OUTBOX_DIR keeps the events until Kafka acknowledged them
+	OUTBOX_DIR string `yaml:"outbox_dir" json:"outbox_dir" env:"KAFKA_OUTBOX_DIR"`
+	// WRITE_TIMEOUT limits a single write to Kafka
+	WRITE_TIMEOUT time.Duration `yaml:"write_timeout" json:"write_timeout" env:"KAFKA_WRITE_TIMEOUT"`
+}
+
+// BrokerList returns the configured brokers
+func (k KafkaConfig) BrokerList() []string {
+	var brokers []string
+	for _, broker := range strings.Split(k.BROKERS, ",") {
+		if broker = strings.TrimSpace(broker); broker != "" {
+			brokers = append(brokers, broker)
+		}
+	}
+	return brokers
+}
+
+// PostgresConfig holds the connection settings of the post catalog and run history database
+type PostgresConfig struct {
+	// HOST is the database host (empty disables the post catalog)
+	HOST     string `yaml:"host" json:"host" env:"POSTGRES_HOST"`
+	PORT     int    `yaml:"port" json:"port" env:"POSTGRES_PORT"`
+	USER     string `yaml:"user" json:"user" env:"POSTGRES_USER"`
+	PASSWORD string `yaml:"password" json:"password" env:"POSTGRES_PASSWORD"`
+	DB       string `yaml:"db" json:"db" env:"POSTGRES_DB"`
+	// SSLMODE is the libpq sslmode, e.g. disable, require or verify-full
+	SSLMODE string `yaml:"sslmode" json:"sslmode" env:"POSTGRES_SSLMODE"`
+	// MAX_CONNS limits the connection pool
+	MAX_CONNS int `yaml:"max_conns" json:"max_conns" env:"POSTGRES_MAX_CONNS"`
+	// RUN_RETENTION is how long finished runs are kept in the run history (0 keeps them forever)
+	RUN_RETENTION time.Duration `yaml:"run_retention" json:"run_retention" env:"POSTGRES_RUN_RETENTION"`
+}
+
+// DSN returns the connection URL of the database
+func (p PostgresConfig) DSN() string {
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(p.USER, p.PASSWORD),
+		Host:     net.JoinHostPort(p.HOST, strconv.Itoa(p.PORT)),
+		Path:     "/" + p.DB,
+		RawQuery: url.Values{"sslmode": {p.SSLMODE}}.Encode(),
 	}
-	LOGGING struct {
-		FILE_PATH string
+	return dsn.String()
+}
+
+// Lock backends guarding runs across replicas
+const (
+	LockNone     = ""
+	LockPostgres = "postgres"
+	LockMinio    = "minio"
+)
+
+// LockConfig holds the settings of the lock that lets a single sync run at
+// a time across all replicas and CLI invocations
+type LockConfig struct {
+	// BACKEND is "postgres", "minio" or empty to run without a lock
+	BACKEND string `yaml:"backend" json:"backend" env:"LOCK_BACKEND"`
+	// KEY names the lock, runs sharing a key never overlap
+	KEY string `yaml:"key" json:"key" env:"LOCK_KEY"`
+	// BUCKET holds the lease object of the minio backend
+	BUCKET string `yaml:"bucket" json:"bucket" env:"LOCK_BUCKET"`
+	// TTL is how long a minio lease stays valid without renewal, it is
+	// renewed every third of it. The postgres lock is checked as often.
+	TTL time.Duration `yaml:"ttl" json:"ttl" env:"LOCK_TTL"`
+}
+
+// APIConfig holds the settings of the blog read API
+type APIConfig struct {
+	// LISTEN_ADDR is the address the blog API listens on
+	LISTEN_ADDR string `yaml:"listen_addr" json:"listen_addr" env:"API_LISTEN_ADDR"`
+	// PUBLIC_URL is the external URL of the API used in resource links,
+	// the scheme and host of the request when empty
+	PUBLIC_URL string `yaml:"public_url" json:"public_url" env:"API_PUBLIC_URL"`
+	// PAGES_BUCKET holds the intro and about me pages
+	PAGES_BUCKET string `yaml:"pages_bucket" json:"pages_bucket" env:"API_PAGES_BUCKET"`
+	// CORS_ORIGINS is a comma separated list of origins allowed to call the API, "*" allows any
+	CORS_ORIGINS string `yaml:"cors_origins" json:"cors_origins" env:"API_CORS_ORIGINS"`
+}
+
+// OriginList returns the origins allowed to call the API
+func (a APIConfig) OriginList() []string {
+	var origins []string
+	for _, origin := range strings.Split(a.CORS_ORIGINS, ",") {
+		if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+			origins = append(origins, origin)
+		}
 	}
-	APP struct {
-		SCHEDULE int
+	return origins
+}
+
+// SiteConfig holds the settings of the blog site the sync generates
+// feeds, sitemaps and robots.txt for
+type SiteConfig struct {
+	// URL is the URL of the blog the feeds and sitemaps link to (empty
+	// disables the feeds and sitemaps)
+	URL string `yaml:"url" json:"url" env:"SITE_URL"`
+	// BUCKET is the public bucket served by the frontend holding
+	// sitemap.xml, the section sitemaps and robots.txt
+	BUCKET string `yaml:"bucket" json:"bucket" env:"SITE_BUCKET"`
+}
+
+// FeedsConfig holds the settings of the RSS, Atom and JSON feeds the sync
+// generates for every section when the site URL is set
+type FeedsConfig struct {
+	// PUBLIC_URL is the URL the feeds bucket is served at, used in the self
+	// links of the feeds, which have none when it is empty
+	PUBLIC_URL string `yaml:"public_url" json:"public_url" env:"FEEDS_PUBLIC_URL"`
+	// BUCKET holds the feeds under the bucket name of each section
+	BUCKET string `yaml:"bucket" json:"bucket" env:"FEEDS_BUCKET"`
+	TITLE  string `yaml:"title" json:"title" env:"FEEDS_TITLE"`
+	// LIMIT is the number of newest posts in a feed
+	LIMIT int `yaml:"limit" json:"limit" env:"FEEDS_LIMIT"`
+}
+
+// RedactConfig holds what is removed from the notes as private before
+// they are uploaded, rendered or indexed
+type RedactConfig struct {
+	// OPEN_MARKER and CLOSE_MARKER enclose private content, inline or
+	// spanning lines (both empty disable them)
+	OPEN_MARKER  string `yaml:"open_marker" json:"open_marker" env:"REDACT_OPEN_MARKER"`
+	CLOSE_MARKER string `yaml:"close_marker" json:"close_marker" env:"REDACT_CLOSE_MARKER"`
+	// TAG removes the blocks tagged with it and the sections of the
+	// headings tagged with it, without the # (empty disables it)
+	TAG string `yaml:"tag" json:"tag" env:"REDACT_TAG"`
+	// FRONTMATTER is a comma separated list of frontmatter keys removed from the notes
+	FRONTMATTER string `yaml:"frontmatter" json:"frontmatter" env:"REDACT_FRONTMATTER"`
+}
+
+// FrontmatterKeys returns the frontmatter keys removed from the notes
+func (r RedactConfig) FrontmatterKeys() []string {
+	var keys []string
+	for _, key := range strings.Split(r.FRONTMATTER, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
 	}
-	Minio struct {
-		ACCESS_KEY string
-		SECRET_KEY string
-		ENDPOINT   string
+	return keys
+}
+
+// ImagesConfig holds how the sync optimizes the images of the posts'
+// Resources folders
+type ImagesConfig struct {
+	// STRIP_METADATA removes the EXIF data, GPS position included, and the
+	// other metadata from the uploaded images
+	STRIP_METADATA bool `yaml:"strip_metadata" json:"strip_metadata" env:"IMAGES_STRIP_METADATA"`
+	// WIDTHS is a comma separated list of the widths in pixels of the
+	// resized variants made of every image (empty disables the variants)
+	WIDTHS string `yaml:"widths" json:"widths" env:"IMAGES_WIDTHS"`
+	// QUALITY is the JPEG quality of the variants, 1 to 100
+	QUALITY int `yaml:"quality" json:"quality" env:"IMAGES_QUALITY"`
+}
+
+// WidthList returns the widths of the image variants, skipping the
+// invalid ones reported by Validate
+func (i ImagesConfig) WidthList() []int {
+	var widths []int
+	for _, value := range strings.Split(i.WIDTHS, ",") {
+		if width, err := strconv.Atoi(strings.TrimSpace(value)); err == nil && width > 0 && width <= maxImageWidth {
+			widths = append(widths, width)
+		}
 	}
+	return widths
 }
 
 // WorkerConfig holds the configuration for the upload worker pool
 type WorkerConfig struct {
-	NumWorkers int           `yaml:"num_workers"`
-	BufferSize int           `yaml:"buffer_size"`
-	MaxRetries int           `yaml:"max_retries"`
-	RetryDelay time.Duration `yaml:"retry_delay"`
+	NumWorkers int           `yaml:"num_workers" json:"num_workers" env:"WORKERS_NUM_WORKERS"`
+	BufferSize int           `yaml:"buffer_size" json:"buffer_size" env:"WORKERS_BUFFER_SIZE"`
+	MaxRetries int           `yaml:"max_retries" json:"max_retries" env:"WORKERS_MAX_RETRIES"`
+	RetryDelay time.Duration `yaml:"retry_delay" json:"retry_delay" env:"WORKERS_RETRY_DELAY"`
+}
+
+// SectionConfig maps a vault directory to the MinIO bucket it is stored in
+type SectionConfig struct {
+	Dir    string `yaml:"dir" json:"dir"`
+	Bucket string `yaml:"bucket" json:"bucket"`
+}
+
+// DefaultSections returns the mapping of the built-in vault sections
+func DefaultSections() []SectionConfig {
+	sections := make([]SectionConfig, 0, len(Sections))
+	for _, dir := range Sections {
+		sections = append(sections, SectionConfig{Dir: dir, Bucket: BucketName(dir)})
+	}
+	return sections
 }
 
 // DefaultWorkerConfig returns the default worker configuration
@@ -46,66 +302,631 @@ func DefaultWorkerConfig() WorkerConfig {
 	}
 }
 
-func InitConfig() Config {
-	// Check for test environment
-	if envFile := os.Getenv("ENV_FILE"); envFile != "" {
-		if err := godotenv.Load(envFile); err != nil {
-			panic(err)
-		}
-	} else {
-		// Regular environment loading
+// DefaultConfig returns the configuration used before the config file
+// and environment variables are applied
+func DefaultConfig() Config {
+	return Config{
+		LOGGING:  LoggingConfig{LEVEL: "info"},
+		APP:      AppConfig{SCHEDULE: 60},
+		Workers:  DefaultWorkerConfig(),
+		GRPC:     GRPCConfig{REPORT_TIMEOUT: 10 * time.Second},
+		Kafka:    KafkaConfig{TOPIC: "obsidian-sync.events", OUTBOX_DIR: "./outbox", WRITE_TIMEOUT: 10 * time.Second},
+		Postgres: PostgresConfig{PORT: 5432, SSLMODE: "disable", MAX_CONNS: 4, RUN_RETENTION: 30 * 24 * time.Hour},
+		Lock:     LockConfig{KEY: "obsidian-sync", TTL: time.Minute},
+		API:      APIConfig{LISTEN_ADDR: ":8000", PAGES_BUCKET: "pages", CORS_ORIGINS: "*"},
+		Site:     SiteConfig{BUCKET: "site"},
+		Feeds:    FeedsConfig{BUCKET: "feeds", TITLE: "Blog", LIMIT: 20},
+		Redact:   RedactConfig{OPEN_MARKER: "<!-- private -->", CLOSE_MARKER: "<!-- /private -->", TAG: "private"},
+		Images:   ImagesConfig{STRIP_METADATA: true, WIDTHS: "480,960,1600", QUALITY: 82},
+		Sections: DefaultSections(),
+	}
+}
+
+// FieldError is a configuration problem of a single field
+type FieldError struct {
+	// Field is the config file path of the field, e.g. "minio.endpoint"
+	Field string `json:"field"`
+	// Env is the environment variable overriding the field
+	Env     string `json:"env,omitempty"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	if e.Env != "" {
+		return fmt.Sprintf("%s (%s): %s", e.Field, e.Env, e.Message)
+	}
+	return fmt.Sprintf("%s: %s", e.Field, e.Message)
+}
+
+// ValidationError reports all configuration problems at once
+type ValidationError struct {
+	Problems []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	lines := make([]string, 0, len(e.Problems))
+	for _, problem := range e.Problems {
+		lines = append(lines, "  - "+problem.Error())
+	}
+	return fmt.Sprintf("invalid configuration (%d problems):\n%s", len(e.Problems), strings.Join(lines, "\n"))
+}
+
+// LoadOptions controls how the configuration is loaded
+type LoadOptions struct {
+	// EnvFile is a dotenv file whose variables are used when they are not set
+	// in the environment. When empty, .env in the working directory is used
+	// if it exists.
+	EnvFile string
+	// ConfigFile is the YAML config file. When empty CONFIG_FILE is used,
+	// then config.yaml in the working directory if it exists.
+	ConfigFile string
+	// LookupEnv reads environment variables, os.LookupEnv when nil
+	LookupEnv func(string) (string, bool)
+}
+
+// Load builds the configuration from defaults, the YAML config file and the
+// environment. It only fails when the dotenv file cannot be read; problems
+// with the values are recorded and reported by Validate, so commands that
+// need only part of the configuration can still run.
+func Load(opts LoadOptions) (Config, error) {
+	lookupEnv := opts.LookupEnv
+	if lookupEnv == nil {
+		lookupEnv = os.LookupEnv
+	}
+
+	envFile := opts.EnvFile
+	if envFile == "" {
 		if _, err := os.Stat(".env"); err == nil {
-			if err := godotenv.Load(".env"); err != nil {
-				panic(err)
-			}
-		} else if !os.IsNotExist(err) {
-			panic(err)
-		} else if err := godotenv.Load(); err != nil {
-			// Ignore error if .env doesn't exist
-			if !os.IsNotExist(err) {
-				panic(err)
-			}
+			envFile = ".env"
+		}
+	}
+	if envFile != "" {
+		dotenv, err := godotenv.Read(envFile)
+		if err != nil {
+			return Config{}, fmt.Errorf("failed to read env file %s: %w", envFile, err)
+		}
+		lookupEnv = withFallback(lookupEnv, dotenv)
+	}
+
+	configFile := opts.ConfigFile
+	if configFile == "" {
+		configFile, _ = lookupEnv("CONFIG_FILE")
+	}
+	if configFile == "" {
+		if _, err := os.Stat(DefaultConfigFile); err == nil {
+			configFile = DefaultConfigFile
+		}
+	}
+	return LoadConfig(configFile, lookupEnv), nil
+}
+
+// withFallback looks variables up in the environment first and in the
+// dotenv values second, matching godotenv which never overrides the environment
+func withFallback(lookupEnv func(string) (string, bool), dotenv map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		if value, ok := lookupEnv(name); ok {
+			return value, ok
+		}
+		value, ok := dotenv[name]
+		return value, ok
+	}
+}
+
+// LoadConfig builds the configuration from defaults, the YAML file at path
+// (skipped when empty) and the variables returned by lookupEnv. It never
+// fails; problems are recorded and reported by Validate.
+func LoadConfig(path string, lookupEnv func(string) (string, bool)) Config {
+	cfg := DefaultConfig()
+	cfg.file = path
+
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			cfg.problems = append(cfg.problems, FieldError{Field: "config file", Message: err.Error()})
 		}
 	}
+	cfg.problems = append(cfg.problems, applyEnv(reflect.ValueOf(&cfg).Elem(), "", lookupEnv)...)
+	return cfg
+}
+
+// File returns the config file the configuration was read from, if any
+func (c Config) File() string {
+	return c.file
+}
 
-	schedule := os.Getenv("APP_SCHEDULE")
-	if schedule == "" {
-		schedule = "60" // Default value
+// loadFile decodes a YAML config file over the current values
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
 	}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return nil
+}
 
-	i, err := strconv.Atoi(schedule)
+// applyEnv walks the config struct and overrides every field with an env
+// tag from the environment, reading <NAME>_FILE when it is set instead
+func applyEnv(v reflect.Value, prefix string, lookupEnv func(string) (string, bool)) []FieldError {
+	var problems []FieldError
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		path := strings.TrimPrefix(prefix+"."+yamlName(field), ".")
+		if field.Type.Kind() == reflect.Struct {
+			problems = append(problems, applyEnv(v.Field(i), path, lookupEnv)...)
+			continue
+		}
+
+		name := field.Tag.Get("env")
+		if name == "" {
+			continue
+		}
+		value, ok, err := lookupValue(name, lookupEnv)
+		if err != nil {
+			problems = append(problems, FieldError{Field: path, Env: name, Message: err.Error()})
+			continue
+		}
+		if !ok {
+			continue
+		}
+		if err := setField(v.Field(i), value); err != nil {
+			problems = append(problems, FieldError{Field: path, Env: name, Message: err.Error()})
+		}
+	}
+	return problems
+}
+
+// lookupValue returns the value of an env variable or of the file named by
+// <NAME>_FILE. Setting both is an error.
+func lookupValue(name string, lookupEnv func(string) (string, bool)) (string, bool, error) {
+	value, ok := lookupEnv(name)
+	filePath, fileOk := lookupEnv(name + "_FILE")
+	if !fileOk || filePath == "" {
+		return value, ok, nil
+	}
+	if ok && value != "" {
+		return "", false, fmt.Errorf("both %s and %s_FILE are set", name, name)
+	}
+	data, err := os.ReadFile(filePath)
 	if err != nil {
-		panic(err)
+		return "", false, fmt.Errorf("failed to read %s_FILE: %w", name, err)
 	}
+	return strings.TrimRight(string(data), "\r\n"), true, nil
+}
 
-	return Config{
-		GIT: struct {
-			URL       string
-			CERT_PATH string
-		}{
-			URL:       os.Getenv("GIT_URL"),
-			CERT_PATH: os.Getenv("GIT_CERT_PATH"),
-		},
-		LOGGING: struct {
-			FILE_PATH string
-		}{
-			FILE_PATH: os.Getenv("LOGGING_FILE_PATH"),
-		},
-		APP: struct {
-			SCHEDULE int
-		}{
-			SCHEDULE: i,
-		},
-		Minio: struct {
-			ACCESS_KEY string
-			SECRET_KEY string
-			ENDPOINT   string
-		}{
-			ACCESS_KEY: os.Getenv("MINIO_ACCESS_KEY"),
-			SECRET_KEY: os.Getenv("MINIO_SECRET_KEY"),
-			ENDPOINT:   os.Getenv("MINIO_ENDPOINT"),
-		},
-	}
-}
-
-var Settings = InitConfig()
+// setField parses value into a string, bool, int or duration field.
+// Empty values leave the field unchanged.
+func setField(field reflect.Value, value string) error {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil
+	}
+	switch {
+	case field.Type() == reflect.TypeOf(time.Duration(0)):
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q", value)
+		}
+		field.SetInt(int64(d))
+	case field.Kind() == reflect.String:
+		field.SetString(value)
+	case field.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		field.SetBool(b)
+	case field.Kind() == reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		field.SetInt(int64(n))
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
+
+// yamlName returns the config file key of a struct field
+func yamlName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("yaml"), ",")[0]
+	if name == "" {
+		return strings.ToLower(field.Name)
+	}
+	return name
+}
+
+// Validate checks the configuration and returns a *ValidationError listing
+// every problem, including those found while loading, or nil when valid.
+func (c Config) Validate() error {
+	problems := append([]FieldError(nil), c.problems...)
+	require := func(field, env, value string) {
+		if strings.TrimSpace(value) == "" {
+			problems = append(problems, FieldError{field, env, "is required"})
+		}
+	}
+
+	require("git.url", "GIT_URL", c.GIT.URL)
+	require("git.cert_path", "GIT_CERT_PATH", c.GIT.CERT_PATH)
+	if c.GIT.CERT_PATH != "" {
+		if _, err := os.Stat(c.GIT.CERT_PATH); err != nil {
+			problems = append(problems, FieldError{"git.cert_path", "GIT_CERT_PATH", "file is not accessible: " + err.Error()})
+		}
+	}
+	problems = append(problems, validateMinio(c.Minio)...)
+	problems = append(problems, validateLogging(c.LOGGING)...)
+
+	if c.APP.SCHEDULE <= 0 {
+		problems = append(problems, FieldError{"app.schedule", "APP_SCHEDULE", "must be a positive number of minutes"})
+	}
+	if c.Workers.NumWorkers <= 0 {
+		problems = append(problems, FieldError{"workers.num_workers", "WORKERS_NUM_WORKERS", "must be positive"})
+	}
+	if c.Workers.BufferSize < 0 {
+		problems = append(problems, FieldError{"workers.buffer_size", "WORKERS_BUFFER_SIZE", "must not be negative"})
+	}
+	if c.Workers.MaxRetries <= 0 {
+		problems = append(problems, FieldError{"workers.max_retries", "WORKERS_MAX_RETRIES", "must be positive"})
+	}
+	if c.Workers.RetryDelay < 0 {
+		problems = append(problems, FieldError{"workers.retry_delay", "WORKERS_RETRY_DELAY", "must not be negative"})
+	}
+	for _, addr := range []struct{ field, env, value string }{
+		{"grpc.listen_addr", "GRPC_LISTEN_ADDR", c.GRPC.LISTEN_ADDR},
+		{"grpc.orchestrator_addr", "GRPC_ORCHESTRATOR_ADDR", c.GRPC.ORCHESTRATOR_ADDR},
+	} {
+		if addr.value == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(addr.value); err != nil || strings.Contains(addr.value, "://") {
+			problems = append(problems, FieldError{addr.field, addr.env, "must be host:port without a scheme"})
+		}
+	}
+	if c.GRPC.REPORT_TIMEOUT <= 0 {
+		problems = append(problems, FieldError{"grpc.report_timeout", "GRPC_REPORT_TIMEOUT", "must be positive"})
+	}
+	problems = append(problems, validateKafka(c.Kafka)...)
+	problems = append(problems, validatePostgres(c.Postgres)...)
+	problems = append(problems, validateLock(c.Lock, c.Postgres)...)
+	problems = append(problems, validateSite(c.Site, c.Feeds)...)
+	problems = append(problems, validateRedact(c.Redact)...)
+	problems = append(problems, validateImages(c.Images)...)
+	problems = append(problems, validateSections(c.Sections)...)
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// ValidateAPI checks the settings used by the blog API, which reads MinIO,
+// searches the Postgres catalog when it is configured, and needs neither the
+// git repository nor the sync settings. It returns a *ValidationError like
+// Validate.
+func (c Config) ValidateAPI() error {
+	problems := append([]FieldError(nil), c.problems...)
+	problems = append(problems, validateMinio(c.Minio)...)
+	problems = append(problems, validateLogging(c.LOGGING)...)
+	if _, _, err := net.SplitHostPort(c.API.LISTEN_ADDR); err != nil || strings.Contains(c.API.LISTEN_ADDR, "://") {
+		problems = append(problems, FieldError{"api.listen_addr", "API_LISTEN_ADDR", "must be host:port without a scheme"})
+	}
+	if c.API.PUBLIC_URL != "" {
+		if u, err := url.Parse(c.API.PUBLIC_URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, FieldError{"api.public_url", "API_PUBLIC_URL", "must be an http or https URL"})
+		}
+	}
+	if !bucketNameRe.MatchString(c.API.PAGES_BUCKET) {
+		problems = append(problems, FieldError{"api.pages_bucket", "API_PAGES_BUCKET", fmt.Sprintf("invalid bucket name %q", c.API.PAGES_BUCKET)})
+	}
+	problems = append(problems, validateSections(c.Sections)...)
+	problems = append(problems, validatePostgres(c.Postgres)...)
+
+	if len(problems) > 0 {
+		return &ValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// validateMinio checks the MinIO connection settings
+func validateMinio(m MinioConfig) []FieldError {
+	var problems []FieldError
+	for _, field := range []struct{ field, env, value string }{
+		{"minio.endpoint", "MINIO_ENDPOINT", m.ENDPOINT},
+		{"minio.access_key", "MINIO_ACCESS_KEY", m.ACCESS_KEY},
+		{"minio.secret_key", "MINIO_SECRET_KEY", m.SECRET_KEY},
+	} {
+		if strings.TrimSpace(field.value) == "" {
+			problems = append(problems, FieldError{field.field, field.env, "is required"})
+		}
+	}
+	if strings.Contains(m.ENDPOINT, "://") {
+		problems = append(problems, FieldError{"minio.endpoint", "MINIO_ENDPOINT", "must be host:port without a scheme"})
+	}
+	return problems
+}
+
+// validateLogging checks the logging settings
+func validateLogging(l LoggingConfig) []FieldError {
+	var problems []FieldError
+	if _, err := logging.NewFormatter(l.FORMAT); err != nil {
+		problems = append(problems, FieldError{"logging.format", "LOGGING_FORMAT", `must be "text" or "json"`})
+	}
+	if _, err := logging.ParseLevels(l.LEVEL); err != nil {
+		problems = append(problems, FieldError{"logging.level", "LOGGING_LEVEL", err.Error()})
+	}
+	if l.MAX_SIZE_MB < 0 {
+		problems = append(problems, FieldError{"logging.max_size_mb", "LOGGING_MAX_SIZE_MB", "must not be negative"})
+	}
+	if l.MAX_AGE < 0 {
+		problems = append(problems, FieldError{"logging.max_age", "LOGGING_MAX_AGE", "must not be negative"})
+	}
+	if l.MAX_BACKUPS < 0 {
+		problems = append(problems, FieldError{"logging.max_backups", "LOGGING_MAX_BACKUPS", "must not be negative"})
+	}
+	return problems
+}
+
+// bucketNameRe matches valid S3 bucket names
+var bucketNameRe = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+
+// topicNameRe matches valid Kafka topic names
+var topicNameRe = regexp.MustCompile(`^[a-zA-Z0-9._-]{1,249}$`)
+
+// validateKafka checks the event publishing settings when publishing is enabled
+func validateKafka(k KafkaConfig) []FieldError {
+	if k.BROKERS == "" {
+		return nil
+	}
+
+	var problems []FieldError
+	for _, broker := range k.BrokerList() {
+		if _, _, err := net.SplitHostPort(broker); err != nil || strings.Contains(broker, "://") {
+			problems = append(problems, FieldError{"kafka.brokers", "KAFKA_BROKERS",
+				fmt.Sprintf("invalid broker %q, must be host:port without a scheme", broker)})
+		}
+	}
+	if !topicNameRe.MatchString(k.TOPIC) {
+		problems = append(problems, FieldError{"kafka.topic", "KAFKA_TOPIC", fmt.Sprintf("invalid topic name %q", k.TOPIC)})
+	}
+	if k.OUTBOX_DIR == "" {
+		problems = append(problems, FieldError{"kafka.outbox_dir", "KAFKA_OUTBOX_DIR", "is required"})
+	}
+	if k.WRITE_TIMEOUT <= 0 {
+		problems = append(problems, FieldError{"kafka.write_timeout", "KAFKA_WRITE_TIMEOUT", "must be positive"})
+	}
+	return problems
+}
+
+// validateLock checks the lock settings when a lock backend is selected
+func validateLock(l LockConfig, p PostgresConfig) []FieldError {
+	var problems []FieldError
+	switch l.BACKEND {
+	case LockNone:
+		return nil
+	case LockPostgres:
+		if p.HOST == "" {
+			problems = append(problems, FieldError{"lock.backend", "LOCK_BACKEND", "postgres requires POSTGRES_HOST"})
+		}
+	case LockMinio:
+		if !bucketNameRe.MatchString(l.BUCKET) {
+			problems = append(problems, FieldError{"lock.bucket", "LOCK_BUCKET", fmt.Sprintf("invalid bucket name %q", l.BUCKET)})
+		}
+	default:
+		problems = append(problems, FieldError{"lock.backend", "LOCK_BACKEND", `must be "postgres", "minio" or empty`})
+	}
+	if strings.TrimSpace(l.KEY) == "" {
+		problems = append(problems, FieldError{"lock.key", "LOCK_KEY", "is required"})
+	}
+	if l.TTL < 3*time.Second {
+		problems = append(problems, FieldError{"lock.ttl", "LOCK_TTL", "must be at least 3s"})
+	}
+	return problems
+}
+
+// validateSite checks the site and feed settings when the site URL is set
+func validateSite(site SiteConfig, f FeedsConfig) []FieldError {
+	if site.URL == "" {
+		return nil
+	}
+
+	var problems []FieldError
+	for _, field := range []struct{ field, env, value string }{
+		{"site.url", "SITE_URL", site.URL},
+		{"feeds.public_url", "FEEDS_PUBLIC_URL", f.PUBLIC_URL},
+	} {
+		if field.value == "" {
+			continue
+		}
+		if u, err := url.Parse(field.value); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, FieldError{field.field, field.env, "must be an http or https URL"})
+		}
+	}
+	for _, bucket := range []struct{ field, env, value string }{
+		{"site.bucket", "SITE_BUCKET", site.BUCKET},
+		{"feeds.bucket", "FEEDS_BUCKET", f.BUCKET},
+	} {
+		if !bucketNameRe.MatchString(bucket.value) {
+			problems = append(problems, FieldError{bucket.field, bucket.env, fmt.Sprintf("invalid bucket name %q", bucket.value)})
+		}
+	}
+	if strings.TrimSpace(f.TITLE) == "" {
+		problems = append(problems, FieldError{"feeds.title", "FEEDS_TITLE", "is required"})
+	}
+	if f.LIMIT <= 0 {
+		problems = append(problems, FieldError{"feeds.limit", "FEEDS_LIMIT", "must be positive"})
+	}
+	return problems
+}
+
+// redactTagRe matches valid Obsidian tags
+var redactTagRe = regexp.MustCompile(`^[\p{L}\p{N}_/-]+$`)
+
+// validateRedact checks the redaction markers and tag
+func validateRedact(r RedactConfig) []FieldError {
+	var problems []FieldError
+	switch {
+	case (r.OPEN_MARKER == "") != (r.CLOSE_MARKER == ""):
+		problems = append(problems, FieldError{"redact.close_marker", "REDACT_CLOSE_MARKER", "must be set together with redact.open_marker"})
+	case r.OPEN_MARKER != "" && r.OPEN_MARKER == r.CLOSE_MARKER:
+		problems = append(problems, FieldError{"redact.close_marker", "REDACT_CLOSE_MARKER", "must differ from redact.open_marker"})
+	}
+	if r.TAG != "" && !redactTagRe.MatchString(r.TAG) {
+		problems = append(problems, FieldError{"redact.tag", "REDACT_TAG", fmt.Sprintf("invalid tag %q, must be given without the #", r.TAG)})
+	}
+	return problems
+}
+
+// maxImageWidth bounds the widths of the image variants
+const maxImageWidth = 10000
+
+// validateImages checks the widths and quality of the image variants
+func validateImages(i ImagesConfig) []FieldError {
+	var problems []FieldError
+	for _, value := range strings.Split(i.WIDTHS, ",") {
+		value = strings.TrimSpace(value)
+		if value == "" {
+			continue
+		}
+		if width, err := strconv.Atoi(value); err != nil || width <= 0 || width > maxImageWidth {
+			problems = append(problems, FieldError{"images.widths", "IMAGES_WIDTHS",
+				fmt.Sprintf("invalid width %q, must be a number of pixels up to %d", value, maxImageWidth)})
+		}
+	}
+	if i.QUALITY < 1 || i.QUALITY > 100 {
+		problems = append(problems, FieldError{"images.quality", "IMAGES_QUALITY", "must be between 1 and 100"})
+	}
+	return problems
+}
+
+// sslModes are the sslmode values accepted by pgx
+var sslModes = []string{"disable", "allow", "prefer", "require", "verify-ca", "verify-full"}
+
+// validatePostgres checks the database settings when the catalog is enabled
+func validatePostgres(p PostgresConfig) []FieldError {
+	if p.HOST == "" {
+		return nil
+	}
+
+	var problems []FieldError
+	if p.PORT <= 0 || p.PORT > 65535 {
+		problems = append(problems, FieldError{"postgres.port", "POSTGRES_PORT", "must be a port number"})
+	}
+	if strings.TrimSpace(p.USER) == "" {
+		problems = append(problems, FieldError{"postgres.user", "POSTGRES_USER", "is required"})
+	}
+	if strings.TrimSpace(p.DB) == "" {
+		problems = append(problems, FieldError{"postgres.db", "POSTGRES_DB", "is required"})
+	}
+	if !slices.Contains(sslModes, p.SSLMODE) {
+		problems = append(problems, FieldError{"postgres.sslmode", "POSTGRES_SSLMODE",
+			fmt.Sprintf("must be one of %s", strings.Join(sslModes, ", "))})
+	}
+	if p.MAX_CONNS <= 0 {
+		problems = append(problems, FieldError{"postgres.max_conns", "POSTGRES_MAX_CONNS", "must be positive"})
+	}
+	if p.RUN_RETENTION < 0 {
+		problems = append(problems, FieldError{"postgres.run_retention", "POSTGRES_RUN_RETENTION", "must not be negative"})
+	}
+	return problems
+}
+
+// validateSections checks the section mapping for missing and duplicate values
+func validateSections(sections []SectionConfig) []FieldError {
+	if len(sections) == 0 {
+		return []FieldError{{Field: "sections", Message: "at least one section is required"}}
+	}
+
+	var problems []FieldError
+	dirs := make(map[string]bool)
+	buckets := make(map[string]bool)
+	for i, section := range sections {
+		field := fmt.Sprintf("sections[%d]", i)
+		switch {
+		case strings.TrimSpace(section.Dir) == "":
+			problems = append(problems, FieldError{Field: field + ".dir", Message: "is required"})
+		case strings.ContainsAny(section.Dir, `/\`) || section.Dir == "." || section.Dir == "..":
+			problems = append(problems, FieldError{Field: field + ".dir", Message: "must be a top-level vault directory"})
+		case dirs[section.Dir]:
+			problems = append(problems, FieldError{Field: field + ".dir", Message: fmt.Sprintf("duplicate directory %q", section.Dir)})
+		}
+		switch {
+		case !bucketNameRe.MatchString(section.Bucket):
+			problems = append(problems, FieldError{Field: field + ".bucket", Message: fmt.Sprintf("invalid bucket name %q", section.Bucket)})
+		case buckets[section.Bucket]:
+			problems = append(problems, FieldError{Field: field + ".bucket", Message: fmt.Sprintf("duplicate bucket %q", section.Bucket)})
+		}
+		dirs[section.Dir] = true
+		buckets[section.Bucket] = true
+	}
+	return problems
+}
+
+// Change is a single configuration value that differs between two configs
+type Change struct {
+	Field string `json:"field"`
+	Old   string `json:"old"`
+	New   string `json:"new"`
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %s -> %s", c.Field, c.Old, c.New)
+}
+
+// Diff lists the fields that differ between two configurations using
+// their config file names. Changed secrets are reported with masked values.
+func Diff(old, new Config) []Change {
+	return diffValues(reflect.ValueOf(old), reflect.ValueOf(new),
+		reflect.ValueOf(old.Masked()), reflect.ValueOf(new.Masked()), "")
+}
+
+// diffValues compares old and new field by field, describing changes with
+// the values of their masked copies
+func diffValues(old, new, maskedOld, maskedNew reflect.Value, prefix string) []Change {
+	var changes []Change
+	for i := 0; i < old.NumField(); i++ {
+		field := old.Type().Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		path := strings.TrimPrefix(prefix+"."+yamlName(field), ".")
+		if field.Type.Kind() == reflect.Struct {
+			changes = append(changes, diffValues(old.Field(i), new.Field(i), maskedOld.Field(i), maskedNew.Field(i), path)...)
+			continue
+		}
+		if !reflect.DeepEqual(old.Field(i).Interface(), new.Field(i).Interface()) {
+			changes = append(changes, Change{
+				Field: path,
+				Old:   fmt.Sprint(maskedOld.Field(i).Interface()),
+				New:   fmt.Sprint(maskedNew.Field(i).Interface()),
+			})
+		}
+	}
+	return changes
+}
+
+// secretMask replaces secret values when the configuration is displayed
+const secretMask = "********"
+
+// MaskSecret hides a secret value, keeping empty values empty so that
+// missing secrets remain visible.
+func MaskSecret(value string) string {
+	if value == "" {
+		return ""
+	}
+	return secretMask
+}
+
+// Masked returns a copy of the configuration with secrets masked,
+// suitable for printing or logging.
+func (c Config) Masked() Config {
+	c.Minio.ACCESS_KEY = MaskSecret(c.Minio.ACCESS_KEY)
+	c.Minio.SECRET_KEY = MaskSecret(c.Minio.SECRET_KEY)
+	c.Postgres.PASSWORD = MaskSecret(c.Postgres.PASSWORD)
+	return c
+}
@@ -0,0 +1,327 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// envMap returns a lookupEnv function backed by a map
+func envMap(env map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+}
+
+// writeFile writes content to a file in a temporary directory
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0600))
+	return path
+}
+
+// problems returns the field names reported by Validate
+func problems(t *testing.T, cfg Config) map[string]string {
+	return fieldProblems(t, cfg.Validate())
+}
+
+// fieldProblems returns the field names reported by a validation error
+func fieldProblems(t *testing.T, err error) map[string]string {
+	if err == nil {
+		return nil
+	}
+	var validationErr *ValidationError
+	require.True(t, errors.As(err, &validationErr))
+	fields := make(map[string]string)
+	for _, problem := range validationErr.Problems {
+		fields[problem.Field] = problem.Message
+	}
+	return fields
+}
+
+func TestLoadConfigLayers(t *testing.T) {
+	certPath := writeFile(t, "id_rsa", "key")
+	configPath := writeFile(t, "config.yaml", `
+git:
+  url: git@example.com:vault.git
+  cert_path: `+certPath+`
+app:
+  schedule: 15
+minio:
+  endpoint: minio:9000
+  access_key: from-file
+workers:
+  num_workers: 4
+  retry_delay: 5s
+`)
+	secretPath := writeFile(t, "secret", "from-secret-file\n")
+
+	cfg := LoadConfig(configPath, envMap(map[string]string{
+		"MINIO_ENDPOINT":        "localhost:9000",
+		"MINIO_SECRET_KEY_FILE": secretPath,
+		"WORKERS_MAX_RETRIES":   "7",
+		"APP_SCHEDULE":          "",
+	}))
+
+	assert.Equal(t, "git@example.com:vault.git", cfg.GIT.URL)
+	assert.Equal(t, 15, cfg.APP.SCHEDULE, "empty env values keep the file value")
+	assert.Equal(t, "localhost:9000", cfg.Minio.ENDPOINT, "env overrides the file")
+	assert.Equal(t, "from-file", cfg.Minio.ACCESS_KEY)
+	assert.Equal(t, "from-secret-file", cfg.Minio.SECRET_KEY)
+	assert.Equal(t, 4, cfg.Workers.NumWorkers)
+	assert.Equal(t, 7, cfg.Workers.MaxRetries)
+	assert.Equal(t, 5*time.Second, cfg.Workers.RetryDelay)
+	assert.Equal(t, DefaultWorkerConfig().BufferSize, cfg.Workers.BufferSize, "defaults are kept")
+	assert.NoError(t, cfg.Validate())
+}
+
+func TestValidateReportsAllProblems(t *testing.T) {
+	configPath := writeFile(t, "config.yaml", "minio:\n  endpont: typo:9000\n")
+
+	cfg := LoadConfig(configPath, envMap(map[string]string{
+		"APP_SCHEDULE":          "hourly",
+		"MINIO_ACCESS_KEY":      "key",
+		"MINIO_ACCESS_KEY_FILE": "/run/secrets/key",
+		"WORKERS_RETRY_DELAY":   "soon",
+		"GIT_CERT_PATH":         "/does/not/exist",
+	}))
+
+	fields := problems(t, cfg)
+	assert.Contains(t, fields["config file"], "field endpont not found")
+	assert.Equal(t, `invalid integer "hourly"`, fields["app.schedule"])
+	assert.Equal(t, `invalid duration "soon"`, fields["workers.retry_delay"])
+	assert.Contains(t, fields["git.cert_path"], "file is not accessible")
+	assert.Equal(t, "is required", fields["git.url"])
+	assert.Equal(t, "is required", fields["minio.endpoint"])
+	assert.Equal(t, "is required", fields["minio.secret_key"])
+
+	err := cfg.Validate()
+	assert.Contains(t, err.Error(), "app.schedule (APP_SCHEDULE): invalid integer")
+	assert.Contains(t, err.Error(), "minio.access_key (MINIO_ACCESS_KEY): both MINIO_ACCESS_KEY and MINIO_ACCESS_KEY_FILE are set")
+}
+
+func TestValidateRanges(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.APP.SCHEDULE = 0
+	cfg.Workers.NumWorkers = 0
+	cfg.Workers.MaxRetries = -1
+	cfg.Minio.ENDPOINT = "http://minio:9000"
+
+	fields := problems(t, cfg)
+	assert.Equal(t, "must be a positive number of minutes", fields["app.schedule"])
+	assert.Equal(t, "must be positive", fields["workers.num_workers"])
+	assert.Equal(t, "must be positive", fields["workers.max_retries"])
+	assert.Equal(t, "must be host:port without a scheme", fields["minio.endpoint"])
+}
+
+func TestValidateGRPC(t *testing.T) {
+	cfg := DefaultConfig()
+	assert.NotContains(t, problems(t, cfg), "grpc.listen_addr", "the status API is optional")
+
+	cfg.GRPC.LISTEN_ADDR = ":9090"
+	cfg.GRPC.ORCHESTRATOR_ADDR = "http://orchestrator"
+	cfg.GRPC.REPORT_TIMEOUT = 0
+
+	fields := problems(t, cfg)
+	assert.NotContains(t, fields, "grpc.listen_addr")
+	assert.Equal(t, "must be host:port without a scheme", fields["grpc.orchestrator_addr"])
+	assert.Equal(t, "must be positive", fields["grpc.report_timeout"])
+}
+
+func TestValidateKafka(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Kafka.TOPIC = ""
+	assert.NotContains(t, problems(t, cfg), "kafka.topic", "publishing is disabled without brokers")
+
+	cfg.Kafka.BROKERS = "kafka-1:9092, kafka://kafka-2:9092"
+	cfg.Kafka.TOPIC = "blog events"
+	cfg.Kafka.WRITE_TIMEOUT = 0
+
+	fields := problems(t, cfg)
+	assert.Equal(t, `invalid broker "kafka://kafka-2:9092", must be host:port without a scheme`, fields["kafka.brokers"])
+	assert.Equal(t, `invalid topic name "blog events"`, fields["kafka.topic"])
+	assert.Equal(t, "must be positive", fields["kafka.write_timeout"])
+	assert.Equal(t, []string{"kafka-1:9092", "kafka://kafka-2:9092"}, cfg.Kafka.BrokerList())
+}
+
+func TestValidatePostgres(t *testing.T) {
+	cfg := DefaultConfig()
+	assert.NotContains(t, problems(t, cfg), "postgres.user", "the catalog is disabled without a host")
+
+	cfg.Postgres.HOST = "db"
+	cfg.Postgres.PORT = 0
+	cfg.Postgres.SSLMODE = "on"
+	cfg.Postgres.RUN_RETENTION = -time.Hour
+	fields := problems(t, cfg)
+	assert.Equal(t, "must be a port number", fields["postgres.port"])
+	assert.Equal(t, "is required", fields["postgres.user"])
+	assert.Equal(t, "is required", fields["postgres.db"])
+	assert.Contains(t, fields["postgres.sslmode"], "must be one of disable")
+	assert.Equal(t, "must not be negative", fields["postgres.run_retention"])
+
+	cfg = DefaultConfig()
+	cfg.Postgres = PostgresConfig{HOST: "db", PORT: 5432, USER: "blog", PASSWORD: "p@ss word", DB: "blog", SSLMODE: "disable"}
+	assert.Equal(t, "postgres://blog:p%40ss%20word@db:5432/blog?sslmode=disable", cfg.Postgres.DSN())
+}
+
+func TestValidateLock(t *testing.T) {
+	cfg := DefaultConfig()
+	assert.NotContains(t, problems(t, cfg), "lock.backend", "runs are not locked by default")
+
+	cfg.Lock.BACKEND = "redis"
+	assert.Equal(t, `must be "postgres", "minio" or empty`, problems(t, cfg)["lock.backend"])
+
+	cfg.Lock.BACKEND = LockPostgres
+	assert.Equal(t, "postgres requires POSTGRES_HOST", problems(t, cfg)["lock.backend"])
+
+	cfg.Lock = LockConfig{BACKEND: LockMinio, BUCKET: "Locks", TTL: time.Second}
+	fields := problems(t, cfg)
+	assert.Equal(t, `invalid bucket name "Locks"`, fields["lock.bucket"])
+	assert.Equal(t, "is required", fields["lock.key"])
+	assert.Equal(t, "must be at least 3s", fields["lock.ttl"])
+
+	cfg.Lock = LockConfig{BACKEND: LockMinio, BUCKET: "obsidian-sync", KEY: "sync.lock", TTL: time.Minute}
+	fields = problems(t, cfg)
+	assert.NotContains(t, fields, "lock.bucket")
+	assert.NotContains(t, fields, "lock.ttl")
+}
+
+func TestValidateSite(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Feeds.LIMIT = 0
+	assert.NotContains(t, problems(t, cfg), "feeds.limit", "the feeds are disabled by default")
+
+	cfg.Site = SiteConfig{URL: "example.com", BUCKET: "Site"}
+	cfg.Feeds = FeedsConfig{PUBLIC_URL: "ftp://cdn.example.com", BUCKET: "Feeds"}
+	fields := problems(t, cfg)
+	assert.Equal(t, "must be an http or https URL", fields["site.url"])
+	assert.Equal(t, `invalid bucket name "Site"`, fields["site.bucket"])
+	assert.Equal(t, "must be an http or https URL", fields["feeds.public_url"])
+	assert.Equal(t, `invalid bucket name "Feeds"`, fields["feeds.bucket"])
+	assert.Equal(t, "is required", fields["feeds.title"])
+	assert.Equal(t, "must be positive", fields["feeds.limit"])
+
+	cfg.Site = DefaultConfig().Site
+	cfg.Site.URL = "https://example.com"
+	cfg.Feeds = DefaultConfig().Feeds
+	fields = problems(t, cfg)
+	for field := range fields {
+		assert.NotContains(t, field, "site.")
+		assert.NotContains(t, field, "feeds.")
+	}
+}
+
+func TestValidateRedact(t *testing.T) {
+	fields := problems(t, DefaultConfig())
+	for field := range fields {
+		assert.NotContains(t, field, "redact.")
+	}
+
+	cfg := DefaultConfig()
+	cfg.Redact = RedactConfig{OPEN_MARKER: "<!-- private -->", TAG: "#private"}
+	fields = problems(t, cfg)
+	assert.Equal(t, "must be set together with redact.open_marker", fields["redact.close_marker"])
+	assert.Equal(t, `invalid tag "#private", must be given without the #`, fields["redact.tag"])
+
+	cfg.Redact = RedactConfig{OPEN_MARKER: "%private%", CLOSE_MARKER: "%private%", FRONTMATTER: " notes, ,secret "}
+	fields = problems(t, cfg)
+	assert.Equal(t, "must differ from redact.open_marker", fields["redact.close_marker"])
+	assert.Equal(t, []string{"notes", "secret"}, cfg.Redact.FrontmatterKeys())
+}
+
+func TestValidateImages(t *testing.T) {
+	fields := problems(t, DefaultConfig())
+	for field := range fields {
+		assert.NotContains(t, field, "images.")
+	}
+	assert.Equal(t, []int{480, 960, 1600}, DefaultConfig().Images.WidthList())
+
+	cfg := DefaultConfig()
+	cfg.Images = ImagesConfig{WIDTHS: " 320, ,wide,0,20000", QUALITY: 101}
+	fields = problems(t, cfg)
+	assert.Equal(t, `invalid width "20000", must be a number of pixels up to 10000`, fields["images.widths"])
+	assert.Equal(t, "must be between 1 and 100", fields["images.quality"])
+	assert.Equal(t, []int{320}, cfg.Images.WidthList())
+}
+
+func TestValidateAPI(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Minio = MinioConfig{ENDPOINT: "localhost:9000", ACCESS_KEY: "access", SECRET_KEY: "secret"}
+	assert.NoError(t, cfg.ValidateAPI(), "the blog API needs neither git nor the sync settings")
+
+	cfg.API = APIConfig{LISTEN_ADDR: "8000", PUBLIC_URL: "api.example.com", PAGES_BUCKET: "Pages"}
+	cfg.Minio.ENDPOINT = ""
+	cfg.Postgres.HOST, cfg.Postgres.SSLMODE = "db", "off"
+	fields := fieldProblems(t, cfg.ValidateAPI())
+	assert.Equal(t, "must be host:port without a scheme", fields["api.listen_addr"])
+	assert.Equal(t, "must be an http or https URL", fields["api.public_url"])
+	assert.Equal(t, `invalid bucket name "Pages"`, fields["api.pages_bucket"])
+	assert.Equal(t, "is required", fields["minio.endpoint"])
+	assert.Contains(t, fields, "postgres.sslmode", "search reads the catalog")
+	assert.NotContains(t, fields, "git.url")
+
+	cfg.API.CORS_ORIGINS = " https://example.com/, http://localhost:5173 ,"
+	assert.Equal(t, []string{"https://example.com", "http://localhost:5173"}, cfg.API.OriginList())
+}
+
+func TestMasked(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.Minio.ACCESS_KEY = "access"
+	cfg.Minio.SECRET_KEY = "secret"
+
+	masked := cfg.Masked()
+	assert.Equal(t, "********", masked.Minio.ACCESS_KEY)
+	assert.Equal(t, "********", masked.Minio.SECRET_KEY)
+	assert.Equal(t, "secret", cfg.Minio.SECRET_KEY, "the original is not modified")
+	assert.Equal(t, "", masked.Postgres.PASSWORD, "a missing secret stays visible")
+	assert.Equal(t, "", MaskSecret(""))
+}
+
+func TestValidateSections(t *testing.T) {
+	cfg := DefaultConfig()
+	assert.NotContains(t, problems(t, cfg), "sections")
+
+	cfg.Sections = nil
+	assert.Contains(t, problems(t, cfg), "sections")
+
+	cfg.Sections = []SectionConfig{
+		{Dir: "05 - Blog", Bucket: "blog"},
+		{Dir: "05 - Blog", Bucket: "Blog"},
+		{Dir: "a/b", Bucket: "blog"},
+	}
+	fields := problems(t, cfg)
+	assert.Equal(t, `duplicate directory "05 - Blog"`, fields["sections[1].dir"])
+	assert.Equal(t, `invalid bucket name "Blog"`, fields["sections[1].bucket"])
+	assert.Equal(t, "must be a top-level vault directory", fields["sections[2].dir"])
+	assert.Equal(t, `duplicate bucket "blog"`, fields["sections[2].bucket"])
+}
+
+func TestDiff(t *testing.T) {
+	old := DefaultConfig()
+	old.Minio.SECRET_KEY = "old-secret"
+
+	assert.Empty(t, Diff(old, old))
+
+	new := old
+	new.APP.SCHEDULE = 15
+	new.Workers.NumWorkers = 10
+	new.Minio.SECRET_KEY = "new-secret"
+	new.Sections = []SectionConfig{{Dir: "07 - Notes", Bucket: "notes"}}
+
+	changes := Diff(old, new)
+	fields := make(map[string]Change)
+	for _, change := range changes {
+		fields[change.Field] = change
+	}
+	assert.Len(t, changes, 4)
+	assert.Equal(t, "app.schedule: 60 -> 15", fields["app.schedule"].String())
+	assert.Equal(t, "10", fields["workers.num_workers"].New)
+	assert.NotContains(t, fields["minio.secret_key"].Old+fields["minio.secret_key"].New, "secret")
+	assert.Contains(t, fields["sections"].New, "07 - Notes")
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// Log fields carrying the correlation IDs of a context
+const (
+	RunIDField  = "run_id"
+	SpanIDField = "span_id"
+)
+
+// contextKey is the type of the context keys of this package
+type contextKey int
+
+const (
+	runIDKey contextKey = iota
+	spanIDKey
+)
+
+// NewID returns a random hex identifier of n bytes
+func NewID(n int) string {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// WithRunID returns a context carrying the ID of a synchronization run
+func WithRunID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, runIDKey, id)
+}
+
+// RunID returns the run ID carried by ctx, empty when there is none
+func RunID(ctx context.Context) string {
+	id, _ := ctx.Value(runIDKey).(string)
+	return id
+}
+
+// WithSpan returns a context carrying a new span ID, used to tell apart
+// the log lines of concurrent operations of one run such as file uploads
+func WithSpan(ctx context.Context) context.Context {
+	return context.WithValue(ctx, spanIDKey, NewID(4))
+}
+
+// SpanID returns the span ID carried by ctx, empty when there is none
+func SpanID(ctx context.Context) string {
+	id, _ := ctx.Value(spanIDKey).(string)
+	return id
+}
+
+// ContextLogger returns logger with the run and span IDs of ctx attached
+func ContextLogger(logger LoggerInterface, ctx context.Context) LoggerInterface {
+	fields := Fields{}
+	if id := RunID(ctx); id != "" {
+		fields[RunIDField] = id
+	}
+	if id := SpanID(ctx); id != "" {
+		fields[SpanIDField] = id
+	}
+	if len(fields) == 0 {
+		return logger
+	}
+	return logger.WithFields(fields)
+}
@@ -1,7 +1,32 @@
 package config
 
+import "strings"
+
 // This is enums for directories of obsidian
 const (
 	Articles string = "06 - Articles"
 	Blog     string = "05 - Blog"
 )
+
+// Sections lists all vault directories that are synchronized
+var Sections = []string{Blog, Articles}
+
+// BucketName returns the MinIO bucket name for a vault section,
+// e.g. "05 - Blog" is stored in the "blog" bucket.
+func BucketName(section string) string {
+	parts := strings.SplitN(section, " - ", 2)
+	return strings.ToLower(parts[len(parts)-1])
+}
+
+// SitePath returns the path the posts of a section are served under on the
+// blog, e.g. the posts of "05 - Blog" are at /posts/<post>. Sections other
+// than the built-in ones use their bucket name.
+func SitePath(section SectionConfig) string {
+	switch section.Dir {
+	case Blog:
+		return "posts"
+	case Articles:
+		return "articles"
+	}
+	return section.Bucket
+}
@@ -1,23 +1,86 @@
 package config
 
 import (
-	"os"
+	"fmt"
+	"io"
+	"sync"
 
-	. "github.com/savabush/lib/pkg/logging"
+	"github.com/savabush/lib/pkg/logging"
+	"github.com/sirupsen/logrus"
 )
 
-var Logger LoggerInterface
+// DefaultLogFile is used when no log file path is configured
+const DefaultLogFile = "/tmp/obsidian-sync.log"
 
-func init() {
-	logPath := Settings.LOGGING.FILE_PATH
+// Fields are key value pairs attached to log entries
+type Fields = map[string]interface{}
+
+// PackageField names the package a log entry comes from. Packages with a
+// level of their own in LOGGING_LEVEL are logged at that level.
+const PackageField = "package"
+
+// ForPackage returns a logger for the named package, see PackageField
+func ForPackage(logger LoggerInterface, name string) LoggerInterface {
+	return logger.WithField(PackageField, name)
+}
+
+// Logger is the application logger created by NewLogger
+type Logger struct {
+	LoggerInterface
+	file *logging.RotatingFile
+}
+
+// NewLogger creates a logger writing to the configured log file in the
+// configured format and mirroring entries to display (nil writes to the
+// file only). The log file is rotated by size and age as configured. An
+// unknown format or level falls back to the default so the problem can be
+// logged; Validate reports it.
+func NewLogger(cfg LoggingConfig, display io.Writer) (*Logger, error) {
+	logPath := cfg.FILE_PATH
 	if logPath == "" {
 		// Default to a temporary log file if no path is specified
-		logPath = "/tmp/obsidian-sync.log"
+		logPath = DefaultLogFile
+	}
+	format := cfg.FORMAT
+	if _, err := logging.NewFormatter(format); err != nil {
+		format = logging.FormatText
+	}
+	levels, err := logging.ParseLevels(cfg.LEVEL)
+	if err != nil {
+		levels, _ = logging.ParseLevels("")
 	}
-	if os.Getenv("ENV_FILE") != "" {
-		logPath = "/tmp/obsidian-sync-test.log"
+
+	logger, err := logging.New(logging.Options{
+		File:   logPath,
+		Output: display,
+		Format: format,
+		Level:  levels.Default,
+		Rotate: logging.RotateOptions{
+			MaxSize:    int64(cfg.MAX_SIZE_MB) << 20,
+			MaxAge:     cfg.MAX_AGE,
+			MaxBackups: cfg.MAX_BACKUPS,
+			Compress:   cfg.COMPRESS,
+		},
+	})
+	if err != nil {
+		return nil, err
 	}
-	Logger = MakeLogger(logPath, true)
+
+	loggers := &packageLoggers{root: logger.Logger, levels: levels, byPackage: make(map[string]*logrus.Logger)}
+	return &Logger{
+		LoggerInterface: entryLogger{Entry: logrus.NewEntry(logger.Logger), loggers: loggers},
+		file:            logger.File,
+	}, nil
+}
+
+// Reopen reopens the log file after it was moved by an external tool such as logrotate
+func (l *Logger) Reopen() error {
+	return l.file.Reopen()
+}
+
+// Close closes the log file
+func (l *Logger) Close() error {
+	return l.file.Close()
 }
 
 // LoggerInterface defines the interface for our logger
@@ -34,4 +97,55 @@ type LoggerInterface interface {
 	Fatalf(format string, args ...interface{})
 	Warn(args ...interface{})
 	Warnf(format string, args ...interface{})
+	// WithField returns a logger adding the field to every entry
+	WithField(key string, value interface{}) LoggerInterface
+	// WithFields returns a logger adding the fields to every entry
+	WithFields(fields Fields) LoggerInterface
+}
+
+// entryLogger implements LoggerInterface with a logrus entry
+type entryLogger struct {
+	*logrus.Entry
+	loggers *packageLoggers
+}
+
+func (l entryLogger) WithField(key string, value interface{}) LoggerInterface {
+	return l.with(l.Entry.WithField(key, value))
+}
+
+func (l entryLogger) WithFields(fields Fields) LoggerInterface {
+	return l.with(l.Entry.WithFields(fields))
+}
+
+// with wraps entry, switching to the logger of its package
+func (l entryLogger) with(entry *logrus.Entry) LoggerInterface {
+	if pkg, ok := entry.Data[PackageField]; ok {
+		entry.Logger = l.loggers.get(fmt.Sprint(pkg))
+	}
+	return entryLogger{Entry: entry, loggers: l.loggers}
+}
+
+// packageLoggers holds a logger per package sharing the root logger's
+// output and format but logging at the package level
+type packageLoggers struct {
+	root   *logrus.Logger
+	levels logging.Levels
+
+	mu        sync.Mutex
+	byPackage map[string]*logrus.Logger
+}
+
+func (p *packageLoggers) get(pkg string) *logrus.Logger {
+	if _, ok := p.levels.Packages[pkg]; !ok {
+		return p.root
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	logger, ok := p.byPackage[pkg]
+	if !ok {
+		logger = logging.WithLevel(p.root, p.levels.Level(pkg))
+		p.byPackage[pkg] = logger
+	}
+	return logger
 }
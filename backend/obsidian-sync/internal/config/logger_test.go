@@ -0,0 +1,105 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewLoggerJSON(t *testing.T) {
+	var out bytes.Buffer
+	logger, err := NewLogger(LoggingConfig{
+		FILE_PATH: filepath.Join(t.TempDir(), "sync.log"),
+		FORMAT:    "json",
+	}, &out)
+	require.NoError(t, err)
+
+	logger.WithField("bucket", "blog").WithFields(Fields{"object": "Post/Post.md", "msg": "clash"}).Infof("Uploaded %d files", 2)
+
+	var entry map[string]interface{}
+	require.NoError(t, json.Unmarshal(out.Bytes(), &entry))
+	assert.Equal(t, "info", entry["level"])
+	assert.Equal(t, "Uploaded 2 files", entry["msg"])
+	assert.Equal(t, "blog", entry["bucket"])
+	assert.Equal(t, "Post/Post.md", entry["object"])
+	assert.Equal(t, "clash", entry["fields.msg"])
+	assert.NotEmpty(t, entry["time"])
+	assert.True(t, strings.HasPrefix(entry["caller"].(string), "config/logger_test.go:"), entry["caller"])
+}
+
+func TestNewLoggerText(t *testing.T) {
+	var out bytes.Buffer
+	logger, err := NewLogger(LoggingConfig{FILE_PATH: filepath.Join(t.TempDir(), "sync.log")}, &out)
+	require.NoError(t, err)
+
+	logger.WithFields(Fields{"object": "a.md", "bucket": "blog"}).Warn("Retrying")
+	assert.Contains(t, out.String(), "logger_test.go - [line:")
+	assert.True(t, strings.HasSuffix(out.String(), "- WARN - Retrying bucket=blog object=a.md\n"), out.String())
+}
+
+func TestValidateLogFormat(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.LOGGING.FORMAT = "xml"
+	assert.Equal(t, `must be "text" or "json"`, problems(t, cfg)["logging.format"])
+
+	cfg.LOGGING.FORMAT = "json"
+	assert.NotContains(t, problems(t, cfg), "logging.format")
+}
+
+func TestNewLoggerPackageLevels(t *testing.T) {
+	var out bytes.Buffer
+	logger, err := NewLogger(LoggingConfig{
+		FILE_PATH: filepath.Join(t.TempDir(), "sync.log"),
+		LEVEL:     "warn,minio=debug",
+	}, &out)
+	require.NoError(t, err)
+	defer logger.Close()
+
+	logger.Info("root info")
+	ForPackage(logger, "app").Info("app info")
+	ForPackage(logger, "app").Warn("app warn")
+	ForPackage(logger, "minio").WithField("bucket", "blog").Debug("minio debug")
+
+	assert.NotContains(t, out.String(), "root info")
+	assert.NotContains(t, out.String(), "app info")
+	assert.Contains(t, out.String(), "app warn")
+	assert.Contains(t, out.String(), "minio debug bucket=blog package=minio")
+	assert.Contains(t, out.String(), "logger_test.go - [line:")
+}
+
+func TestLoggerReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sync.log")
+	logger, err := NewLogger(LoggingConfig{FILE_PATH: path}, nil)
+	require.NoError(t, err)
+	defer logger.Close()
+
+	logger.Info("before")
+	require.NoError(t, os.Rename(path, path+".1"))
+	require.NoError(t, logger.Reopen())
+	logger.Info("after")
+
+	rotated, err := os.ReadFile(path + ".1")
+	require.NoError(t, err)
+	current, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(rotated), "before")
+	assert.NotContains(t, string(current), "before")
+	assert.Contains(t, string(current), "after")
+}
+
+func TestValidateLogging(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.LOGGING.LEVEL = "info,minio=loud"
+	cfg.LOGGING.MAX_SIZE_MB = -1
+	cfg.LOGGING.MAX_BACKUPS = -1
+	fields := problems(t, cfg)
+	assert.Contains(t, fields["logging.level"], "minio=loud")
+	assert.Contains(t, fields, "logging.max_size_mb")
+	assert.Contains(t, fields, "logging.max_backups")
+}
@@ -0,0 +1,200 @@
+package minio
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/savabush/obsidian-sync/internal/config"
+)
+
+// Metadata of a lease object
+const (
+	leaseOwnerMeta   = "Lock-Owner"
+	leaseExpiresMeta = "Lock-Expires"
+)
+
+// Lease is a lock held by writing a lease object with an owner and an
+// expiry. Writes are conditional on the ETag of the object, so only one
+// owner can create or take over an expired lease. The holder renews the
+// lease every third of its TTL.
+type Lease struct {
+	client MinioClient
+	bucket string
+	key    string
+	ttl    time.Duration
+	logger config.LoggerInterface
+}
+
+// Lease returns a lease on the object key of the current bucket.
+func (r *Repository) Lease(key string, ttl time.Duration) *Lease {
+	return &Lease{client: r.client, bucket: r.bucket, key: key, ttl: ttl, logger: r.logger}
+}
+
+// TryLock takes the lease for owner without waiting. When another owner
+// holds an unexpired lease, it returns a nil lock and describes the holder.
+func (l *Lease) TryLock(ctx context.Context, owner string) (*LeaseLock, string, error) {
+	opts := l.putOptions(owner, time.Now())
+	info, err := l.client.StatObject(ctx, l.bucket, l.key, minio.StatObjectOptions{})
+	switch {
+	case err == nil:
+		holder, expires := leaseHolder(info)
+		if time.Now().Before(expires) {
+			return nil, fmt.Sprintf("%s until %s", holder, expires.Format(time.RFC3339)), nil
+		}
+		l.logger.Infof("Taking over lease %s/%s of %s expired at %s", l.bucket, l.key, holder, expires.Format(time.RFC3339))
+		opts.SetMatchETag(info.ETag)
+	case minio.ToErrorResponse(err).Code == "NoSuchKey":
+		opts.SetMatchETagExcept("*")
+	default:
+		return nil, "", fmt.Errorf("failed to read lease %s/%s: %w", l.bucket, l.key, err)
+	}
+
+	uploaded, err := l.client.PutObject(ctx, l.bucket, l.key, bytes.NewReader(nil), 0, opts)
+	if isPreconditionFailed(err) {
+		// Another owner wrote the lease since it was read
+		return nil, "another owner", nil
+	}
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to write lease %s/%s: %w", l.bucket, l.key, err)
+	}
+
+	lock := &LeaseLock{
+		lease:   l,
+		owner:   owner,
+		etag:    uploaded.ETag,
+		expires: time.Now().Add(l.ttl),
+		lost:    make(chan struct{}),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go lock.renew()
+	return lock, "", nil
+}
+
+// putOptions are the options writing the lease of owner from now on
+func (l *Lease) putOptions(owner string, now time.Time) minio.PutObjectOptions {
+	return minio.PutObjectOptions{
+		ContentType: "application/octet-stream",
+		UserMetadata: map[string]string{
+			leaseOwnerMeta:   owner,
+			leaseExpiresMeta: now.Add(l.ttl).UTC().Format(time.RFC3339Nano),
+		},
+	}
+}
+
+// LeaseLock is a held lease.
+type LeaseLock struct {
+	lease *Lease
+	owner string
+	// etag and expires describe the last written lease, guarded by mu
+	mu      sync.Mutex
+	etag    string
+	expires time.Time
+	lost    chan struct{}
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+}
+
+// Lost is closed when the lease could not be renewed before it expired or
+// was taken over.
+func (l *LeaseLock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Release stops renewing the lease and removes it if it is still held.
+func (l *LeaseLock) Release(ctx context.Context) error {
+	l.once.Do(func() { close(l.stop) })
+	<-l.done
+
+	lease := l.lease
+	info, err := lease.client.StatObject(ctx, lease.bucket, lease.key, minio.StatObjectOptions{})
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to release lease %s/%s: %w", lease.bucket, lease.key, err)
+	}
+	l.mu.Lock()
+	held := info.ETag == l.etag
+	l.mu.Unlock()
+	if !held {
+		return nil
+	}
+	if err := lease.client.RemoveObject(ctx, lease.bucket, lease.key, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to release lease %s/%s: %w", lease.bucket, lease.key, err)
+	}
+	return nil
+}
+
+// renew rewrites the lease every third of its TTL until released. A lease
+// taken over by another owner, or not renewed before it expires, is lost.
+func (l *LeaseLock) renew() {
+	defer close(l.done)
+	lease := l.lease
+	interval := lease.ttl / 3
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			l.mu.Lock()
+			etag, expires := l.etag, l.expires
+			l.mu.Unlock()
+
+			now := time.Now()
+			opts := lease.putOptions(l.owner, now)
+			opts.SetMatchETag(etag)
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			uploaded, err := lease.client.PutObject(ctx, lease.bucket, lease.key, bytes.NewReader(nil), 0, opts)
+			cancel()
+			switch {
+			case err == nil:
+				l.mu.Lock()
+				l.etag, l.expires = uploaded.ETag, now.Add(lease.ttl)
+				l.mu.Unlock()
+			case isPreconditionFailed(err):
+				lease.logger.Errorf("Lost lease %s/%s: it was taken over", lease.bucket, lease.key)
+				close(l.lost)
+				return
+			case !time.Now().Add(interval).Before(expires):
+				lease.logger.Errorf("Lost lease %s/%s: renewal failed until it expired: %v", lease.bucket, lease.key, err)
+				close(l.lost)
+				return
+			default:
+				lease.logger.Warnf("Failed to renew lease %s/%s, retrying: %v", lease.bucket, lease.key, err)
+			}
+		case <-l.stop:
+			return
+		}
+	}
+}
+
+// leaseHolder returns the owner and expiry of a lease object. A lease
+// without a valid expiry is treated as expired.
+func leaseHolder(info minio.ObjectInfo) (string, time.Time) {
+	var owner string
+	var expires time.Time
+	for key, value := range info.UserMetadata {
+		switch {
+		case strings.EqualFold(key, leaseOwnerMeta):
+			owner = value
+		case strings.EqualFold(key, leaseExpiresMeta):
+			expires, _ = time.Parse(time.RFC3339Nano, value)
+		}
+	}
+	if owner == "" {
+		owner = "unknown owner"
+	}
+	return owner, expires
+}
+
+// isPreconditionFailed reports whether a conditional write failed
+func isPreconditionFailed(err error) bool {
+	return err != nil && minio.ToErrorResponse(err).Code == "PreconditionFailed"
+}
@@ -0,0 +1,350 @@
+package minio
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/savabush/obsidian-sync/internal/config"
+)
+
+// Plan actions describing what happens to a single object
+const (
+	ActionCreate string = "create"
+	ActionUpdate string = "update"
+	ActionDelete string = "delete"
+	ActionSkip   string = "skip"
+)
+
+// PlanItem is a single planned operation on an object.
+type PlanItem struct {
+	// Action is one of ActionCreate, ActionUpdate, ActionDelete or ActionSkip
+	Action string `json:"action"`
+	// Key is the object name in the bucket
+	Key string `json:"key"`
+	// Size is the local size for uploads and the remote size for deletions
+	Size int64 `json:"size"`
+	// Reason explains why the action was chosen
+	Reason string `json:"reason"`
+	// Error is set when applying the action failed
+	Error string `json:"error,omitempty"`
+
+	file File
+}
+
+// PlanSummary counts the planned actions.
+type PlanSummary struct {
+	Create int `json:"create"`
+	Update int `json:"update"`
+	Delete int `json:"delete"`
+	Skip   int `json:"skip"`
+	// UploadBytes is the total size of objects to create or update
+	UploadBytes int64 `json:"upload_bytes"`
+	// DeleteBytes is the total size of objects to delete
+	DeleteBytes int64 `json:"delete_bytes"`
+}
+
+// Plan describes how a bucket is brought in line with a set of local files.
+// The same plan is produced for dry and real runs; only Apply differs.
+type Plan struct {
+	Bucket  string      `json:"bucket"`
+	Summary PlanSummary `json:"summary"`
+	Items   []PlanItem  `json:"items"`
+}
+
+// Changed reports whether applying the plan writes or removes anything.
+func (p *Plan) Changed() bool {
+	return p.Summary.Create+p.Summary.Update+p.Summary.Delete > 0
+}
+
+// Keys returns the keys of all items with the given action.
+func (p *Plan) Keys(action string) []string {
+	var keys []string
+	for _, item := range p.Items {
+		if item.Action == action {
+			keys = append(keys, item.Key)
+		}
+	}
+	return keys
+}
+
+// add appends an item and updates the summary
+func (p *Plan) add(item PlanItem) {
+	switch item.Action {
+	case ActionCreate:
+		p.Summary.Create++
+		p.Summary.UploadBytes += item.Size
+	case ActionUpdate:
+		p.Summary.Update++
+		p.Summary.UploadBytes += item.Size
+	case ActionDelete:
+		p.Summary.Delete++
+		p.Summary.DeleteBytes += item.Size
+	case ActionSkip:
+		p.Summary.Skip++
+	}
+	p.Items = append(p.Items, item)
+}
+
+// Plan compares the given files with the objects in the current bucket and
+// returns the operations needed to make the bucket match them: files missing
+// from the bucket are created, files with a different checksum or metadata
+// are updated, objects without a local file are deleted and everything else
+// is skipped. Nothing is written to the bucket.
+func (r *Repository) Plan(files []File) (*Plan, error) {
+	return r.plan(prefixed(""), files)
+}
+
+// PlanPrefix is Plan limited to the objects whose names start with prefix,
+// the rest of the bucket is neither compared nor deleted. The file names
+// are the full object names.
+func (r *Repository) PlanPrefix(prefix string, files []File) (*Plan, error) {
+	return r.plan(prefixed(prefix), files)
+}
+
+// PlanFiles is Plan limited to the objects of the files: nothing is deleted.
+func (r *Repository) PlanFiles(files []File) (*Plan, error) {
+	return r.plan(scope{}, files)
+}
+
+// scope selects the objects of a bucket a plan compares and deletes
+type scope struct {
+	prefix string
+	// all selects every object under prefix, else only those of the files
+	all bool
+}
+
+// prefixed selects the objects whose names start with prefix
+func prefixed(prefix string) scope {
+	return scope{prefix: prefix, all: true}
+}
+
+// plan compares the files with the objects of the bucket in scope
+func (r *Repository) plan(scope scope, files []File) (*Plan, error) {
+	plan := &Plan{Bucket: r.bucket, Items: []PlanItem{}}
+
+	// Listings only return the content type with the metadata
+	withMetadata := false
+	for _, file := range files {
+		withMetadata = withMetadata || len(file.Metadata) > 0 || file.ContentType != ""
+	}
+	names := make(map[string]bool, len(files))
+	for _, file := range files {
+		names[file.Name] = true
+	}
+	remote := make(map[string]Object)
+	exists, err := r.BucketExists()
+	if err != nil {
+		return nil, fmt.Errorf("failed to check bucket %s: %w", r.bucket, err)
+	}
+	if exists {
+		objects, err := r.ListObjects(scope.prefix, withMetadata)
+		if err != nil {
+			return nil, err
+		}
+		for _, object := range objects {
+			if (scope.all && strings.HasPrefix(object.Key, scope.prefix)) || names[object.Key] {
+				remote[object.Key] = object
+			}
+		}
+	}
+
+	for _, file := range files {
+		size, checksum, err := fileChecksum(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", file.Name, err)
+		}
+
+		item := PlanItem{Key: file.Name, Size: size, file: file}
+		object, ok := remote[file.Name]
+		delete(remote, file.Name)
+		switch {
+		case !exists:
+			item.Action, item.Reason = ActionCreate, "bucket does not exist"
+		case !ok:
+			item.Action, item.Reason = ActionCreate, "not in bucket"
+		case strings.Contains(object.ETag, "-"):
+			// Multipart uploads have no plain MD5 ETag, fall back to the size
+			if object.Size == size {
+				item.Action, item.Reason = ActionSkip, "multipart object with the same size"
+			} else {
+				item.Action, item.Reason = ActionUpdate, fmt.Sprintf("size changed from %d to %d", object.Size, size)
+			}
+		case object.ETag != checksum:
+			item.Action, item.Reason = ActionUpdate, fmt.Sprintf("checksum changed from %s to %s", object.ETag, checksum)
+		case changedMetadata(object, file) != "":
+			item.Action, item.Reason = ActionUpdate, fmt.Sprintf("metadata %s changed", changedMetadata(object, file))
+		default:
+			item.Action, item.Reason = ActionSkip, "unchanged"
+		}
+		plan.add(item)
+	}
+
+	for key, object := range remote {
+		plan.add(PlanItem{Action: ActionDelete, Key: key, Size: object.Size, Reason: "not in vault"})
+	}
+
+	sort.SliceStable(plan.Items, func(i, j int) bool {
+		return plan.Items[i].Key < plan.Items[j].Key
+	})
+	return plan, nil
+}
+
+// Apply executes a plan produced by Plan. Uploads and deletions run
+// concurrently with retries; failures are recorded on the plan items and
+// returned as a single aggregated error. In dry-run mode the plan is only
+// logged and nothing is written or removed.
+func (r *Repository) Apply(plan *Plan) error {
+	if r.dryRun {
+		for _, item := range plan.Items {
+			if item.Action != ActionSkip {
+				r.objectLogger(r.ctx, item.Key).WithField("action", item.Action).
+					Infof("Dry run: would %s %s/%s (%s)", item.Action, plan.Bucket, item.Key, item.Reason)
+			}
+		}
+		return nil
+	}
+
+	var wg sync.WaitGroup
+	errChan := make(chan error, len(plan.Items))
+	semaphore := make(chan struct{}, r.numWorkers) // Limit concurrent operations
+
+	for i := range plan.Items {
+		item := &plan.Items[i]
+		if item.Action == ActionSkip {
+			continue
+		}
+
+		wg.Add(1)
+		go func(item *PlanItem) {
+			defer wg.Done()
+			semaphore <- struct{}{}        // Acquire
+			defer func() { <-semaphore }() // Release
+
+			// Every operation gets a span to tell apart its log lines
+			ctx := config.WithSpan(r.ctx)
+			var err error
+			switch item.Action {
+			case ActionCreate, ActionUpdate:
+				err = r.uploadWithRetry(ctx, item.file)
+			case ActionDelete:
+				err = r.removeWithRetry(ctx, item.Key)
+			}
+			if err != nil {
+				item.Error = err.Error()
+				errChan <- fmt.Errorf("failed to %s %s: %w", item.Action, item.Key, err)
+			}
+			if r.progress != nil {
+				r.progress(*item)
+			}
+		}(item)
+	}
+
+	// Wait for all operations to complete
+	wg.Wait()
+	close(errChan)
+
+	// Collect any errors
+	var errs []error
+	for err := range errChan {
+		errs = append(errs, err)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("failed to apply plan for %s: %v", plan.Bucket, errs)
+	}
+	return nil
+}
+
+// RemoveFile removes an object from the current bucket.
+// In dry-run mode the removal is only logged.
+func (r *Repository) RemoveFile(key string) error {
+	return r.removeFile(r.ctx, key)
+}
+
+// removeFile removes an object within ctx, logging with its correlation IDs
+func (r *Repository) removeFile(ctx context.Context, key string) error {
+	if r.dryRun {
+		r.objectLogger(ctx, key).Infof("Dry run: would remove file: %s", key)
+		return nil
+	}
+
+	logger := r.objectLogger(ctx, key)
+	logger.Infof("Removing file: %s", key)
+	if err := r.client.RemoveObject(ctx, r.bucket, key, minio.RemoveObjectOptions{}); err != nil {
+		return fmt.Errorf("failed to remove file: %v", err)
+	}
+	logger.Infof("File removed successfully: %s", key)
+	return nil
+}
+
+// removeWithRetry removes an object, retrying failed attempts
+func (r *Repository) removeWithRetry(ctx context.Context, key string) error {
+	var lastErr error
+	for attempt := 0; attempt < r.maxRetries; attempt++ {
+		if attempt > 0 {
+			r.objectLogger(ctx, key).WithField("attempt", attempt+1).
+				Infof("Retry attempt %d/%d for removing %s", attempt+1, r.maxRetries, key)
+			time.Sleep(r.retryDelay)
+		}
+		if lastErr = r.removeFile(ctx, key); lastErr == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("failed after %d attempts: %v", r.maxRetries, lastErr)
+}
+
+// changedMetadata returns content-type when the object has another content
+// type than the one set for the file, else the first name, in sorted
+// order, of the file metadata the object does not have with the same
+// value, empty when none. A content type the server does not list is not
+// compared.
+func changedMetadata(object Object, file File) string {
+	if file.ContentType != "" && object.ContentType != "" && object.ContentType != file.ContentType {
+		return "content-type"
+	}
+	names := make([]string, 0, len(file.Metadata))
+	for name := range file.Metadata {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if object.MetadataValue(name) != file.Metadata[name] {
+			return name
+		}
+	}
+	return ""
+}
+
+// fileChecksum returns the size and hex MD5 of a file's content
+func fileChecksum(file File) (int64, string, error) {
+	var reader io.Reader
+	if file.Content != nil {
+		reader = bytes.NewReader(file.Content)
+	} else if file.Path != "" {
+		f, err := os.Open(file.Path)
+		if err != nil {
+			return 0, "", err
+		}
+		defer f.Close()
+		reader = f
+	} else {
+		return 0, "", fmt.Errorf("either Content or Path must be provided")
+	}
+
+	h := md5.New()
+	size, err := io.Copy(h, reader)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,100 @@
+package minio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// ErrObjectNotFound is returned when a read object does not exist
+var ErrObjectNotFound = errors.New("object not found")
+
+// ListObjectsContext returns all objects in the current bucket under the
+// given prefix within ctx. When withMetadata is true the custom user
+// metadata of each object is included.
+func (r *Repository) ListObjectsContext(ctx context.Context, prefix string, withMetadata bool) ([]Object, error) {
+	opts := minio.ListObjectsOptions{
+		Prefix:       prefix,
+		Recursive:    true,
+		WithMetadata: withMetadata,
+	}
+
+	var objects []Object
+	for info := range r.client.ListObjects(ctx, r.bucket, opts) {
+		if info.Err != nil {
+			return nil, fmt.Errorf("failed to list objects in %s: %w", r.bucket, info.Err)
+		}
+		objects = append(objects, toObject(info))
+	}
+	return objects, nil
+}
+
+// OpenObject opens an object of the current bucket for reading. The caller
+// closes the returned reader. A missing object returns ErrObjectNotFound.
+func (r *Repository) OpenObject(ctx context.Context, key string) (io.ReadCloser, Object, error) {
+	obj, err := r.client.GetObject(ctx, r.bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, Object{}, r.readError(key, err)
+	}
+	// GetObject is lazy, Stat sends the request and reports a missing object
+	info, err := obj.Stat()
+	if err != nil {
+		obj.Close()
+		return nil, Object{}, r.readError(key, err)
+	}
+	return obj, toObject(info), nil
+}
+
+// StatObject returns the information of an object of the current bucket
+// without reading it. A missing object returns ErrObjectNotFound.
+func (r *Repository) StatObject(ctx context.Context, key string) (Object, error) {
+	info, err := r.client.StatObject(ctx, r.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return Object{}, r.readError(key, err)
+	}
+	return toObject(info), nil
+}
+
+// ReadObject reads a whole object of the current bucket. A missing object
+// returns ErrObjectNotFound.
+func (r *Repository) ReadObject(ctx context.Context, key string) ([]byte, Object, error) {
+	reader, object, err := r.OpenObject(ctx, key)
+	if err != nil {
+		return nil, Object{}, err
+	}
+	defer reader.Close()
+
+	data, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, Object{}, r.readError(key, err)
+	}
+	return data, object, nil
+}
+
+// readError wraps a failed read of key, mapping missing objects to ErrObjectNotFound
+func (r *Repository) readError(key string, err error) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		return fmt.Errorf("%w: %s/%s", ErrObjectNotFound, r.bucket, key)
+	}
+	return fmt.Errorf("failed to read %s/%s: %w", r.bucket, key, err)
+}
+
+// toObject converts the object info of the client
+func toObject(info minio.ObjectInfo) Object {
+	object := Object{
+		Key:          info.Key,
+		Size:         info.Size,
+		ETag:         info.ETag,
+		LastModified: info.LastModified,
+		ContentType:  info.ContentType,
+		Metadata:     info.UserMetadata,
+	}
+	if object.ContentType == "" {
+		// Listings with metadata return it among the user metadata
+		object.ContentType = object.MetadataValue("Content-Type")
+	}
+	return object
+}
@@ -10,20 +10,24 @@ import (
 	"io"
 	"os"
 	"path/filepath"
-	"sync"
+	"strings"
 	"time"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
-	. "github.com/savabush/obsidian-sync/internal/config"
-	
+	"github.com/savabush/obsidian-sync/internal/config"
 )
 
-
 // MinioClient defines the interface for MinIO operations
 type MinioClient interface {
 	PutObject(ctx context.Context, bucketName, objectName string, reader io.Reader, objectSize int64, opts minio.PutObjectOptions) (minio.UploadInfo, error)
 	StatObject(ctx context.Context, bucketName, objectName string, opts minio.StatObjectOptions) (minio.ObjectInfo, error)
+	GetObject(ctx context.Context, bucketName, objectName string, opts minio.GetObjectOptions) (*minio.Object, error)
+	ListObjects(ctx context.Context, bucketName string, opts minio.ListObjectsOptions) <-chan minio.ObjectInfo
+	BucketExists(ctx context.Context, bucketName string) (bool, error)
+	MakeBucket(ctx context.Context, bucketName string, opts minio.MakeBucketOptions) error
+	SetBucketPolicy(ctx context.Context, bucketName, policy string) error
+	RemoveObject(ctx context.Context, bucketName, objectName string, opts minio.RemoveObjectOptions) error
 }
 
 // Repository handles MinIO storage operations with support for concurrent uploads,
@@ -37,7 +41,11 @@ type Repository struct {
 	maxRetries int
 	retryDelay time.Duration
 	putOpts    minio.PutObjectOptions
-	mu         sync.Mutex // Protects metadata access
+	numWorkers int
+	dryRun     bool
+	logger     config.LoggerInterface
+	// progress is called after every applied plan item
+	progress func(PlanItem)
 }
 
 // RepositoryConfig holds the configuration parameters for the MinIO repository.
@@ -59,6 +67,12 @@ type RepositoryConfig struct {
 	ContentLanguage string
 	// ContentType specifies the MIME type of the content
 	ContentType string
+	// UseSSL enables TLS for the connection to MinIO
+	UseSSL bool
+	// NumWorkers is the number of concurrent uploads and removals (default 5)
+	NumWorkers int
+	// DryRun disables all writes; uploads and removals are only logged
+	DryRun bool
 }
 
 // File represents a file to be uploaded to MinIO storage.
@@ -68,10 +82,60 @@ type File struct {
 	Name string
 	// Path is the local file path (optional if Content is provided)
 	Path string
-	// Content is the file content (optional if Path is provided)
+	// Content is the file content, uploaded instead of Path when not nil
 	Content []byte
-	// Metadata is optional custom metadata to attach to the file
+	// Metadata is optional custom metadata to attach to the file, added to
+	// the default metadata of the repository
 	Metadata map[string]string
+	// ContentType overrides the default content type of the repository
+	ContentType string
+}
+
+// Object describes an object stored in a MinIO bucket.
+type Object struct {
+	// Key is the object name inside the bucket
+	Key string `json:"key"`
+	// Size is the object size in bytes
+	Size int64 `json:"size"`
+	// ETag is the object entity tag (MD5 of the content for single part uploads)
+	ETag string `json:"etag"`
+	// LastModified is the time the object was last written
+	LastModified time.Time `json:"last_modified"`
+	// ContentType is the MIME type of the object
+	ContentType string `json:"content_type,omitempty"`
+	// Metadata is the custom user metadata attached to the object
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// Metadata of note objects holding the dates of the note, RFC 3339 times
+// taken from its frontmatter, else from the vault history
+const (
+	MetaNoteCreated = "note-created"
+	MetaNoteUpdated = "note-updated"
+)
+
+// Metadata of image objects holding the size in pixels they display at
+const (
+	MetaImageWidth  = "image-width"
+	MetaImageHeight = "image-height"
+)
+
+// metaPrefix is the header prefix of user metadata
+const metaPrefix = "X-Amz-Meta-"
+
+// MetadataValue returns the user metadata value of name, ignoring case.
+// Listings return the names with their X-Amz-Meta- header prefix, object
+// info without it; both are matched.
+func (o Object) MetadataValue(name string) string {
+	for key, value := range o.Metadata {
+		if len(key) > len(metaPrefix) && strings.EqualFold(key[:len(metaPrefix)], metaPrefix) {
+			key = key[len(metaPrefix):]
+		}
+		if strings.EqualFold(key, name) {
+			return value
+		}
+	}
+	return ""
 }
 
 // For testing
@@ -79,19 +143,20 @@ var (
 	NewRepositoryFunc = NewRepository
 )
 
-// NewRepository creates a new MinIO repository instance with the provided configuration.
-// It initializes the MinIO client and sets up default upload options.
+// NewRepository creates a new MinIO repository instance with the provided configuration
+// and logger. It initializes the MinIO client and sets up default upload options.
 // Returns an error if the client initialization fails.
-func NewRepository(cfg RepositoryConfig) (*Repository, error) {
-	Logger.Info("Initializing MinIO repository")
-	
+func NewRepository(cfg RepositoryConfig, logger config.LoggerInterface) (*Repository, error) {
+	logger = config.ForPackage(logger, "minio")
+	logger.Info("Initializing MinIO repository")
+
 	client, err := minio.New(cfg.Endpoint, &minio.Options{
 		Creds: credentials.NewStaticV4(
 			cfg.AccessKey,
 			cfg.SecretKey,
 			"",
 		),
-		Secure: false,
+		Secure: cfg.UseSSL,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("failed to create MinIO client: %w", err)
@@ -117,27 +182,53 @@ func NewRepository(cfg RepositoryConfig) (*Repository, error) {
 		maxRetries: cfg.MaxRetries,
 		retryDelay: cfg.RetryDelay,
 		putOpts:    opts,
+		numWorkers: cfg.NumWorkers,
+		dryRun:     cfg.DryRun,
+		logger:     logger,
+	}
+	if repo.numWorkers <= 0 {
+		repo.numWorkers = 5
 	}
 
-	Logger.Info("MinIO repository initialized successfully")
+	logger.Info("MinIO repository initialized successfully")
 	return repo, nil
 }
 
 // UploadFile uploads a single file to MinIO storage.
 // It supports both content-based and path-based uploads, with automatic MD5 checksum
 // calculation and metadata handling. The function properly manages resources and
-// provides detailed error information.
+// provides detailed error information. In dry-run mode the upload is only logged.
 func (r *Repository) UploadFile(file File) error {
-	r.mu.Lock()
+	return r.uploadFile(r.ctx, file)
+}
+
+// uploadFile uploads a file within ctx, logging with its correlation IDs
+func (r *Repository) uploadFile(ctx context.Context, file File) error {
+	if r.dryRun {
+		r.objectLogger(ctx, file.Name).Infof("Dry run: would upload file: %s", file.Name)
+		return nil
+	}
+
+	// Uploads run concurrently, every file gets its own copy of the options
+	opts := r.putOpts
 	if file.Metadata != nil {
-		r.putOpts.UserMetadata = file.Metadata
+		opts.UserMetadata = make(map[string]string, len(r.putOpts.UserMetadata)+len(file.Metadata))
+		for key, value := range r.putOpts.UserMetadata {
+			opts.UserMetadata[key] = value
+		}
+		for key, value := range file.Metadata {
+			opts.UserMetadata[key] = value
+		}
+	}
+
+	if file.ContentType != "" {
+		opts.ContentType = file.ContentType
 	}
-	r.mu.Unlock()
 
 	var reader io.Reader
 	var size int64
 
-	if len(file.Content) > 0 {
+	if file.Content != nil {
 		reader = bytes.NewReader(file.Content)
 		size = int64(len(file.Content))
 	} else if file.Path != "" {
@@ -158,27 +249,40 @@ func (r *Repository) UploadFile(file File) error {
 		return fmt.Errorf("either Content or Path must be provided")
 	}
 
-	Logger.Infof("Uploading file: %s", file.Name)
-	info, err := r.client.PutObject(r.ctx, r.bucket, file.Name, reader, size, r.putOpts)
+	logger := r.objectLogger(ctx, file.Name)
+	logger.Infof("Uploading file: %s", file.Name)
+	info, err := r.client.PutObject(ctx, r.bucket, file.Name, reader, size, opts)
 	if err != nil {
 		return fmt.Errorf("failed to upload file: %v", err)
 	}
 
-	Logger.Infof("File uploaded successfully: %s, size: %d", file.Name, info.Size)
+	logger.WithField("size", info.Size).Infof("File uploaded successfully: %s, size: %d", file.Name, info.Size)
 	return nil
 }
 
-// UploadFiles concurrently uploads multiple files from a directory to MinIO storage.
-// It walks through the directory tree, uploading files while maintaining a maximum
-// number of concurrent uploads. The function provides proper error aggregation and
-// resource management.
-func (r *Repository) UploadFiles(dirPath string) error {
-	Logger.Infof("Uploading files from directory: %s", dirPath)
+// UploadFiles synchronizes a directory with the current bucket. It collects
+// the files of the directory tree, plans the changes against the bucket and
+// applies the plan, uploading new and changed files and removing objects
+// that no longer exist locally. The applied plan is returned.
+func (r *Repository) UploadFiles(dirPath string) (*Plan, error) {
+	r.log().Infof("Uploading files from directory: %s", dirPath)
 
-	var wg sync.WaitGroup
-	errChan := make(chan error, 100)
-	semaphore := make(chan struct{}, 5) // Limit concurrent uploads
+	files, err := CollectFiles(dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := r.Plan(files)
+	if err != nil {
+		return nil, err
+	}
+	return plan, r.Apply(plan)
+}
 
+// CollectFiles walks a directory tree and returns every regular file in it.
+// Object names are the slash-separated paths relative to dirPath.
+func CollectFiles(dirPath string) ([]File, error) {
+	var files []File
 	err := filepath.Walk(dirPath, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return err
@@ -192,72 +296,44 @@ func (r *Repository) UploadFiles(dirPath string) error {
 			return fmt.Errorf("failed to get relative path: %w", err)
 		}
 
-		wg.Add(1)
-		go func(filePath, objectName string) {
-			defer wg.Done()
-			semaphore <- struct{}{} // Acquire
-			defer func() { <-semaphore }() // Release
-
-			file := File{
-				Name: objectName,
-				Path: filePath,
-			}
-
-			if err := r.uploadWithRetry(file); err != nil {
-				errChan <- fmt.Errorf("failed to upload %s: %w", objectName, err)
-			}
-		}(path, relPath)
-
+		files = append(files, File{
+			Name: filepath.ToSlash(relPath),
+			Path: path,
+		})
 		return nil
 	})
-
 	if err != nil {
-		return fmt.Errorf("failed to walk directory: %w", err)
-	}
-
-	// Wait for all uploads to complete
-	wg.Wait()
-	close(errChan)
-
-	// Collect any errors
-	var errs []error
-	for err := range errChan {
-		errs = append(errs, err)
+		return nil, fmt.Errorf("failed to walk directory: %w", err)
 	}
+	return files, nil
+}
 
-	if len(errs) > 0 {
-		return fmt.Errorf("failed to upload some files: %v", errs)
-	}
+// log returns the logger with the correlation IDs of the repository context attached
+func (r *Repository) log() config.LoggerInterface {
+	return config.ContextLogger(r.logger, r.ctx)
+}
 
-	return nil
+// objectLogger returns the logger with the correlation IDs of ctx and the
+// bucket and object fields attached
+func (r *Repository) objectLogger(ctx context.Context, key string) config.LoggerInterface {
+	return config.ContextLogger(r.logger, ctx).WithFields(config.Fields{"bucket": r.bucket, "object": key})
 }
 
-// uploadWithRetry attempts to upload a file with automatic retry logic.
-// It checks for file existence before each attempt and implements exponential
-// backoff between retries. The function provides detailed error information
-// about each retry attempt.
-func (r *Repository) uploadWithRetry(file File) error {
+// uploadWithRetry attempts to upload a file with automatic retry logic,
+// waiting retryDelay between attempts. The function provides detailed error
+// information about the last failed attempt.
+func (r *Repository) uploadWithRetry(ctx context.Context, file File) error {
 	var lastErr error
 	for attempt := 0; attempt < r.maxRetries; attempt++ {
 		if attempt > 0 {
-			Logger.Infof("Retry attempt %d/%d for file %s", attempt+1, r.maxRetries, file.Name)
+			r.objectLogger(ctx, file.Name).WithField("attempt", attempt+1).
+				Infof("Retry attempt %d/%d for file %s", attempt+1, r.maxRetries, file.Name)
 			time.Sleep(r.retryDelay)
 		}
 
-		exists, err := r.CheckFileExists(file.Name)
-		if err != nil && minio.ToErrorResponse(err).Code != "NoSuchKey" {
-			lastErr = err
-			continue
-		}
-		if exists {
+		if lastErr = r.uploadFile(ctx, file); lastErr == nil {
 			return nil
 		}
-
-		if err := r.UploadFile(file); err == nil {
-			return nil
-		} else {
-			lastErr = err
-		}
 	}
 	return fmt.Errorf("failed after %d attempts: %v", r.maxRetries, lastErr)
 }
@@ -276,6 +352,61 @@ func (r *Repository) CheckFileExists(filename string) (bool, error) {
 	return true, nil
 }
 
+// BucketExists reports whether the current bucket exists.
+func (r *Repository) BucketExists() (bool, error) {
+	return r.client.BucketExists(r.ctx, r.bucket)
+}
+
+// publicReadPolicy is the bucket policy letting anyone read the objects of
+// the bucket named by %s, but not list or write them
+const publicReadPolicy = `{"Version":"2012-10-17","Statement":[{"Effect":"Allow","Principal":{"AWS":["*"]},` +
+	`"Action":["s3:GetObject"],"Resource":["arn:aws:s3:::%s/*"]}]}`
+
+// EnsurePublicBucket creates the current bucket when it does not exist and
+// lets anyone read its objects. An existing bucket and its policy are left
+// as they are. In dry-run mode the creation is only logged.
+func (r *Repository) EnsurePublicBucket() error {
+	exists, err := r.BucketExists()
+	if err != nil {
+		return fmt.Errorf("failed to check bucket %s: %w", r.bucket, err)
+	}
+	if exists {
+		return nil
+	}
+	if r.dryRun {
+		r.log().Infof("Dry run: would create public bucket %s", r.bucket)
+		return nil
+	}
+	err = r.client.MakeBucket(r.ctx, r.bucket, minio.MakeBucketOptions{})
+	// Created meanwhile by another run, which may not have set the policy yet
+	if err != nil && minio.ToErrorResponse(err).Code != "BucketAlreadyOwnedByYou" {
+		return fmt.Errorf("failed to create bucket %s: %w", r.bucket, err)
+	}
+	if err := r.client.SetBucketPolicy(r.ctx, r.bucket, fmt.Sprintf(publicReadPolicy, r.bucket)); err != nil {
+		return fmt.Errorf("failed to make bucket %s public: %w", r.bucket, err)
+	}
+	r.log().WithField("bucket", r.bucket).Infof("Created public bucket %s", r.bucket)
+	return nil
+}
+
+// ListObjects returns all objects in the current bucket under the given prefix.
+// When withMetadata is true the custom user metadata of each object is included.
+func (r *Repository) ListObjects(prefix string, withMetadata bool) ([]Object, error) {
+	return r.ListObjectsContext(r.ctx, prefix, withMetadata)
+}
+
+// SetContext sets the context of subsequent operations. Its correlation
+// IDs are added to every log line of the repository.
+func (r *Repository) SetContext(ctx context.Context) {
+	r.ctx = ctx
+}
+
+// SetProgress sets a function called after every plan item Apply uploads or
+// removes, with Error set when it failed. It is called concurrently.
+func (r *Repository) SetProgress(fn func(PlanItem)) {
+	r.progress = fn
+}
+
 // SetBucket changes the target bucket for subsequent operations
 func (r *Repository) SetBucket(bucket string) {
 	r.bucket = bucket
@@ -286,6 +417,11 @@ func (r *Repository) GetBucket() string {
 	return r.bucket
 }
 
+// IsDryRun reports whether the repository only logs writes
+func (r *Repository) IsDryRun() bool {
+	return r.dryRun
+}
+
 // SetClient replaces the MinIO client (used for testing)
 func (r *Repository) SetClient(client MinioClient) {
 	r.client = client
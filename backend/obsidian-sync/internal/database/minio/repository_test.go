@@ -2,12 +2,18 @@ package minio_test
 
 import (
 	"context"
+	"crypto/md5"
+	"encoding/hex"
 	"errors"
+	"fmt"
 	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
-	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -17,6 +23,7 @@ import (
 	"github.com/stretchr/testify/require"
 
 	minio_repo "github.com/savabush/obsidian-sync/internal/database/minio"
+	"github.com/savabush/obsidian-sync/internal/lib"
 )
 
 // MockMinioClient is a mock implementation of the MinIO client interface
@@ -35,20 +42,55 @@ func (m *MockMinioClient) StatObject(ctx context.Context, bucketName, objectName
 	return args.Get(0).(minio.ObjectInfo), args.Error(1)
 }
 
+func (m *MockMinioClient) GetObject(ctx context.Context, bucketName, objectName string, opts minio.GetObjectOptions) (*minio.Object, error) {
+	args := m.Called(ctx, bucketName, objectName, opts)
+	return args.Get(0).(*minio.Object), args.Error(1)
+}
+
+func (m *MockMinioClient) ListObjects(ctx context.Context, bucketName string, opts minio.ListObjectsOptions) <-chan minio.ObjectInfo {
+	args := m.Called(ctx, bucketName, opts)
+	ch := make(chan minio.ObjectInfo, len(args.Get(0).([]minio.ObjectInfo)))
+	for _, info := range args.Get(0).([]minio.ObjectInfo) {
+		ch <- info
+	}
+	close(ch)
+	return ch
+}
+
+func (m *MockMinioClient) BucketExists(ctx context.Context, bucketName string) (bool, error) {
+	args := m.Called(ctx, bucketName)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockMinioClient) MakeBucket(ctx context.Context, bucketName string, opts minio.MakeBucketOptions) error {
+	args := m.Called(ctx, bucketName, opts)
+	return args.Error(0)
+}
+
+func (m *MockMinioClient) SetBucketPolicy(ctx context.Context, bucketName, policy string) error {
+	args := m.Called(ctx, bucketName, policy)
+	return args.Error(0)
+}
+
+func (m *MockMinioClient) RemoveObject(ctx context.Context, bucketName, objectName string, opts minio.RemoveObjectOptions) error {
+	args := m.Called(ctx, bucketName, objectName, opts)
+	return args.Error(0)
+}
+
 func setupTestRepo(t *testing.T) (*minio_repo.Repository, *MockMinioClient, func()) {
 	mockClient := new(MockMinioClient)
 	cfg := minio_repo.RepositoryConfig{
 		Endpoint:        "test:9000",
 		AccessKey:       "test",
 		SecretKey:       "test",
-		Bucket:         "test-bucket",
-		MaxRetries:     3,
-		RetryDelay:     time.Millisecond,
+		Bucket:          "test-bucket",
+		MaxRetries:      3,
+		RetryDelay:      time.Millisecond,
 		ContentLanguage: "en-US",
-		ContentType:    "application/octet-stream",
+		ContentType:     "application/octet-stream",
 	}
 
-	repo, err := minio_repo.NewRepository(cfg)
+	repo, err := minio_repo.NewRepository(cfg, lib.TestLog)
 	require.NoError(t, err)
 
 	// Replace the real client with our mock
@@ -85,6 +127,37 @@ func TestUploadFile(t *testing.T) {
 				).Return(minio.UploadInfo{}, nil)
 			},
 		},
+		{
+			name: "metadata added to the defaults",
+			file: minio_repo.File{
+				Name:     "note.md",
+				Content:  []byte("note"),
+				Metadata: map[string]string{minio_repo.MetaNoteCreated: "2024-05-01T00:00:00Z"},
+			},
+			setupMock: func(m *MockMinioClient) {
+				m.On("PutObject", mock.Anything, "test-bucket", "note.md", mock.Anything, int64(4),
+					mock.MatchedBy(func(opts minio.PutObjectOptions) bool {
+						return opts.UserMetadata[minio_repo.MetaNoteCreated] == "2024-05-01T00:00:00Z" &&
+							opts.UserMetadata["is-posted"] == "false"
+					}),
+				).Return(minio.UploadInfo{}, nil)
+			},
+		},
+		{
+			name: "content type override",
+			file: minio_repo.File{
+				Name:        "feed.json",
+				Content:     []byte("{}"),
+				ContentType: "application/feed+json",
+			},
+			setupMock: func(m *MockMinioClient) {
+				m.On("PutObject", mock.Anything, "test-bucket", "feed.json", mock.Anything, int64(2),
+					mock.MatchedBy(func(opts minio.PutObjectOptions) bool {
+						return opts.ContentType == "application/feed+json"
+					}),
+				).Return(minio.UploadInfo{}, nil)
+			},
+		},
 		{
 			name: "upload failure",
 			file: minio_repo.File{
@@ -135,20 +208,15 @@ func TestUploadFiles(t *testing.T) {
 	require.NoError(t, os.WriteFile(file2Path, []byte("test content 2"), 0644))
 
 	tests := []struct {
-		name          string
-		setupMock     func(*MockMinioClient)
-		expectedError string
+		name           string
+		setupMock      func(*MockMinioClient)
+		expectedErrors []string
 	}{
 		{
 			name: "successful upload of directory",
 			setupMock: func(m *MockMinioClient) {
-				// First file
-				m.On("StatObject",
-					mock.Anything,
-					"test-bucket",
-					"file1.txt",
-					mock.Anything,
-				).Return(minio.ObjectInfo{}, minio.ErrorResponse{Code: "NoSuchKey"}).Once()
+				m.On("BucketExists", mock.Anything, "test-bucket").Return(true, nil)
+				m.On("ListObjects", mock.Anything, "test-bucket", mock.Anything).Return([]minio.ObjectInfo{})
 
 				m.On("PutObject",
 					mock.Anything,
@@ -159,14 +227,6 @@ func TestUploadFiles(t *testing.T) {
 					mock.Anything,
 				).Return(minio.UploadInfo{}, nil).Once()
 
-				// Second file
-				m.On("StatObject",
-					mock.Anything,
-					"test-bucket",
-					"file2.txt",
-					mock.Anything,
-				).Return(minio.ObjectInfo{}, minio.ErrorResponse{Code: "NoSuchKey"}).Once()
-
 				m.On("PutObject",
 					mock.Anything,
 					"test-bucket",
@@ -180,13 +240,8 @@ func TestUploadFiles(t *testing.T) {
 		{
 			name: "upload failure",
 			setupMock: func(m *MockMinioClient) {
-				// First file
-				m.On("StatObject",
-					mock.Anything,
-					"test-bucket",
-					"file1.txt",
-					mock.Anything,
-				).Return(minio.ObjectInfo{}, minio.ErrorResponse{Code: "NoSuchKey"}).Times(3)
+				m.On("BucketExists", mock.Anything, "test-bucket").Return(true, nil)
+				m.On("ListObjects", mock.Anything, "test-bucket", mock.Anything).Return([]minio.ObjectInfo{})
 
 				m.On("PutObject",
 					mock.Anything,
@@ -197,14 +252,6 @@ func TestUploadFiles(t *testing.T) {
 					mock.Anything,
 				).Return(minio.UploadInfo{}, errors.New("upload failed")).Times(3)
 
-				// Second file
-				m.On("StatObject",
-					mock.Anything,
-					"test-bucket",
-					"file2.txt",
-					mock.Anything,
-				).Return(minio.ObjectInfo{}, minio.ErrorResponse{Code: "NoSuchKey"}).Times(3)
-
 				m.On("PutObject",
 					mock.Anything,
 					"test-bucket",
@@ -214,7 +261,10 @@ func TestUploadFiles(t *testing.T) {
 					mock.Anything,
 				).Return(minio.UploadInfo{}, errors.New("upload failed")).Times(3)
 			},
-			expectedError: "failed to upload some files: [failed to upload file2.txt: failed after 3 attempts: failed to upload file: upload failed failed to upload file1.txt: failed after 3 attempts: failed to upload file: upload failed]",
+			expectedErrors: []string{
+				"failed to create file1.txt: failed after 3 attempts: failed to upload file: upload failed",
+				"failed to create file2.txt: failed after 3 attempts: failed to upload file: upload failed",
+			},
 		},
 	}
 
@@ -225,20 +275,18 @@ func TestUploadFiles(t *testing.T) {
 
 			tt.setupMock(mockClient)
 
-			err := repo.UploadFiles(tempDir)
-			if tt.expectedError != "" {
-				// Split error messages into parts and sort them for order-independent comparison
-				actualParts := strings.Split(strings.TrimPrefix(err.Error(), "failed to upload some files: ["), "]")[0]
-				actualErrors := strings.Split(actualParts, " ")
-				sort.Strings(actualErrors)
-				actualSorted := "failed to upload some files: [" + strings.Join(actualErrors, " ") + "]"
-
-				expectedParts := strings.Split(strings.TrimPrefix(tt.expectedError, "failed to upload some files: ["), "]")[0]
-				expectedErrors := strings.Split(expectedParts, " ")
-				sort.Strings(expectedErrors)
-				expectedSorted := "failed to upload some files: [" + strings.Join(expectedErrors, " ") + "]"
-
-				assert.Equal(t, expectedSorted, actualSorted)
+			plan, err := repo.UploadFiles(tempDir)
+			require.NotNil(t, plan)
+			assert.Equal(t, 2, plan.Summary.Create)
+			if len(tt.expectedErrors) > 0 {
+				require.Error(t, err)
+				// Uploads run concurrently, so the error order is not fixed
+				for _, expected := range tt.expectedErrors {
+					assert.Contains(t, err.Error(), expected)
+				}
+				for _, item := range plan.Items {
+					assert.NotEmpty(t, item.Error)
+				}
 			} else {
 				assert.NoError(t, err)
 			}
@@ -311,3 +359,455 @@ func TestCheckFileExists(t *testing.T) {
 		})
 	}
 }
+
+func TestListObjects(t *testing.T) {
+	modified := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name          string
+		setupMock     func(*MockMinioClient)
+		expected      []minio_repo.Object
+		expectedError string
+	}{
+		{
+			name: "objects with metadata",
+			setupMock: func(m *MockMinioClient) {
+				m.On("ListObjects",
+					mock.Anything,
+					"test-bucket",
+					minio.ListObjectsOptions{Prefix: "post", Recursive: true, WithMetadata: true},
+				).Return([]minio.ObjectInfo{
+					{Key: "post/post.md", Size: 10, ETag: "abc", LastModified: modified,
+						UserMetadata: minio.StringMap{"is-posted": "false"}},
+				})
+			},
+			expected: []minio_repo.Object{
+				{Key: "post/post.md", Size: 10, ETag: "abc", LastModified: modified,
+					Metadata: map[string]string{"is-posted": "false"}},
+			},
+		},
+		{
+			name: "listing error",
+			setupMock: func(m *MockMinioClient) {
+				m.On("ListObjects", mock.Anything, "test-bucket", mock.Anything).
+					Return([]minio.ObjectInfo{{Err: errors.New("access denied")}})
+			},
+			expectedError: "access denied",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo, mockClient, cleanup := setupTestRepo(t)
+			defer cleanup()
+
+			tt.setupMock(mockClient)
+
+			objects, err := repo.ListObjects("post", true)
+			if tt.expectedError != "" {
+				assert.ErrorContains(t, err, tt.expectedError)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expected, objects)
+			}
+		})
+	}
+}
+
+func TestPlan(t *testing.T) {
+	tempDir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(tempDir, "post"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "post", "new.md"), []byte("new"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "post", "same.md"), []byte("same"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "post", "changed.md"), []byte("changed"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "post", "big.png"), []byte("big"), 0644))
+
+	files, err := minio_repo.CollectFiles(tempDir)
+	require.NoError(t, err)
+
+	t.Run("existing bucket", func(t *testing.T) {
+		repo, mockClient, cleanup := setupTestRepo(t)
+		defer cleanup()
+
+		mockClient.On("BucketExists", mock.Anything, "test-bucket").Return(true, nil)
+		mockClient.On("ListObjects", mock.Anything, "test-bucket", mock.Anything).Return([]minio.ObjectInfo{
+			{Key: "post/same.md", Size: 4, ETag: md5Hex("same")},
+			{Key: "post/changed.md", Size: 3, ETag: "0123456789abcdef0123456789abcdef"},
+			{Key: "post/big.png", Size: 3, ETag: "0123456789abcdef0123456789abcdef-2"},
+			{Key: "post/removed.md", Size: 7, ETag: "0123456789abcdef0123456789abcdef"},
+		})
+
+		plan, err := repo.Plan(files)
+		require.NoError(t, err)
+
+		actions := make(map[string]string)
+		for _, item := range plan.Items {
+			actions[item.Key] = item.Action
+		}
+		assert.Equal(t, map[string]string{
+			"post/new.md":     minio_repo.ActionCreate,
+			"post/same.md":    minio_repo.ActionSkip,
+			"post/changed.md": minio_repo.ActionUpdate,
+			"post/big.png":    minio_repo.ActionSkip,
+			"post/removed.md": minio_repo.ActionDelete,
+		}, actions)
+		assert.Equal(t, minio_repo.PlanSummary{
+			Create: 1, Update: 1, Delete: 1, Skip: 2,
+			UploadBytes: int64(len("new") + len("changed")),
+			DeleteBytes: 7,
+		}, plan.Summary)
+		assert.True(t, plan.Changed())
+		assert.Equal(t, []string{"post/removed.md"}, plan.Keys(minio_repo.ActionDelete))
+	})
+
+	t.Run("metadata", func(t *testing.T) {
+		repo, mockClient, cleanup := setupTestRepo(t)
+		defer cleanup()
+
+		dated := []minio_repo.File{
+			{Name: "a.md", Content: []byte("a"), Metadata: map[string]string{minio_repo.MetaNoteCreated: "2024-05-01T00:00:00Z"}},
+			{Name: "b.md", Content: []byte("b"), Metadata: map[string]string{minio_repo.MetaNoteCreated: "2024-05-01T00:00:00Z"}},
+			{Name: "c.md", Content: []byte("c")},
+			{Name: "d.xml", Content: []byte("d"), ContentType: "application/xml"},
+			{Name: "e.xml", Content: []byte("e"), ContentType: "application/xml"},
+		}
+		mockClient.On("BucketExists", mock.Anything, "test-bucket").Return(true, nil)
+		mockClient.On("ListObjects", mock.Anything, "test-bucket",
+			minio.ListObjectsOptions{Recursive: true, WithMetadata: true}).Return([]minio.ObjectInfo{
+			{Key: "a.md", Size: 1, ETag: md5Hex("a"), UserMetadata: minio.StringMap{"X-Amz-Meta-Note-Created": "2024-05-01T00:00:00Z"}},
+			{Key: "b.md", Size: 1, ETag: md5Hex("b"), UserMetadata: minio.StringMap{"X-Amz-Meta-Note-Created": "2024-06-01T00:00:00Z"}},
+			{Key: "c.md", Size: 1, ETag: md5Hex("c")},
+			{Key: "d.xml", Size: 1, ETag: md5Hex("d"), UserMetadata: minio.StringMap{"content-type": "text/plain"}},
+			{Key: "e.xml", Size: 1, ETag: md5Hex("e"), UserMetadata: minio.StringMap{"content-type": "application/xml"}},
+		})
+
+		plan, err := repo.Plan(dated)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"b.md", "d.xml"}, plan.Keys(minio_repo.ActionUpdate))
+		assert.Equal(t, "metadata note-created changed", plan.Items[1].Reason)
+		assert.Equal(t, "metadata content-type changed", plan.Items[3].Reason)
+	})
+
+	t.Run("prefix", func(t *testing.T) {
+		repo, mockClient, cleanup := setupTestRepo(t)
+		defer cleanup()
+
+		mockClient.On("BucketExists", mock.Anything, "test-bucket").Return(true, nil)
+		mockClient.On("ListObjects", mock.Anything, "test-bucket",
+			minio.ListObjectsOptions{Prefix: "blog/", Recursive: true}).Return([]minio.ObjectInfo{
+			{Key: "blog/rss.xml", Size: 3, ETag: md5Hex("rss")},
+			{Key: "blog/en/rss.xml", Size: 3, ETag: md5Hex("rss")},
+			{Key: "blogroll.xml", Size: 3, ETag: md5Hex("rss")},
+		})
+
+		plan, err := repo.PlanPrefix("blog/", []minio_repo.File{{Name: "blog/rss.xml", Content: []byte("rss")}})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"blog/rss.xml"}, plan.Keys(minio_repo.ActionSkip))
+		assert.Equal(t, []string{"blog/en/rss.xml"}, plan.Keys(minio_repo.ActionDelete),
+			"objects outside of the prefix are kept")
+	})
+
+	t.Run("files", func(t *testing.T) {
+		repo, mockClient, cleanup := setupTestRepo(t)
+		defer cleanup()
+
+		mockClient.On("BucketExists", mock.Anything, "test-bucket").Return(true, nil)
+		mockClient.On("ListObjects", mock.Anything, "test-bucket", mock.Anything).Return([]minio.ObjectInfo{
+			{Key: "robots.txt", Size: 3, ETag: md5Hex("old")},
+			{Key: "sitemaps/blog/sitemap-1.xml", Size: 3, ETag: md5Hex("xml")},
+		})
+
+		plan, err := repo.PlanFiles([]minio_repo.File{
+			{Name: "robots.txt", Content: []byte("new")},
+			{Name: "sitemap.xml", Content: []byte("xml")},
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"robots.txt"}, plan.Keys(minio_repo.ActionUpdate))
+		assert.Equal(t, []string{"sitemap.xml"}, plan.Keys(minio_repo.ActionCreate))
+		assert.Empty(t, plan.Keys(minio_repo.ActionDelete), "other objects are kept")
+	})
+
+	t.Run("missing bucket", func(t *testing.T) {
+		repo, mockClient, cleanup := setupTestRepo(t)
+		defer cleanup()
+
+		mockClient.On("BucketExists", mock.Anything, "test-bucket").Return(false, nil)
+
+		plan, err := repo.Plan(files)
+		require.NoError(t, err)
+		assert.Equal(t, 4, plan.Summary.Create)
+		assert.Equal(t, "bucket does not exist", plan.Items[0].Reason)
+	})
+}
+
+func TestApply(t *testing.T) {
+	tempDir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(tempDir, "new.md"), []byte("new"), 0644))
+	files, err := minio_repo.CollectFiles(tempDir)
+	require.NoError(t, err)
+
+	setupPlan := func(m *MockMinioClient) {
+		m.On("BucketExists", mock.Anything, "test-bucket").Return(true, nil)
+		m.On("ListObjects", mock.Anything, "test-bucket", mock.Anything).Return([]minio.ObjectInfo{
+			{Key: "old.md", Size: 3, ETag: md5Hex("old")},
+		})
+	}
+
+	t.Run("real run", func(t *testing.T) {
+		repo, mockClient, cleanup := setupTestRepo(t)
+		defer cleanup()
+
+		setupPlan(mockClient)
+		mockClient.On("PutObject", mock.Anything, "test-bucket", "new.md", mock.Anything, int64(3), mock.Anything).
+			Return(minio.UploadInfo{}, nil).Once()
+		mockClient.On("RemoveObject", mock.Anything, "test-bucket", "old.md", mock.Anything).Return(nil).Once()
+
+		plan, err := repo.Plan(files)
+		require.NoError(t, err)
+		require.NoError(t, repo.Apply(plan))
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		mockClient := new(MockMinioClient)
+		repo, err := minio_repo.NewRepository(minio_repo.RepositoryConfig{
+			Endpoint:   "test:9000",
+			Bucket:     "test-bucket",
+			MaxRetries: 3,
+			DryRun:     true,
+		}, lib.TestLog)
+		require.NoError(t, err)
+		repo.SetClient(mockClient)
+		assert.True(t, repo.IsDryRun())
+
+		setupPlan(mockClient)
+
+		plan, err := repo.Plan(files)
+		require.NoError(t, err)
+		require.NoError(t, repo.Apply(plan))
+		require.NoError(t, repo.UploadFile(minio_repo.File{Name: "x", Content: []byte("x")}))
+		require.NoError(t, repo.RemoveFile("x"))
+
+		assert.Equal(t, 1, plan.Summary.Create)
+		assert.Equal(t, 1, plan.Summary.Delete)
+		mockClient.AssertExpectations(t)
+		mockClient.AssertNotCalled(t, "PutObject", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+		mockClient.AssertNotCalled(t, "RemoveObject", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+	})
+}
+
+// md5Hex returns the hex MD5 of s, as MinIO reports it in the ETag
+func md5Hex(s string) string {
+	sum := md5.Sum([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// leaseStore is an in-memory bucket honoring the conditional writes of leases
+type leaseStore struct {
+	MockMinioClient
+	mu      sync.Mutex
+	objects map[string]minio.ObjectInfo
+	version int
+}
+
+func newLeaseStore() *leaseStore {
+	return &leaseStore{objects: make(map[string]minio.ObjectInfo)}
+}
+
+func (s *leaseStore) PutObject(ctx context.Context, bucketName, objectName string, reader io.Reader, objectSize int64,
+	opts minio.PutObjectOptions) (minio.UploadInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current, exists := s.objects[objectName]
+	header := opts.Header()
+	if match := header.Get("If-Match"); match != "" && (!exists || match != `"`+current.ETag+`"`) {
+		return minio.UploadInfo{}, minio.ErrorResponse{Code: "PreconditionFailed"}
+	}
+	if header.Get("If-None-Match") == "*" && exists {
+		return minio.UploadInfo{}, minio.ErrorResponse{Code: "PreconditionFailed"}
+	}
+	s.version++
+	etag := fmt.Sprintf("etag-%d", s.version)
+	s.objects[objectName] = minio.ObjectInfo{Key: objectName, ETag: etag, UserMetadata: opts.UserMetadata}
+	return minio.UploadInfo{ETag: etag}, nil
+}
+
+func (s *leaseStore) StatObject(ctx context.Context, bucketName, objectName string, opts minio.StatObjectOptions) (minio.ObjectInfo, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	info, ok := s.objects[objectName]
+	if !ok {
+		return minio.ObjectInfo{}, minio.ErrorResponse{Code: "NoSuchKey"}
+	}
+	return info, nil
+}
+
+func (s *leaseStore) RemoveObject(ctx context.Context, bucketName, objectName string, opts minio.RemoveObjectOptions) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.objects, objectName)
+	return nil
+}
+
+// newLease creates a lease on the store
+func newLease(t *testing.T, store *leaseStore, ttl time.Duration) *minio_repo.Lease {
+	repo, err := minio_repo.NewRepository(minio_repo.RepositoryConfig{Endpoint: "test:9000", Bucket: "locks"}, lib.TestLog)
+	require.NoError(t, err)
+	repo.SetClient(store)
+	return repo.Lease("sync.lock", ttl)
+}
+
+func TestLease(t *testing.T) {
+	ctx := context.Background()
+	store := newLeaseStore()
+	lease := newLease(t, store, time.Minute)
+
+	first, _, err := lease.TryLock(ctx, "replica-1")
+	require.NoError(t, err)
+	require.NotNil(t, first)
+
+	second, holder, err := lease.TryLock(ctx, "replica-2")
+	require.NoError(t, err)
+	assert.Nil(t, second)
+	assert.Contains(t, holder, "replica-1 until ")
+
+	require.NoError(t, first.Release(ctx))
+	assert.Empty(t, store.objects, "a released lease is removed")
+
+	second, _, err = lease.TryLock(ctx, "replica-2")
+	require.NoError(t, err)
+	require.NotNil(t, second)
+	require.NoError(t, second.Release(ctx))
+}
+
+func TestLeaseExpired(t *testing.T) {
+	ctx := context.Background()
+	store := newLeaseStore()
+	store.objects["sync.lock"] = minio.ObjectInfo{ETag: "old", UserMetadata: map[string]string{
+		"Lock-Owner":   "crashed-replica",
+		"Lock-Expires": time.Now().Add(-time.Second).UTC().Format(time.RFC3339Nano),
+	}}
+
+	lock, _, err := newLease(t, store, time.Minute).TryLock(ctx, "replica-1")
+	require.NoError(t, err)
+	require.NotNil(t, lock, "an expired lease is taken over")
+	assert.Equal(t, "replica-1", store.objects["sync.lock"].UserMetadata["Lock-Owner"])
+	require.NoError(t, lock.Release(ctx))
+}
+
+func TestLeaseRenewal(t *testing.T) {
+	ctx := context.Background()
+	store := newLeaseStore()
+	lock, _, err := newLease(t, store, 60*time.Millisecond).TryLock(ctx, "replica-1")
+	require.NoError(t, err)
+	require.NotNil(t, lock)
+
+	// The lease is renewed past its first expiry
+	time.Sleep(100 * time.Millisecond)
+	store.mu.Lock()
+	renewed := store.version
+	store.mu.Unlock()
+	assert.Greater(t, renewed, 1)
+	select {
+	case <-lock.Lost():
+		t.Fatal("a renewed lease is not lost")
+	default:
+	}
+
+	// A lease taken over by another owner is lost at the next renewal
+	store.mu.Lock()
+	info := store.objects["sync.lock"]
+	info.ETag = "taken-over"
+	store.objects["sync.lock"] = info
+	store.mu.Unlock()
+	select {
+	case <-lock.Lost():
+	case <-time.After(time.Second):
+		t.Fatal("the lease was not lost")
+	}
+
+	require.NoError(t, lock.Release(ctx))
+	assert.Contains(t, store.objects, "sync.lock", "a lease taken over is not removed")
+}
+
+// newS3Server serves the objects of test-bucket over the S3 API for the
+// read operations, which need a real *minio.Object
+func newS3Server(t *testing.T, objects map[string]string) *minio_repo.Repository {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.URL.Query()["location"]; ok {
+			io.WriteString(w, `<LocationConstraint xmlns="http://s3.amazonaws.com/doc/2006-03-01/">us-east-1</LocationConstraint>`)
+			return
+		}
+		key := strings.TrimPrefix(r.URL.Path, "/test-bucket/")
+		content, ok := objects[key]
+		if !ok {
+			w.Header().Set("Content-Type", "application/xml")
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprintf(w, `<Error><Code>NoSuchKey</Code><Key>%s</Key><BucketName>test-bucket</BucketName></Error>`, key)
+			return
+		}
+		w.Header().Set("ETag", `"`+md5Hex(content)+`"`)
+		w.Header().Set("Last-Modified", time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC).Format(http.TimeFormat))
+		w.Header().Set("Content-Type", "text/markdown")
+		w.Header().Set("Content-Length", strconv.Itoa(len(content)))
+		w.Header().Set("X-Amz-Meta-Is-Posted", "false")
+		io.WriteString(w, content)
+	}))
+	t.Cleanup(srv.Close)
+
+	repo, err := minio_repo.NewRepository(minio_repo.RepositoryConfig{
+		Endpoint: strings.TrimPrefix(srv.URL, "http://"),
+		Bucket:   "test-bucket",
+	}, lib.TestLog)
+	require.NoError(t, err)
+	return repo
+}
+
+func TestReadObject(t *testing.T) {
+	ctx := context.Background()
+	repo := newS3Server(t, map[string]string{"Post/Post.md": "# Post"})
+
+	data, object, err := repo.ReadObject(ctx, "Post/Post.md")
+	require.NoError(t, err)
+	assert.Equal(t, "# Post", string(data))
+	assert.Equal(t, md5Hex("# Post"), object.ETag)
+	assert.Equal(t, int64(6), object.Size)
+	assert.Equal(t, "text/markdown", object.ContentType)
+	assert.Equal(t, "false", object.Metadata["Is-Posted"])
+	assert.Equal(t, time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC), object.LastModified.UTC())
+
+	_, _, err = repo.ReadObject(ctx, "Missing/Missing.md")
+	assert.ErrorIs(t, err, minio_repo.ErrObjectNotFound)
+}
+
+func TestEnsurePublicBucket(t *testing.T) {
+	repo, mockClient, cleanup := setupTestRepo(t)
+	defer cleanup()
+
+	mockClient.On("BucketExists", mock.Anything, "test-bucket").Return(true, nil).Once()
+	require.NoError(t, repo.EnsurePublicBucket(), "an existing bucket is left as it is")
+
+	mockClient.On("BucketExists", mock.Anything, "test-bucket").Return(false, nil)
+	mockClient.On("MakeBucket", mock.Anything, "test-bucket", minio.MakeBucketOptions{}).Return(nil).Once()
+	mockClient.On("SetBucketPolicy", mock.Anything, "test-bucket",
+		mock.MatchedBy(func(policy string) bool {
+			return strings.Contains(policy, `"Action":["s3:GetObject"],"Resource":["arn:aws:s3:::test-bucket/*"]`)
+		})).Return(nil).Once()
+	require.NoError(t, repo.EnsurePublicBucket())
+
+	mockClient.On("MakeBucket", mock.Anything, "test-bucket", minio.MakeBucketOptions{}).
+		Return(errors.New("access denied")).Once()
+	assert.EqualError(t, repo.EnsurePublicBucket(), "failed to create bucket test-bucket: access denied")
+}
+
+func TestStatObject(t *testing.T) {
+	ctx := context.Background()
+	repo := newS3Server(t, map[string]string{"Post/Resources/image.png": "png"})
+
+	object, err := repo.StatObject(ctx, "Post/Resources/image.png")
+	require.NoError(t, err)
+	assert.Equal(t, "Post/Resources/image.png", object.Key)
+	assert.Equal(t, md5Hex("png"), object.ETag)
+	assert.Equal(t, int64(3), object.Size)
+
+	_, err = repo.StatObject(ctx, "Post/Resources/missing.png")
+	assert.ErrorIs(t, err, minio_repo.ErrObjectNotFound)
+}
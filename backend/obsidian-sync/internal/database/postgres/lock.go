@@ -0,0 +1,131 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/savabush/obsidian-sync/internal/config"
+)
+
+// holderSQL describes the session holding an advisory lock by its
+// application_name, which TryLock sets to the lock owner
+const holderSQL = `SELECT a.application_name FROM pg_locks l JOIN pg_stat_activity a ON a.pid = l.pid
+WHERE l.locktype = 'advisory' AND l.granted AND (l.classid::bigint << 32) | l.objid::bigint = $1`
+
+// Locker takes a Postgres advisory lock named by a key. The lock is held
+// by an open transaction, so it is released when the transaction ends or
+// its connection is lost, and checked with a query every interval.
+type Locker struct {
+	db       DB
+	key      string
+	id       int64
+	interval time.Duration
+	logger   config.LoggerInterface
+}
+
+// Locker returns a locker for the advisory lock named key.
+func (r *Repository) Locker(key string, interval time.Duration) *Locker {
+	return &Locker{db: r.db, key: key, id: lockID(key), interval: interval, logger: r.logger}
+}
+
+// TryLock takes the lock for owner without waiting. When another session
+// holds it, it returns a nil lock and describes the holder.
+func (l *Locker) TryLock(ctx context.Context, owner string) (*Lock, string, error) {
+	tx, err := l.db.Begin(ctx)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to take lock %s: %w", l.key, err)
+	}
+	var acquired bool
+	if err := tx.QueryRow(ctx, "SELECT pg_try_advisory_xact_lock($1)", l.id).Scan(&acquired); err != nil {
+		tx.Rollback(ctx)
+		return nil, "", fmt.Errorf("failed to take lock %s: %w", l.key, err)
+	}
+	if !acquired {
+		tx.Rollback(ctx)
+		return nil, l.holder(ctx), nil
+	}
+	if _, err := tx.Exec(ctx, "SELECT set_config('application_name', $1, true)", owner); err != nil {
+		tx.Rollback(ctx)
+		return nil, "", fmt.Errorf("failed to take lock %s: %w", l.key, err)
+	}
+
+	lock := &Lock{tx: tx, key: l.key, lost: make(chan struct{}), stop: make(chan struct{}), done: make(chan struct{})}
+	go lock.check(l.interval, l.logger)
+	return lock, "", nil
+}
+
+// holder describes the session holding the lock, best effort
+func (l *Locker) holder(ctx context.Context) string {
+	var name string
+	err := l.db.QueryRow(ctx, holderSQL, l.id).Scan(&name)
+	if errors.Is(err, pgx.ErrNoRows) || (err == nil && name == "") {
+		return "another Postgres session"
+	}
+	if err != nil {
+		l.logger.Warnf("Failed to look up the holder of lock %s: %v", l.key, err)
+		return "another Postgres session"
+	}
+	return name
+}
+
+// Lock is a held advisory lock.
+type Lock struct {
+	tx   pgx.Tx
+	key  string
+	lost chan struct{}
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// Lost is closed when the connection holding the lock failed.
+func (l *Lock) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Release releases the lock by ending its transaction.
+func (l *Lock) Release(ctx context.Context) error {
+	l.once.Do(func() { close(l.stop) })
+	<-l.done
+	if err := l.tx.Rollback(ctx); err != nil && !errors.Is(err, pgx.ErrTxClosed) {
+		return fmt.Errorf("failed to release lock %s: %w", l.key, err)
+	}
+	return nil
+}
+
+// check queries the connection holding the lock every interval until
+// released, closing lost when the query fails
+func (l *Lock) check(interval time.Duration, logger config.LoggerInterface) {
+	defer close(l.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), interval)
+			_, err := l.tx.Exec(ctx, "SELECT 1")
+			cancel()
+			if err != nil {
+				logger.Errorf("Lost lock %s: %v", l.key, err)
+				close(l.lost)
+				return
+			}
+		case <-l.stop:
+			return
+		}
+	}
+}
+
+// lockID maps a lock key to a non-negative advisory lock ID
+func lockID(key string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(key))
+	return int64(h.Sum64() & math.MaxInt64)
+}
@@ -0,0 +1,23 @@
+-- The post catalog: one row per post of every synchronized section.
+-- The content stays in MinIO, object_key and resource_keys point to it.
+CREATE TABLE posts (
+    bucket        text        NOT NULL,
+    slug          text        NOT NULL,
+    section       text        NOT NULL,
+    title         text        NOT NULL,
+    language      text        NOT NULL DEFAULT '',
+    tags          text[]      NOT NULL DEFAULT '{}',
+    created_at    timestamptz,
+    updated_at    timestamptz,
+    object_key    text        NOT NULL,
+    resource_keys text[]      NOT NULL DEFAULT '{}',
+    checksum      text        NOT NULL,
+    commit_hash   text        NOT NULL DEFAULT '',
+    draft         boolean     NOT NULL DEFAULT false,
+    published     boolean     NOT NULL DEFAULT true,
+    synced_at     timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (bucket, slug)
+);
+
+CREATE INDEX posts_tags_idx ON posts USING gin (tags);
+CREATE INDEX posts_listing_idx ON posts (bucket, created_at DESC) WHERE published AND NOT draft;
@@ -0,0 +1,15 @@
+-- The run history: one row per synchronization run, written when the run
+-- starts and updated when it finishes. sections holds the per-section counts.
+CREATE TABLE sync_runs (
+    run_id       text        PRIMARY KEY,
+    triggered_by text        NOT NULL DEFAULT '',
+    state        text        NOT NULL,
+    dry_run      boolean     NOT NULL DEFAULT false,
+    commit_hash  text        NOT NULL DEFAULT '',
+    started_at   timestamptz NOT NULL,
+    finished_at  timestamptz,
+    error        text        NOT NULL DEFAULT '',
+    sections     jsonb       NOT NULL DEFAULT '[]'
+);
+
+CREATE INDEX sync_runs_started_at_idx ON sync_runs (started_at DESC);
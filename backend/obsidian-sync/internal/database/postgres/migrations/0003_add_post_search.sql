@@ -0,0 +1,20 @@
+-- Full-text search over the post catalog. The sync stores the headings and
+-- the plain text of every note, search is derived from them: tags and title
+-- weigh most, then headings, then the body. Words are stemmed as Russian and
+-- English, tags are kept as written.
+CREATE FUNCTION post_search_vector(title text, headings text, body text, tags text[])
+RETURNS tsvector
+LANGUAGE sql IMMUTABLE PARALLEL SAFE
+AS $$
+    SELECT setweight(to_tsvector('simple', array_to_string(tags, ' ')), 'A')
+        || setweight(to_tsvector('russian', title) || to_tsvector('english', title), 'A')
+        || setweight(to_tsvector('russian', headings) || to_tsvector('english', headings), 'B')
+        || setweight(to_tsvector('russian', body) || to_tsvector('english', body), 'C')
+$$;
+
+ALTER TABLE posts
+    ADD COLUMN headings text NOT NULL DEFAULT '',
+    ADD COLUMN body     text NOT NULL DEFAULT '',
+    ADD COLUMN search   tsvector GENERATED ALWAYS AS (post_search_vector(title, headings, body, tags)) STORED;
+
+CREATE INDEX posts_search_idx ON posts USING gin (search);
@@ -0,0 +1,73 @@
+// Package postgres keeps the post catalog and the run history in Postgres.
+//
+// The MinIO objects stay the source of the content; the catalog indexes
+// them so the blog backend can query posts without listing buckets. The
+// run history records every synchronization run. The schema is created
+// and upgraded by the embedded migrations in Connect.
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"github.com/savabush/obsidian-sync/internal/config"
+)
+
+// DB is the part of pgxpool.Pool the repository uses, so tests can mock it.
+type DB interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+	Begin(ctx context.Context) (pgx.Tx, error)
+	Close()
+}
+
+// Repository reads and writes the post catalog and the run history.
+type Repository struct {
+	db     DB
+	logger config.LoggerInterface
+}
+
+// NewRepository creates a repository on an open database.
+func NewRepository(db DB, logger config.LoggerInterface) *Repository {
+	return &Repository{db: db, logger: config.ForPackage(logger, "postgres")}
+}
+
+// Connect opens a connection pool to the configured database and applies
+// the pending migrations.
+func Connect(ctx context.Context, cfg config.PostgresConfig, logger config.LoggerInterface) (*Repository, error) {
+	poolCfg, err := pgxpool.ParseConfig(cfg.DSN())
+	if err != nil {
+		return nil, fmt.Errorf("invalid Postgres configuration: %w", err)
+	}
+	poolCfg.MaxConns = int32(cfg.MAX_CONNS)
+
+	pool, err := pgxpool.NewWithConfig(ctx, poolCfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to Postgres at %s: %w", cfg.HOST, err)
+	}
+	if err := pool.Ping(ctx); err != nil {
+		pool.Close()
+		return nil, fmt.Errorf("failed to connect to Postgres at %s: %w", cfg.HOST, err)
+	}
+
+	repo := NewRepository(pool, logger)
+	applied, err := Migrate(ctx, pool)
+	if err != nil {
+		pool.Close()
+		return nil, err
+	}
+	if applied > 0 {
+		repo.logger.Infof("Applied %d database migrations", applied)
+	}
+	return repo, nil
+}
+
+// Close closes the database connections.
+func (r *Repository) Close() {
+	r.db.Close()
+}
@@ -0,0 +1,258 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"github.com/savabush/obsidian-sync/internal/config"
+)
+
+// ErrNotFound is returned when a post is not in the catalog.
+var ErrNotFound = errors.New("post not found")
+
+// Post is a row of the post catalog.
+type Post struct {
+	Bucket   string   `json:"bucket"`
+	Slug     string   `json:"slug"`
+	Section  string   `json:"section"`
+	Title    string   `json:"title"`
+	Language string   `json:"language"`
+	Tags     []string `json:"tags"`
+	// CreatedAt and UpdatedAt are the dates of the post, else the time its
+	// note object was written. They are nil in rows stored without them.
+	CreatedAt *time.Time `json:"created_at"`
+	UpdatedAt *time.Time `json:"updated_at"`
+	// ObjectKey is the note object, ResourceKeys the objects of its resources
+	ObjectKey    string   `json:"object_key"`
+	ResourceKeys []string `json:"resource_keys"`
+	// Checksum is the MD5 of the note, Commit the vault commit it was synced from
+	Checksum string `json:"checksum"`
+	Commit   string `json:"commit"`
+	// Draft and Published are the workflow flags of the note
+	Draft     bool      `json:"draft"`
+	Published bool      `json:"published"`
+	SyncedAt  time.Time `json:"synced_at"`
+	// Headings and Body are the text the search column is built from. They
+	// are written by SyncPosts but not read back.
+	Headings string `json:"-"`
+	Body     string `json:"-"`
+}
+
+// postColumns are the selected columns in the order scanPost reads them
+const postColumns = `bucket, slug, section, title, language, tags, created_at, updated_at,
+	object_key, resource_keys, checksum, commit_hash, draft, published, synced_at`
+
+const upsertPostSQL = `INSERT INTO posts (bucket, slug, section, title, language, tags, created_at, updated_at,
+	object_key, resource_keys, checksum, commit_hash, draft, published, synced_at, headings, body)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, now(), $15, $16)
+ON CONFLICT (bucket, slug) DO UPDATE SET
+	section = EXCLUDED.section,
+	title = EXCLUDED.title,
+	language = EXCLUDED.language,
+	tags = EXCLUDED.tags,
+	created_at = EXCLUDED.created_at,
+	updated_at = EXCLUDED.updated_at,
+	object_key = EXCLUDED.object_key,
+	resource_keys = EXCLUDED.resource_keys,
+	checksum = EXCLUDED.checksum,
+	commit_hash = EXCLUDED.commit_hash,
+	draft = EXCLUDED.draft,
+	published = EXCLUDED.published,
+	synced_at = EXCLUDED.synced_at,
+	headings = EXCLUDED.headings,
+	body = EXCLUDED.body`
+
+// SyncPosts makes the catalog of a bucket match posts: every post is
+// inserted or updated and posts no longer in the bucket are removed, all
+// in one transaction.
+func (r *Repository) SyncPosts(ctx context.Context, bucket string, posts []Post) error {
+	tx, err := r.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to start catalog update of %s: %w", bucket, err)
+	}
+	defer tx.Rollback(ctx)
+
+	slugs := make([]string, 0, len(posts))
+	for _, post := range posts {
+		_, err := tx.Exec(ctx, upsertPostSQL, bucket, post.Slug, post.Section, post.Title, post.Language,
+			nonNil(post.Tags), post.CreatedAt, post.UpdatedAt, post.ObjectKey, nonNil(post.ResourceKeys),
+			post.Checksum, post.Commit, post.Draft, post.Published, post.Headings, post.Body)
+		if err != nil {
+			return fmt.Errorf("failed to store post %s/%s: %w", bucket, post.Slug, err)
+		}
+		slugs = append(slugs, post.Slug)
+	}
+
+	tag, err := tx.Exec(ctx, "DELETE FROM posts WHERE bucket = $1 AND NOT (slug = ANY($2))", bucket, slugs)
+	if err != nil {
+		return fmt.Errorf("failed to remove deleted posts of %s: %w", bucket, err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("failed to commit catalog update of %s: %w", bucket, err)
+	}
+
+	config.ContextLogger(r.logger, ctx).WithFields(config.Fields{"bucket": bucket, "count": len(posts)}).
+		Infof("Catalog of %s updated: %d posts, %d removed", bucket, len(posts), tag.RowsAffected())
+	return nil
+}
+
+// ListPosts returns the posts of a bucket, newest first.
+func (r *Repository) ListPosts(ctx context.Context, bucket string) ([]Post, error) {
+	rows, err := r.db.Query(ctx, "SELECT "+postColumns+
+		" FROM posts WHERE bucket = $1 ORDER BY created_at DESC NULLS LAST, slug", bucket)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list posts of %s: %w", bucket, err)
+	}
+	posts, err := collectPosts(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list posts of %s: %w", bucket, err)
+	}
+	return posts, nil
+}
+
+// Sort keys of a PostQuery
+const (
+	SortCreated = "created"
+	SortUpdated = "updated"
+	SortTitle   = "title"
+)
+
+// sortKeys are the SQL expressions of the sort keys. Rows stored without
+// dates are sorted by the time they were synced and untitled posts by
+// their slug. Titles are compared by their bytes, like Go strings.
+var sortKeys = map[string]string{
+	SortCreated: "coalesce(created_at, synced_at)",
+	SortUpdated: "coalesce(updated_at, synced_at)",
+	SortTitle:   `lower(coalesce(nullif(title, ''), slug)) COLLATE "C"`,
+}
+
+// PostQuery selects a page of the published posts of a bucket.
+type PostQuery struct {
+	Bucket string
+	// Sort is SortCreated, SortUpdated or SortTitle, Desc reverses it.
+	// Posts with the same sort key are ordered by slug.
+	Sort string
+	Desc bool
+	// Tag keeps the posts with the tag, compared case-insensitively
+	Tag string
+	// Language keeps the posts of a language and its regional variants
+	Language string
+	// After continues the listing after a post, nil for the first page
+	After *PostKey
+	// Limit of zero returns all posts
+	Limit int
+}
+
+// PostKey is the position of a post in a listing: its sort key and slug.
+type PostKey struct {
+	Time  time.Time
+	Title string
+	Slug  string
+}
+
+// Key returns the position of the post in a listing sorted by sort, the
+// values sortKeys compares
+func (p Post) Key(sort string) PostKey {
+	key := PostKey{Slug: p.Slug, Time: p.SyncedAt, Title: p.Title}
+	switch {
+	case sort == SortCreated && p.CreatedAt != nil:
+		key.Time = *p.CreatedAt
+	case sort == SortUpdated && p.UpdatedAt != nil:
+		key.Time = *p.UpdatedAt
+	}
+	if key.Title == "" {
+		key.Title = p.Slug
+	}
+	return key
+}
+
+// QueryPosts returns the published posts of a bucket matching q in the
+// order of its sort key.
+func (r *Repository) QueryPosts(ctx context.Context, q PostQuery) ([]Post, error) {
+	key, ok := sortKeys[q.Sort]
+	if !ok {
+		return nil, fmt.Errorf("unknown sort key %q", q.Sort)
+	}
+	query := "SELECT " + postColumns + ` FROM posts
+WHERE bucket = $1 AND published AND NOT draft
+	AND ($2::text = '' OR EXISTS (SELECT 1 FROM unnest(tags) AS tag WHERE lower(tag) = lower($2)))
+	AND ($3::text = '' OR lower(language) = lower($3) OR left(lower(language), length($3) + 1) = lower($3) || '-')`
+	args := []interface{}{q.Bucket, q.Tag, q.Language}
+	cmp, order := ">", "ASC"
+	if q.Desc {
+		cmp, order = "<", "DESC"
+	}
+	if q.After != nil {
+		after := "$4::timestamptz"
+		args = append(args, q.After.Time)
+		if q.Sort == SortTitle {
+			after = `lower($4::text) COLLATE "C"`
+			args[3] = q.After.Title
+		}
+		query += fmt.Sprintf("\n\tAND (%s %s %s OR %s = %s AND slug COLLATE \"C\" > $5)", key, cmp, after, key, after)
+		args = append(args, q.After.Slug)
+	}
+	query += fmt.Sprintf("\nORDER BY %s %s, slug COLLATE \"C\"", key, order)
+	if q.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT $%d", len(args)+1)
+		args = append(args, q.Limit)
+	}
+
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query posts of %s: %w", q.Bucket, err)
+	}
+	posts, err := collectPosts(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query posts of %s: %w", q.Bucket, err)
+	}
+	return posts, nil
+}
+
+// collectPosts reads and closes rows of postColumns
+func collectPosts(rows pgx.Rows) ([]Post, error) {
+	defer rows.Close()
+	var posts []Post
+	for rows.Next() {
+		post, err := scanPost(rows)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, post)
+	}
+	return posts, rows.Err()
+}
+
+// GetPost returns a post of a bucket, or ErrNotFound.
+func (r *Repository) GetPost(ctx context.Context, bucket, slug string) (Post, error) {
+	row := r.db.QueryRow(ctx, "SELECT "+postColumns+" FROM posts WHERE bucket = $1 AND slug = $2", bucket, slug)
+	post, err := scanPost(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Post{}, ErrNotFound
+	}
+	if err != nil {
+		return Post{}, fmt.Errorf("failed to get post %s/%s: %w", bucket, slug, err)
+	}
+	return post, nil
+}
+
+// scanPost reads a row of postColumns
+func scanPost(row pgx.Row) (Post, error) {
+	var post Post
+	err := row.Scan(&post.Bucket, &post.Slug, &post.Section, &post.Title, &post.Language, &post.Tags,
+		&post.CreatedAt, &post.UpdatedAt, &post.ObjectKey, &post.ResourceKeys, &post.Checksum, &post.Commit,
+		&post.Draft, &post.Published, &post.SyncedAt)
+	return post, err
+}
+
+// nonNil returns an empty slice for nil, stored as an empty array instead of NULL
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
@@ -0,0 +1,133 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// ErrRunNotFound is returned when a run is not in the run history.
+var ErrRunNotFound = errors.New("run not found")
+
+// Run is a row of the run history.
+type Run struct {
+	ID string `json:"run_id"`
+	// Trigger is what started the run: schedule, cli or api
+	Trigger   string    `json:"trigger"`
+	State     string    `json:"state"`
+	DryRun    bool      `json:"dry_run"`
+	Commit    string    `json:"commit"`
+	StartedAt time.Time `json:"started_at"`
+	// FinishedAt is nil while the run is in progress
+	FinishedAt *time.Time   `json:"finished_at"`
+	Error      string       `json:"error"`
+	Sections   []RunSection `json:"sections"`
+}
+
+// RunSection counts the operations of a run on one section bucket. It is
+// stored as JSON in the sections column.
+type RunSection struct {
+	Section     string `json:"section"`
+	Bucket      string `json:"bucket"`
+	Created     int    `json:"created"`
+	Updated     int    `json:"updated"`
+	Deleted     int    `json:"deleted"`
+	Unchanged   int    `json:"unchanged"`
+	Failed      int    `json:"failed"`
+	UploadBytes int64  `json:"upload_bytes"`
+	// Errors are the messages of the failed operations
+	Errors []string `json:"errors,omitempty"`
+}
+
+// runColumns are the selected columns in the order scanRun reads them
+const runColumns = `run_id, triggered_by, state, dry_run, commit_hash, started_at, finished_at, error, sections`
+
+const upsertRunSQL = `INSERT INTO sync_runs (` + runColumns + `)
+VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+ON CONFLICT (run_id) DO UPDATE SET
+	triggered_by = EXCLUDED.triggered_by,
+	state = EXCLUDED.state,
+	dry_run = EXCLUDED.dry_run,
+	commit_hash = EXCLUDED.commit_hash,
+	started_at = EXCLUDED.started_at,
+	finished_at = EXCLUDED.finished_at,
+	error = EXCLUDED.error,
+	sections = EXCLUDED.sections`
+
+// RecordRun inserts a run into the history or updates it, so a run can be
+// recorded when it starts and again when it finishes.
+func (r *Repository) RecordRun(ctx context.Context, run Run) error {
+	sections := run.Sections
+	if sections == nil {
+		sections = []RunSection{}
+	}
+	_, err := r.db.Exec(ctx, upsertRunSQL, run.ID, run.Trigger, run.State, run.DryRun, run.Commit,
+		run.StartedAt, run.FinishedAt, run.Error, sections)
+	if err != nil {
+		return fmt.Errorf("failed to record run %s: %w", run.ID, err)
+	}
+	return nil
+}
+
+// ListRuns returns up to limit runs, newest first. A limit of zero
+// returns all runs.
+func (r *Repository) ListRuns(ctx context.Context, limit int) ([]Run, error) {
+	query := "SELECT " + runColumns + " FROM sync_runs ORDER BY started_at DESC, run_id"
+	var args []interface{}
+	if limit > 0 {
+		query += " LIMIT $1"
+		args = append(args, limit)
+	}
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list runs: %w", err)
+	}
+	defer rows.Close()
+
+	var runs []Run
+	for rows.Next() {
+		run, err := scanRun(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list runs: %w", err)
+		}
+		runs = append(runs, run)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list runs: %w", err)
+	}
+	return runs, nil
+}
+
+// GetRun returns a run of the history, or ErrRunNotFound.
+func (r *Repository) GetRun(ctx context.Context, runID string) (Run, error) {
+	row := r.db.QueryRow(ctx, "SELECT "+runColumns+" FROM sync_runs WHERE run_id = $1", runID)
+	run, err := scanRun(row)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return Run{}, ErrRunNotFound
+	}
+	if err != nil {
+		return Run{}, fmt.Errorf("failed to get run %s: %w", runID, err)
+	}
+	return run, nil
+}
+
+// PruneRuns removes the finished runs started before the given time and
+// returns how many were removed.
+func (r *Repository) PruneRuns(ctx context.Context, before time.Time) (int64, error) {
+	tag, err := r.db.Exec(ctx, "DELETE FROM sync_runs WHERE started_at < $1 AND finished_at IS NOT NULL", before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune runs: %w", err)
+	}
+	return tag.RowsAffected(), nil
+}
+
+// scanRun reads a row of runColumns
+func scanRun(row pgx.Row) (Run, error) {
+	var run Run
+	err := row.Scan(&run.ID, &run.Trigger, &run.State, &run.DryRun, &run.Commit, &run.StartedAt,
+		&run.FinishedAt, &run.Error, &run.Sections)
+	return run, err
+}
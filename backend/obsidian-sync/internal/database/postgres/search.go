@@ -0,0 +1,104 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"html"
+	"strings"
+)
+
+// Markers around the matched words of a snippet, replaced by <mark> tags
+// once the rest of the snippet is escaped
+const (
+	snippetStart = "{{mark}}"
+	snippetStop  = "{{/mark}}"
+)
+
+// SearchQuery selects the published posts matching a full-text query.
+type SearchQuery struct {
+	// Text is a web search query: words, "quoted phrases", or and -excluded words
+	Text string
+	// Buckets and Language filter the posts when set. A language matches
+	// its regional variants, en matches en-US.
+	Buckets  []string
+	Language string
+	// Limit of zero returns all hits
+	Limit  int
+	Offset int
+}
+
+// SearchHit is a post matching a search query.
+type SearchHit struct {
+	Post
+	Rank float32 `json:"rank"`
+	// Snippet is an HTML excerpt of the body with the matched words in <mark> tags
+	Snippet string `json:"snippet"`
+}
+
+// SearchResults are a page of search hits.
+type SearchResults struct {
+	Hits []SearchHit `json:"hits"`
+	// Total counts the hits of all pages. It is zero when Offset is past the
+	// last hit.
+	Total int `json:"total"`
+}
+
+// searchSQL ranks the posts whose search column matches the query stemmed
+// as Russian or English. The language is compared as a string prefix
+// rather than with LIKE, so wildcards in it match nothing.
+const searchSQL = `WITH query AS (
+	SELECT websearch_to_tsquery('russian', $1) || websearch_to_tsquery('english', $1) AS q
+)
+SELECT ` + postColumns + `,
+	ts_rank_cd(search, query.q) AS rank,
+	ts_headline('russian', body, query.q,
+		'StartSel="` + snippetStart + `", StopSel="` + snippetStop + `", MaxFragments=2, MaxWords=25, MinWords=10') AS snippet,
+	count(*) OVER () AS total
+FROM posts, query
+WHERE search @@ query.q AND published AND NOT draft
+	AND (cardinality($2::text[]) = 0 OR bucket = ANY($2))
+	AND ($3::text = '' OR lower(language) = lower($3) OR left(lower(language), length($3) + 1) = lower($3) || '-')
+ORDER BY rank DESC, created_at DESC NULLS LAST, slug`
+
+// SearchPosts returns the published posts matching q, best matches first.
+func (r *Repository) SearchPosts(ctx context.Context, q SearchQuery) (SearchResults, error) {
+	query := searchSQL
+	args := []interface{}{q.Text, nonNil(q.Buckets), q.Language}
+	if q.Limit > 0 {
+		query += " LIMIT $4"
+		args = append(args, q.Limit)
+	}
+	if q.Offset > 0 {
+		query += fmt.Sprintf(" OFFSET $%d", len(args)+1)
+		args = append(args, q.Offset)
+	}
+	rows, err := r.db.Query(ctx, query, args...)
+	if err != nil {
+		return SearchResults{}, fmt.Errorf("failed to search posts: %w", err)
+	}
+	defer rows.Close()
+
+	results := SearchResults{Hits: []SearchHit{}}
+	for rows.Next() {
+		var hit SearchHit
+		post := &hit.Post
+		err := rows.Scan(&post.Bucket, &post.Slug, &post.Section, &post.Title, &post.Language, &post.Tags,
+			&post.CreatedAt, &post.UpdatedAt, &post.ObjectKey, &post.ResourceKeys, &post.Checksum, &post.Commit,
+			&post.Draft, &post.Published, &post.SyncedAt, &hit.Rank, &hit.Snippet, &results.Total)
+		if err != nil {
+			return SearchResults{}, fmt.Errorf("failed to search posts: %w", err)
+		}
+		hit.Snippet = highlight(hit.Snippet)
+		results.Hits = append(results.Hits, hit)
+	}
+	if err := rows.Err(); err != nil {
+		return SearchResults{}, fmt.Errorf("failed to search posts: %w", err)
+	}
+	return results, nil
+}
+
+// highlight escapes a snippet and turns its markers into <mark> tags
+func highlight(snippet string) string {
+	snippet = html.EscapeString(snippet)
+	return strings.NewReplacer(snippetStart, "<mark>", snippetStop, "</mark>").Replace(snippet)
+}
@@ -0,0 +1,362 @@
+// Package feed renders the RSS 2.0, Atom and JSON Feed documents of the
+// published posts of a section.
+//
+// Documents only depend on their feed: the build date of a feed is the
+// date of its newest item, so a feed whose posts did not change renders to
+// the same bytes.
+package feed
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"sort"
+	"time"
+)
+
+// Format is a feed document format.
+type Format struct {
+	// Name is the file name of the document, e.g. rss.xml
+	Name        string
+	ContentType string
+	render      func(Feed, string) ([]byte, error)
+}
+
+// Render renders the feed, linking the document to itself at selfURL
+// (empty to leave the self link out)
+func (f Format) Render(feed Feed, selfURL string) ([]byte, error) {
+	return f.render(feed, selfURL)
+}
+
+// Formats are the rendered document formats
+var Formats = []Format{
+	{Name: "rss.xml", ContentType: "application/rss+xml; charset=utf-8", render: RSS},
+	{Name: "atom.xml", ContentType: "application/atom+xml; charset=utf-8", render: Atom},
+	{Name: "feed.json", ContentType: "application/feed+json; charset=utf-8", render: JSON},
+}
+
+// Feed is the feed of a section, or of the posts of a section in one language.
+type Feed struct {
+	Title       string
+	Description string
+	// Link is the page of the section on the site
+	Link string
+	// Language is empty for a feed of all languages
+	Language string
+	// Items are the posts, newest first
+	Items []Item
+}
+
+// Item is a post of a feed.
+type Item struct {
+	Title   string
+	Summary string
+	// URL is the canonical URL of the post, also its ID
+	URL  string
+	Tags []string
+	// Published is the creation date of the post, Updated its last change.
+	// Either is zero when unknown.
+	Published time.Time
+	Updated   time.Time
+	// Image is the cover of the post, nil when it has none
+	Image *Enclosure
+}
+
+// Enclosure is a file attached to an item.
+type Enclosure struct {
+	URL    string
+	Type   string
+	Length int64
+}
+
+// Updated returns the newest date of the items, zero for a feed without dates
+func (f Feed) Updated() time.Time {
+	var updated time.Time
+	for _, item := range f.Items {
+		if d := item.updated(); d.After(updated) {
+			updated = d
+		}
+	}
+	return updated
+}
+
+// Sort orders items newest first by their publication date, keeping the
+// order of items published at the same time. Undated items come last.
+func Sort(items []Item) {
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].published().After(items[j].published())
+	})
+}
+
+// published returns the publication date of an item, its update date when unknown
+func (i Item) published() time.Time {
+	if i.Published.IsZero() {
+		return i.Updated
+	}
+	return i.Published
+}
+
+// updated returns the update date of an item, its publication date when unknown
+func (i Item) updated() time.Time {
+	if i.Updated.IsZero() {
+		return i.Published
+	}
+	return i.Updated
+}
+
+// rssFeed is the root of an RSS 2.0 document
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Atom    string     `xml:"xmlns:atom,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	Language      string    `xml:"language,omitempty"`
+	LastBuildDate string    `xml:"lastBuildDate,omitempty"`
+	Self          *atomLink `xml:"atom:link,omitempty"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string        `xml:"title"`
+	Link        string        `xml:"link"`
+	GUID        rssGUID       `xml:"guid"`
+	Description string        `xml:"description,omitempty"`
+	PubDate     string        `xml:"pubDate,omitempty"`
+	Categories  []string      `xml:"category"`
+	Enclosure   *rssEnclosure `xml:"enclosure"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int64  `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// RSS renders the feed as an RSS 2.0 document
+func RSS(f Feed, selfURL string) ([]byte, error) {
+	doc := rssFeed{
+		Version: "2.0",
+		Atom:    atomNamespace,
+		Channel: rssChannel{
+			Title:         f.Title,
+			Link:          f.Link,
+			Description:   f.Description,
+			Language:      f.Language,
+			LastBuildDate: rssDate(f.Updated()),
+			Items:         []rssItem{},
+		},
+	}
+	if selfURL != "" {
+		doc.Channel.Self = &atomLink{Href: selfURL, Rel: "self", Type: "application/rss+xml"}
+	}
+	for _, item := range f.Items {
+		entry := rssItem{
+			Title:       item.Title,
+			Link:        item.URL,
+			GUID:        rssGUID{IsPermaLink: true, Value: item.URL},
+			Description: item.Summary,
+			PubDate:     rssDate(item.published()),
+			Categories:  item.Tags,
+		}
+		if item.Image != nil {
+			entry.Enclosure = &rssEnclosure{URL: item.Image.URL, Length: item.Image.Length, Type: item.Image.Type}
+		}
+		doc.Channel.Items = append(doc.Channel.Items, entry)
+	}
+	return marshalXML(doc)
+}
+
+// rssDate formats an RSS date, empty for the zero time
+func rssDate(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC1123Z)
+}
+
+// atomNamespace is the XML namespace of Atom documents
+const atomNamespace = "http://www.w3.org/2005/Atom"
+
+// atomFeed is the root of an Atom document
+type atomFeed struct {
+	XMLName  xml.Name    `xml:"feed"`
+	Xmlns    string      `xml:"xmlns,attr"`
+	Language string      `xml:"xml:lang,attr,omitempty"`
+	ID       string      `xml:"id"`
+	Title    string      `xml:"title"`
+	Subtitle string      `xml:"subtitle,omitempty"`
+	Updated  string      `xml:"updated"`
+	Links    []atomLink  `xml:"link"`
+	Entries  []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr,omitempty"`
+	Type   string `xml:"type,attr,omitempty"`
+	Length int64  `xml:"length,attr,omitempty"`
+}
+
+type atomEntry struct {
+	ID         string         `xml:"id"`
+	Title      string         `xml:"title"`
+	Updated    string         `xml:"updated"`
+	Published  string         `xml:"published,omitempty"`
+	Summary    string         `xml:"summary,omitempty"`
+	Links      []atomLink     `xml:"link"`
+	Categories []atomCategory `xml:"category"`
+}
+
+type atomCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+// Atom renders the feed as an Atom document
+func Atom(f Feed, selfURL string) ([]byte, error) {
+	doc := atomFeed{
+		Xmlns:    atomNamespace,
+		Language: f.Language,
+		ID:       f.Link,
+		Title:    f.Title,
+		Subtitle: f.Description,
+		Updated:  atomDate(f.Updated()),
+		Links:    []atomLink{{Href: f.Link, Rel: "alternate", Type: "text/html"}},
+		Entries:  []atomEntry{},
+	}
+	if selfURL != "" {
+		doc.ID = selfURL
+		doc.Links = append(doc.Links, atomLink{Href: selfURL, Rel: "self", Type: "application/atom+xml"})
+	}
+	for _, item := range f.Items {
+		entry := atomEntry{
+			ID:      item.URL,
+			Title:   item.Title,
+			Updated: atomDate(item.updated()),
+			Summary: item.Summary,
+			Links:   []atomLink{{Href: item.URL, Rel: "alternate", Type: "text/html"}},
+		}
+		if !item.Published.IsZero() {
+			entry.Published = atomDate(item.Published)
+		}
+		if item.Image != nil {
+			entry.Links = append(entry.Links, atomLink{Href: item.Image.URL, Rel: "enclosure", Type: item.Image.Type,
+				Length: item.Image.Length})
+		}
+		for _, tag := range item.Tags {
+			entry.Categories = append(entry.Categories, atomCategory{Term: tag})
+		}
+		doc.Entries = append(doc.Entries, entry)
+	}
+	return marshalXML(doc)
+}
+
+// atomDate formats an Atom date. Atom requires update dates, an unknown
+// date is the zero time.
+func atomDate(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// marshalXML encodes an XML document with its declaration
+func marshalXML(doc interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&buf)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
+
+// jsonFeedVersion identifies the JSON Feed specification
+const jsonFeedVersion = "https://jsonfeed.org/version/1.1"
+
+// jsonFeed is a JSON Feed 1.1 document
+type jsonFeed struct {
+	Version     string     `json:"version"`
+	Title       string     `json:"title"`
+	HomePageURL string     `json:"home_page_url"`
+	FeedURL     string     `json:"feed_url,omitempty"`
+	Description string     `json:"description,omitempty"`
+	Language    string     `json:"language,omitempty"`
+	Items       []jsonItem `json:"items"`
+}
+
+type jsonItem struct {
+	ID            string           `json:"id"`
+	URL           string           `json:"url"`
+	Title         string           `json:"title"`
+	ContentText   string           `json:"content_text"`
+	Summary       string           `json:"summary,omitempty"`
+	Image         string           `json:"image,omitempty"`
+	DatePublished *time.Time       `json:"date_published,omitempty"`
+	DateModified  *time.Time       `json:"date_modified,omitempty"`
+	Tags          []string         `json:"tags,omitempty"`
+	Attachments   []jsonAttachment `json:"attachments,omitempty"`
+}
+
+type jsonAttachment struct {
+	URL      string `json:"url"`
+	MimeType string `json:"mime_type"`
+	Size     int64  `json:"size_in_bytes,omitempty"`
+}
+
+// JSON renders the feed as a JSON Feed 1.1 document
+func JSON(f Feed, selfURL string) ([]byte, error) {
+	doc := jsonFeed{
+		Version:     jsonFeedVersion,
+		Title:       f.Title,
+		HomePageURL: f.Link,
+		FeedURL:     selfURL,
+		Description: f.Description,
+		Language:    f.Language,
+		Items:       []jsonItem{},
+	}
+	for _, item := range f.Items {
+		entry := jsonItem{
+			ID:            item.URL,
+			URL:           item.URL,
+			Title:         item.Title,
+			ContentText:   item.Summary,
+			Summary:       item.Summary,
+			DatePublished: jsonDate(item.published()),
+			DateModified:  jsonDate(item.Updated),
+			Tags:          item.Tags,
+		}
+		// Every item needs content, the title stands in for a missing summary
+		if entry.ContentText == "" {
+			entry.ContentText = item.Title
+		}
+		if item.Image != nil {
+			entry.Image = item.Image.URL
+			entry.Attachments = []jsonAttachment{{URL: item.Image.URL, MimeType: item.Image.Type, Size: item.Image.Length}}
+		}
+		doc.Items = append(doc.Items, entry)
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// jsonDate returns the UTC time, nil for the zero time
+func jsonDate(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	t = t.UTC()
+	return &t
+}
@@ -0,0 +1,149 @@
+package feed
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// testFeed is a feed with a dated post with a cover and an undated post
+func testFeed() Feed {
+	return Feed{
+		Title:       "Blog",
+		Description: "Posts",
+		Link:        "https://example.com/posts",
+		Language:    "en",
+		Items: []Item{
+			{
+				Title:     "New <post>",
+				Summary:   "About & more",
+				URL:       "https://example.com/posts/New",
+				Tags:      []string{"go"},
+				Published: time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+				Updated:   time.Date(2024, 5, 3, 12, 0, 0, 0, time.FixedZone("MSK", 3*3600)),
+				Image:     &Enclosure{URL: "https://example.com/cover.png", Type: "image/png", Length: 42},
+			},
+			{Title: "Undated", URL: "https://example.com/posts/Undated"},
+		},
+	}
+}
+
+func TestRSS(t *testing.T) {
+	data, err := RSS(testFeed(), "https://cdn.example.com/feeds/blog/en/rss.xml")
+	require.NoError(t, err)
+
+	var doc struct {
+		Channel struct {
+			Title         string `xml:"title"`
+			Language      string `xml:"language"`
+			LastBuildDate string `xml:"lastBuildDate"`
+			Self          struct {
+				Href string `xml:"href,attr"`
+			} `xml:"http://www.w3.org/2005/Atom link"`
+			Items []struct {
+				Title     string   `xml:"title"`
+				GUID      string   `xml:"guid"`
+				PubDate   string   `xml:"pubDate"`
+				Category  []string `xml:"category"`
+				Enclosure *struct {
+					URL    string `xml:"url,attr"`
+					Length int64  `xml:"length,attr"`
+				} `xml:"enclosure"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	require.NoError(t, xml.Unmarshal(data, &doc))
+	assert.Equal(t, "Blog", doc.Channel.Title)
+	assert.Equal(t, "en", doc.Channel.Language)
+	assert.Equal(t, "Fri, 03 May 2024 09:00:00 +0000", doc.Channel.LastBuildDate)
+	assert.Equal(t, "https://cdn.example.com/feeds/blog/en/rss.xml", doc.Channel.Self.Href)
+	require.Len(t, doc.Channel.Items, 2)
+	assert.Equal(t, "New <post>", doc.Channel.Items[0].Title)
+	assert.Equal(t, "https://example.com/posts/New", doc.Channel.Items[0].GUID)
+	assert.Equal(t, "Wed, 01 May 2024 00:00:00 +0000", doc.Channel.Items[0].PubDate)
+	assert.Equal(t, []string{"go"}, doc.Channel.Items[0].Category)
+	require.NotNil(t, doc.Channel.Items[0].Enclosure)
+	assert.Equal(t, int64(42), doc.Channel.Items[0].Enclosure.Length)
+	assert.Empty(t, doc.Channel.Items[1].PubDate)
+	assert.Nil(t, doc.Channel.Items[1].Enclosure)
+}
+
+func TestAtom(t *testing.T) {
+	data, err := Atom(testFeed(), "")
+	require.NoError(t, err)
+
+	var doc struct {
+		XMLName  xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+		Language string   `xml:"http://www.w3.org/XML/1998/namespace lang,attr"`
+		ID       string   `xml:"id"`
+		Updated  string   `xml:"updated"`
+		Entries  []struct {
+			ID        string `xml:"id"`
+			Updated   string `xml:"updated"`
+			Published string `xml:"published"`
+			Links     []struct {
+				Href string `xml:"href,attr"`
+				Rel  string `xml:"rel,attr"`
+			} `xml:"link"`
+		} `xml:"entry"`
+	}
+	require.NoError(t, xml.Unmarshal(data, &doc))
+	assert.Equal(t, "https://example.com/posts", doc.ID, "without a self link the site page is the ID")
+	assert.Equal(t, "2024-05-03T09:00:00Z", doc.Updated)
+	require.Len(t, doc.Entries, 2)
+	assert.Equal(t, "2024-05-01T00:00:00Z", doc.Entries[0].Published)
+	assert.Len(t, doc.Entries[0].Links, 2)
+	assert.Equal(t, "enclosure", doc.Entries[0].Links[1].Rel)
+	assert.Equal(t, "0001-01-01T00:00:00Z", doc.Entries[1].Updated)
+	assert.Empty(t, doc.Entries[1].Published)
+}
+
+func TestJSON(t *testing.T) {
+	data, err := JSON(testFeed(), "https://cdn.example.com/feeds/blog/en/feed.json")
+	require.NoError(t, err)
+
+	var doc map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &doc))
+	assert.Equal(t, "https://jsonfeed.org/version/1.1", doc["version"])
+	assert.Equal(t, "https://cdn.example.com/feeds/blog/en/feed.json", doc["feed_url"])
+	items := doc["items"].([]interface{})
+	require.Len(t, items, 2)
+	first := items[0].(map[string]interface{})
+	assert.Equal(t, "2024-05-01T00:00:00Z", first["date_published"])
+	assert.Equal(t, "2024-05-03T09:00:00Z", first["date_modified"])
+	assert.Equal(t, "https://example.com/cover.png", first["image"])
+	second := items[1].(map[string]interface{})
+	assert.Equal(t, "Undated", second["content_text"], "the title stands in for the content")
+	assert.NotContains(t, second, "date_published")
+}
+
+func TestRenderIsStable(t *testing.T) {
+	for _, format := range Formats {
+		first, err := format.Render(testFeed(), "")
+		require.NoError(t, err)
+		second, err := format.Render(testFeed(), "")
+		require.NoError(t, err)
+		assert.Equal(t, first, second, format.Name)
+	}
+}
+
+func TestSort(t *testing.T) {
+	day := func(d int) time.Time { return time.Date(2024, 5, d, 0, 0, 0, 0, time.UTC) }
+	items := []Item{
+		{Title: "undated"},
+		{Title: "first", Published: day(1)},
+		{Title: "updated only", Updated: day(3)},
+		{Title: "second", Published: day(2)},
+		{Title: "also first", Published: day(1)},
+	}
+	Sort(items)
+	var titles []string
+	for _, item := range items {
+		titles = append(titles, item.Title)
+	}
+	assert.Equal(t, []string{"updated only", "second", "first", "also first", "undated"}, titles)
+}
@@ -0,0 +1,187 @@
+// Package images optimizes the images of the posts in pure Go: it strips
+// their metadata and makes the resized variants browsers pick from with
+// srcset.
+package images
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"math"
+	"path"
+	"sort"
+	"strings"
+
+	"golang.org/x/image/draw"
+	// Registers the WebP decoder
+	_ "golang.org/x/image/webp"
+)
+
+// MaxPixels bounds the images variants are made of, so a huge image
+// cannot exhaust the memory of the sync
+const MaxPixels = 40_000_000
+
+// ErrTooLarge is returned for an image of more than MaxPixels pixels
+var ErrTooLarge = errors.New("image too large")
+
+// supported are the extensions of the images variants are made of
+var supported = map[string]bool{".jpg": true, ".jpeg": true, ".png": true, ".webp": true}
+
+// Supported reports whether the file name is an image variants are made
+// of, by its extension. GIF images are left out, as only their first
+// frame would be kept, and so are SVG images, which scale by themselves.
+func Supported(name string) bool {
+	return supported[strings.ToLower(path.Ext(name))]
+}
+
+// Options control the variants made of an image.
+type Options struct {
+	// Widths are the widths of the variants in pixels, those not smaller
+	// than the image are skipped
+	Widths []int
+	// Quality is the JPEG quality of the variants, 1 to 100
+	Quality int
+}
+
+// Variant is an image resized and encoded again.
+type Variant struct {
+	Width  int
+	Height int
+	// Ext is the extension of the encoding, .jpg or .png
+	Ext         string
+	ContentType string
+	Data        []byte
+}
+
+// Size returns the width and height of an image as it is displayed, with
+// its EXIF orientation applied.
+func Size(data []byte) (int, int, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, err
+	}
+	if orientation(data) >= 5 {
+		return cfg.Height, cfg.Width, nil
+	}
+	return cfg.Width, cfg.Height, nil
+}
+
+// Variants returns an image turned upright as its EXIF orientation says,
+// resized to each of the widths smaller than it and kept at its own width
+// when encoding it again makes it smaller, ordered by width. Opaque images
+// are encoded as JPEG, images with transparency as PNG; the variants hold
+// no metadata. Encoding is deterministic, so the variants of an image do
+// not change from one sync to the next.
+func Variants(data []byte, opts Options) ([]Variant, error) {
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > MaxPixels {
+		return nil, fmt.Errorf("%w: %dx%d pixels", ErrTooLarge, cfg.Width, cfg.Height)
+	}
+	decoded, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	img := orient(toRGBA(decoded), orientation(data))
+	opaque := img.Opaque()
+	bounds := img.Bounds()
+
+	widths := append([]int(nil), opts.Widths...)
+	sort.Ints(widths)
+	var variants []Variant
+	for i, width := range widths {
+		if width <= 0 || width >= bounds.Dx() || i > 0 && widths[i-1] == width {
+			continue
+		}
+		height := max(1, int(math.Round(float64(bounds.Dy())*float64(width)/float64(bounds.Dx()))))
+		resized := image.NewRGBA(image.Rect(0, 0, width, height))
+		draw.CatmullRom.Scale(resized, resized.Bounds(), img, bounds, draw.Src, nil)
+		variant, err := encode(resized, opaque, opts.Quality)
+		if err != nil {
+			return nil, err
+		}
+		variants = append(variants, variant)
+	}
+
+	full, err := encode(img, opaque, opts.Quality)
+	if err != nil {
+		return nil, err
+	}
+	if len(full.Data) < len(data) {
+		variants = append(variants, full)
+	}
+	return variants, nil
+}
+
+// encode encodes an image as JPEG when it is opaque, else as PNG
+func encode(img *image.RGBA, opaque bool, quality int) (Variant, error) {
+	variant := Variant{Width: img.Bounds().Dx(), Height: img.Bounds().Dy()}
+	var buf bytes.Buffer
+	var err error
+	if opaque {
+		variant.Ext, variant.ContentType = ".jpg", "image/jpeg"
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	} else {
+		variant.Ext, variant.ContentType = ".png", "image/png"
+		err = (&png.Encoder{CompressionLevel: png.BestCompression}).Encode(&buf, img)
+	}
+	if err != nil {
+		return Variant{}, err
+	}
+	variant.Data = buf.Bytes()
+	return variant, nil
+}
+
+// toRGBA returns the pixels of an image with its origin at 0,0
+func toRGBA(img image.Image) *image.RGBA {
+	if rgba, ok := img.(*image.RGBA); ok && rgba.Rect.Min == (image.Point{}) {
+		return rgba
+	}
+	bounds := img.Bounds()
+	rgba := image.NewRGBA(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	draw.Draw(rgba, rgba.Bounds(), img, bounds.Min, draw.Src)
+	return rgba
+}
+
+// orient returns an image turned and mirrored as its EXIF orientation o
+// says it is displayed
+func orient(img *image.RGBA, o int) *image.RGBA {
+	if o < 2 || o > 8 {
+		return img
+	}
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	rect := image.Rect(0, 0, w, h)
+	if o >= 5 {
+		rect = image.Rect(0, 0, h, w)
+	}
+	turned := image.NewRGBA(rect)
+	for y := 0; y < rect.Dy(); y++ {
+		for x := 0; x < rect.Dx(); x++ {
+			// The pixel of the stored image displayed at x, y
+			var sx, sy int
+			switch o {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			}
+			copy(turned.Pix[turned.PixOffset(x, y):][:4], img.Pix[img.PixOffset(sx, sy):][:4])
+		}
+	}
+	return turned
+}
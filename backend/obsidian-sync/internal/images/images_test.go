@@ -0,0 +1,108 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSupported(t *testing.T) {
+	for _, name := range []string{"photo.jpg", "Photo.JPEG", "screen.png", "image.webp"} {
+		assert.True(t, Supported(name), name)
+	}
+	for _, name := range []string{"anim.gif", "logo.svg", "notes.pdf", "png"} {
+		assert.False(t, Supported(name), name)
+	}
+}
+
+func TestVariants(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, testImage(800, 400, false)))
+
+	variants, err := Variants(buf.Bytes(), Options{Widths: []int{1600, 400, 200, 400, 800}, Quality: 80})
+	require.NoError(t, err)
+	require.Len(t, variants, 3)
+	for i, want := range [][2]int{{200, 100}, {400, 200}, {800, 400}} {
+		assert.Equal(t, want, [2]int{variants[i].Width, variants[i].Height})
+		assert.Equal(t, ".jpg", variants[i].Ext, "opaque images are encoded as JPEG")
+		assert.Equal(t, "image/jpeg", variants[i].ContentType)
+		img, err := jpeg.Decode(bytes.NewReader(variants[i].Data))
+		require.NoError(t, err)
+		assert.Equal(t, image.Rect(0, 0, want[0], want[1]), img.Bounds())
+	}
+
+	again, err := Variants(buf.Bytes(), Options{Widths: []int{200, 400}, Quality: 80})
+	require.NoError(t, err)
+	assert.Equal(t, variants, again, "the variants are deterministic")
+}
+
+func TestVariantsTransparent(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, testImage(300, 30, true)))
+
+	variants, err := Variants(buf.Bytes(), Options{Widths: []int{100}, Quality: 80})
+	require.NoError(t, err)
+	require.NotEmpty(t, variants)
+	assert.Equal(t, ".png", variants[0].Ext, "transparency needs PNG")
+	img, err := png.Decode(bytes.NewReader(variants[0].Data))
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 100, 10), img.Bounds())
+	_, _, _, a := img.At(10, 5).RGBA()
+	assert.Less(t, a, uint32(0xffff))
+}
+
+func TestVariantsOrientation(t *testing.T) {
+	variants, err := Variants(testJPEG(t, 40, 20, 6), Options{Widths: []int{10}, Quality: 80})
+	require.NoError(t, err)
+	require.NotEmpty(t, variants)
+	assert.Equal(t, [2]int{10, 20}, [2]int{variants[0].Width, variants[0].Height}, "the variants are upright")
+	assert.NotContains(t, string(variants[0].Data), private)
+}
+
+func TestVariantsErrors(t *testing.T) {
+	_, err := Variants([]byte("not an image"), Options{Widths: []int{100}})
+	assert.Error(t, err)
+
+	// A header claiming a huge image is refused before decoding
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1))))
+	data := buf.Bytes()
+	copy(data[16:24], []byte{0, 0, 0x27, 0x10, 0, 0, 0x27, 0x10})
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	_, err = Variants(data, Options{Widths: []int{100}})
+	assert.ErrorIs(t, err, ErrTooLarge)
+}
+
+func TestOrient(t *testing.T) {
+	red, blue := color.RGBA{R: 255, A: 255}, color.RGBA{B: 255, A: 255}
+	img := image.NewRGBA(image.Rect(0, 0, 2, 1))
+	img.SetRGBA(0, 0, red)
+	img.SetRGBA(1, 0, blue)
+
+	tests := []struct {
+		o     int
+		rect  image.Rectangle
+		first color.RGBA
+	}{
+		{1, image.Rect(0, 0, 2, 1), red},
+		{2, image.Rect(0, 0, 2, 1), blue},
+		{3, image.Rect(0, 0, 2, 1), blue},
+		{5, image.Rect(0, 0, 1, 2), red},
+		{6, image.Rect(0, 0, 1, 2), red},
+		{7, image.Rect(0, 0, 1, 2), blue},
+		{8, image.Rect(0, 0, 1, 2), blue},
+	}
+	for _, tt := range tests {
+		turned := orient(img, tt.o)
+		assert.Equal(t, tt.rect, turned.Bounds(), "orientation %d", tt.o)
+		assert.Equal(t, tt.first, turned.RGBAAt(0, 0), "orientation %d", tt.o)
+	}
+}
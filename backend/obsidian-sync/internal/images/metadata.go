@@ -0,0 +1,492 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"path"
+	"strings"
+)
+
+// JPEG markers
+const (
+	markerSOI   = 0xd8
+	markerEOI   = 0xd9
+	markerSOS   = 0xda
+	markerAPP0  = 0xe0
+	markerAPP1  = 0xe1
+	markerAPP13 = 0xed
+	markerCOM   = 0xfe
+)
+
+// orientationTag is the EXIF tag of the orientation
+const orientationTag = 0x0112
+
+// VP8X flags of the metadata chunks of a WebP image
+const (
+	webpFlagXMP  = 0x04
+	webpFlagEXIF = 0x08
+)
+
+var (
+	// ErrUnsupportedFormat is returned by Strip for an image format whose
+	// metadata it cannot remove
+	ErrUnsupportedFormat = errors.New("image format without metadata stripping")
+	// ErrInvalidImage is returned by Strip for an image that cannot be parsed
+	ErrInvalidImage = errors.New("invalid image")
+)
+
+// photos are the extensions of the images that can hold metadata
+var photos = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".webp": true, ".gif": true,
+	".heic": true, ".heif": true, ".avif": true, ".tif": true, ".tiff": true,
+}
+
+// heifBrands are the major brands of HEIF and AVIF images
+var heifBrands = map[string]bool{
+	"heic": true, "heix": true, "hevc": true, "hevx": true, "heim": true, "heis": true,
+	"mif1": true, "msf1": true, "avif": true, "avis": true,
+}
+
+// gifLoopApps are the application extensions of GIF images that loop an
+// animation, the only ones kept
+var gifLoopApps = map[string]bool{"NETSCAPE2.0": true, "ANIMEXTS1.0": true}
+
+var (
+	// exifHeader starts the EXIF data of a JPEG APP1 segment
+	exifHeader   = []byte("Exif\x00\x00")
+	pngSignature = []byte("\x89PNG\r\n\x1a\n")
+)
+
+// pngMetadataChunks are the PNG chunks holding metadata: EXIF, text and
+// the time of the last change
+var pngMetadataChunks = map[string]bool{"eXIf": true, "tEXt": true, "iTXt": true, "zTXt": true, "tIME": true}
+
+// HoldsMetadata reports whether the file name is an image that can hold
+// metadata, by its extension. SVG images are left out, they are text.
+func HoldsMetadata(name string) bool {
+	return photos[strings.ToLower(path.Ext(name))]
+}
+
+// Strip returns an image without its metadata: the EXIF data, with the
+// camera, the time and the GPS position, XMP, IPTC and comments of JPEG
+// images, the EXIF and text chunks of PNG images, the EXIF and XMP
+// chunks of WebP images and the comments and application extensions of
+// GIF images. The pixels and the color profile are kept as they are, and
+// so is the EXIF orientation, so the image still displays upright.
+//
+// Strip returns ErrInvalidImage for one of these images that cannot be
+// parsed and ErrUnsupportedFormat for a HEIF, AVIF or TIFF image, which
+// can hold metadata it cannot remove. Other data is returned as is.
+func Strip(data []byte) ([]byte, error) {
+	var stripped []byte
+	ok := true
+	switch {
+	case isJPEG(data):
+		stripped, ok = stripJPEG(data)
+	case bytes.HasPrefix(data, pngSignature):
+		stripped, ok = stripPNG(data)
+	case isWebP(data):
+		stripped, ok = stripWebP(data)
+	case isGIF(data):
+		stripped, ok = stripGIF(data)
+	case isHEIF(data), isTIFF(data):
+		return nil, ErrUnsupportedFormat
+	default:
+		return data, nil
+	}
+	if !ok {
+		return nil, ErrInvalidImage
+	}
+	return stripped, nil
+}
+
+// orientation returns the EXIF orientation of an image, 1 when it has none
+func orientation(data []byte) int {
+	o := 0
+	switch {
+	case isJPEG(data):
+		jpegSegments(data, func(marker byte, _, payload []byte) {
+			if marker == markerAPP1 && bytes.HasPrefix(payload, exifHeader) && o == 0 {
+				o = tiffOrientation(payload[len(exifHeader):])
+			}
+		})
+	case bytes.HasPrefix(data, pngSignature):
+		pngChunks(data, func(kind string, _, payload []byte) {
+			if kind == "eXIf" && o == 0 {
+				o = tiffOrientation(payload)
+			}
+		})
+	case isWebP(data):
+		webpChunks(data, func(kind string, _, payload []byte) {
+			if kind == "EXIF" && o == 0 {
+				o = tiffOrientation(bytes.TrimPrefix(payload, exifHeader))
+			}
+		})
+	}
+	if o == 0 {
+		return 1
+	}
+	return o
+}
+
+// isJPEG reports whether data starts like a JPEG image
+func isJPEG(data []byte) bool {
+	return len(data) > 2 && data[0] == 0xff && data[1] == markerSOI
+}
+
+// isWebP reports whether data starts like a WebP image
+func isWebP(data []byte) bool {
+	return len(data) >= 12 && string(data[:4]) == "RIFF" && string(data[8:12]) == "WEBP"
+}
+
+// isGIF reports whether data starts like a GIF image
+func isGIF(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("GIF87a")) || bytes.HasPrefix(data, []byte("GIF89a"))
+}
+
+// isHEIF reports whether data starts like a HEIF or AVIF image
+func isHEIF(data []byte) bool {
+	return len(data) >= 12 && string(data[4:8]) == "ftyp" && heifBrands[string(data[8:12])]
+}
+
+// isTIFF reports whether data starts like a TIFF image
+func isTIFF(data []byte) bool {
+	return bytes.HasPrefix(data, []byte("II*\x00")) || bytes.HasPrefix(data, []byte("MM\x00*"))
+}
+
+// stripJPEG drops the APP1, APP13 and comment segments of a JPEG image.
+// It reports false for data that is not a valid JPEG image.
+func stripJPEG(data []byte) ([]byte, bool) {
+	o := orientation(data)
+	out := make([]byte, 0, len(data))
+	out = append(out, 0xff, markerSOI)
+	stripped, oriented := false, o == 1
+	scan, ok := jpegSegments(data, func(marker byte, segment, _ []byte) {
+		// The orientation follows the JFIF segment, which comes first
+		if !oriented && marker != markerAPP0 {
+			out = appendSegment(out, markerAPP1, append(bytes.Clone(exifHeader), orientationTIFF(o)...))
+			oriented = true
+		}
+		switch marker {
+		case markerAPP1, markerAPP13, markerCOM:
+			stripped = true
+		default:
+			out = append(out, segment...)
+		}
+	})
+	if !ok {
+		return nil, false
+	}
+	if !stripped {
+		return data, true
+	}
+	return append(out, data[scan:]...), true
+}
+
+// jpegSegments calls fn with the marker, the bytes and the payload of the
+// segments of a JPEG image up to its first scan and returns the offset of
+// the scan. It reports false for data that is not a valid JPEG image.
+func jpegSegments(data []byte, fn func(marker byte, segment, payload []byte)) (int, bool) {
+	if !isJPEG(data) {
+		return 0, false
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xff {
+			return 0, false
+		}
+		marker := data[i+1]
+		switch {
+		case marker == 0xff:
+			// Fill byte
+			i++
+			continue
+		case marker == markerSOS:
+			return i, true
+		case marker == markerEOI:
+			return 0, false
+		case marker == 0x01 || marker >= 0xd0 && marker <= 0xd7:
+			// Markers without a payload
+			fn(marker, data[i:i+2], nil)
+			i += 2
+			continue
+		}
+		n := int(binary.BigEndian.Uint16(data[i+2:]))
+		if n < 2 || i+2+n > len(data) {
+			return 0, false
+		}
+		fn(marker, data[i:i+2+n], data[i+4:i+2+n])
+		i += 2 + n
+	}
+	return 0, false
+}
+
+// appendSegment appends a JPEG segment to out
+func appendSegment(out []byte, marker byte, payload []byte) []byte {
+	out = append(out, 0xff, marker)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(payload)+2))
+	return append(out, payload...)
+}
+
+// stripPNG drops the metadata chunks of a PNG image and anything after
+// its end. It reports false for data that is not a valid PNG image.
+func stripPNG(data []byte) ([]byte, bool) {
+	o := orientation(data)
+	out := make([]byte, 0, len(data))
+	out = append(out, pngSignature...)
+	stripped := false
+	end := pngChunks(data, func(kind string, chunk, _ []byte) {
+		if !pngMetadataChunks[kind] {
+			out = append(out, chunk...)
+			return
+		}
+		stripped = true
+		if kind == "eXIf" && o != 1 {
+			out = appendChunk(out, kind, orientationTIFF(o))
+		}
+	})
+	if end == 0 {
+		return nil, false
+	}
+	if !stripped && end == len(data) {
+		return data, true
+	}
+	return out, true
+}
+
+// pngChunks calls fn with the type, the bytes and the payload of the
+// chunks of a PNG image and returns the offset of the end of the image,
+// 0 for data that is not a valid PNG image
+func pngChunks(data []byte, fn func(kind string, chunk, payload []byte)) int {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return 0
+	}
+	for i := len(pngSignature); i+12 <= len(data); {
+		n := int(binary.BigEndian.Uint32(data[i:]))
+		if n > len(data)-i-12 {
+			return 0
+		}
+		kind := string(data[i+4 : i+8])
+		fn(kind, data[i:i+12+n], data[i+8:i+8+n])
+		i += 12 + n
+		if kind == "IEND" {
+			return i
+		}
+	}
+	return 0
+}
+
+// appendChunk appends a PNG chunk to out
+func appendChunk(out []byte, kind string, payload []byte) []byte {
+	out = binary.BigEndian.AppendUint32(out, uint32(len(payload)))
+	start := len(out)
+	out = append(out, kind...)
+	out = append(out, payload...)
+	return binary.BigEndian.AppendUint32(out, crc32.ChecksumIEEE(out[start:]))
+}
+
+// stripWebP drops the EXIF and XMP chunks of an extended WebP image. It
+// reports false for data that is not a valid WebP image.
+func stripWebP(data []byte) ([]byte, bool) {
+	o := orientation(data)
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:12]...)
+	stripped := false
+	ok := webpChunks(data, func(kind string, chunk, payload []byte) {
+		switch kind {
+		case "EXIF", "XMP ":
+			stripped = true
+			if kind == "EXIF" && o != 1 {
+				out = appendWebPChunk(out, kind, orientationTIFF(o))
+			}
+		case "VP8X":
+			start := len(out)
+			out = append(out, chunk...)
+			if len(payload) > 0 {
+				out[start+8] &^= webpFlagXMP
+				if o == 1 {
+					out[start+8] &^= webpFlagEXIF
+				}
+			}
+		default:
+			out = append(out, chunk...)
+		}
+	})
+	if !ok {
+		return nil, false
+	}
+	if !stripped {
+		return data, true
+	}
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out, true
+}
+
+// webpChunks calls fn with the FourCC, the bytes and the payload of the
+// chunks of a WebP image. It reports false for data that is not a valid
+// WebP image.
+func webpChunks(data []byte, fn func(kind string, chunk, payload []byte)) bool {
+	if !isWebP(data) {
+		return false
+	}
+	size := int(binary.LittleEndian.Uint32(data[4:])) + 8
+	if size > len(data) || size < 12 {
+		return false
+	}
+	for i := 12; i < size; {
+		if i+8 > size {
+			return false
+		}
+		n := int(binary.LittleEndian.Uint32(data[i+4:]))
+		if n > size-i-8 {
+			return false
+		}
+		end := i + 8 + n + n%2
+		if end > size {
+			end = size
+		}
+		fn(string(data[i:i+4]), data[i:end], data[i+8:i+8+n])
+		i = end
+	}
+	return true
+}
+
+// appendWebPChunk appends a RIFF chunk padded to an even size to out
+func appendWebPChunk(out []byte, kind string, payload []byte) []byte {
+	out = append(out, kind...)
+	out = binary.LittleEndian.AppendUint32(out, uint32(len(payload)))
+	out = append(out, payload...)
+	if len(payload)%2 == 1 {
+		out = append(out, 0)
+	}
+	return out
+}
+
+// stripGIF drops the comments and the application extensions of a GIF
+// image, XMP included, but the ones looping an animation, and anything
+// after its end. It reports false for data that is not a valid GIF image.
+func stripGIF(data []byte) ([]byte, bool) {
+	// The header and the logical screen descriptor, with the global color table
+	i := 13
+	if len(data) < i {
+		return nil, false
+	}
+	if data[10]&0x80 != 0 {
+		i += 3 << (data[10]&0x07 + 1)
+	}
+	if i > len(data) {
+		return nil, false
+	}
+	out := make([]byte, 0, len(data))
+	out = append(out, data[:i]...)
+	stripped := false
+	for i < len(data) {
+		start := i
+		switch data[i] {
+		case 0x3b:
+			// Trailer
+			if !stripped && i+1 == len(data) {
+				return data, true
+			}
+			return append(out, 0x3b), true
+		case 0x2c:
+			// Image descriptor, local color table and image data
+			if i+11 > len(data) {
+				return nil, false
+			}
+			if data[i+9]&0x80 != 0 {
+				i += 3 << (data[i+9]&0x07 + 1)
+			}
+			i = gifSubBlocks(data, i+11)
+		case 0x21:
+			if i+2 > len(data) {
+				return nil, false
+			}
+			label := data[i+1]
+			i = gifSubBlocks(data, i+2)
+			if i < 0 {
+				return nil, false
+			}
+			app := label == 0xff && start+14 <= len(data) && data[start+2] == 11 &&
+				gifLoopApps[string(data[start+3:start+14])]
+			if label == 0xfe || label == 0xff && !app {
+				stripped = true
+				continue
+			}
+		default:
+			return nil, false
+		}
+		if i < 0 {
+			return nil, false
+		}
+		out = append(out, data[start:i]...)
+	}
+	return nil, false
+}
+
+// gifSubBlocks returns the offset after the data sub-blocks of a GIF
+// image starting at i, -1 when they run past the end of data
+func gifSubBlocks(data []byte, i int) int {
+	for i < len(data) {
+		n := int(data[i])
+		i += 1 + n
+		if n == 0 {
+			return i
+		}
+	}
+	return -1
+}
+
+// tiffOrientation returns the orientation tag of the first IFD of EXIF
+// data, 0 when there is none
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 0
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+	if order.Uint16(tiff[2:]) != 42 {
+		return 0
+	}
+	ifd := int(order.Uint32(tiff[4:]))
+	if ifd < 8 || ifd > len(tiff)-2 {
+		return 0
+	}
+	n := int(order.Uint16(tiff[ifd:]))
+	for i := 0; i < n; i++ {
+		entry := ifd + 2 + 12*i
+		if entry+12 > len(tiff) {
+			return 0
+		}
+		// A single SHORT value
+		if order.Uint16(tiff[entry:]) != orientationTag || order.Uint16(tiff[entry+2:]) != 3 {
+			continue
+		}
+		if o := int(order.Uint16(tiff[entry+8:])); o >= 1 && o <= 8 {
+			return o
+		}
+		return 0
+	}
+	return 0
+}
+
+// orientationTIFF returns EXIF data holding nothing but an orientation
+func orientationTIFF(o int) []byte {
+	tiff := []byte("MM\x00\x2a\x00\x00\x00\x08")
+	tiff = binary.BigEndian.AppendUint16(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, orientationTag)
+	tiff = binary.BigEndian.AppendUint16(tiff, 3)
+	tiff = binary.BigEndian.AppendUint32(tiff, 1)
+	tiff = binary.BigEndian.AppendUint16(tiff, uint16(o))
+	tiff = append(tiff, 0, 0)
+	// No next IFD
+	return binary.BigEndian.AppendUint32(tiff, 0)
+}
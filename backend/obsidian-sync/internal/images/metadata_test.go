@@ -0,0 +1,175 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// private is metadata that must not be published
+const private = "GPS 52.3676N 4.9041E"
+
+// testJPEG returns a JPEG image with an EXIF segment holding the
+// orientation o and private data, an XMP segment and a comment
+func testJPEG(t *testing.T, width, height, o int) []byte {
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, testImage(width, height, false), nil))
+	data := buf.Bytes()
+
+	var out []byte
+	out = append(out, data[:2]...)
+	out = appendSegment(out, markerAPP1, append(append(bytes.Clone(exifHeader), orientationTIFF(o)...), private...))
+	out = appendSegment(out, markerAPP1, []byte("http://ns.adobe.com/xap/1.0/\x00"+private))
+	out = appendSegment(out, markerCOM, []byte(private))
+	return append(out, data[2:]...)
+}
+
+// testImage returns an image with a different color in every pixel
+func testImage(width, height int, transparent bool) *image.NRGBA {
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			a := uint8(255)
+			if transparent && x < width/2 {
+				a = 128
+			}
+			img.SetNRGBA(x, y, color.NRGBA{R: uint8(x * 7), G: uint8(y * 13), B: uint8(x*y + x%3*90), A: a})
+		}
+	}
+	return img
+}
+
+// mustStrip strips the metadata of an image that can be stripped
+func mustStrip(t *testing.T, data []byte) []byte {
+	stripped, err := Strip(data)
+	require.NoError(t, err)
+	return stripped
+}
+
+func TestStripJPEG(t *testing.T) {
+	data := testJPEG(t, 40, 20, 6)
+	stripped := mustStrip(t, data)
+	assert.NotContains(t, string(stripped), private)
+	assert.NotContains(t, string(stripped), "http://ns.adobe.com/xap/")
+	assert.Equal(t, 6, orientation(stripped), "the orientation is kept")
+	assert.Equal(t, stripped, mustStrip(t, stripped), "a stripped image is left as is")
+
+	img, err := jpeg.Decode(bytes.NewReader(stripped))
+	require.NoError(t, err)
+	assert.Equal(t, image.Rect(0, 0, 40, 20), img.Bounds())
+	width, height, err := Size(stripped)
+	require.NoError(t, err)
+	assert.Equal(t, []int{20, 40}, []int{width, height}, "the size is the displayed one")
+
+	upright := mustStrip(t, testJPEG(t, 40, 20, 1))
+	assert.Equal(t, 1, orientation(upright))
+	assert.NotContains(t, string(upright), "Exif")
+}
+
+func TestStripPNG(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, testImage(8, 8, true)))
+	data := buf.Bytes()
+	assert.Equal(t, data, mustStrip(t, data), "an image without metadata is left as is")
+
+	// Metadata chunks before the last one, IEND
+	end := len(data) - 12
+	var tagged []byte
+	tagged = append(tagged, data[:end]...)
+	tagged = appendChunk(tagged, "tEXt", []byte("Comment\x00"+private))
+	tagged = appendChunk(tagged, "eXIf", orientationTIFF(3))
+	tagged = append(tagged, data[end:]...)
+	tagged = append(tagged, private...)
+	_, err := png.Decode(bytes.NewReader(tagged))
+	require.NoError(t, err)
+	assert.Equal(t, 3, orientation(tagged))
+
+	stripped := mustStrip(t, tagged)
+	assert.NotContains(t, string(stripped), private)
+	assert.Equal(t, 3, orientation(stripped))
+	_, err = png.Decode(bytes.NewReader(stripped))
+	assert.NoError(t, err)
+}
+
+func TestStripWebP(t *testing.T) {
+	chunk := func(kind string, payload []byte) []byte { return appendWebPChunk(nil, kind, payload) }
+	var body []byte
+	body = append(body, "WEBP"...)
+	body = append(body, chunk("VP8X", []byte{webpFlagEXIF | webpFlagXMP, 0, 0, 0, 7, 0, 0, 7, 0, 0})...)
+	body = append(body, chunk("VP8 ", []byte("frame"))...)
+	body = append(body, chunk("EXIF", append(orientationTIFF(8), private...))...)
+	body = append(body, chunk("XMP ", []byte(private))...)
+	data := binary.LittleEndian.AppendUint32([]byte("RIFF"), uint32(len(body)))
+	data = append(data, body...)
+	assert.Equal(t, 8, orientation(data))
+
+	stripped := mustStrip(t, data)
+	assert.NotContains(t, string(stripped), private)
+	assert.Equal(t, 8, orientation(stripped))
+	assert.Equal(t, uint32(len(stripped)-8), binary.LittleEndian.Uint32(stripped[4:]))
+	assert.Equal(t, byte(webpFlagEXIF), stripped[20], "only the EXIF flag is left")
+	assert.Contains(t, string(stripped), "VP8 \x05\x00\x00\x00frame\x00")
+}
+
+func TestStripGIF(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, gif.Encode(&buf, testImage(8, 8, false), nil))
+	data := buf.Bytes()
+	assert.Equal(t, data, mustStrip(t, data), "an image without metadata is left as is")
+
+	// The extensions go after the screen descriptor and its color table
+	screen := 13 + 3<<(data[10]&0x07+1)
+	loop := []byte("\x21\xff\x0bNETSCAPE2.0\x03\x01\x00\x00\x00")
+	var tagged []byte
+	tagged = append(tagged, data[:screen]...)
+	tagged = append(tagged, loop...)
+	tagged = append(tagged, 0x21, 0xfe, byte(len(private)))
+	tagged = append(tagged, private...)
+	tagged = append(tagged, 0x00)
+	tagged = append(tagged, "\x21\xff\x0bXMP DataXMP\x05GPS 1\x00"...)
+	tagged = append(tagged, data[screen:]...)
+	_, err := gif.Decode(bytes.NewReader(tagged))
+	require.NoError(t, err)
+
+	stripped := mustStrip(t, tagged)
+	assert.NotContains(t, string(stripped), private)
+	assert.NotContains(t, string(stripped), "XMP")
+	assert.Contains(t, string(stripped), string(loop), "the animation still loops")
+	_, err = gif.Decode(bytes.NewReader(stripped))
+	assert.NoError(t, err)
+}
+
+func TestStripUnsupported(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"heic": []byte("\x00\x00\x00\x18ftypheic\x00\x00\x00\x00mif1heicExif\x00\x00" + private),
+		"avif": []byte("\x00\x00\x00\x1cftypavif\x00\x00\x00\x00avifmif1miaf"),
+		"tiff": append([]byte("II*\x00\x08\x00\x00\x00"), private...),
+	} {
+		_, err := Strip(data)
+		assert.ErrorIs(t, err, ErrUnsupportedFormat, name)
+	}
+}
+
+func TestStripInvalid(t *testing.T) {
+	for _, data := range [][]byte{nil, []byte("not an image")} {
+		assert.Equal(t, data, mustStrip(t, data), "data that is no image is left as is")
+		assert.Equal(t, 1, orientation(data))
+	}
+	for _, data := range [][]byte{
+		{0xff, markerSOI, 0xff, markerAPP1, 0xff, 0xff},
+		append(bytes.Clone(pngSignature), "\x00\x00\x00\x20tEXt"+private...),
+		[]byte("GIF89a\x01\x00"),
+	} {
+		_, err := Strip(data)
+		assert.ErrorIs(t, err, ErrInvalidImage)
+		assert.Equal(t, 1, orientation(data))
+	}
+}
@@ -1,10 +1,11 @@
 package lib
 
 import (
+	"fmt"
 	"io"
 	"log"
 	"os"
-	"testing"
+	"sort"
 
 	"github.com/savabush/obsidian-sync/internal/config"
 )
@@ -12,38 +13,65 @@ import (
 // TestLogger implements a simple logger for testing
 type TestLogger struct {
 	*log.Logger
+	// fields are appended to every line
+	fields config.Fields
 }
 
-func (l *TestLogger) Info(args ...interface{})                    { l.Println(args...) }
-func (l *TestLogger) Infof(format string, args ...interface{})    { l.Printf(format+"\n", args...) }
-func (l *TestLogger) Debug(args ...interface{})                   { l.Println(args...) }
-func (l *TestLogger) Debugf(format string, args ...interface{})   { l.Printf(format+"\n", args...) }
-func (l *TestLogger) Warning(args ...interface{})                 { l.Println(args...) }
-func (l *TestLogger) Warningf(format string, args ...interface{}) { l.Printf(format+"\n", args...) }
-func (l *TestLogger) Error(args ...interface{})                   { l.Println(args...) }
-func (l *TestLogger) Errorf(format string, args ...interface{})   { l.Printf(format+"\n", args...) }
-func (l *TestLogger) Fatal(args ...interface{})                   { l.Println(args...) }
-func (l *TestLogger) Fatalf(format string, args ...interface{})   { l.Printf(format+"\n", args...) }
-func (l *TestLogger) Warn(args ...interface{})                    { l.Println(args...) }
-func (l *TestLogger) Warnf(format string, args ...interface{})    { l.Printf(format+"\n", args...) }
+func (l *TestLogger) Info(args ...interface{})                 { l.print(fmt.Sprint(args...)) }
+func (l *TestLogger) Infof(format string, args ...interface{}) { l.print(fmt.Sprintf(format, args...)) }
+func (l *TestLogger) Debug(args ...interface{})                { l.print(fmt.Sprint(args...)) }
+func (l *TestLogger) Debugf(format string, args ...interface{}) {
+	l.print(fmt.Sprintf(format, args...))
+}
+func (l *TestLogger) Warning(args ...interface{}) { l.print(fmt.Sprint(args...)) }
+func (l *TestLogger) Warningf(format string, args ...interface{}) {
+	l.print(fmt.Sprintf(format, args...))
+}
+func (l *TestLogger) Error(args ...interface{}) { l.print(fmt.Sprint(args...)) }
+func (l *TestLogger) Errorf(format string, args ...interface{}) {
+	l.print(fmt.Sprintf(format, args...))
+}
+func (l *TestLogger) Fatal(args ...interface{}) { l.print(fmt.Sprint(args...)) }
+func (l *TestLogger) Fatalf(format string, args ...interface{}) {
+	l.print(fmt.Sprintf(format, args...))
+}
+func (l *TestLogger) Warn(args ...interface{})                 { l.print(fmt.Sprint(args...)) }
+func (l *TestLogger) Warnf(format string, args ...interface{}) { l.print(fmt.Sprintf(format, args...)) }
 
-// Global test logger instance
-var TestLog config.LoggerInterface
+func (l *TestLogger) WithField(key string, value interface{}) config.LoggerInterface {
+	return l.WithFields(config.Fields{key: value})
+}
 
-func init() {
-	writer := io.MultiWriter(os.Stdout)
-	TestLog = &TestLogger{
-		Logger: log.New(writer, "TEST: ", log.Ldate|log.Ltime),
+func (l *TestLogger) WithFields(fields config.Fields) config.LoggerInterface {
+	merged := make(config.Fields, len(l.fields)+len(fields))
+	for key, value := range l.fields {
+		merged[key] = value
 	}
+	for key, value := range fields {
+		merged[key] = value
+	}
+	return &TestLogger{Logger: l.Logger, fields: merged}
+}
+
+// print writes the message followed by the fields sorted by key
+func (l *TestLogger) print(msg string) {
+	keys := make([]string, 0, len(l.fields))
+	for key := range l.fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		msg += fmt.Sprintf(" %s=%v", key, l.fields[key])
+	}
+	l.Println(msg)
 }
 
-func SetupTestLogger(t *testing.T) func() {
-	// Replace the global logger
-	originalLogger := config.Logger
-	config.Logger = TestLog
+// Global test logger instance, passed to constructors in tests
+var TestLog *TestLogger
 
-	// Return cleanup function
-	return func() {
-		config.Logger = originalLogger
+func init() {
+	writer := io.MultiWriter(os.Stdout)
+	TestLog = &TestLogger{
+		Logger: log.New(writer, "TEST: ", log.Ldate|log.Ltime),
 	}
 }
@@ -0,0 +1,270 @@
+// Package markdown renders the markdown body of a note to sanitized HTML.
+//
+// Notes are rendered with the GitHub Flavored Markdown extensions (tables,
+// task lists, strikethrough and autolinks) and footnotes. Code blocks are
+// highlighted with chroma CSS classes and headings get IDs to link to. The
+// Obsidian callouts, highlights, math and mermaid diagrams are rendered to
+// semantic HTML. Raw HTML in notes is kept, and the whole document is then
+// sanitized, so the output is safe to embed in a page. Relative links, e.g. to the resources
+// of a post, are resolved by the caller.
+package markdown
+
+import (
+	"bytes"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	highlighting "github.com/yuin/goldmark-highlighting/v2"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer/html"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// Renderer renders notes to HTML. It is safe for concurrent use.
+type Renderer struct {
+	md     goldmark.Markdown
+	policy *bluemonday.Policy
+}
+
+// New creates a renderer.
+func New() *Renderer {
+	return &Renderer{
+		md: goldmark.New(
+			goldmark.WithExtensions(
+				extension.GFM,
+				extension.Footnote,
+				obsidian{},
+				highlighting.NewHighlighting(highlighting.WithFormatOptions(chromahtml.WithClasses(true))),
+			),
+			goldmark.WithParserOptions(
+				parser.WithAutoHeadingID(),
+				parser.WithASTTransformers(util.Prioritized(linkTransformer{}, 100)),
+			),
+			goldmark.WithRendererOptions(html.WithUnsafe()),
+		),
+		policy: policy(),
+	}
+}
+
+// LinkResolver returns the URL of a relative link or image destination of
+// a note, e.g. Resources/image.png, empty to keep the destination as is.
+type LinkResolver func(destination string) string
+
+// resolverKey holds the LinkResolver of the note being rendered
+var resolverKey = parser.NewContextKey()
+
+// Heading is an entry of the table of contents of a document
+type Heading struct {
+	// Level is 1 to 6
+	Level int    `json:"level"`
+	Text  string `json:"text"`
+	// ID is the ID of the heading in the rendered HTML to link to
+	ID string `json:"id"`
+	// Children are the headings of a lower level up to the next heading
+	// of the same or a higher level
+	Children []Heading `json:"children,omitempty"`
+}
+
+// Document is a rendered markdown body
+type Document struct {
+	HTML []byte
+	// TOC is the tree of the headings of the document, those nested in
+	// quotes, callouts or lists left out
+	TOC []Heading
+}
+
+// Render renders a markdown body to sanitized HTML, pointing its relative
+// links and images to the URLs returned by resolve (nil keeps them). The
+// same body always renders to the same bytes.
+func (r *Renderer) Render(body string, resolve LinkResolver) ([]byte, error) {
+	doc, err := r.RenderDocument(body, resolve)
+	return doc.HTML, err
+}
+
+// RenderDocument renders a markdown body like Render and returns it with
+// its table of contents.
+func (r *Renderer) RenderDocument(body string, resolve LinkResolver) (Document, error) {
+	source := []byte(body)
+	ctx := parser.NewContext(parser.WithIDs(newHeadingIDs()))
+	if resolve != nil {
+		ctx.Set(resolverKey, resolve)
+	}
+	root := r.md.Parser().Parse(text.NewReader(source), parser.WithContext(ctx))
+
+	var buf bytes.Buffer
+	if err := r.md.Renderer().Render(&buf, source, root); err != nil {
+		return Document{}, err
+	}
+	return Document{HTML: r.policy.SanitizeBytes(buf.Bytes()), TOC: tableOfContents(root, source)}, nil
+}
+
+// tableOfContents returns the tree of the top-level headings of a document
+func tableOfContents(root ast.Node, source []byte) []Heading {
+	var headings []Heading
+	for node := root.FirstChild(); node != nil; node = node.NextSibling() {
+		heading, ok := node.(*ast.Heading)
+		if !ok {
+			continue
+		}
+		id, _ := heading.AttributeString("id")
+		idBytes, _ := id.([]byte)
+		headings = append(headings, Heading{
+			Level: heading.Level,
+			Text:  strings.TrimSpace(inlineText(heading, source)),
+			ID:    string(idBytes),
+		})
+	}
+	return nestHeadings(headings)
+}
+
+// nestHeadings nests every heading of a flat list under the previous one
+// of a higher level
+func nestHeadings(headings []Heading) []Heading {
+	var tree []Heading
+	for i := 0; i < len(headings); {
+		heading := headings[i]
+		end := i + 1
+		for end < len(headings) && headings[end].Level > heading.Level {
+			end++
+		}
+		heading.Children = nestHeadings(headings[i+1 : end])
+		tree = append(tree, heading)
+		i = end
+	}
+	return tree
+}
+
+// inlineText returns the text of the inline nodes under node, without markup
+func inlineText(node ast.Node, source []byte) string {
+	var b strings.Builder
+	for child := node.FirstChild(); child != nil; child = child.NextSibling() {
+		switch n := child.(type) {
+		case *ast.Text:
+			b.Write(n.Segment.Value(source))
+			if n.SoftLineBreak() || n.HardLineBreak() {
+				b.WriteByte(' ')
+			}
+		case *ast.String:
+			b.Write(n.Value)
+		case *ast.RawHTML:
+			// Tags are not text
+		case *mathInline:
+			b.Write(n.content.Value(source))
+		default:
+			b.WriteString(inlineText(child, source))
+		}
+	}
+	return b.String()
+}
+
+// linkTransformer resolves the relative link and image destinations of a
+// document with the LinkResolver of its context
+type linkTransformer struct{}
+
+func (linkTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	resolve, _ := pc.Get(resolverKey).(LinkResolver)
+	if resolve == nil {
+		return
+	}
+	_ = ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := node.(type) {
+		case *ast.Link:
+			n.Destination = resolveDestination(resolve, n.Destination)
+		case *ast.Image:
+			n.Destination = resolveDestination(resolve, n.Destination)
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+// resolveDestination returns the resolved URL of a relative destination,
+// else the destination unchanged
+func resolveDestination(resolve LinkResolver, destination []byte) []byte {
+	dest := string(destination)
+	if u, err := url.Parse(dest); err != nil || u.Scheme != "" || u.Host != "" ||
+		strings.HasPrefix(dest, "/") || strings.HasPrefix(dest, "#") {
+		return destination
+	}
+	if unescaped, err := url.PathUnescape(dest); err == nil {
+		dest = unescaped
+	}
+	if resolved := resolve(strings.TrimPrefix(dest, "./")); resolved != "" {
+		return []byte(resolved)
+	}
+	return destination
+}
+
+// Patterns of the attribute values kept by the sanitizer
+var (
+	idRe    = regexp.MustCompile(`^[\p{L}\p{N}:_-]+$`)
+	classRe = regexp.MustCompile(`^[\w\s-]+$`)
+	roleRe  = regexp.MustCompile(`^doc-[a-z]+$`)
+)
+
+// policy returns the sanitizer of rendered notes: the user generated
+// content policy extended with the markup of the enabled extensions
+func policy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+	// Heading anchors and footnotes
+	p.AllowAttrs("id").Matching(idRe).OnElements("h1", "h2", "h3", "h4", "h5", "h6", "li", "sup")
+	p.AllowAttrs("role").Matching(roleRe).OnElements("a", "div", "li")
+	// Highlighted code and footnotes
+	p.AllowAttrs("class").Matching(classRe).OnElements("a", "code", "div", "pre", "span", "sup")
+	// Task lists
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+	// Table cell alignment
+	p.AllowAttrs("style").Matching(regexp.MustCompile(`^text-align:(left|center|right)$`)).OnElements("th", "td")
+	// Callouts, highlights, math and diagrams
+	p.AllowElements("details", "summary", "mark")
+	p.AllowAttrs("open").OnElements("details")
+	p.AllowAttrs("class").Matching(classRe).OnElements("details", "summary")
+	p.AllowAttrs("data-callout").Matching(regexp.MustCompile(`^[\w-]+$`)).OnElements("div", "details")
+	return p
+}
+
+// headingIDs generates the IDs of the headings of a document from their
+// text. Unlike the goldmark default it keeps non-ASCII letters, so
+// headings in Russian get readable anchors too.
+type headingIDs struct {
+	used map[string]bool
+}
+
+func newHeadingIDs() *headingIDs {
+	return &headingIDs{used: make(map[string]bool)}
+}
+
+// Generate returns a unique ID for a heading: its lowercased words joined
+// by dashes, with a number appended to repeated IDs
+func (s *headingIDs) Generate(value []byte, kind ast.NodeKind) []byte {
+	words := strings.FieldsFunc(strings.ToLower(string(value)), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r) && r != '_'
+	})
+	id := strings.Join(words, "-")
+	if id == "" {
+		id = "heading"
+	}
+	unique := id
+	for i := 1; s.used[unique]; i++ {
+		unique = id + "-" + strconv.Itoa(i)
+	}
+	s.used[unique] = true
+	return []byte(unique)
+}
+
+// Put reserves an ID set explicitly
+func (s *headingIDs) Put(value []byte) {
+	s.used[string(value)] = true
+}
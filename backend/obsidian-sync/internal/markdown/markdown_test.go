@@ -0,0 +1,152 @@
+package markdown
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		contains []string
+		excludes []string
+	}{
+		{
+			name:     "heading anchors",
+			body:     "# Привет, мир!\n\n## Intro\n\n## Intro\n\n## {#}",
+			contains: []string{`<h1 id="привет-мир">`, `<h2 id="intro">`, `<h2 id="intro-1">`, `<h2 id="heading">`},
+		},
+		{
+			name:     "table",
+			body:     "| a | b |\n|:--|--:|\n| 1 | 2 |",
+			contains: []string{"<table>", `<th style="text-align:left">a</th>`, `<td style="text-align:right">2</td>`},
+		},
+		{
+			name:     "task list",
+			body:     "- [x] done\n- [ ] todo",
+			contains: []string{`<input checked="" disabled="" type="checkbox"> done`, `<input disabled="" type="checkbox"> todo`},
+		},
+		{
+			name: "footnotes",
+			body: "Text[^1]\n\n[^1]: Note",
+			contains: []string{`<sup id="fnref:1"><a href="#fn:1" class="footnote-ref" role="doc-noteref"`,
+				`<div class="footnotes" role="doc-endnotes">`, `<li id="fn:1">`},
+		},
+		{
+			name:     "highlighted code",
+			body:     "```go\nfunc main() {}\n```",
+			contains: []string{`<pre class="chroma">`, `<span class="kd">func</span>`},
+		},
+		{
+			name:     "autolinks and strikethrough",
+			body:     "~~old~~ https://example.com",
+			contains: []string{"<del>old</del>", `<a href="https://example.com" rel="nofollow">`},
+		},
+		{
+			name: "callouts",
+			body: "> [!note]\n> Body\n\n> [!Warning] Be **careful**\n\n> Quote",
+			contains: []string{`<div class="callout" data-callout="note">` + "\n" + `<div class="callout-title">Note</div>` + "\n" +
+				`<div class="callout-content">` + "\n<p>Body</p>\n</div>\n</div>",
+				`<div class="callout" data-callout="warning">` + "\n" + `<div class="callout-title">Be <strong>careful</strong></div>` + "\n</div>",
+				"<blockquote>\n<p>Quote</p>\n</blockquote>"},
+			excludes: []string{"[!"},
+		},
+		{
+			name: "folded callouts",
+			body: "> [!tip]- Closed\n> Hidden\n\n> [!todo]+ Open\n> > [!info]\n> > Nested",
+			contains: []string{`<details class="callout" data-callout="tip">` + "\n" + `<summary class="callout-title">Closed</summary>`,
+				`<details class="callout" data-callout="todo" open="">` + "\n" + `<summary class="callout-title">Open</summary>`,
+				`<div class="callout-content">` + "\n" + `<div class="callout" data-callout="info">`},
+		},
+		{
+			name:     "highlights",
+			body:     "Some ==marked *text*== and a==b, ===not===",
+			contains: []string{"Some <mark>marked <em>text</em></mark>", "===not==="},
+		},
+		{
+			name: "math",
+			body: "Inline $a_b + c_d$ and $$x^2$$, prices $5 and $10\n\n$$\n\\frac{a_1}{b_2} < c\n$$",
+			contains: []string{`<span class="math math-inline">a_b + c_d</span>`, `<span class="math math-display">x^2</span>`,
+				"prices $5 and $10", `<div class="math math-display">\frac{a_1}{b_2} &lt; c</div>`},
+			excludes: []string{"<em>"},
+		},
+		{
+			name:     "mermaid",
+			body:     "```mermaid\ngraph TD\n  A-->B\n```",
+			contains: []string{`<pre class="mermaid">graph TD` + "\n" + `  A--&gt;B</pre>`},
+			excludes: []string{"chroma"},
+		},
+		{
+			name:     "raw html is sanitized",
+			body:     "<b onclick=\"steal()\">bold</b><script>alert(1)</script>\n\n[x](javascript:alert(1)) <p style=\"color:red\">red</p>",
+			contains: []string{"<b>bold</b>", "<p>red</p>"},
+			excludes: []string{"onclick", "<script", "alert(1)", "javascript:", "color:red"},
+		},
+	}
+	r := New()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, err := r.Render(tt.body, nil)
+			require.NoError(t, err)
+			for _, s := range tt.contains {
+				assert.Contains(t, string(out), s)
+			}
+			for _, s := range tt.excludes {
+				assert.NotContains(t, string(out), s)
+			}
+		})
+	}
+}
+
+func TestRenderLinks(t *testing.T) {
+	resolve := func(destination string) string {
+		if name, ok := strings.CutPrefix(destination, "Resources/"); ok {
+			return "https://api.example.com/resources/" + url.PathEscape(name)
+		}
+		return ""
+	}
+	out, err := New().Render("![Cover](Resources/cover%20image.png) ![Diagram](<./Resources/a b.svg>)\n\n"+
+		"[Other](Other.md) [Site](https://example.com) [Top](#top) [Root](/posts)", resolve)
+	require.NoError(t, err)
+	for _, s := range []string{
+		`<img src="https://api.example.com/resources/cover%20image.png" alt="Cover">`,
+		`<img src="https://api.example.com/resources/a%20b.svg" alt="Diagram">`,
+		`<a href="Other.md"`, `<a href="https://example.com"`, `<a href="#top"`, `<a href="/posts"`,
+	} {
+		assert.Contains(t, string(out), s)
+	}
+}
+
+func TestRenderIsStable(t *testing.T) {
+	r := New()
+	body := "# Title\n\n## Title\n\nText[^1]\n\n[^1]: Note"
+	first, err := r.Render(body, nil)
+	require.NoError(t, err)
+	second, err := r.Render(body, nil)
+	require.NoError(t, err)
+	assert.Equal(t, string(first), string(second), "heading IDs start over for every note")
+}
+
+func TestRenderDocumentTOC(t *testing.T) {
+	body := "Intro\n\n## Setup `go`\n\n### Install\n\n> ## Quoted\n\n### Run\n\n# Reference\n\n##### Deep\n\n## Setup go"
+	doc, err := New().RenderDocument(body, nil)
+	require.NoError(t, err)
+	assert.Equal(t, []Heading{
+		{Level: 2, Text: "Setup go", ID: "setup-go", Children: []Heading{
+			{Level: 3, Text: "Install", ID: "install"},
+			{Level: 3, Text: "Run", ID: "run"},
+		}},
+		{Level: 1, Text: "Reference", ID: "reference", Children: []Heading{
+			{Level: 5, Text: "Deep", ID: "deep"},
+			{Level: 2, Text: "Setup go", ID: "setup-go-1"},
+		}},
+	}, doc.TOC)
+	for _, id := range []string{"setup-go", "install", "run", "reference", "deep", "setup-go-1"} {
+		assert.Contains(t, string(doc.HTML), `id="`+id+`"`, "the TOC links to the rendered headings")
+	}
+}
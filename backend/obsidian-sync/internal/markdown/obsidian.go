@@ -0,0 +1,477 @@
+package markdown
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// obsidian extends the renderer with the Obsidian syntax:
+//
+//   - > [!type] callouts, foldable with [!type]+ and [!type]-, render to
+//     <div class="callout" data-callout="type">, or <details> when foldable
+//   - ==highlights== render to <mark>
+//   - $inline$ and $$display$$ math render to <span class="math math-inline">
+//     and <div class="math math-display"> holding the TeX source
+//   - mermaid code blocks render to <pre class="mermaid"> holding the diagram
+//
+// Math and diagrams are left to the site to render. %%comments%% are
+// stripped from the notes before they are rendered.
+type obsidian struct{}
+
+func (obsidian) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(
+		parser.WithBlockParsers(util.Prioritized(mathBlockParser{}, 650)),
+		parser.WithInlineParsers(
+			util.Prioritized(highlightParser{}, 500),
+			util.Prioritized(mathInlineParser{}, 500),
+		),
+		parser.WithASTTransformers(util.Prioritized(obsidianTransformer{}, 200)),
+	)
+	m.Renderer().AddOptions(renderer.WithNodeRenderers(util.Prioritized(obsidianRenderer{}, 500)))
+}
+
+// Node kinds of the Obsidian syntax
+var (
+	kindCallout        = ast.NewNodeKind("Callout")
+	kindCalloutTitle   = ast.NewNodeKind("CalloutTitle")
+	kindCalloutContent = ast.NewNodeKind("CalloutContent")
+	kindHighlight      = ast.NewNodeKind("Highlight")
+	kindMathInline     = ast.NewNodeKind("MathInline")
+	kindMathBlock      = ast.NewNodeKind("MathBlock")
+	kindMermaid        = ast.NewNodeKind("Mermaid")
+)
+
+// callout is a callout block holding its title and its content
+type callout struct {
+	ast.BaseBlock
+	// calloutType is the lowercased type, e.g. note or warning
+	calloutType string
+	// fold is + for a callout folded open, - for a folded one, else 0
+	fold byte
+}
+
+func (n *callout) Kind() ast.NodeKind { return kindCallout }
+
+func (n *callout) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Type": n.calloutType, "Fold": string(n.fold)}, nil)
+}
+
+// calloutTitle holds the inline title of a callout
+type calloutTitle struct {
+	ast.BaseBlock
+}
+
+func (n *calloutTitle) Kind() ast.NodeKind { return kindCalloutTitle }
+
+func (n *calloutTitle) Dump(source []byte, level int) { ast.DumpHelper(n, source, level, nil, nil) }
+
+// calloutContent holds the blocks of a callout
+type calloutContent struct {
+	ast.BaseBlock
+}
+
+func (n *calloutContent) Kind() ast.NodeKind { return kindCalloutContent }
+
+func (n *calloutContent) Dump(source []byte, level int) { ast.DumpHelper(n, source, level, nil, nil) }
+
+// highlight is ==highlighted== text
+type highlight struct {
+	ast.BaseInline
+}
+
+func (n *highlight) Kind() ast.NodeKind { return kindHighlight }
+
+func (n *highlight) Dump(source []byte, level int) { ast.DumpHelper(n, source, level, nil, nil) }
+
+// mathInline is $inline$ math, or $$display$$ math inside a paragraph
+type mathInline struct {
+	ast.BaseInline
+	content text.Segment
+	display bool
+}
+
+func (n *mathInline) Kind() ast.NodeKind { return kindMathInline }
+
+func (n *mathInline) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{"Content": string(n.content.Value(source))}, nil)
+}
+
+// mathBlock is a $$ display math block, its lines are the TeX source
+type mathBlock struct {
+	ast.BaseBlock
+	// closed is set for a block opened and closed on the same line
+	closed bool
+}
+
+func (n *mathBlock) Kind() ast.NodeKind { return kindMathBlock }
+
+func (n *mathBlock) IsRaw() bool { return true }
+
+func (n *mathBlock) Dump(source []byte, level int) { ast.DumpHelper(n, source, level, nil, nil) }
+
+// mermaid is a mermaid code block, its lines are the diagram source
+type mermaid struct {
+	ast.BaseBlock
+}
+
+func (n *mermaid) Kind() ast.NodeKind { return kindMermaid }
+
+func (n *mermaid) IsRaw() bool { return true }
+
+func (n *mermaid) Dump(source []byte, level int) { ast.DumpHelper(n, source, level, nil, nil) }
+
+// highlightDelimiter is the == delimiter of highlights
+type highlightDelimiter struct{}
+
+func (highlightDelimiter) IsDelimiter(b byte) bool { return b == '=' }
+
+func (highlightDelimiter) CanOpenCloser(opener, closer *parser.Delimiter) bool {
+	return opener.Char == closer.Char
+}
+
+func (highlightDelimiter) OnMatch(consumes int) ast.Node { return &highlight{} }
+
+// highlightParser parses ==highlights==
+type highlightParser struct{}
+
+func (highlightParser) Trigger() []byte { return []byte{'='} }
+
+func (highlightParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	before := block.PrecendingCharacter()
+	line, segment := block.PeekLine()
+	node := parser.ScanDelimiter(line, before, 2, highlightDelimiter{})
+	if node == nil || node.OriginalLength != 2 || before == '=' {
+		return nil
+	}
+	node.Segment = segment.WithStop(segment.Start + node.OriginalLength)
+	block.Advance(node.OriginalLength)
+	pc.PushDelimiter(node)
+	return node
+}
+
+func (highlightParser) CloseBlock(parent ast.Node, pc parser.Context) {}
+
+// mathInlineParser parses $inline$ and $$display$$ math within a line. As
+// in Obsidian, inline math does not start before or end after a space and
+// a closing $ is not followed by a digit, so prices like $5 stay text.
+type mathInlineParser struct{}
+
+func (mathInlineParser) Trigger() []byte { return []byte{'$'} }
+
+func (mathInlineParser) Parse(parent ast.Node, block text.Reader, pc parser.Context) ast.Node {
+	line, segment := block.PeekLine()
+	if bytes.HasPrefix(line, []byte("$$")) {
+		end := bytes.Index(line[2:], []byte("$$"))
+		if end <= 0 {
+			return nil
+		}
+		block.Advance(end + 4)
+		return &mathInline{content: text.NewSegment(segment.Start+2, segment.Start+2+end), display: true}
+	}
+	if len(line) < 3 || util.IsSpace(line[1]) {
+		return nil
+	}
+	for end := 2; end < len(line); end++ {
+		if line[end] != '$' || util.IsSpace(line[end-1]) || line[end-1] == '\\' {
+			continue
+		}
+		if end+1 < len(line) && line[end+1] >= '0' && line[end+1] <= '9' {
+			return nil
+		}
+		block.Advance(end + 1)
+		return &mathInline{content: text.NewSegment(segment.Start+1, segment.Start+end)}
+	}
+	return nil
+}
+
+// mathBlockParser parses display math between lines starting and ending
+// with $$, also on a single line
+type mathBlockParser struct{}
+
+func (mathBlockParser) Trigger() []byte { return []byte{'$'} }
+
+func (mathBlockParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, segment := reader.PeekLine()
+	pos := pc.BlockOffset()
+	if pos < 0 || !bytes.HasPrefix(line[pos:], []byte("$$")) {
+		return nil, parser.NoChildren
+	}
+	node := &mathBlock{}
+	rest := util.TrimRightSpace(line[pos+2:])
+	start := segment.Start + pos + 2
+	if end := bytes.Index(rest, []byte("$$")); end >= 0 {
+		// Only a block closing at the end of its line is a single line block
+		if end != len(rest)-2 {
+			return nil, parser.NoChildren
+		}
+		rest, node.closed = rest[:end], true
+	}
+	if !util.IsBlank(rest) {
+		node.Lines().Append(text.NewSegment(start, start+len(rest)))
+	}
+	advanceLine(reader, line, segment)
+	return node, parser.NoChildren
+}
+
+func (mathBlockParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	if node.(*mathBlock).closed {
+		return parser.Close
+	}
+	line, segment := reader.PeekLine()
+	trimmed := util.TrimRightSpace(line)
+	if bytes.HasSuffix(trimmed, []byte("$$")) {
+		if content := trimmed[:len(trimmed)-2]; !util.IsBlank(content) {
+			node.Lines().Append(text.NewSegment(segment.Start, segment.Start+len(content)))
+		}
+		advanceLine(reader, line, segment)
+		return parser.Close
+	}
+	node.Lines().Append(segment)
+	advanceLine(reader, line, segment)
+	return parser.Continue | parser.NoChildren
+}
+
+// advanceLine advances the reader to the line break of its current line
+func advanceLine(reader text.Reader, line []byte, segment text.Segment) {
+	n := segment.Len()
+	if bytes.HasSuffix(line, []byte("\n")) {
+		n--
+	}
+	reader.Advance(n)
+}
+
+func (mathBlockParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {}
+
+func (mathBlockParser) CanInterruptParagraph() bool { return true }
+
+func (mathBlockParser) CanAcceptIndentedLine() bool { return false }
+
+// calloutRe matches the first line of a callout: its type, fold and title
+var calloutRe = regexp.MustCompile(`^\[!([\w-]+)\]([+-]?)[ \t]*`)
+
+// obsidianTransformer turns the blockquotes opening with [!type] into
+// callouts and the mermaid code blocks into diagrams
+type obsidianTransformer struct{}
+
+func (obsidianTransformer) Transform(doc *ast.Document, reader text.Reader, pc parser.Context) {
+	source := reader.Source()
+	var quotes []*ast.Blockquote
+	var diagrams []*ast.FencedCodeBlock
+	_ = ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch n := node.(type) {
+		case *ast.Blockquote:
+			quotes = append(quotes, n)
+		case *ast.FencedCodeBlock:
+			if strings.EqualFold(string(n.Language(source)), "mermaid") {
+				diagrams = append(diagrams, n)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+
+	for _, quote := range quotes {
+		if c := newCallout(quote, source); c != nil {
+			quote.Parent().ReplaceChild(quote.Parent(), quote, c)
+		}
+	}
+	for _, code := range diagrams {
+		diagram := &mermaid{}
+		diagram.SetLines(code.Lines())
+		code.Parent().ReplaceChild(code.Parent(), code, diagram)
+	}
+}
+
+// newCallout converts a blockquote whose first line is [!type] to a
+// callout, nil for any other blockquote. The rest of the first line is the
+// title, the type when empty.
+func newCallout(quote *ast.Blockquote, source []byte) *callout {
+	first, ok := quote.FirstChild().(*ast.Paragraph)
+	if !ok || first.Lines().Len() == 0 {
+		return nil
+	}
+	line := first.Lines().At(0)
+	match := calloutRe.FindSubmatchIndex(line.Value(source))
+	if match == nil {
+		return nil
+	}
+	c := &callout{calloutType: strings.ToLower(string(line.Value(source)[match[2]:match[3]]))}
+	if match[5] > match[4] {
+		c.fold = line.Value(source)[match[4]]
+	}
+
+	// The inline nodes of the first line after the marker are the title
+	title := &calloutTitle{}
+	markerEnd := line.Start + match[1]
+	for child := first.FirstChild(); child != nil; {
+		next := child.NextSibling()
+		start := nodeStart(child)
+		if start >= line.Stop {
+			break
+		}
+		if t, ok := child.(*ast.Text); ok {
+			t.SetSoftLineBreak(false)
+			t.SetHardLineBreak(false)
+			if t.Segment.Stop <= markerEnd {
+				first.RemoveChild(first, child)
+				child = next
+				continue
+			}
+			if t.Segment.Start < markerEnd {
+				t.Segment = t.Segment.WithStart(markerEnd)
+			}
+		}
+		title.AppendChild(title, child)
+		child = next
+	}
+	if !title.HasChildren() {
+		name := []byte(c.calloutType)
+		name[0] = bytes.ToUpper(name[:1])[0]
+		title.AppendChild(title, ast.NewString(name))
+	}
+	if !first.HasChildren() {
+		quote.RemoveChild(quote, first)
+	}
+
+	c.AppendChild(c, title)
+	if quote.HasChildren() {
+		content := &calloutContent{}
+		for child := quote.FirstChild(); child != nil; child = quote.FirstChild() {
+			content.AppendChild(content, child)
+		}
+		c.AppendChild(c, content)
+	}
+	return c
+}
+
+// nodeStart returns the source position an inline node starts at, -1 when
+// it has no text
+func nodeStart(node ast.Node) int {
+	if t, ok := node.(*ast.Text); ok {
+		return t.Segment.Start
+	}
+	for child := node.FirstChild(); child != nil; child = child.NextSibling() {
+		if start := nodeStart(child); start >= 0 {
+			return start
+		}
+	}
+	return -1
+}
+
+// obsidianRenderer renders the nodes of the Obsidian syntax
+type obsidianRenderer struct{}
+
+func (r obsidianRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	reg.Register(kindCallout, r.renderCallout)
+	reg.Register(kindCalloutTitle, r.renderCalloutTitle)
+	reg.Register(kindCalloutContent, r.renderCalloutContent)
+	reg.Register(kindHighlight, r.renderHighlight)
+	reg.Register(kindMathInline, r.renderMathInline)
+	reg.Register(kindMathBlock, r.renderMathBlock)
+	reg.Register(kindMermaid, r.renderMermaid)
+}
+
+func (obsidianRenderer) renderCallout(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	n := node.(*callout)
+	element := "div"
+	if n.fold != 0 {
+		element = "details"
+	}
+	if !entering {
+		_, _ = w.WriteString("</" + element + ">\n")
+		return ast.WalkContinue, nil
+	}
+	_, _ = w.WriteString("<" + element + ` class="callout" data-callout="`)
+	_, _ = w.Write(util.EscapeHTML([]byte(n.calloutType)))
+	_ = w.WriteByte('"')
+	if n.fold == '+' {
+		_, _ = w.WriteString(" open")
+	}
+	_, _ = w.WriteString(">\n")
+	return ast.WalkContinue, nil
+}
+
+func (obsidianRenderer) renderCalloutTitle(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	element := "div"
+	if node.Parent().(*callout).fold != 0 {
+		element = "summary"
+	}
+	if entering {
+		_, _ = w.WriteString("<" + element + ` class="callout-title">`)
+	} else {
+		_, _ = w.WriteString("</" + element + ">\n")
+	}
+	return ast.WalkContinue, nil
+}
+
+func (obsidianRenderer) renderCalloutContent(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		_, _ = w.WriteString(`<div class="callout-content">` + "\n")
+	} else {
+		_, _ = w.WriteString("</div>\n")
+	}
+	return ast.WalkContinue, nil
+}
+
+func (obsidianRenderer) renderHighlight(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		_, _ = w.WriteString("<mark>")
+	} else {
+		_, _ = w.WriteString("</mark>")
+	}
+	return ast.WalkContinue, nil
+}
+
+func (obsidianRenderer) renderMathInline(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkContinue, nil
+	}
+	n := node.(*mathInline)
+	class := "math math-inline"
+	if n.display {
+		class = "math math-display"
+	}
+	_, _ = w.WriteString(`<span class="` + class + `">`)
+	_, _ = w.Write(util.EscapeHTML(n.content.Value(source)))
+	_, _ = w.WriteString("</span>")
+	return ast.WalkSkipChildren, nil
+}
+
+func (obsidianRenderer) renderMathBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		_, _ = w.WriteString(`<div class="math math-display">`)
+		writeLines(w, source, node)
+		_, _ = w.WriteString("</div>\n")
+	}
+	return ast.WalkSkipChildren, nil
+}
+
+func (obsidianRenderer) renderMermaid(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if entering {
+		_, _ = w.WriteString(`<pre class="mermaid">`)
+		writeLines(w, source, node)
+		_, _ = w.WriteString("</pre>\n")
+	}
+	return ast.WalkSkipChildren, nil
+}
+
+// writeLines writes the escaped lines of a raw block without the final line break
+func writeLines(w util.BufWriter, source []byte, node ast.Node) {
+	var buf bytes.Buffer
+	lines := node.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		segment := lines.At(i)
+		buf.Write(segment.Value(source))
+	}
+	_, _ = w.Write(util.EscapeHTML(bytes.TrimRight(buf.Bytes(), "\n")))
+}
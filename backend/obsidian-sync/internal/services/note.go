@@ -0,0 +1,323 @@
+package obsidian
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/savabush/obsidian-sync/internal/markdown"
+	"gopkg.in/yaml.v3"
+)
+
+// frontmatterDelimiter opens and closes the YAML frontmatter of a note
+const frontmatterDelimiter = "---"
+
+// dateLayouts are the accepted formats of frontmatter dates
+var dateLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02 15:04", "2006-01-02"}
+
+// Note is a parsed markdown note.
+type Note struct {
+	// Title is the frontmatter title, else the first heading
+	Title    string   `json:"title"`
+	Language string   `json:"language,omitempty"`
+	Tags     []string `json:"tags,omitempty"`
+	// Summary is the frontmatter summary or description
+	Summary string `json:"summary,omitempty"`
+	// Cover names the resource shown as the note image, as a name or a wiki link
+	Cover string `json:"cover,omitempty"`
+	// Translation is shared by the notes that are translations of each other
+	Translation string `json:"translation,omitempty"`
+	// Created and Updated are zero when the frontmatter has no date
+	Created time.Time `json:"created,omitempty"`
+	Updated time.Time `json:"updated,omitempty"`
+	// Draft and Publish are the workflow flags: drafts and notes with
+	// publish: false are kept out of the blog
+	Draft   bool `json:"draft"`
+	Publish bool `json:"publish"`
+	// Frontmatter holds all frontmatter fields as parsed
+	Frontmatter map[string]interface{} `json:"-"`
+	// Body is the content after the frontmatter
+	Body string `json:"-"`
+}
+
+// ParseNote parses a note with an optional YAML frontmatter block.
+func ParseNote(content []byte) (Note, error) {
+	note := Note{Publish: true, Body: string(content)}
+	front, body, ok := splitFrontmatter(content)
+	if ok {
+		note.Body = body
+		if err := yaml.Unmarshal(front, &note.Frontmatter); err != nil {
+			return note, fmt.Errorf("invalid frontmatter: %w", err)
+		}
+	}
+
+	fields := note.Frontmatter
+	var err error
+	note.Title = stringField(fields, "title")
+	if note.Title == "" {
+		note.Title = firstHeading(note.Body)
+	}
+	note.Language = stringField(fields, "language", "lang")
+	note.Tags = tagsField(fields["tags"])
+	note.Summary = stringField(fields, "summary", "description")
+	note.Cover = stringField(fields, "cover", "image")
+	note.Translation = stringField(fields, "translation", "translationKey", "translation_key")
+	if note.Created, err = dateField(fields, "created", "date"); err != nil {
+		return note, err
+	}
+	if note.Updated, err = dateField(fields, "updated", "modified"); err != nil {
+		return note, err
+	}
+	note.Draft, _ = fields["draft"].(bool)
+	if publish, ok := fields["publish"].(bool); ok {
+		note.Publish = publish
+	}
+	return note, nil
+}
+
+// splitFrontmatter separates the frontmatter block from the body
+func splitFrontmatter(content []byte) ([]byte, string, bool) {
+	text := strings.TrimPrefix(string(content), "\ufeff")
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	if !strings.HasPrefix(text, frontmatterDelimiter+"\n") {
+		return nil, "", false
+	}
+	lines := strings.SplitAfter(text, "\n")
+	offset := len(lines[0])
+	for _, line := range lines[1:] {
+		if strings.TrimSuffix(line, "\n") == frontmatterDelimiter {
+			return []byte(text[len(lines[0]):offset]), text[offset+len(line):], true
+		}
+		offset += len(line)
+	}
+	return nil, "", false
+}
+
+// stringField returns the first non-empty string among the given fields
+func stringField(fields map[string]interface{}, names ...string) string {
+	for _, name := range names {
+		if value, ok := fields[name]; ok && value != nil {
+			if s := strings.TrimSpace(fmt.Sprint(value)); s != "" {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// tagsField accepts a list of tags or a comma or space separated string,
+// with or without the leading #
+func tagsField(value interface{}) []string {
+	var raw []string
+	switch v := value.(type) {
+	case string:
+		raw = strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ' ' })
+	case []interface{}:
+		for _, tag := range v {
+			if tag != nil {
+				raw = append(raw, fmt.Sprint(tag))
+			}
+		}
+	}
+
+	var tags []string
+	seen := make(map[string]bool)
+	for _, tag := range raw {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "#")
+		if tag != "" && !seen[tag] {
+			seen[tag] = true
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// dateField parses the first present date among the given fields
+func dateField(fields map[string]interface{}, names ...string) (time.Time, error) {
+	for _, name := range names {
+		switch v := fields[name].(type) {
+		case time.Time:
+			return v, nil
+		case string:
+			for _, layout := range dateLayouts {
+				if t, err := time.Parse(layout, strings.TrimSpace(v)); err == nil {
+					return t, nil
+				}
+			}
+			return time.Time{}, fmt.Errorf("%s: invalid date %q", name, v)
+		}
+	}
+	return time.Time{}, nil
+}
+
+// firstHeading returns the text of the first level one heading
+func firstHeading(body string) string {
+	for _, line := range strings.Split(body, "\n") {
+		if strings.HasPrefix(line, "# ") {
+			return strings.TrimSpace(strings.TrimPrefix(line, "# "))
+		}
+	}
+	return ""
+}
+
+// imageExtensions are the resources that can be used as a cover
+var imageExtensions = []string{".png", ".jpg", ".jpeg", ".gif", ".webp", ".svg"}
+
+// CoverResource returns the resource named by the cover of a note, else
+// the first image among the resources. Resources are named by their path
+// inside the Resources folder; empty when no resource is an image.
+func CoverResource(cover string, resources []string) string {
+	cover = strings.TrimSuffix(strings.TrimLeft(cover, "!["), "]]")
+	cover = strings.TrimPrefix(cover, ResourcesDir+"/")
+	for _, resource := range resources {
+		if cover != "" && (resource == cover || path.Base(resource) == cover) {
+			return resource
+		}
+	}
+	for _, resource := range resources {
+		for _, ext := range imageExtensions {
+			if strings.EqualFold(path.Ext(resource), ext) {
+				return resource
+			}
+		}
+	}
+	return ""
+}
+
+// Post is a post folder of a vault section.
+type Post struct {
+	// Slug names the post in the section bucket and in its URLs
+	Slug string `json:"slug"`
+	// Dir is the post folder name
+	Dir string `json:"dir"`
+	Note
+	// Key is the object name of the note in the section bucket
+	Key string `json:"key"`
+	// Resources are the object names of the files in the Resources folder,
+	// which are in the slug folder like the note
+	Resources []string `json:"resources"`
+	// Checksum is the MD5 of the note, the ETag of its object
+	Checksum string `json:"checksum"`
+}
+
+// HTMLKey returns the object name of the rendered HTML of a post's note
+func HTMLKey(slug string) string {
+	return path.Join(slug, slug+".html")
+}
+
+// InfoKey returns the object name of the info sidecar of a post's note
+func InfoKey(slug string) string {
+	return path.Join(slug, slug+".json")
+}
+
+// VariantsDir is the name of the per-post folder of a section bucket
+// holding the resized variants of the images of the Resources folder
+const VariantsDir = "Variants"
+
+// VariantKey returns the object name of a variant of an image resource of
+// a post, named after its width: <slug>/Variants/<resource>/<width>w<ext>
+func VariantKey(slug, resource string, width int, ext string) string {
+	return path.Join(slug, VariantsDir, resource, strconv.Itoa(width)+"w"+ext)
+}
+
+// PostInfo is what the post pages and listings show besides the content of
+// a note, stored by the sync next to the note as <slug>/<slug>.json
+type PostInfo struct {
+	// TOC links to the headings of the rendered HTML
+	TOC       []markdown.Heading `json:"toc"`
+	WordCount int                `json:"word_count"`
+	// ReadingTime is in minutes
+	ReadingTime int    `json:"reading_time"`
+	Excerpt     string `json:"excerpt"`
+}
+
+// NewPostInfo returns the info of a note with the table of contents of its rendering.
+func NewPostInfo(note Note, toc []markdown.Heading) PostInfo {
+	if toc == nil {
+		toc = []markdown.Heading{}
+	}
+	return PostInfo{TOC: toc, WordCount: note.WordCount(), ReadingTime: note.ReadingTime(), Excerpt: note.Excerpt()}
+}
+
+// ReadPosts reads the posts of a vault section as redacted, sorted by
+// slug. Folders without a <Post>.md note are not posts and are left out,
+// and so are notes that cannot be parsed, returned as the invalid errors
+// for the caller to report.
+func ReadPosts(root, section string, redaction Redaction) (posts []Post, invalid []error, err error) {
+	slugs, err := PostSlugs(root, section)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dirs := make([]string, 0, len(slugs))
+	for dir := range slugs {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+
+	for _, dir := range dirs {
+		slug := slugs[dir]
+		content, err := os.ReadFile(filepath.Join(root, section, dir, dir+".md"))
+		if err != nil {
+			return nil, nil, err
+		}
+		// Posts are read as uploaded
+		content = redaction.Apply(content)
+		note, err := ParseNote(content)
+		if err != nil {
+			invalid = append(invalid, fmt.Errorf("%s: %w", path.Join(section, dir, dir+".md"), err))
+			continue
+		}
+		if note.Title == "" {
+			note.Title = dir
+		}
+		sum := md5.Sum(content)
+		resources, err := resourceKeys(root, section, dir, slug)
+		if err != nil {
+			return nil, nil, err
+		}
+		posts = append(posts, Post{
+			Slug:      slug,
+			Dir:       dir,
+			Note:      note,
+			Key:       SlugKey(dir, slug, dir+".md"),
+			Resources: resources,
+			Checksum:  hex.EncodeToString(sum[:]),
+		})
+	}
+	sort.Slice(posts, func(i, j int) bool { return posts[i].Slug < posts[j].Slug })
+	return posts, invalid, nil
+}
+
+// resourceKeys returns the object names of the files in the Resources
+// folder of the post in folder dir
+func resourceKeys(root, section, dir, slug string) ([]string, error) {
+	resources := filepath.Join(root, section, dir, ResourcesDir)
+	var keys []string
+	err := filepath.WalkDir(resources, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && p == resources {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(filepath.Join(root, section, dir), p)
+		if err != nil {
+			return err
+		}
+		keys = append(keys, path.Join(slug, filepath.ToSlash(rel)))
+		return nil
+	})
+	sort.Strings(keys)
+	return keys, err
+}
@@ -0,0 +1,119 @@
+package obsidian
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseNote(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    Note
+		body    string
+	}{
+		{
+			name: "frontmatter",
+			content: "---\ntitle: Hello\nlang: en\ntags: [go, \"#obsidian\", go]\ncreated: 2024-05-01\n" +
+				"updated: 2024-05-02T10:00:00Z\ndraft: true\npublish: false\ndescription: About it\ncover: \"[[Cover.png]]\"\ntranslationKey: hello\n---\n# Heading\nText",
+			want: Note{
+				Title:       "Hello",
+				Language:    "en",
+				Tags:        []string{"go", "obsidian"},
+				Summary:     "About it",
+				Cover:       "[[Cover.png]]",
+				Translation: "hello",
+				Created:     time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC),
+				Updated:     time.Date(2024, 5, 2, 10, 0, 0, 0, time.UTC),
+				Draft:       true,
+				Publish:     false,
+			},
+			body: "# Heading\nText",
+		},
+		{
+			name:    "heading title and tag string",
+			content: "---\ntags: \"#go, blog\"\ndate: \"2024-05-01 12:30\"\n---\n\n# From Heading\n",
+			want: Note{
+				Title:   "From Heading",
+				Tags:    []string{"go", "blog"},
+				Created: time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC),
+				Publish: true,
+			},
+			body: "\n# From Heading\n",
+		},
+		{
+			name:    "no frontmatter",
+			content: "# Plain\n---\nnot: frontmatter\n---\n",
+			want:    Note{Title: "Plain", Publish: true},
+			body:    "# Plain\n---\nnot: frontmatter\n---\n",
+		},
+		{
+			name:    "unterminated frontmatter",
+			content: "---\ntitle: Open\n",
+			want:    Note{Publish: true},
+			body:    "---\ntitle: Open\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			note, err := ParseNote([]byte(tt.content))
+			require.NoError(t, err)
+			assert.Equal(t, tt.body, note.Body)
+			note.Body = ""
+			note.Frontmatter = nil
+			assert.Equal(t, tt.want, note)
+		})
+	}
+}
+
+func TestParseNoteErrors(t *testing.T) {
+	_, err := ParseNote([]byte("---\ntitle: [unclosed\n---\n"))
+	assert.ErrorContains(t, err, "invalid frontmatter")
+
+	_, err = ParseNote([]byte("---\ncreated: yesterday\n---\n"))
+	assert.EqualError(t, err, `created: invalid date "yesterday"`)
+}
+
+func TestCoverResource(t *testing.T) {
+	resources := []string{"notes.txt", "a.png", "img/Cover.jpg"}
+	assert.Equal(t, "img/Cover.jpg", CoverResource("![[Cover.jpg]]", resources))
+	assert.Equal(t, "img/Cover.jpg", CoverResource("Resources/img/Cover.jpg", resources))
+	assert.Equal(t, "a.png", CoverResource("", resources), "the first image is the fallback")
+	assert.Equal(t, "a.png", CoverResource("missing.png", resources))
+	assert.Empty(t, CoverResource("", []string{"notes.txt"}))
+}
+
+func TestReadPosts(t *testing.T) {
+	root := t.TempDir()
+	writeVaultFile(t, root, "05 - Blog/First/First.md", "---\ntitle: First post\n---\nText")
+	writeVaultFile(t, root, "05 - Blog/First/Resources/b.png", "png")
+	writeVaultFile(t, root, "05 - Blog/First/Resources/a.png", "png")
+	writeVaultFile(t, root, "05 - Blog/Second/Second.md", "no title")
+	writeVaultFile(t, root, "05 - Blog/NoNote/Resources/Image.png", "png")
+	writeVaultFile(t, root, "05 - Blog/Stray.md", "stray")
+
+	posts, invalid, err := ReadPosts(root, "05 - Blog", Redaction{})
+	require.NoError(t, err)
+	assert.Empty(t, invalid)
+	require.Len(t, posts, 2)
+
+	assert.Equal(t, "first", posts[0].Slug)
+	assert.Equal(t, "First", posts[0].Dir)
+	assert.Equal(t, "First post", posts[0].Title)
+	assert.Equal(t, "first/first.md", posts[0].Key)
+	assert.Equal(t, []string{"first/Resources/a.png", "first/Resources/b.png"}, posts[0].Resources)
+	assert.Equal(t, "875b2a2e98477c84978bf4a8f2665e8d", posts[0].Checksum)
+
+	assert.Equal(t, "Second", posts[1].Title, "the folder name is the fallback title")
+	assert.Empty(t, posts[1].Resources)
+
+	writeVaultFile(t, root, "05 - Blog/Broken/Broken.md", "---\ndate: soon\n---\n")
+	posts, invalid, err = ReadPosts(root, "05 - Blog", Redaction{})
+	require.NoError(t, err, "an invalid note does not fail the section")
+	require.Len(t, invalid, 1)
+	assert.EqualError(t, invalid[0], `05 - Blog/Broken/Broken.md: date: invalid date "soon"`)
+	assert.Len(t, posts, 2, "the valid posts are still read")
+}
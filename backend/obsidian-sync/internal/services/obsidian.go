@@ -1,71 +1,96 @@
 package obsidian
 
 import (
+	"context"
 	"crypto/md5"
 	"encoding/hex"
+	"errors"
 	"io"
 	"os"
-	"strings"
+	"slices"
 
-	. "github.com/savabush/obsidian-sync/internal/config"
+	"github.com/savabush/obsidian-sync/internal/config"
 )
 
-// RemoveUselessDirs removes directories from the "obsidian" folder that don't start with "06" or "05".
-// It logs the process, handles errors, and ensures that not all directories are removed.
+// Service performs file operations on the cloned obsidian vault.
+type Service struct {
+	logger config.LoggerInterface
+}
+
+// NewService creates a vault service logging to the given logger.
+func NewService(logger config.LoggerInterface) *Service {
+	return &Service{logger: config.ForPackage(logger, "obsidian")}
+}
+
+// WithContext returns a service adding the correlation IDs of ctx to its log lines.
+func (s *Service) WithContext(ctx context.Context) *Service {
+	return &Service{logger: config.ContextLogger(s.logger, ctx)}
+}
+
+// gitDir is the repository directory of the cloned vault, kept by RemoveUselessDirs
+const gitDir = ".git"
+
+// ErrNoSections is returned by RemoveUselessDirs when no directory of the
+// vault is a section.
+var ErrNoSections = errors.New("all dirs are removed, check git repository")
+
+// RemoveUselessDirs removes directories from the "obsidian" folder that are not one of the given sections
+// or the .git directory.
+// It logs the process and ensures that not all directories are removed.
 //
 // The function performs the following steps:
 // 1. Reads the contents of the "obsidian" directory.
 // 2. Iterates through each entry, removing directories that don't match the criteria.
 // 3. Keeps a count of remaining directories.
-// 4. Panics if all directories are removed, as a safeguard.
+// 4. Returns ErrNoSections if all directories are removed, as a safeguard.
 //
-// Errors during directory reading or removal are logged as fatal.
-func RemoveUselessDirs() {
-	Logger.Info("Remove useless dirs")
+// Errors during directory reading or removal are returned.
+func (s *Service) RemoveUselessDirs(sections []string) error {
+	s.logger.Info("Remove useless dirs")
 	entries, err := os.ReadDir("obsidian")
 	if err != nil {
-		Logger.Fatal(err)
+		return err
 	}
 	countDirs := len(entries)
 	for _, entry := range entries {
+		if entry.Name() == gitDir {
+			// The history dates the notes, but it is no section
+			countDirs -= 1
+			continue
+		}
 		if entry.IsDir() {
-			if !strings.HasPrefix(entry.Name(), "06") && !strings.HasPrefix(entry.Name(), "05") {
+			if !slices.Contains(sections, entry.Name()) {
 				countDirs -= 1
-				err := os.RemoveAll("obsidian/" + entry.Name())
-				if err != nil {
-					Logger.Fatal(err)
+				if err := os.RemoveAll("obsidian/" + entry.Name()); err != nil {
+					return err
 				}
 			}
 		}
 	}
 	if countDirs == 0 {
-		panic("All dirs are removed, check git repository")
+		return ErrNoSections
 	}
-	Logger.Info("Remove useless dirs done")
+	s.logger.Info("Remove useless dirs done")
+	return nil
 }
 
 // RemoveObsidianDirIfExists checks for the existence of the "obsidian" folder
-// and removes it if it exists. It logs the process and handles any errors.
+// and removes it if it exists. It logs the process and returns any error.
 //
 // The function performs the following steps:
 // 1. Checks if the "obsidian" folder exists.
 // 2. If it exists, removes the folder and its contents.
-// 3. Logs fatal errors if any occur during the process.
-func RemoveObsidianDirIfExists() {
-	Logger.Info("Check existing obsidian folder")
-	if _, err := os.Stat("obsidian"); err == nil {
+// 3. Returns the errors that occur during the process.
+func (s *Service) RemoveObsidianDirIfExists() error {
+	s.logger.Info("Check existing obsidian folder")
+	if _, err := os.Stat("obsidian"); err != nil {
 		if os.IsNotExist(err) {
-			if err != nil {
-				Logger.Fatal(err)
-			}
-		} else {
-			Logger.Info("Remove existing obsidian folder")
-			err := os.RemoveAll("obsidian")
-			if err != nil {
-				Logger.Fatal(err)
-			}
+			return nil
 		}
+		return err
 	}
+	s.logger.Info("Remove existing obsidian folder")
+	return os.RemoveAll("obsidian")
 }
 
 // GetFileMD5 calculates the MD5 checksum of a file given its filepath.
@@ -83,7 +108,7 @@ func RemoveObsidianDirIfExists() {
 // 3. Converts the hash to a hexadecimal string.
 // 4. Logs the calculated MD5 checksum.
 // 5. Returns the MD5 checksum and any error encountered.
-func GetFileMD5(filepath string) (string, error) {
+func (s *Service) GetFileMD5(filepath string) (string, error) {
 	file, err := os.Open(filepath)
 	if err != nil {
 		return "", err
@@ -95,6 +120,6 @@ func GetFileMD5(filepath string) (string, error) {
 		return "", err
 	}
 	md5Checksum := hex.EncodeToString(h.Sum(nil))
-	Logger.Infof("MD5: ", md5Checksum)
+	s.logger.Debugf("MD5 of %s: %s", filepath, md5Checksum)
 	return md5Checksum, nil
 }
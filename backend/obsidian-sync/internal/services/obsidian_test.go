@@ -5,6 +5,8 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+
+	"github.com/savabush/obsidian-sync/internal/lib"
 )
 
 func TestRemoveUselessDirs(t *testing.T) {
@@ -19,6 +21,7 @@ func TestRemoveUselessDirs(t *testing.T) {
 		"obsidian/05-test",
 		"obsidian/04-remove",
 		"obsidian/07-remove",
+		"obsidian/.git",
 	}
 
 	for _, dir := range testDirs {
@@ -27,18 +30,20 @@ func TestRemoveUselessDirs(t *testing.T) {
 	}
 
 	// Run the function
-	RemoveUselessDirs()
+	err = NewService(lib.TestLog).RemoveUselessDirs([]string{"06-test", "05-test"})
+	assert.NoError(t, err)
 
 	// Check results
 	entries, err := os.ReadDir("obsidian")
 	assert.NoError(t, err)
 
-	// Should only have directories starting with 06 or 05
+	// Should only have the section directories
 	for _, entry := range entries {
 		name := entry.Name()
 		assert.True(t, entry.IsDir())
-		assert.True(t, name == "06-test" || name == "05-test")
+		assert.True(t, name == "06-test" || name == "05-test" || name == ".git")
 	}
+	assert.DirExists(t, "obsidian/.git", "the history is kept")
 }
 
 func TestRemoveObsidianDirIfExists(t *testing.T) {
@@ -47,11 +52,15 @@ func TestRemoveObsidianDirIfExists(t *testing.T) {
 	assert.NoError(t, err)
 
 	// Run the function
-	RemoveObsidianDirIfExists()
+	err = NewService(lib.TestLog).RemoveObsidianDirIfExists()
+	assert.NoError(t, err)
 
 	// Verify directory is removed
 	_, err = os.Stat("obsidian")
 	assert.True(t, os.IsNotExist(err))
+
+	// A missing directory is no error
+	assert.NoError(t, NewService(lib.TestLog).RemoveObsidianDirIfExists())
 }
 
 func TestGetFileMD5(t *testing.T) {
@@ -63,7 +72,7 @@ func TestGetFileMD5(t *testing.T) {
 	defer os.Remove(testFile)
 
 	// Get actual MD5
-	actualMD5, err := GetFileMD5(testFile)
+	actualMD5, err := NewService(lib.TestLog).GetFileMD5(testFile)
 	assert.NoError(t, err)
 	
 	// Calculate MD5 of the actual content we wrote
@@ -71,7 +80,7 @@ func TestGetFileMD5(t *testing.T) {
 	assert.Equal(t, expectedMD5, actualMD5)
 
 	// Test with non-existent file
-	_, err = GetFileMD5("non_existent_file.txt")
+	_, err = NewService(lib.TestLog).GetFileMD5("non_existent_file.txt")
 	assert.Error(t, err)
 }
 
@@ -85,6 +94,7 @@ func TestRemoveUselessDirs_AllDirsRemoved(t *testing.T) {
 	testDirs := []string{
 		"obsidian/01-remove",
 		"obsidian/02-remove",
+		"obsidian/.git",
 	}
 
 	for _, dir := range testDirs {
@@ -92,8 +102,7 @@ func TestRemoveUselessDirs_AllDirsRemoved(t *testing.T) {
 		assert.NoError(t, err)
 	}
 
-	// The function should panic when all directories would be removed
-	assert.Panics(t, func() {
-		RemoveUselessDirs()
-	})
+	// The function should fail when all directories would be removed
+	err = NewService(lib.TestLog).RemoveUselessDirs([]string{"06-test", "05-test"})
+	assert.ErrorIs(t, err, ErrNoSections)
 }
@@ -0,0 +1,242 @@
+package obsidian
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/savabush/obsidian-sync/internal/config"
+	"gopkg.in/yaml.v3"
+)
+
+// ErrUnredactable is returned for a note whose frontmatter cannot be parsed
+// while frontmatter keys are denied
+var ErrUnredactable = errors.New("invalid frontmatter, the denied keys cannot be removed")
+
+// Redaction removes the private parts of notes before they are published:
+// the %%comments%%, the content between the private markers, the blocks and
+// heading sections tagged private and the denied frontmatter keys. The zero
+// value only strips comments.
+type Redaction struct {
+	open, close string
+	// tagRe matches a line holding the private tag
+	tagRe *regexp.Regexp
+	keys  []string
+}
+
+// NewRedaction creates the redaction of the given settings.
+func NewRedaction(cfg config.RedactConfig) Redaction {
+	r := Redaction{keys: cfg.FrontmatterKeys()}
+	if cfg.OPEN_MARKER != "" && cfg.CLOSE_MARKER != "" {
+		r.open, r.close = cfg.OPEN_MARKER, cfg.CLOSE_MARKER
+	}
+	if tag := strings.TrimPrefix(cfg.TAG, "#"); tag != "" {
+		r.tagRe = regexp.MustCompile(`(?i)(?:^|\s)#` + regexp.QuoteMeta(tag) + `(?:[^\p{L}\p{N}_/-]|$)`)
+	}
+	return r
+}
+
+// Apply returns a note as it is published. Private content is removed
+// everywhere, code blocks included, except for comments, which are kept in
+// code. With denied frontmatter keys, a frontmatter block that cannot be
+// parsed is removed as a whole. A note without private content is returned
+// unchanged.
+func (r Redaction) Apply(content []byte) []byte {
+	content = StripComments(content)
+	text := strings.ReplaceAll(strings.TrimPrefix(string(content), "\ufeff"), "\r\n", "\n")
+	header, body := "", text
+	front, rest, ok := splitFrontmatter(content)
+	if ok {
+		header, body = text[:len(text)-len(rest)], rest
+		redacted, changed, err := r.redactFrontmatter(front)
+		switch {
+		case err != nil:
+			// The denied keys cannot be told apart, so none of it is kept
+			header = ""
+		case changed:
+			header = frontmatterDelimiter + "\n" + string(redacted) + frontmatterDelimiter + "\n"
+		}
+	}
+	body = r.redactMarked(body)
+	body = r.redactTagged(body)
+	if header+body == text {
+		return content
+	}
+	return []byte(header + body)
+}
+
+// redactMarked removes the content between the open and close markers,
+// markers included. An unclosed marker hides the rest of the note.
+func (r Redaction) redactMarked(body string) string {
+	if r.open == "" {
+		return body
+	}
+	for {
+		start := strings.Index(body, r.open)
+		if start < 0 {
+			return body
+		}
+		end := strings.Index(body[start+len(r.open):], r.close)
+		if end < 0 {
+			return body[:start]
+		}
+		end += start + len(r.open) + len(r.close)
+		// Markers on lines of their own leave no empty line behind
+		if (start == 0 || body[start-1] == '\n') && strings.HasPrefix(body[end:], "\n") {
+			end++
+		}
+		body = body[:start] + body[end:]
+	}
+}
+
+// redactTagged removes the blocks holding the private tag: paragraphs,
+// lists, quotes and code blocks up to the next blank line or heading. A
+// tagged heading removes its section up to the next heading of the same or
+// a higher level.
+func (r Redaction) redactTagged(body string) string {
+	if r.tagRe == nil || !r.tagRe.MatchString(body) {
+		return body
+	}
+
+	var out strings.Builder
+	section := 0
+	for _, block := range markdownBlocks(body) {
+		if level := headingLevel(block[0]); level > 0 {
+			if section > 0 && level <= section {
+				section = 0
+			}
+			if section == 0 && r.tagged(block) {
+				section = level
+			}
+		}
+		if section > 0 || r.tagged(block) {
+			continue
+		}
+		for _, line := range block {
+			out.WriteString(line)
+		}
+	}
+	return out.String()
+}
+
+// tagged reports whether a line of a block holds the private tag
+func (r Redaction) tagged(block []string) bool {
+	for _, line := range block {
+		if r.tagRe.MatchString(line) {
+			return true
+		}
+	}
+	return false
+}
+
+// markdownBlocks splits a body into blocks of lines: headings are blocks
+// of their own and other blocks end with the blank lines after them.
+// Fenced code blocks are never split.
+func markdownBlocks(body string) [][]string {
+	var blocks [][]string
+	var block []string
+	flush := func() {
+		if len(block) > 0 {
+			blocks = append(blocks, block)
+			block = nil
+		}
+	}
+	fence := ""
+	for _, line := range strings.SplitAfter(body, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case fence != "":
+			block = append(block, line)
+			if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+				fence = ""
+			}
+		case strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~"):
+			fence = trimmed[:3]
+			block = append(block, line)
+		case headingLevel(line) > 0:
+			flush()
+			blocks = append(blocks, []string{line})
+		case trimmed == "":
+			block = append(block, line)
+			flush()
+		default:
+			block = append(block, line)
+		}
+	}
+	flush()
+	return blocks
+}
+
+// headingLevel returns the level of a markdown heading line, 0 for other lines
+func headingLevel(line string) int {
+	line = strings.TrimSuffix(line, "\n")
+	if !headingRe.MatchString(line) {
+		return 0
+	}
+	return len(line) - len(strings.TrimLeft(line, "#"))
+}
+
+// Check returns ErrUnredactable for a note whose denied frontmatter keys
+// cannot be removed because its frontmatter is invalid.
+func (r Redaction) Check(content []byte) error {
+	front, _, ok := splitFrontmatter(StripComments(content))
+	if !ok {
+		return nil
+	}
+	_, _, err := r.redactFrontmatter(front)
+	return err
+}
+
+// redactFrontmatter removes the denied top-level keys from a frontmatter
+// block and reports whether any was removed. Invalid frontmatter returns
+// ErrUnredactable when keys are denied, as they cannot be found in it.
+func (r Redaction) redactFrontmatter(front []byte) ([]byte, bool, error) {
+	if len(r.keys) == 0 {
+		return front, false, nil
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(front, &doc); err != nil {
+		return nil, false, fmt.Errorf("%w: %v", ErrUnredactable, err)
+	}
+	if len(doc.Content) == 0 {
+		return front, false, nil
+	}
+	if doc.Content[0].Kind != yaml.MappingNode {
+		return nil, false, fmt.Errorf("%w: not a mapping", ErrUnredactable)
+	}
+
+	mapping := doc.Content[0]
+	removed := false
+	for i := 0; i+1 < len(mapping.Content); {
+		if r.denied(mapping.Content[i].Value) {
+			mapping.Content = append(mapping.Content[:i], mapping.Content[i+2:]...)
+			removed = true
+			continue
+		}
+		i += 2
+	}
+	if !removed {
+		return front, false, nil
+	}
+
+	var buf bytes.Buffer
+	encoder := yaml.NewEncoder(&buf)
+	encoder.SetIndent(2)
+	if err := encoder.Encode(&doc); err != nil {
+		return nil, false, fmt.Errorf("%w: %v", ErrUnredactable, err)
+	}
+	_ = encoder.Close()
+	return buf.Bytes(), true, nil
+}
+
+// denied reports whether a frontmatter key is on the denylist
+func (r Redaction) denied(key string) bool {
+	for _, denied := range r.keys {
+		if strings.EqualFold(key, denied) {
+			return true
+		}
+	}
+	return false
+}
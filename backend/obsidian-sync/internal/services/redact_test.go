@@ -0,0 +1,71 @@
+package obsidian
+
+import (
+	"testing"
+
+	"github.com/savabush/obsidian-sync/internal/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedactionApply(t *testing.T) {
+	redaction := NewRedaction(config.RedactConfig{
+		OPEN_MARKER:  "<!-- private -->",
+		CLOSE_MARKER: "<!-- /private -->",
+		TAG:          "private",
+		FRONTMATTER:  "notes, Secret",
+	})
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"nothing private", "---\ntitle:  Kept as is\r\n---\r\nText #privateer", "---\ntitle:  Kept as is\r\n---\r\nText #privateer"},
+		{"inline markers", "Public <!-- private -->secret<!-- /private --> text", "Public  text"},
+		{"block markers", "Before\n\n<!-- private -->\nsecret\n```\ncode\n```\n<!-- /private -->\n\nAfter",
+			"Before\n\n\nAfter"},
+		{"unclosed marker", "Shown <!-- private -->\nhidden to the end", "Shown "},
+		{"tagged blocks", "Public\n\nSecret #private idea\nstill secret\n\n- item\n- #Private item\n\n> quote\n\nEnd",
+			"Public\n\n> quote\n\nEnd"},
+		{"tagged code", "```\n#private\nsecret()\n```\n\nEnd", "End"},
+		{"tagged sections", "# Post\n\n## Notes #private\n\nSecret\n\n### Deeper\n\nSecret too\n\n## Public\n\nText",
+			"# Post\n\n## Public\n\nText"},
+		{"comments", "Text %%secret%%", "Text "},
+		{"frontmatter", "---\ntitle: Post\nnotes: secret\nsecret:\n  - a\ntags: [go]\n---\nBody",
+			"---\ntitle: Post\ntags: [go]\n---\nBody"},
+		{"invalid frontmatter", "---\ntitle: Post\nnotes: SECRET\ntags: [a\n---\nBody", "Body"},
+		{"ambiguous frontmatter", "---\ntitle: Post: bad\nnotes: SECRET\n---\nBody", "Body"},
+		{"frontmatter list", "---\n- notes: SECRET\n---\nBody", "Body"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, string(redaction.Apply([]byte(tt.in))))
+		})
+	}
+}
+
+func TestRedactionCheck(t *testing.T) {
+	redaction := NewRedaction(config.RedactConfig{FRONTMATTER: "notes"})
+	assert.NoError(t, redaction.Check([]byte("---\ntitle: Post\nnotes: secret\n---\nBody")))
+	assert.NoError(t, redaction.Check([]byte("No frontmatter")))
+	assert.ErrorIs(t, redaction.Check([]byte("---\ntitle: Post: bad\nnotes: SECRET\n---\nBody")), ErrUnredactable)
+	assert.NoError(t, Redaction{}.Check([]byte("---\ntitle: Post: bad\n---\nBody")), "nothing is denied")
+}
+
+func TestRedactionDisabled(t *testing.T) {
+	content := "<!-- private -->Kept<!-- /private --> #private %%comment%%"
+	assert.Equal(t, "<!-- private -->Kept<!-- /private --> #private ", string(Redaction{}.Apply([]byte(content))),
+		"comments are always removed")
+}
+
+func TestReadPostsRedacted(t *testing.T) {
+	root := t.TempDir()
+	writeVaultFile(t, root, "05 - Blog/Post/Post.md", "---\ntitle: Post\nnotes: secret\n---\nText\n\nSecret #private")
+
+	posts, _, err := ReadPosts(root, "05 - Blog", NewRedaction(config.RedactConfig{TAG: "private", FRONTMATTER: "notes"}))
+	require.NoError(t, err)
+	require.Len(t, posts, 1)
+	assert.Equal(t, "Text\n\n", posts[0].Body)
+	assert.NotContains(t, posts[0].Frontmatter, "notes")
+	assert.Equal(t, "Text", posts[0].PlainText())
+}
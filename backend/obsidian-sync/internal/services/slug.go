@@ -0,0 +1,195 @@
+package obsidian
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// RedirectsKey is the object name of the slug state of a section bucket
+const RedirectsKey = "redirects.json"
+
+// defaultSlug is the slug of a name without letters or digits
+const defaultSlug = "post"
+
+// transliteration spells the Cyrillic letters in latin, following the
+// common Russian and Ukrainian romanizations
+var transliteration = map[rune]string{
+	'а': "a", 'б': "b", 'в': "v", 'г': "g", 'д': "d", 'е': "e", 'ё': "yo", 'ж': "zh",
+	'з': "z", 'и': "i", 'й': "y", 'к': "k", 'л': "l", 'м': "m", 'н': "n", 'о': "o",
+	'п': "p", 'р': "r", 'с': "s", 'т': "t", 'у': "u", 'ф': "f", 'х': "kh", 'ц': "ts",
+	'ч': "ch", 'ш': "sh", 'щ': "shch", 'ъ': "", 'ы': "y", 'ь': "", 'э': "e", 'ю': "yu",
+	'я': "ya", 'і': "i", 'ї': "yi", 'є': "ye", 'ґ': "g",
+}
+
+// Slugify returns the URL slug of a name: lowercase latin letters and
+// digits with Cyrillic transliterated, and every other run of characters
+// replaced by a single dash. Apostrophes are dropped. A name without
+// letters or digits gets the slug "post".
+func Slugify(name string) string {
+	var b strings.Builder
+	dash := false
+	write := func(s string) {
+		if s == "" {
+			return
+		}
+		if dash && b.Len() > 0 {
+			b.WriteByte('-')
+		}
+		dash = false
+		b.WriteString(s)
+	}
+	for _, r := range strings.ToLower(name) {
+		if latin, ok := transliteration[r]; ok {
+			write(latin)
+			continue
+		}
+		switch {
+		case r >= 'a' && r <= 'z' || r >= '0' && r <= '9':
+			write(string(r))
+		case r == '\'' || r == '’':
+		default:
+			dash = true
+		}
+	}
+	if b.Len() == 0 {
+		return defaultSlug
+	}
+	return b.String()
+}
+
+// PostSlugs returns the slugs of the post folders of a vault section, keyed
+// by folder name. A post is slugged from the slug field of its frontmatter,
+// else from its folder name. Slugs are unique within the section: posts
+// with a frontmatter slug claim theirs first, then the other posts in
+// folder order, and a slug already taken gets the first free -2, -3, …
+// suffix.
+func PostSlugs(root, section string) (map[string]string, error) {
+	entries, err := os.ReadDir(filepath.Join(root, section))
+	if err != nil {
+		return nil, err
+	}
+
+	type candidate struct {
+		folder, slug string
+		override     bool
+	}
+	var candidates []candidate
+	for _, entry := range entries {
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		folder := entry.Name()
+		content, err := os.ReadFile(filepath.Join(root, section, folder, folder+".md"))
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		c := candidate{folder: folder, slug: Slugify(folder)}
+		// Invalid frontmatter is reported by the vault validation
+		note, _ := ParseNote(content)
+		if slug := stringField(note.Frontmatter, "slug"); slug != "" {
+			c.slug, c.override = Slugify(slug), true
+		}
+		candidates = append(candidates, c)
+	}
+	// os.ReadDir sorts by folder name
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].override && !candidates[j].override })
+
+	slugs := make(map[string]string, len(candidates))
+	taken := make(map[string]bool, len(candidates))
+	for _, c := range candidates {
+		slug := c.slug
+		for n := 2; taken[slug]; n++ {
+			slug = c.slug + "-" + strconv.Itoa(n)
+		}
+		taken[slug] = true
+		slugs[c.folder] = slug
+	}
+	return slugs, nil
+}
+
+// SlugKey returns the object name of a file of a post folder in the
+// section bucket, with the folder and its note named after the slug
+func SlugKey(folder, slug, name string) string {
+	if name == folder+".md" {
+		name = slug + ".md"
+	}
+	return path.Join(slug, name)
+}
+
+// Slugs is the slug state of a section, stored by the sync in the section
+// bucket as redirects.json. It records the slug of every post folder, so
+// the next sync can tell which posts were renamed, and the redirects from
+// the slugs posts had before to the ones they have now.
+type Slugs struct {
+	// Posts holds the slug of every post, keyed by folder name
+	Posts map[string]string `json:"posts"`
+	// Redirects maps the former slugs of posts to their current slug
+	Redirects map[string]string `json:"redirects"`
+}
+
+// Next returns the slug state of the given posts of a section. A post
+// whose slug changed redirects from its former slug, be it because its
+// frontmatter slug changed or because its folder was renamed: a folder
+// that is gone is matched to a new folder holding the same note, by the
+// checksums of the notes stored under the former slugs. Without a former
+// state every post redirects from its folder name, the key posts had
+// before they were slugged.
+//
+// Redirects to a post redirecting elsewhere are followed to the end,
+// those to posts that are gone are dropped, and slugs taken by a post are
+// never redirected.
+func (s Slugs) Next(posts []Post, checksums map[string]string) Slugs {
+	former := s.Posts
+	if former == nil {
+		former = make(map[string]string, len(posts))
+		for _, post := range posts {
+			former[post.Dir] = post.Dir
+		}
+	}
+
+	next := Slugs{Posts: make(map[string]string, len(posts)), Redirects: make(map[string]string)}
+	live := make(map[string]bool, len(posts))
+	// moved holds the slugs of the new folders by the checksum of their note
+	moved := make(map[string]string)
+	for _, post := range posts {
+		next.Posts[post.Dir] = post.Slug
+		live[post.Slug] = true
+		if _, ok := former[post.Dir]; !ok {
+			moved[post.Checksum] = post.Slug
+		}
+	}
+	for from, to := range s.Redirects {
+		next.Redirects[from] = to
+	}
+	for folder, slug := range former {
+		if to, ok := next.Posts[folder]; ok {
+			next.Redirects[slug] = to
+		} else if sum := checksums[slug]; sum != "" && moved[sum] != "" {
+			next.Redirects[slug] = moved[sum]
+		}
+	}
+
+	for from, to := range next.Redirects {
+		// Bounded, so redirect loops end
+		for i := 0; !live[to] && i < len(next.Redirects); i++ {
+			further, ok := next.Redirects[to]
+			if !ok {
+				break
+			}
+			to = further
+		}
+		if live[from] || !live[to] {
+			delete(next.Redirects, from)
+			continue
+		}
+		next.Redirects[from] = to
+	}
+	return next
+}
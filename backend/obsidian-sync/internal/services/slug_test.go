@@ -0,0 +1,84 @@
+package obsidian
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"NewPost1", "newpost1"},
+		{"About Me", "about-me"},
+		{"  Go: 10 tips & tricks!  ", "go-10-tips-tricks"},
+		{"Don't panic", "dont-panic"},
+		{"Привет, мир", "privet-mir"},
+		{"Щука и ёжик", "shchuka-i-yozhik"},
+		{"Объявление", "obyavlenie"},
+		{"Їжак і ґанок", "yizhak-i-ganok"},
+		{"Café déjà vu", "caf-d-j-vu"},
+		{"---", "post"},
+		{"", "post"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Slugify(tt.name), tt.name)
+	}
+}
+
+func TestPostSlugs(t *testing.T) {
+	root := t.TempDir()
+	writeVaultFile(t, root, "05 - Blog/Hello World/Hello World.md", "# Hello")
+	writeVaultFile(t, root, "05 - Blog/hello-world/hello-world.md", "# Hello again")
+	writeVaultFile(t, root, "05 - Blog/Zed/Zed.md", "---\nslug: Hello World\n---\n# Zed")
+	writeVaultFile(t, root, "05 - Blog/Привет/Привет.md", "---\ntitle: [broken\n---\n# Привет")
+	writeVaultFile(t, root, "05 - Blog/NoNote/Resources/Image.png", "png")
+
+	slugs, err := PostSlugs(root, "05 - Blog")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"Zed":         "hello-world",
+		"Hello World": "hello-world-2",
+		"hello-world": "hello-world-3",
+		"Привет":      "privet",
+	}, slugs, "frontmatter slugs are claimed first")
+}
+
+func TestSlugsNext(t *testing.T) {
+	posts := []Post{
+		{Dir: "First Post", Slug: "first-post", Checksum: "1"},
+		{Dir: "Second", Slug: "second", Checksum: "2"},
+	}
+	state := Slugs{}.Next(posts, map[string]string{"First Post": "1"})
+	assert.Equal(t, Slugs{
+		Posts:     map[string]string{"First Post": "first-post", "Second": "second"},
+		Redirects: map[string]string{"First Post": "first-post", "Second": "second"},
+	}, state, "the folder names of the first state redirect to the slugs")
+	assert.Equal(t, state, state.Next(posts, nil), "the state only changes with the slugs")
+
+	// The first post gets a frontmatter slug and the second a new folder
+	posts = []Post{
+		{Dir: "First Post", Slug: "first", Checksum: "3"},
+		{Dir: "Second Post", Slug: "second-post", Checksum: "2"},
+	}
+	state = state.Next(posts, map[string]string{"first-post": "1", "second": "2"})
+	assert.Equal(t, Slugs{
+		Posts: map[string]string{"First Post": "first", "Second Post": "second-post"},
+		Redirects: map[string]string{"First Post": "first", "first-post": "first", "Second": "second-post",
+			"second": "second-post"},
+	}, state, "chains are followed to the current slug")
+
+	// The second post is removed and a new post takes the former first slug
+	posts = []Post{
+		{Dir: "First Post", Slug: "first", Checksum: "3"},
+		{Dir: "Other", Slug: "first-post", Checksum: "4"},
+	}
+	state = state.Next(posts, map[string]string{"first": "3", "second-post": "2"})
+	assert.Equal(t, Slugs{
+		Posts:     map[string]string{"First Post": "first", "Other": "first-post"},
+		Redirects: map[string]string{"First Post": "first"},
+	}, state, "redirects to removed posts and from taken slugs are dropped")
+}
@@ -0,0 +1,286 @@
+package obsidian
+
+import (
+	"math"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// commentDelimiter opens and closes an Obsidian comment
+const commentDelimiter = "%%"
+
+// The markdown syntax removed from the plain text of a note
+var (
+	headingRe     = regexp.MustCompile(`^#{1,6}\s+(.+?)\s*#*\s*$`)
+	embedRe       = regexp.MustCompile(`!\[\[[^\]]*\]\]`)
+	imageRe       = regexp.MustCompile(`!\[([^\]]*)\]\([^)]*\)`)
+	aliasedWikiRe = regexp.MustCompile(`\[\[[^\]|]*\|([^\]]*)\]\]`)
+	wikiLinkRe    = regexp.MustCompile(`\[\[([^\]]*)\]\]`)
+	linkRe        = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+	htmlTagRe     = regexp.MustCompile(`</?[a-zA-Z][^>]*>`)
+	lineMarkerRe  = regexp.MustCompile(`^[ \t]*(?:>\s?|[-*+]\s+(?:\[[ xX]\]\s+)?|\d+\.\s+)`)
+	calloutRe     = regexp.MustCompile(`^\[![\w-]+\][+-]?[ \t]*`)
+	emphasisRe    = regexp.MustCompile("\\*\\*|__|~~|==|[*`]")
+	blankLinesRe  = regexp.MustCompile(`\n{3,}`)
+)
+
+// excerptLength is the maximum length of an excerpt in characters
+const excerptLength = 280
+
+// readingSpeeds are the average silent reading speeds of non-fiction in
+// words per minute by language
+var readingSpeeds = map[string]int{"en": 238, "ru": 184}
+
+// Lines left out of excerpts
+var (
+	// excerptSkipRe matches the first line of the blocks that are not
+	// paragraphs: code, quotes and callouts, lists, tables, HTML and math
+	excerptSkipRe = regexp.MustCompile("^(```|~~~|>|[-*+]\\s|\\d+\\.\\s|\\||<|\\$\\$)")
+	// imageLineRe matches the lines holding only images and embeds
+	imageLineRe = regexp.MustCompile(`^((!\[\[[^\]]*\]\]|!\[[^\]]*\]\([^)]*\))\s*)+$`)
+)
+
+// Headings returns the text of the markdown headings of the body, skipping
+// fenced code blocks.
+func (n Note) Headings() []string {
+	var headings []string
+	fence := ""
+	for _, line := range strings.Split(n.Body, "\n") {
+		var marker bool
+		if fence, marker = codeFence(strings.TrimSpace(line), fence); marker || fence != "" {
+			continue
+		}
+		if match := headingRe.FindStringSubmatch(line); match != nil {
+			headings = append(headings, match[1])
+		}
+	}
+	return headings
+}
+
+// PlainText returns the body without markdown syntax: link texts and the
+// alias of wiki links are kept, embeds, HTML tags, code fences and the
+// markers of headings, lists, quotes and emphasis are removed. The content
+// of code blocks is kept as is.
+func (n Note) PlainText() string {
+	var lines []string
+	fence := ""
+	for _, line := range strings.Split(n.Body, "\n") {
+		inCode := fence != ""
+		var marker bool
+		fence, marker = codeFence(strings.TrimSpace(line), fence)
+		switch {
+		case marker:
+		case inCode:
+			lines = append(lines, line)
+		default:
+			lines = append(lines, plainLine(line))
+		}
+	}
+	text := blankLinesRe.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.TrimSpace(text)
+}
+
+// codeFence follows the fenced code blocks of a body line by line, like
+// markdownBlocks: given a trimmed line and the fence of the open block,
+// empty outside of one, it returns the fence of the block open after the
+// line and reports whether the line opens or closes a block. Blocks open
+// with ``` or ~~~ and close with a line of the same character only.
+func codeFence(trimmed, fence string) (string, bool) {
+	if fence != "" {
+		if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+			return "", true
+		}
+		return fence, false
+	}
+	if strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~") {
+		return trimmed[:3], true
+	}
+	return "", false
+}
+
+// WordCount returns the number of words of the plain text of the body.
+func (n Note) WordCount() int {
+	return countWords(n.PlainText())
+}
+
+// ReadingTime returns the minutes it takes to read the body, at least one
+// for a body with words. The reading speed is the one of the language of
+// the note, else of Russian when most letters are Cyrillic, else of English.
+func (n Note) ReadingTime() int {
+	text := n.PlainText()
+	words := countWords(text)
+	if words == 0 {
+		return 0
+	}
+	return int(math.Ceil(float64(words) / float64(readingSpeeds[readingLanguage(n.Language, text)])))
+}
+
+// readingLanguage returns the language of the reading speed of a text
+func readingLanguage(language, text string) string {
+	language, _, _ = strings.Cut(strings.ToLower(language), "-")
+	if _, ok := readingSpeeds[language]; ok {
+		return language
+	}
+	cyrillic, latin := 0, 0
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Cyrillic, r):
+			cyrillic++
+		case unicode.Is(unicode.Latin, r):
+			latin++
+		}
+	}
+	if cyrillic > latin {
+		return "ru"
+	}
+	return "en"
+}
+
+// countWords counts the words of a text having a letter or a digit
+func countWords(text string) int {
+	words := 0
+	for _, word := range strings.Fields(text) {
+		if strings.IndexFunc(word, func(r rune) bool { return unicode.IsLetter(r) || unicode.IsNumber(r) }) >= 0 {
+			words++
+		}
+	}
+	return words
+}
+
+// Excerpt returns the summary of the note, else the text of its first
+// paragraph without markdown syntax, shortened to a whole word.
+func (n Note) Excerpt() string {
+	if n.Summary != "" {
+		return n.Summary
+	}
+	for _, block := range markdownBlocks(n.Body) {
+		var lines []string
+		for _, line := range block {
+			if trimmed := strings.TrimSpace(line); trimmed != "" && !imageLineRe.MatchString(trimmed) {
+				lines = append(lines, trimmed)
+			}
+		}
+		if len(lines) == 0 || headingLevel(lines[0]) > 0 || excerptSkipRe.MatchString(lines[0]) {
+			continue
+		}
+		var words []string
+		for _, line := range lines {
+			words = append(words, strings.Fields(plainLine(line))...)
+		}
+		if text := strings.Join(words, " "); text != "" {
+			return shorten(text, excerptLength)
+		}
+	}
+	return ""
+}
+
+// shorten cuts a text longer than max characters after its last whole word
+// that fits, marking the cut with an ellipsis
+func shorten(text string, max int) string {
+	if utf8.RuneCountInString(text) <= max {
+		return text
+	}
+	cut := string([]rune(text)[:max])
+	if space := strings.LastIndex(cut, " "); space > 0 {
+		cut = cut[:space]
+	}
+	return strings.TrimRight(cut, " ,;:-–—") + "…"
+}
+
+// plainLine removes the markdown syntax of a line outside code blocks
+func plainLine(line string) string {
+	if match := headingRe.FindStringSubmatch(line); match != nil {
+		line = match[1]
+	}
+	line = embedRe.ReplaceAllString(line, "")
+	line = imageRe.ReplaceAllString(line, "$1")
+	line = aliasedWikiRe.ReplaceAllString(line, "$1")
+	line = wikiLinkRe.ReplaceAllString(line, "$1")
+	line = linkRe.ReplaceAllString(line, "$1")
+	line = htmlTagRe.ReplaceAllString(line, "")
+	line = lineMarkerRe.ReplaceAllString(line, "")
+	line = calloutRe.ReplaceAllString(line, "")
+	line = emphasisRe.ReplaceAllString(line, "")
+	return strings.TrimRight(line, " \t")
+}
+
+// StripComments removes the Obsidian %%comments%% from the body of a note,
+// inline or spanning lines, so they are never published. Code blocks and
+// inline code are kept as is. A note without comments is returned unchanged.
+func StripComments(content []byte) []byte {
+	if !strings.Contains(string(content), commentDelimiter) {
+		return content
+	}
+	text := strings.ReplaceAll(strings.TrimPrefix(string(content), "\ufeff"), "\r\n", "\n")
+	header := ""
+	if _, body, ok := splitFrontmatter(content); ok {
+		header = text[:len(text)-len(body)]
+		text = body
+	}
+
+	var out strings.Builder
+	out.WriteString(header)
+	inComment := false
+	fence := ""
+	for _, line := range strings.SplitAfter(text, "\n") {
+		trimmed := strings.TrimSpace(line)
+		switch {
+		case fence != "":
+			out.WriteString(line)
+			if strings.HasPrefix(trimmed, fence) && strings.Trim(trimmed, fence[:1]) == "" {
+				fence = ""
+			}
+			continue
+		case !inComment && (strings.HasPrefix(trimmed, "```") || strings.HasPrefix(trimmed, "~~~")):
+			fence = trimmed[:3]
+			out.WriteString(line)
+			continue
+		}
+		inComment = stripLineComments(&out, line, inComment)
+	}
+	return []byte(out.String())
+}
+
+// stripLineComments writes a line without its comments and reports whether
+// a comment is still open at its end. Inline code spans are kept.
+func stripLineComments(out *strings.Builder, line string, inComment bool) bool {
+	for line != "" {
+		if inComment {
+			end := strings.Index(line, commentDelimiter)
+			if end < 0 {
+				// The line break of a comment ending on a later line is removed
+				return true
+			}
+			line = line[end+len(commentDelimiter):]
+			inComment = false
+			continue
+		}
+		next := strings.IndexAny(line, "`%")
+		if next < 0 {
+			out.WriteString(line)
+			return false
+		}
+		out.WriteString(line[:next])
+		line = line[next:]
+		switch {
+		case line[0] == '`':
+			ticks := len(line) - len(strings.TrimLeft(line, "`"))
+			if end := strings.Index(line[ticks:], line[:ticks]); end >= 0 {
+				out.WriteString(line[:ticks+end+ticks])
+				line = line[ticks+end+ticks:]
+			} else {
+				out.WriteString(line[:ticks])
+				line = line[ticks:]
+			}
+		case strings.HasPrefix(line, commentDelimiter):
+			line = line[len(commentDelimiter):]
+			inComment = true
+		default:
+			out.WriteByte('%')
+			line = line[1:]
+		}
+	}
+	return inComment
+}
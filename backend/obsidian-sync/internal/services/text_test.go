@@ -0,0 +1,87 @@
+package obsidian
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const textNote = "# Title\n\nIntro with **bold**, _kept_ and `code`.\n\n" +
+	"## Setup ##\n\n- [ ] Install [Go](https://go.dev)\n1. Read [[Other Note|the other note]] and [[Index]]\n" +
+	"> Quoted ==highlight==\n> [!tip]- Callout title\n\n![[diagram.png]]\n![Diagram](diagram.png)\n\n" +
+	"```go\n# not a heading\nfmt.Println()\n```\n<br/>\n### Русский заголовок"
+
+func TestHeadings(t *testing.T) {
+	note := Note{Body: textNote}
+	assert.Equal(t, []string{"Title", "Setup", "Русский заголовок"}, note.Headings())
+	assert.Empty(t, Note{Body: "#tag is not a heading"}.Headings())
+	assert.Equal(t, []string{"After"}, Note{Body: "~~~md\n# Inside\n```\n# Still inside\n~~~\n# After"}.Headings(),
+		"tilde fences are code blocks, closed by their own fence only")
+}
+
+func TestPlainText(t *testing.T) {
+	note := Note{Body: textNote}
+	assert.Equal(t, "Title\n\nIntro with bold, _kept_ and code.\n\nSetup\n\n"+
+		"Install Go\nRead the other note and Index\nQuoted highlight\nCallout title\n\nDiagram\n\n"+
+		"# not a heading\nfmt.Println()\n\nРусский заголовок", note.PlainText())
+	assert.Equal(t, "**kept**\n```\nText", Note{Body: "~~~~\n**kept**\n```\n~~~~\n**Text**"}.PlainText())
+}
+
+func TestStripComments(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{"no comments", "Text with 100% and\r\n`code`", "Text with 100% and\r\n`code`"},
+		{"inline", "Keep %%secret%% this %%and this%%", "Keep  this "},
+		{"spanning lines", "Before %%start\nsecret\nend%% after\n", "Before  after\n"},
+		{"block", "Para\n\n%%\nTODO: private\n%%\n\nNext", "Para\n\n\n\nNext"},
+		{"unclosed", "Shown\n%% hidden\nto the end", "Shown\n"},
+		{"code is kept", "```\n%%not a comment%%\n```\n`%%code%%` %%x%%", "```\n%%not a comment%%\n```\n`%%code%%` "},
+		{"frontmatter", "---\ntitle: \"%%\"\n---\nBody%%x%%", "---\ntitle: \"%%\"\n---\nBody"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, string(StripComments([]byte(tt.in))))
+		})
+	}
+}
+
+func TestReadingTime(t *testing.T) {
+	english := strings.Repeat("word ", 476)
+	russian := strings.Repeat("слово ", 368)
+	tests := []struct {
+		name    string
+		note    Note
+		words   int
+		minutes int
+	}{
+		{"empty", Note{Body: "# \n\n---"}, 0, 0},
+		{"short", Note{Body: "# Title\n\nA **few** words - and `code`."}, 6, 1},
+		{"english", Note{Body: english}, 476, 2},
+		{"russian by language", Note{Language: "ru-RU", Body: english}, 476, 3},
+		{"russian by script", Note{Body: russian}, 368, 2},
+		{"english by language", Note{Language: "EN", Body: russian + "x"}, 369, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.words, tt.note.WordCount())
+			assert.Equal(t, tt.minutes, tt.note.ReadingTime())
+		})
+	}
+}
+
+func TestExcerpt(t *testing.T) {
+	body := "# Title\n\n![Cover](cover.png)\n> [!note] Callout\n\n- list\n\n```\ncode\n```\n\n" +
+		"First **paragraph** with a [link](https://example.com)\nand a [[Note|wiki link]].\n\nSecond paragraph"
+	assert.Equal(t, "First paragraph with a link and a wiki link.", Note{Body: body}.Excerpt())
+	assert.Equal(t, "Summary", Note{Summary: "Summary", Body: body}.Excerpt(), "the frontmatter description wins")
+	assert.Empty(t, Note{Body: "# Only a title"}.Excerpt())
+
+	long := Note{Body: strings.Repeat("Длинное предложение, ", 20)}.Excerpt()
+	assert.Equal(t, strings.Repeat("Длинное предложение, ", 12)+"Длинное предложение…", long)
+	assert.LessOrEqual(t, utf8.RuneCountInString(long), excerptLength+1)
+}
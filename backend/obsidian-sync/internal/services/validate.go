@@ -0,0 +1,158 @@
+package obsidian
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Severity levels of vault issues
+const (
+	SeverityError   string = "error"
+	SeverityWarning string = "warning"
+)
+
+// ResourcesDir is the name of the per-post folder holding embedded files
+const ResourcesDir = "Resources"
+
+// VaultIssue describes a single problem found while linting the vault.
+type VaultIssue struct {
+	// Severity is either SeverityError or SeverityWarning
+	Severity string `json:"severity"`
+	// Path is the vault-relative path the issue refers to
+	Path string `json:"path"`
+	// Message is a human readable description of the problem
+	Message string `json:"message"`
+}
+
+var (
+	wikiEmbedRe     = regexp.MustCompile(`!\[\[([^\]|#]+)(?:[|#][^\]]*)?\]\]`)
+	markdownEmbedRe = regexp.MustCompile(`!\[[^\]]*\]\(([^)\s]+)(?:\s+"[^"]*")?\)`)
+)
+
+// ValidateVault lints the given sections of the vault rooted at root.
+//
+// Every section is expected to follow the layout
+//
+//	<section>/<Post>/<Post>.md
+//	<section>/<Post>/Resources/<files>
+//
+// The function reports missing sections and notes, files placed outside
+// of post folders, empty notes and embeds that point to missing resources.
+// It never modifies the vault.
+func ValidateVault(root string, sections []string) []VaultIssue {
+	var issues []VaultIssue
+	for _, section := range sections {
+		issues = append(issues, validateSection(root, section)...)
+	}
+	return issues
+}
+
+// HasErrors reports whether any of the issues has error severity.
+func HasErrors(issues []VaultIssue) bool {
+	for _, issue := range issues {
+		if issue.Severity == SeverityError {
+			return true
+		}
+	}
+	return false
+}
+
+func validateSection(root, section string) []VaultIssue {
+	entries, err := os.ReadDir(filepath.Join(root, section))
+	if err != nil {
+		return []VaultIssue{{SeverityError, section, "section directory is not readable: " + err.Error()}}
+	}
+
+	var issues []VaultIssue
+	for _, entry := range entries {
+		rel := path.Join(section, entry.Name())
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		if !entry.IsDir() {
+			issues = append(issues, VaultIssue{SeverityWarning, rel, "file is outside of a post folder and will be uploaded as is"})
+			continue
+		}
+		issues = append(issues, validatePost(root, rel)...)
+	}
+	return issues
+}
+
+func validatePost(root, post string) []VaultIssue {
+	name := path.Base(post)
+	notePath := path.Join(post, name+".md")
+
+	var issues []VaultIssue
+	entries, err := os.ReadDir(filepath.Join(root, post))
+	if err != nil {
+		return []VaultIssue{{SeverityError, post, "post directory is not readable: " + err.Error()}}
+	}
+	for _, entry := range entries {
+		switch {
+		case entry.Name() == name+".md", strings.HasPrefix(entry.Name(), "."):
+		case entry.IsDir() && entry.Name() == ResourcesDir:
+		case entry.IsDir():
+			issues = append(issues, VaultIssue{SeverityWarning, path.Join(post, entry.Name()), "unexpected directory, only " + ResourcesDir + " is supported"})
+		case strings.HasSuffix(entry.Name(), ".md"):
+			issues = append(issues, VaultIssue{SeverityWarning, path.Join(post, entry.Name()), "note name does not match the post folder"})
+		default:
+			issues = append(issues, VaultIssue{SeverityWarning, path.Join(post, entry.Name()), "resource is outside of the " + ResourcesDir + " folder"})
+		}
+	}
+
+	content, err := os.ReadFile(filepath.Join(root, notePath))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return append(issues, VaultIssue{SeverityError, post, "post folder has no " + name + ".md note"})
+		}
+		return append(issues, VaultIssue{SeverityError, notePath, "note is not readable: " + err.Error()})
+	}
+	if len(strings.TrimSpace(string(content))) == 0 {
+		issues = append(issues, VaultIssue{SeverityWarning, notePath, "note is empty"})
+	}
+	if _, err := ParseNote(content); err != nil {
+		issues = append(issues, VaultIssue{SeverityError, notePath, err.Error()})
+	}
+
+	for _, target := range embeddedResources(string(content)) {
+		if !resourceExists(root, post, target) {
+			issues = append(issues, VaultIssue{SeverityError, notePath, "embedded resource not found: " + target})
+		}
+	}
+	return issues
+}
+
+// embeddedResources returns the local targets of wiki (![[...]]) and
+// markdown (![](...)) embeds found in a note. Remote URLs are ignored.
+func embeddedResources(content string) []string {
+	var targets []string
+	for _, m := range wikiEmbedRe.FindAllStringSubmatch(content, -1) {
+		targets = append(targets, strings.TrimSpace(m[1]))
+	}
+	for _, m := range markdownEmbedRe.FindAllStringSubmatch(content, -1) {
+		target := m[1]
+		if strings.Contains(target, "://") || strings.HasPrefix(target, "data:") {
+			continue
+		}
+		targets = append(targets, strings.ReplaceAll(target, "%20", " "))
+	}
+	return targets
+}
+
+// resourceExists resolves an embed target the way Obsidian does for this
+// vault layout: relative to the post folder or by name inside Resources.
+func resourceExists(root, post, target string) bool {
+	candidates := []string{
+		path.Join(post, target),
+		path.Join(post, ResourcesDir, path.Base(target)),
+	}
+	for _, candidate := range candidates {
+		if _, err := os.Stat(filepath.Join(root, candidate)); err == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,52 @@
+package obsidian
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeVaultFile creates a file inside the test vault, creating parent dirs
+func writeVaultFile(t *testing.T, root, name, content string) {
+	path := filepath.Join(root, filepath.FromSlash(name))
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
+
+func TestValidateVault(t *testing.T) {
+	root := t.TempDir()
+	writeVaultFile(t, root, "05 - Blog/Good/Good.md", "# Good\n![[Image.png]]\n![alt](Resources/Other.png)")
+	writeVaultFile(t, root, "05 - Blog/Good/Resources/Image.png", "png")
+	writeVaultFile(t, root, "05 - Blog/Good/Resources/Other.png", "png")
+	writeVaultFile(t, root, "05 - Blog/Broken/Broken.md", "![[Missing.png]] ![remote](https://example.com/a.png)")
+	writeVaultFile(t, root, "05 - Blog/NoNote/Resources/Image.png", "png")
+	writeVaultFile(t, root, "05 - Blog/Empty/Empty.md", "  \n")
+	writeVaultFile(t, root, "05 - Blog/Stray.md", "stray")
+
+	issues := ValidateVault(root, []string{"05 - Blog", "06 - Articles"})
+
+	require.Len(t, issues, 5)
+	assert.ElementsMatch(t, []VaultIssue{
+		{SeverityError, "05 - Blog/Broken/Broken.md", "embedded resource not found: Missing.png"},
+		{SeverityError, "05 - Blog/NoNote", "post folder has no NoNote.md note"},
+		{SeverityWarning, "05 - Blog/Empty/Empty.md", "note is empty"},
+		{SeverityWarning, "05 - Blog/Stray.md", "file is outside of a post folder and will be uploaded as is"},
+	}, issues[:4])
+	// Missing sections are reported last, in section order
+	assert.Equal(t, SeverityError, issues[4].Severity)
+	assert.Equal(t, "06 - Articles", issues[4].Path)
+	assert.True(t, HasErrors(issues))
+}
+
+func TestValidateVault_Clean(t *testing.T) {
+	root := t.TempDir()
+	writeVaultFile(t, root, "06 - Articles/Post/Post.md", "# Post")
+
+	issues := ValidateVault(root, []string{"06 - Articles"})
+
+	assert.Empty(t, issues)
+	assert.False(t, HasErrors(issues))
+}
@@ -0,0 +1,140 @@
+// Package sitemap renders the sitemaps, sitemap index and robots.txt of the
+// blog site following the sitemaps.org protocol.
+package sitemap
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"time"
+)
+
+// MaxURLs is the number of URLs a single sitemap may hold
+const MaxURLs = 50000
+
+// XML namespaces of sitemaps and of their language alternates
+const (
+	sitemapNamespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+	xhtmlNamespace   = "http://www.w3.org/1999/xhtml"
+)
+
+// URL is a page of the site.
+type URL struct {
+	Loc string
+	// LastMod is the last change of the page, zero when unknown
+	LastMod time.Time
+	// Alternates are the translations of the page including itself, empty
+	// for a page without translations
+	Alternates []Alternate
+}
+
+// Alternate is a translation of a page.
+type Alternate struct {
+	// Language is the hreflang of the translation, e.g. en or en-US
+	Language string
+	Href     string
+}
+
+// Entry is a sitemap listed in a sitemap index.
+type Entry struct {
+	Loc     string
+	LastMod time.Time
+}
+
+type urlSet struct {
+	XMLName xml.Name `xml:"urlset"`
+	Xmlns   string   `xml:"xmlns,attr"`
+	Xhtml   string   `xml:"xmlns:xhtml,attr,omitempty"`
+	URLs    []urlXML `xml:"url"`
+}
+
+type urlXML struct {
+	Loc        string    `xml:"loc"`
+	LastMod    string    `xml:"lastmod,omitempty"`
+	Alternates []linkXML `xml:"xhtml:link"`
+}
+
+type linkXML struct {
+	Rel      string `xml:"rel,attr"`
+	Hreflang string `xml:"hreflang,attr"`
+	Href     string `xml:"href,attr"`
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name     `xml:"sitemapindex"`
+	Xmlns    string       `xml:"xmlns,attr"`
+	Sitemaps []sitemapXML `xml:"sitemap"`
+}
+
+type sitemapXML struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// Render renders a sitemap of at most MaxURLs URLs
+func Render(urls []URL) ([]byte, error) {
+	if len(urls) > MaxURLs {
+		return nil, fmt.Errorf("a sitemap holds at most %d URLs, got %d", MaxURLs, len(urls))
+	}
+	doc := urlSet{Xmlns: sitemapNamespace, URLs: []urlXML{}}
+	for _, u := range urls {
+		entry := urlXML{Loc: u.Loc, LastMod: date(u.LastMod)}
+		for _, alternate := range u.Alternates {
+			entry.Alternates = append(entry.Alternates, linkXML{Rel: "alternate", Hreflang: alternate.Language, Href: alternate.Href})
+		}
+		if len(entry.Alternates) > 0 {
+			doc.Xhtml = xhtmlNamespace
+		}
+		doc.URLs = append(doc.URLs, entry)
+	}
+	return marshal(doc)
+}
+
+// RenderIndex renders a sitemap index of sitemaps
+func RenderIndex(entries []Entry) ([]byte, error) {
+	if len(entries) > MaxURLs {
+		return nil, fmt.Errorf("a sitemap index holds at most %d sitemaps, got %d", MaxURLs, len(entries))
+	}
+	doc := sitemapIndex{Xmlns: sitemapNamespace, Sitemaps: []sitemapXML{}}
+	for _, entry := range entries {
+		doc.Sitemaps = append(doc.Sitemaps, sitemapXML{Loc: entry.Loc, LastMod: date(entry.LastMod)})
+	}
+	return marshal(doc)
+}
+
+// Split splits urls into the parts of at most size URLs each, one empty
+// part for no URLs
+func Split(urls []URL, size int) [][]URL {
+	parts := [][]URL{urls[:min(len(urls), size)]}
+	for start := size; start < len(urls); start += size {
+		parts = append(parts, urls[start:min(len(urls), start+size)])
+	}
+	return parts
+}
+
+// Robots renders a robots.txt allowing every crawler and pointing it to
+// the sitemap index at sitemapURL
+func Robots(sitemapURL string) []byte {
+	return []byte("User-agent: *\nAllow: /\n\nSitemap: " + sitemapURL + "\n")
+}
+
+// date formats a W3C date, empty for the zero time
+func date(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// marshal encodes an XML document with its declaration
+func marshal(doc interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	encoder := xml.NewEncoder(&buf)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(doc); err != nil {
+		return nil, err
+	}
+	buf.WriteByte('\n')
+	return buf.Bytes(), nil
+}
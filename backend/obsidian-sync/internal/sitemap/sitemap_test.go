@@ -0,0 +1,78 @@
+package sitemap
+
+import (
+	"encoding/xml"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRender(t *testing.T) {
+	data, err := Render([]URL{
+		{Loc: "https://example.com/posts"},
+		{
+			Loc:     "https://example.com/posts/Hello",
+			LastMod: time.Date(2024, 5, 2, 12, 0, 0, 0, time.FixedZone("MSK", 3*3600)),
+			Alternates: []Alternate{
+				{Language: "en", Href: "https://example.com/posts/Hello"},
+				{Language: "ru", Href: "https://example.com/posts/Privet"},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	var doc struct {
+		XMLName xml.Name `xml:"http://www.sitemaps.org/schemas/sitemap/0.9 urlset"`
+		URLs    []struct {
+			Loc     string `xml:"loc"`
+			LastMod string `xml:"lastmod"`
+			Links   []struct {
+				Rel      string `xml:"rel,attr"`
+				Hreflang string `xml:"hreflang,attr"`
+				Href     string `xml:"href,attr"`
+			} `xml:"http://www.w3.org/1999/xhtml link"`
+		} `xml:"url"`
+	}
+	require.NoError(t, xml.Unmarshal(data, &doc))
+	require.Len(t, doc.URLs, 2)
+	assert.Empty(t, doc.URLs[0].LastMod)
+	assert.Empty(t, doc.URLs[0].Links)
+	assert.Equal(t, "2024-05-02T09:00:00Z", doc.URLs[1].LastMod)
+	require.Len(t, doc.URLs[1].Links, 2)
+	assert.Equal(t, "ru", doc.URLs[1].Links[1].Hreflang)
+	assert.Equal(t, "alternate", doc.URLs[1].Links[1].Rel)
+
+	_, err = Render(make([]URL, MaxURLs+1))
+	assert.Error(t, err)
+}
+
+func TestRenderIndex(t *testing.T) {
+	data, err := RenderIndex([]Entry{
+		{Loc: "https://example.com/sitemaps/blog/sitemap-1.xml", LastMod: time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)},
+	})
+	require.NoError(t, err)
+	assert.Contains(t, string(data), "<sitemapindex xmlns=\"http://www.sitemaps.org/schemas/sitemap/0.9\">")
+	assert.Contains(t, string(data), "<lastmod>2024-05-02T00:00:00Z</lastmod>")
+}
+
+func TestSplit(t *testing.T) {
+	urls := make([]URL, 5)
+	for i := range urls {
+		urls[i].Loc = fmt.Sprint(i)
+	}
+	parts := Split(urls, 2)
+	require.Len(t, parts, 3)
+	assert.Len(t, parts[0], 2)
+	assert.Equal(t, "4", parts[2][0].Loc)
+
+	assert.Len(t, Split(nil, 2), 1, "no URLs make one empty sitemap")
+	assert.Len(t, Split(urls[:2], 2), 1)
+}
+
+func TestRobots(t *testing.T) {
+	assert.Equal(t, "User-agent: *\nAllow: /\n\nSitemap: https://example.com/sitemap.xml\n",
+		string(Robots("https://example.com/sitemap.xml")))
+}
@@ -1,3 +1,79 @@
+// Package grpc provides gRPC transport layer implementation.
+//
+// It serves the status API defined in api/proto/obsidiansync/v1/sync.proto
+// and reports finished runs to the orchestrator.
 package grpc
 
-// Package grpc provides gRPC transport layer implementation
\ No newline at end of file
+//go:generate protoc -I ../../../api/proto --go_out=pb --go_opt=paths=source_relative --go-grpc_out=pb --go-grpc_opt=paths=source_relative obsidiansync/v1/sync.proto
+
+import (
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/savabush/obsidian-sync/internal/app"
+	"github.com/savabush/obsidian-sync/internal/transport/grpc/pb"
+)
+
+// runStates maps run states to their protobuf values
+var runStates = map[app.RunState]pb.RunState{
+	app.RunRunning:   pb.RunState_RUN_STATE_RUNNING,
+	app.RunSucceeded: pb.RunState_RUN_STATE_SUCCEEDED,
+	app.RunFailed:    pb.RunState_RUN_STATE_FAILED,
+	app.RunSkipped:   pb.RunState_RUN_STATE_SKIPPED,
+}
+
+// eventTypes maps event types to their protobuf values
+var eventTypes = map[app.EventType]pb.RunEvent_Type{
+	app.EventStarted:  pb.RunEvent_TYPE_STARTED,
+	app.EventPlanned:  pb.RunEvent_TYPE_PLANNED,
+	app.EventApplied:  pb.RunEvent_TYPE_APPLIED,
+	app.EventFinished: pb.RunEvent_TYPE_FINISHED,
+}
+
+// toProtoRun converts a run status to its protobuf message
+func toProtoRun(status app.RunStatus) *pb.Run {
+	run := &pb.Run{
+		RunId:     status.RunID,
+		State:     runStates[status.State],
+		DryRun:    status.DryRun,
+		Commit:    status.Commit,
+		StartedAt: timestamppb.New(status.StartedAt),
+		Error:     status.Error,
+		Trigger:   string(status.Trigger),
+	}
+	if !status.FinishedAt.IsZero() {
+		run.FinishedAt = timestamppb.New(status.FinishedAt)
+	}
+	for _, section := range status.Sections {
+		run.Sections = append(run.Sections, &pb.SectionSummary{
+			Section:     section.Section,
+			Bucket:      section.Bucket,
+			Created:     int32(section.Create),
+			Updated:     int32(section.Update),
+			Deleted:     int32(section.Delete),
+			Unchanged:   int32(section.Skip),
+			Failed:      int32(section.Failed),
+			UploadBytes: section.UploadBytes,
+			Errors:      section.Errors,
+		})
+	}
+	return run
+}
+
+// toProtoEvent converts a progress event to its protobuf message
+func toProtoEvent(event app.Event) *pb.RunEvent {
+	msg := &pb.RunEvent{
+		RunId:   event.RunID,
+		Type:    eventTypes[event.Type],
+		Time:    timestamppb.New(event.Time),
+		Section: event.Section,
+		Key:     event.Key,
+		Action:  event.Action,
+		Error:   event.Error,
+		Done:    int32(event.Done),
+		Total:   int32(event.Total),
+	}
+	if event.Status != nil {
+		msg.Run = toProtoRun(*event.Status)
+	}
+	return msg
+}
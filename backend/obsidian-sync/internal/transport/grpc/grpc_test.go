@@ -0,0 +1,291 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/savabush/obsidian-sync/internal/app"
+	"github.com/savabush/obsidian-sync/internal/database/minio"
+	"github.com/savabush/obsidian-sync/internal/lib"
+	"github.com/savabush/obsidian-sync/internal/transport/grpc/pb"
+)
+
+// fakeRunner keeps a fixed set of runs and hands out a prepared event channel
+type fakeRunner struct {
+	mu      sync.Mutex
+	runs    []app.RunStatus // newest first
+	events  chan app.Event
+	started []app.Options
+	err     error
+}
+
+func (f *fakeRunner) Start(opts app.Options) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.err != nil {
+		return "", f.err
+	}
+	f.started = append(f.started, opts)
+	return "new-run", nil
+}
+
+func (f *fakeRunner) Subscribe() (<-chan app.Event, func()) {
+	return f.events, func() {}
+}
+
+func (f *fakeRunner) Status(runID string) (app.RunStatus, bool) {
+	for _, run := range f.runs {
+		if run.RunID == runID {
+			return run, true
+		}
+	}
+	return app.RunStatus{}, false
+}
+
+func (f *fakeRunner) Last() (app.RunStatus, bool) {
+	if len(f.runs) == 0 {
+		return app.RunStatus{}, false
+	}
+	return f.runs[0], true
+}
+
+func (f *fakeRunner) List(limit int) []app.RunStatus {
+	if limit > 0 && len(f.runs) > limit {
+		return f.runs[:limit]
+	}
+	return f.runs
+}
+
+func (f *fakeRunner) History(ctx context.Context, limit int) ([]app.RunStatus, error) {
+	return f.List(limit), nil
+}
+
+func (f *fakeRunner) Find(ctx context.Context, runID string) (app.RunStatus, bool, error) {
+	if runID == "broken" {
+		return app.RunStatus{}, false, errors.New("connection refused")
+	}
+	run, ok := f.Status(runID)
+	return run, ok, nil
+}
+
+// dial connects to a gRPC server registered by register over an in-memory listener
+func dial(t *testing.T, register func(*grpc.Server)) *grpc.ClientConn {
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	register(srv)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet", bufDialer(lis),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// bufDialer dials the in-memory listener
+func bufDialer(lis *bufconn.Listener) grpc.DialOption {
+	return grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return lis.DialContext(ctx)
+	})
+}
+
+// newTestClient serves the runner and returns a client for it
+func newTestClient(t *testing.T, runner Runner) pb.SyncServiceClient {
+	server := NewServer(runner, lib.TestLog)
+	conn := dial(t, func(srv *grpc.Server) { pb.RegisterSyncServiceServer(srv, server) })
+	return pb.NewSyncServiceClient(conn)
+}
+
+var (
+	startedAt = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	finished  = app.RunStatus{
+		RunID:      "finished",
+		State:      app.RunSucceeded,
+		Trigger:    app.TriggerSchedule,
+		Commit:     "abc123",
+		StartedAt:  startedAt,
+		FinishedAt: startedAt.Add(time.Minute),
+		Sections: []app.SectionSummary{{
+			Section:     "05 - Blog",
+			Bucket:      "blog",
+			PlanSummary: minio.PlanSummary{Create: 2, Delete: 1, Skip: 3, UploadBytes: 100},
+			Failed:      1,
+			Errors:      []string{"Post/Post.md: access denied"},
+		}},
+	}
+	running = app.RunStatus{RunID: "running", State: app.RunRunning, StartedAt: startedAt}
+)
+
+func TestTriggerSync(t *testing.T) {
+	runner := &fakeRunner{}
+	client := newTestClient(t, runner)
+
+	resp, err := client.TriggerSync(context.Background(), &pb.TriggerSyncRequest{
+		Ref:      "main",
+		DryRun:   true,
+		Sections: []string{"blog"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "new-run", resp.GetRunId())
+	require.Len(t, runner.started, 1)
+	assert.Equal(t, "main", runner.started[0].Source.Ref)
+	assert.True(t, runner.started[0].DryRun)
+	assert.Equal(t, []string{"blog"}, runner.started[0].Sections)
+	assert.Equal(t, app.TriggerAPI, runner.started[0].Trigger)
+
+	runner.err = app.ErrRunInProgress
+	_, err = client.TriggerSync(context.Background(), &pb.TriggerSyncRequest{})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+}
+
+func TestGetAndListRuns(t *testing.T) {
+	runner := &fakeRunner{}
+	client := newTestClient(t, runner)
+
+	_, err := client.GetLastRun(context.Background(), &pb.GetLastRunRequest{})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+
+	runner.runs = []app.RunStatus{running, finished}
+	run, err := client.GetLastRun(context.Background(), &pb.GetLastRunRequest{})
+	require.NoError(t, err)
+	assert.Equal(t, "running", run.GetRunId())
+	assert.Equal(t, pb.RunState_RUN_STATE_RUNNING, run.GetState())
+	assert.Nil(t, run.GetFinishedAt())
+
+	resp, err := client.ListRuns(context.Background(), &pb.ListRunsRequest{})
+	require.NoError(t, err)
+	require.Len(t, resp.GetRuns(), 2)
+	last := resp.GetRuns()[1]
+	assert.Equal(t, pb.RunState_RUN_STATE_SUCCEEDED, last.GetState())
+	assert.Equal(t, "abc123", last.GetCommit())
+	assert.Equal(t, "schedule", last.GetTrigger())
+	assert.Equal(t, finished.FinishedAt, last.GetFinishedAt().AsTime())
+	require.Len(t, last.GetSections(), 1)
+	section := last.GetSections()[0]
+	assert.Equal(t, "blog", section.GetBucket())
+	assert.Equal(t, int32(2), section.GetCreated())
+	assert.Equal(t, int32(1), section.GetDeleted())
+	assert.Equal(t, int32(3), section.GetUnchanged())
+	assert.Equal(t, int32(1), section.GetFailed())
+	assert.Equal(t, int64(100), section.GetUploadBytes())
+	assert.Equal(t, []string{"Post/Post.md: access denied"}, section.GetErrors())
+
+	resp, err = client.ListRuns(context.Background(), &pb.ListRunsRequest{Limit: 1})
+	require.NoError(t, err)
+	assert.Len(t, resp.GetRuns(), 1)
+
+	_, err = client.ListRuns(context.Background(), &pb.ListRunsRequest{Limit: -1})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	run, err = client.GetRun(context.Background(), &pb.GetRunRequest{RunId: "finished"})
+	require.NoError(t, err)
+	assert.Equal(t, pb.RunState_RUN_STATE_SUCCEEDED, run.GetState())
+
+	_, err = client.GetRun(context.Background(), &pb.GetRunRequest{RunId: "unknown"})
+	assert.Equal(t, codes.NotFound, status.Code(err))
+	_, err = client.GetRun(context.Background(), &pb.GetRunRequest{RunId: "broken"})
+	assert.Equal(t, codes.Internal, status.Code(err))
+}
+
+// receiveAll reads a run event stream until it ends
+func receiveAll(t *testing.T, stream pb.SyncService_WatchRunClient) []*pb.RunEvent {
+	var events []*pb.RunEvent
+	for {
+		event, err := stream.Recv()
+		if err == io.EOF {
+			return events
+		}
+		require.NoError(t, err)
+		events = append(events, event)
+	}
+}
+
+func TestWatchRun(t *testing.T) {
+	runner := &fakeRunner{runs: []app.RunStatus{running, finished}, events: make(chan app.Event, 10)}
+	client := newTestClient(t, runner)
+
+	t.Run("running", func(t *testing.T) {
+		done := finished
+		done.RunID = "running"
+		runner.events <- app.Event{RunID: "other", Type: app.EventStarted}
+		runner.events <- app.Event{RunID: "running", Type: app.EventApplied, Section: "05 - Blog", Key: "Post/Post.md",
+			Action: "create", Done: 1, Total: 2}
+		runner.events <- app.Event{RunID: "running", Type: app.EventFinished, Status: &done}
+
+		stream, err := client.WatchRun(context.Background(), &pb.WatchRunRequest{RunId: "running"})
+		require.NoError(t, err)
+		events := receiveAll(t, stream)
+		require.Len(t, events, 2, "events of other runs are skipped")
+		assert.Equal(t, pb.RunEvent_TYPE_APPLIED, events[0].GetType())
+		assert.Equal(t, "Post/Post.md", events[0].GetKey())
+		assert.Equal(t, int32(1), events[0].GetDone())
+		assert.Equal(t, int32(2), events[0].GetTotal())
+		assert.Equal(t, pb.RunEvent_TYPE_FINISHED, events[1].GetType())
+		assert.Equal(t, pb.RunState_RUN_STATE_SUCCEEDED, events[1].GetRun().GetState())
+	})
+
+	t.Run("finished", func(t *testing.T) {
+		stream, err := client.WatchRun(context.Background(), &pb.WatchRunRequest{RunId: "finished"})
+		require.NoError(t, err)
+		events := receiveAll(t, stream)
+		require.Len(t, events, 1)
+		assert.Equal(t, pb.RunEvent_TYPE_FINISHED, events[0].GetType())
+		assert.Equal(t, "finished", events[0].GetRun().GetRunId())
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		stream, err := client.WatchRun(context.Background(), &pb.WatchRunRequest{RunId: "unknown"})
+		require.NoError(t, err)
+		_, err = stream.Recv()
+		assert.Equal(t, codes.NotFound, status.Code(err))
+	})
+}
+
+// fakeOrchestrator records the reported runs
+type fakeOrchestrator struct {
+	pb.UnimplementedOrchestratorServiceServer
+	mu      sync.Mutex
+	reports []*pb.ReportRunRequest
+}
+
+func (f *fakeOrchestrator) ReportRun(ctx context.Context, req *pb.ReportRunRequest) (*pb.ReportRunResponse, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.reports = append(f.reports, req)
+	return &pb.ReportRunResponse{}, nil
+}
+
+func TestReporter(t *testing.T) {
+	orchestrator := &fakeOrchestrator{}
+	lis := bufconn.Listen(1 << 20)
+	srv := grpc.NewServer()
+	pb.RegisterOrchestratorServiceServer(srv, orchestrator)
+	go srv.Serve(lis)
+	defer srv.Stop()
+
+	reporter := NewReporter("passthrough:///orchestrator", time.Second, bufDialer(lis),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, reporter.ReportRun(context.Background(), finished))
+
+	require.Len(t, orchestrator.reports, 1)
+	assert.Equal(t, ReporterSource, orchestrator.reports[0].GetSource())
+	assert.Equal(t, "finished", orchestrator.reports[0].GetRun().GetRunId())
+
+	srv.Stop()
+	err := reporter.ReportRun(context.Background(), finished)
+	assert.ErrorContains(t, err, "failed to report run finished")
+}
@@ -0,0 +1,57 @@
+package grpc
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/savabush/obsidian-sync/internal/app"
+	"github.com/savabush/obsidian-sync/internal/transport/grpc/pb"
+)
+
+// ReporterSource identifies obsidian-sync in the reports sent to the orchestrator
+const ReporterSource = "obsidian-sync"
+
+// Reporter sends the final status of runs to the orchestrator. It
+// implements app.StatusReporter.
+type Reporter struct {
+	addr    string
+	timeout time.Duration
+	opts    []grpc.DialOption
+}
+
+// NewReporter creates a reporter for the orchestrator at addr. Every report
+// uses its own connection and gives up after timeout. Without options the
+// connection is not encrypted.
+func NewReporter(addr string, timeout time.Duration, opts ...grpc.DialOption) *Reporter {
+	if len(opts) == 0 {
+		opts = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+	return &Reporter{addr: addr, timeout: timeout, opts: opts}
+}
+
+// ReportRun sends the status of a finished run to the orchestrator.
+func (r *Reporter) ReportRun(ctx context.Context, status app.RunStatus) error {
+	conn, err := grpc.NewClient(r.addr, r.opts...)
+	if err != nil {
+		return fmt.Errorf("failed to connect to orchestrator %s: %w", r.addr, err)
+	}
+	defer conn.Close()
+
+	if r.timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, r.timeout)
+		defer cancel()
+	}
+	_, err = pb.NewOrchestratorServiceClient(conn).ReportRun(ctx, &pb.ReportRunRequest{
+		Source: ReporterSource,
+		Run:    toProtoRun(status),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to report run %s to orchestrator %s: %w", status.RunID, r.addr, err)
+	}
+	return nil
+}
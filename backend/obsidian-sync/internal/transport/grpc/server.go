@@ -0,0 +1,152 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/savabush/obsidian-sync/internal/app"
+	"github.com/savabush/obsidian-sync/internal/config"
+	"github.com/savabush/obsidian-sync/internal/transport/grpc/pb"
+)
+
+// Runner runs synchronizations and keeps their status, see app.Runner
+type Runner interface {
+	Start(opts app.Options) (string, error)
+	Subscribe() (<-chan app.Event, func())
+	Status(runID string) (app.RunStatus, bool)
+	Last() (app.RunStatus, bool)
+	List(limit int) []app.RunStatus
+	History(ctx context.Context, limit int) ([]app.RunStatus, error)
+	Find(ctx context.Context, runID string) (app.RunStatus, bool, error)
+}
+
+// Server implements the SyncService on top of a Runner.
+type Server struct {
+	pb.UnimplementedSyncServiceServer
+	runner Runner
+	logger config.LoggerInterface
+}
+
+// NewServer creates a SyncService server for the runner.
+func NewServer(runner Runner, logger config.LoggerInterface) *Server {
+	return &Server{runner: runner, logger: config.ForPackage(logger, "grpc")}
+}
+
+// Serve registers the server on a new gRPC server listening on lis and
+// serves until the listener fails or the returned server is stopped.
+func (s *Server) Serve(lis net.Listener) (*grpc.Server, <-chan error) {
+	srv := grpc.NewServer()
+	pb.RegisterSyncServiceServer(srv, s)
+
+	errc := make(chan error, 1)
+	go func() {
+		s.logger.Infof("Serving gRPC status API on %s", lis.Addr())
+		errc <- srv.Serve(lis)
+	}()
+	return srv, errc
+}
+
+// TriggerSync starts a run in the background.
+func (s *Server) TriggerSync(ctx context.Context, req *pb.TriggerSyncRequest) (*pb.TriggerSyncResponse, error) {
+	runID, err := s.runner.Start(app.Options{
+		Source:   app.Source{Ref: req.GetRef()},
+		DryRun:   req.GetDryRun(),
+		Sections: req.GetSections(),
+		Trigger:  app.TriggerAPI,
+	})
+	if errors.Is(err, app.ErrRunInProgress) {
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	s.logger.WithField(config.RunIDField, runID).Infof("Sync triggered over gRPC")
+	return &pb.TriggerSyncResponse{RunId: runID}, nil
+}
+
+// WatchRun streams the events of a run until it finishes.
+func (s *Server) WatchRun(req *pb.WatchRunRequest, stream pb.SyncService_WatchRunServer) error {
+	// Subscribe before looking the run up so no event is missed in between
+	events, unsubscribe := s.runner.Subscribe()
+	defer unsubscribe()
+
+	run, ok := s.runner.Status(req.GetRunId())
+	if !ok {
+		return status.Errorf(codes.NotFound, "run %q not found", req.GetRunId())
+	}
+	if run.State != app.RunRunning {
+		return stream.Send(finishedEvent(run))
+	}
+
+	for {
+		select {
+		case event, ok := <-events:
+			if !ok {
+				// The subscription was dropped, send the final status if the run is done
+				run, _ = s.runner.Status(req.GetRunId())
+				if run.State != app.RunRunning {
+					return stream.Send(finishedEvent(run))
+				}
+				return status.Error(codes.ResourceExhausted, "client too slow to follow the run")
+			}
+			if event.RunID != req.GetRunId() {
+				continue
+			}
+			if err := stream.Send(toProtoEvent(event)); err != nil {
+				return err
+			}
+			if event.Type == app.EventFinished {
+				return nil
+			}
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		}
+	}
+}
+
+// GetLastRun returns the latest run.
+func (s *Server) GetLastRun(ctx context.Context, req *pb.GetLastRunRequest) (*pb.Run, error) {
+	run, ok := s.runner.Last()
+	if !ok {
+		return nil, status.Error(codes.NotFound, "no run yet")
+	}
+	return toProtoRun(run), nil
+}
+
+// ListRuns returns the recent runs, newest first.
+func (s *Server) ListRuns(ctx context.Context, req *pb.ListRunsRequest) (*pb.ListRunsResponse, error) {
+	if req.GetLimit() < 0 {
+		return nil, status.Error(codes.InvalidArgument, "limit must not be negative")
+	}
+	runs, err := s.runner.History(ctx, int(req.GetLimit()))
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	resp := &pb.ListRunsResponse{}
+	for _, run := range runs {
+		resp.Runs = append(resp.Runs, toProtoRun(run))
+	}
+	return resp, nil
+}
+
+// GetRun returns a run by its ID.
+func (s *Server) GetRun(ctx context.Context, req *pb.GetRunRequest) (*pb.Run, error) {
+	run, ok, err := s.runner.Find(ctx, req.GetRunId())
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "run %q not found", req.GetRunId())
+	}
+	return toProtoRun(run), nil
+}
+
+// finishedEvent is the last event of a finished run
+func finishedEvent(run app.RunStatus) *pb.RunEvent {
+	return toProtoEvent(app.Event{RunID: run.RunID, Type: app.EventFinished, Time: run.FinishedAt, Status: &run})
+}
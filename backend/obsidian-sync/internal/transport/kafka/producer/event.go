@@ -0,0 +1,169 @@
+package producer
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/savabush/obsidian-sync/internal/app"
+	"github.com/savabush/obsidian-sync/internal/config"
+	"github.com/savabush/obsidian-sync/internal/database/minio"
+	obsidian "github.com/savabush/obsidian-sync/internal/services"
+)
+
+// Schema names the event schema, see api/events/obsidiansync/v1/event.schema.json.
+// SchemaVersion is increased on incompatible changes.
+const (
+	Schema        = "obsidian-sync.event"
+	SchemaVersion = 1
+)
+
+// Message headers describing the event in the value
+const (
+	HeaderContentType   = "content-type"
+	HeaderSchema        = "schema"
+	HeaderSchemaVersion = "schema-version"
+	HeaderEventType     = "event-type"
+)
+
+// EventType is the type of a domain event.
+type EventType string
+
+const (
+	PostCreated   EventType = "post.created"
+	PostUpdated   EventType = "post.updated"
+	PostDeleted   EventType = "post.deleted"
+	AssetUploaded EventType = "asset.uploaded"
+	AssetDeleted  EventType = "asset.deleted"
+	RunFinished   EventType = "run.finished"
+)
+
+// Event is a domain event of a synchronization run.
+type Event struct {
+	// ID is unique per event, consumers use it to drop redelivered events
+	ID      string    `json:"id"`
+	Schema  string    `json:"schema"`
+	Version int       `json:"version"`
+	Type    EventType `json:"type"`
+	Time    time.Time `json:"time"`
+	RunID   string    `json:"run_id"`
+	Commit  string    `json:"commit,omitempty"`
+	// Slug, Section, Bucket, Key and Size describe the changed post or asset
+	Slug    string `json:"slug,omitempty"`
+	Section string `json:"section,omitempty"`
+	Bucket  string `json:"bucket,omitempty"`
+	Key     string `json:"key,omitempty"`
+	Size    int64  `json:"size,omitempty"`
+	// Run is the final status of the run, set on RunFinished
+	Run *app.RunStatus `json:"run,omitempty"`
+}
+
+// Message encodes the event as a message keyed by the post slug, or by the
+// run ID for run events.
+func (e Event) Message() (Message, error) {
+	value, err := json.Marshal(e)
+	if err != nil {
+		return Message{}, fmt.Errorf("failed to encode event %s: %w", e.ID, err)
+	}
+	key := e.Slug
+	if key == "" {
+		key = e.RunID
+	}
+	return Message{
+		Key:   key,
+		Value: value,
+		Headers: map[string]string{
+			HeaderContentType:   "application/json",
+			HeaderSchema:        e.Schema,
+			HeaderSchemaVersion: strconv.Itoa(e.Version),
+			HeaderEventType:     string(e.Type),
+		},
+	}, nil
+}
+
+// postEvents maps the applied plan actions on posts to their event type
+var postEvents = map[string]EventType{
+	minio.ActionCreate: PostCreated,
+	minio.ActionUpdate: PostUpdated,
+	minio.ActionDelete: PostDeleted,
+}
+
+// assetEvents maps the applied plan actions on assets to their event type
+var assetEvents = map[string]EventType{
+	minio.ActionCreate: AssetUploaded,
+	minio.ActionUpdate: AssetUploaded,
+	minio.ActionDelete: AssetDeleted,
+}
+
+// Events returns the events of a run: one per created, updated or deleted
+// post, one per uploaded or deleted asset and a final RunFinished. Failed
+// and skipped items have no event, and neither have the objects the sync
+// derives from the vault: the rendered HTML and info of the notes, the
+// image variants and the slug state.
+func Events(report *app.Report, status app.RunStatus) []Event {
+	newEvent := func(eventType EventType) Event {
+		return Event{
+			ID:      config.NewID(16),
+			Schema:  Schema,
+			Version: SchemaVersion,
+			Type:    eventType,
+			Time:    status.FinishedAt,
+			RunID:   status.RunID,
+			Commit:  status.Commit,
+		}
+	}
+
+	var events []Event
+	for _, section := range report.Sections {
+		for _, item := range section.Plan.Items {
+			if item.Action == minio.ActionSkip || item.Error != "" {
+				continue
+			}
+			var event Event
+			switch {
+			case IsPost(item.Key):
+				event = newEvent(postEvents[item.Action])
+			case IsAsset(item.Key):
+				event = newEvent(assetEvents[item.Action])
+			default:
+				continue
+			}
+			event.Slug = Slug(item.Key)
+			event.Section = section.Section
+			event.Bucket = section.Plan.Bucket
+			event.Key = item.Key
+			event.Size = item.Size
+			events = append(events, event)
+		}
+	}
+
+	finished := newEvent(RunFinished)
+	finished.Run = &status
+	return append(events, finished)
+}
+
+// IsPost reports whether an object is the markdown text of a post,
+// <slug>/<slug>.md
+func IsPost(key string) bool {
+	dir, name, ok := strings.Cut(key, "/")
+	return ok && name == dir+".md"
+}
+
+// IsAsset reports whether an object is a file of a post's Resources
+// folder, <slug>/Resources/<name>
+func IsAsset(key string) bool {
+	_, name, ok := strings.Cut(key, "/")
+	return ok && strings.HasPrefix(name, obsidian.ResourcesDir+"/")
+}
+
+// Slug returns the slug of the post an object belongs to: the post
+// directory, or the file name without extension for top-level objects.
+func Slug(key string) string {
+	if dir, _, ok := strings.Cut(key, "/"); ok {
+		return dir
+	}
+	return strings.TrimSuffix(key, path.Ext(key))
+}
@@ -0,0 +1,165 @@
+package producer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// flushBatch is the number of events written to Kafka at once
+const flushBatch = 100
+
+// Outbox stores events in a directory until they were published. Every
+// event is a file named after the time it was added, so events are
+// published in the order they were added.
+type Outbox struct {
+	dir string
+	mu  sync.Mutex
+	seq int
+}
+
+// OpenOutbox opens the outbox in dir, creating the directory when needed.
+func OpenOutbox(dir string) (*Outbox, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create outbox %s: %w", dir, err)
+	}
+	return &Outbox{dir: dir}, nil
+}
+
+// Add stores the events. An event is either stored completely or not at all.
+func (o *Outbox) Add(events ...Event) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for _, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to encode event %s: %w", event.ID, err)
+		}
+		o.seq++
+		name := fmt.Sprintf("%020d-%06d-%s.json", time.Now().UnixNano(), o.seq%1000000, event.ID)
+		if err := writeFileSync(filepath.Join(o.dir, name), data); err != nil {
+			return fmt.Errorf("failed to store event %s: %w", event.ID, err)
+		}
+	}
+	return nil
+}
+
+// Pending returns the stored events, oldest first. Files that can't be
+// decoded are renamed to *.invalid and left for inspection.
+func (o *Outbox) Pending() ([]Event, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	events, _, err := o.pending()
+	return events, err
+}
+
+// Flush publishes the stored events in order and removes them once the
+// producer acknowledged them. It returns the number of published events;
+// on error the remaining events are kept for the next flush.
+func (o *Outbox) Flush(ctx context.Context, producer Producer) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	events, files, err := o.pending()
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for start := 0; start < len(events); start += flushBatch {
+		end := min(start+flushBatch, len(events))
+		msgs := make([]Message, 0, end-start)
+		for _, event := range events[start:end] {
+			msg, err := event.Message()
+			if err != nil {
+				return sent, err
+			}
+			msgs = append(msgs, msg)
+		}
+		if err := producer.Produce(ctx, msgs...); err != nil {
+			return sent, err
+		}
+		for _, file := range files[start:end] {
+			// An event published but not removed is published again, which
+			// at-least-once delivery allows
+			if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+				return sent, fmt.Errorf("failed to remove published event %s: %w", file, err)
+			}
+		}
+		sent += end - start
+	}
+	return sent, nil
+}
+
+// pending reads the stored events and their files, oldest first
+func (o *Outbox) pending() ([]Event, []string, error) {
+	entries, err := os.ReadDir(o.dir)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read outbox %s: %w", o.dir, err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".json") {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	var events []Event
+	var files []string
+	for _, name := range names {
+		file := filepath.Join(o.dir, name)
+		data, err := os.ReadFile(file)
+		if errors.Is(err, os.ErrNotExist) {
+			// Published by another process in the meantime
+			continue
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read event %s: %w", file, err)
+		}
+		var event Event
+		if err := json.Unmarshal(data, &event); err != nil {
+			if err := os.Rename(file, strings.TrimSuffix(file, ".json")+".invalid"); err != nil {
+				return nil, nil, fmt.Errorf("failed to set aside invalid event %s: %w", file, err)
+			}
+			continue
+		}
+		events = append(events, event)
+		files = append(files, file)
+	}
+	return events, files, nil
+}
+
+// writeFileSync writes a file through a temporary file so it appears
+// complete or not at all, even after a crash
+func writeFileSync(name string, data []byte) error {
+	tmp := name + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, name)
+}
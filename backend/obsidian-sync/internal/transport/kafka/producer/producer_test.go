@@ -0,0 +1,206 @@
+package producer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/savabush/obsidian-sync/internal/app"
+	"github.com/savabush/obsidian-sync/internal/database/minio"
+	"github.com/savabush/obsidian-sync/internal/lib"
+	obsidian "github.com/savabush/obsidian-sync/internal/services"
+)
+
+// testRun returns the report and status of a run that changed two posts
+func testRun() (*app.Report, app.RunStatus) {
+	report := &app.Report{
+		RunID:  "run1",
+		Commit: "abc123",
+		Sections: []app.SectionResult{{
+			Section: "05 - Blog",
+			Plan: &minio.Plan{
+				Bucket: "blog",
+				Items: []minio.PlanItem{
+					{Action: minio.ActionCreate, Key: "New/New.md", Size: 10},
+					{Action: minio.ActionCreate, Key: "New/Resources/Image.png", Size: 20},
+					{Action: minio.ActionUpdate, Key: "Changed/Changed.md", Size: 30},
+					{Action: minio.ActionSkip, Key: "Same/Same.md", Size: 40},
+					{Action: minio.ActionDelete, Key: "Old/Old.md", Size: 50},
+					{Action: minio.ActionDelete, Key: "Old/Resources/Image.png", Size: 60},
+					{Action: minio.ActionUpdate, Key: "Broken/Broken.md", Error: "timeout"},
+					{Action: minio.ActionCreate, Key: "New/New.html", Size: 70},
+					{Action: minio.ActionCreate, Key: "New/New.json", Size: 80},
+					{Action: minio.ActionCreate, Key: "New/Variants/Image.png/480w.jpg", Size: 90},
+					{Action: minio.ActionDelete, Key: "Old/Variants/Image.png/480w.jpg", Size: 100},
+					{Action: minio.ActionUpdate, Key: obsidian.RedirectsKey, Size: 110},
+				},
+			},
+		}},
+	}
+	finishedAt := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	status := app.RunStatus{RunID: "run1", State: app.RunFailed, Commit: "abc123", FinishedAt: finishedAt}
+	return report, status
+}
+
+func TestEvents(t *testing.T) {
+	report, status := testRun()
+	events := Events(report, status)
+
+	type summary struct {
+		Type EventType
+		Slug string
+		Key  string
+	}
+	var got []summary
+	ids := make(map[string]bool)
+	for _, event := range events {
+		got = append(got, summary{event.Type, event.Slug, event.Key})
+		ids[event.ID] = true
+		assert.Equal(t, Schema, event.Schema)
+		assert.Equal(t, SchemaVersion, event.Version)
+		assert.Equal(t, "run1", event.RunID)
+		assert.Equal(t, "abc123", event.Commit)
+		assert.Equal(t, status.FinishedAt, event.Time)
+	}
+	assert.Equal(t, []summary{
+		{PostCreated, "New", "New/New.md"},
+		{AssetUploaded, "New", "New/Resources/Image.png"},
+		{PostUpdated, "Changed", "Changed/Changed.md"},
+		{PostDeleted, "Old", "Old/Old.md"},
+		{AssetDeleted, "Old", "Old/Resources/Image.png"},
+		{RunFinished, "", ""},
+	}, got, "skipped, failed and generated objects have no event")
+	assert.Len(t, ids, len(events), "event IDs are unique")
+
+	assert.Equal(t, "blog", events[0].Bucket)
+	assert.Equal(t, "05 - Blog", events[0].Section)
+	assert.Equal(t, int64(10), events[0].Size)
+	require.NotNil(t, events[5].Run)
+	assert.Equal(t, app.RunFailed, events[5].Run.State)
+}
+
+func TestIsPost(t *testing.T) {
+	for _, key := range []string{"post/post.md", "about-me/about-me.md"} {
+		assert.True(t, IsPost(key), key)
+		assert.False(t, IsAsset(key), key)
+	}
+	for _, key := range []string{"post/Resources/notes.md", "post/post.html", "index.md", obsidian.RedirectsKey} {
+		assert.False(t, IsPost(key), key)
+	}
+	assert.True(t, IsAsset("post/Resources/diagrams/flow.svg"))
+	for _, key := range []string{"post/Variants/image.png/480w.jpg", "post/post.json", "Resources/image.png"} {
+		assert.False(t, IsAsset(key), key)
+	}
+}
+
+func TestSlug(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"Post/Post.md", "Post"},
+		{"Post/Resources/Image.png", "Post"},
+		{"About.md", "About"},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, Slug(tt.key), tt.key)
+	}
+}
+
+func TestEventMessage(t *testing.T) {
+	report, status := testRun()
+	events := Events(report, status)
+
+	msg, err := events[0].Message()
+	require.NoError(t, err)
+	assert.Equal(t, "New", msg.Key, "post events are keyed by slug")
+	assert.Equal(t, map[string]string{
+		HeaderContentType:   "application/json",
+		HeaderSchema:        Schema,
+		HeaderSchemaVersion: "1",
+		HeaderEventType:     "post.created",
+	}, msg.Headers)
+
+	var value map[string]interface{}
+	require.NoError(t, json.Unmarshal(msg.Value, &value))
+	assert.Equal(t, "post.created", value["type"])
+	assert.Equal(t, "New/New.md", value["key"])
+	assert.Equal(t, float64(1), value["version"])
+
+	msg, err = events[len(events)-1].Message()
+	require.NoError(t, err)
+	assert.Equal(t, "run1", msg.Key, "run events are keyed by run ID")
+}
+
+func TestOutbox(t *testing.T) {
+	dir := t.TempDir()
+	outbox, err := OpenOutbox(dir)
+	require.NoError(t, err)
+	kafka := NewMemoryProducer()
+
+	report, status := testRun()
+	events := Events(report, status)
+	require.NoError(t, outbox.Add(events...))
+
+	// Events survive a failed flush
+	kafka.SetError(errors.New("kafka is down"))
+	sent, err := outbox.Flush(context.Background(), kafka)
+	assert.EqualError(t, err, "kafka is down")
+	assert.Zero(t, sent)
+	pending, err := outbox.Pending()
+	require.NoError(t, err)
+	assert.Equal(t, events, pending)
+
+	// and survive a restart
+	outbox, err = OpenOutbox(dir)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "99999999999999999999-000000-broken.json"), []byte("{"), 0644))
+
+	kafka.SetError(nil)
+	sent, err = outbox.Flush(context.Background(), kafka)
+	require.NoError(t, err)
+	assert.Equal(t, len(events), sent)
+
+	msgs := kafka.Messages()
+	require.Len(t, msgs, len(events))
+	for i, msg := range msgs {
+		var event Event
+		require.NoError(t, json.Unmarshal(msg.Value, &event))
+		assert.Equal(t, events[i].ID, event.ID, "events are published in order")
+	}
+
+	pending, err = outbox.Pending()
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+	assert.FileExists(t, filepath.Join(dir, "99999999999999999999-000000-broken.invalid"),
+		"invalid events are set aside")
+}
+
+func TestPublisher(t *testing.T) {
+	outbox, err := OpenOutbox(t.TempDir())
+	require.NoError(t, err)
+	kafka := NewMemoryProducer()
+	publisher := NewPublisher(kafka, outbox, lib.TestLog)
+
+	report, status := testRun()
+	kafka.SetError(errors.New("kafka is down"))
+	err = publisher.PublishRun(context.Background(), report, status)
+	assert.ErrorContains(t, err, "kept in the outbox")
+	assert.Empty(t, kafka.Messages())
+
+	// The next run publishes its own events after the kept ones
+	kafka.SetError(nil)
+	require.NoError(t, publisher.PublishRun(context.Background(), report, status))
+	msgs := kafka.Messages()
+	require.Len(t, msgs, 12)
+	assert.Equal(t, "New", msgs[0].Key)
+	assert.Equal(t, "run1", msgs[5].Key)
+	assert.Equal(t, "New", msgs[6].Key)
+}
@@ -0,0 +1,59 @@
+package producer
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/savabush/obsidian-sync/internal/app"
+	"github.com/savabush/obsidian-sync/internal/config"
+)
+
+// Publisher publishes the events of runs through the outbox. It
+// implements app.EventPublisher.
+type Publisher struct {
+	producer Producer
+	outbox   *Outbox
+	logger   config.LoggerInterface
+}
+
+// NewPublisher creates a publisher writing to producer through outbox.
+func NewPublisher(producer Producer, outbox *Outbox, logger config.LoggerInterface) *Publisher {
+	return &Publisher{producer: producer, outbox: outbox, logger: config.ForPackage(logger, "kafka")}
+}
+
+// New creates a publisher for the configured Kafka topic and outbox.
+func New(cfg config.KafkaConfig, logger config.LoggerInterface) (*Publisher, error) {
+	outbox, err := OpenOutbox(cfg.OUTBOX_DIR)
+	if err != nil {
+		return nil, err
+	}
+	return NewPublisher(NewKafka(cfg.BrokerList(), cfg.TOPIC, cfg.WRITE_TIMEOUT), outbox, logger), nil
+}
+
+// PublishRun stores the events of a run in the outbox and publishes all
+// pending events. Events that could not be published stay in the outbox
+// and are published with the next run.
+func (p *Publisher) PublishRun(ctx context.Context, report *app.Report, status app.RunStatus) error {
+	events := Events(report, status)
+	if err := p.outbox.Add(events...); err != nil {
+		return fmt.Errorf("failed to store events in the outbox: %w", err)
+	}
+	return p.Flush(ctx)
+}
+
+// Flush publishes the pending events of the outbox.
+func (p *Publisher) Flush(ctx context.Context) error {
+	sent, err := p.outbox.Flush(ctx, p.producer)
+	if sent > 0 {
+		p.logger.WithField("count", sent).Infof("Published %d events", sent)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to publish events, the rest is kept in the outbox: %w", err)
+	}
+	return nil
+}
+
+// Close closes the producer. Pending events stay in the outbox.
+func (p *Publisher) Close() error {
+	return p.producer.Close()
+}
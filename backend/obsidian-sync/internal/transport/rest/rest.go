@@ -0,0 +1,272 @@
+// Package rest provides the HTTP transport of the blog read API.
+//
+// It serves the published posts, articles and pages read by the blog
+// package as JSON under /api/v1/, with links to their resources.
+package rest
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/savabush/obsidian-sync/internal/blog"
+	"github.com/savabush/obsidian-sync/internal/markdown"
+)
+
+// response is the envelope of every successful JSON response
+type response struct {
+	Result interface{} `json:"result"`
+	// NextCursor continues a paginated listing, empty on the last page
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// errorResponse is the body of a failed request
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// postSummary is a post in a list. The field names are the ones the
+// frontend reads.
+type postSummary struct {
+	ID    string `json:"id"`
+	Title string `json:"name"`
+	// Summary is always sent, empty when the note has none
+	Summary  string   `json:"summary"`
+	Language string   `json:"language,omitempty"`
+	Tags     []string `json:"tags"`
+	// Excerpt is the summary, else the text of the first paragraph
+	Excerpt     string `json:"excerpt,omitempty"`
+	WordCount   int    `json:"word_count"`
+	ReadingTime int    `json:"reading_time"`
+	// Image is the URL of the cover resource
+	Image     string    `json:"img,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_date"`
+}
+
+// postDetail is a single post with its content
+type postDetail struct {
+	postSummary
+	// Content is the markdown body of the note
+	Content string `json:"content"`
+	// HTML is the sanitized rendering of the content, empty when the sync
+	// did not render the note
+	HTML string `json:"html,omitempty"`
+	// TOC is the table of contents linking to the headings of the HTML
+	TOC []markdown.Heading `json:"toc"`
+	// Metadata holds all frontmatter fields
+	Metadata  map[string]interface{} `json:"metadata"`
+	Resources []resource             `json:"resources"`
+}
+
+// intro is the intro page shown on the home page
+type intro struct {
+	Name       string `json:"name"`
+	Profession string `json:"profession"`
+	// About is the about field of the frontmatter, else the excerpt
+	About string `json:"about"`
+	// Image is the URL of the cover resource
+	Image string `json:"img,omitempty"`
+}
+
+// resource is a file of a post with the URL it is served at
+type resource struct {
+	Name        string `json:"name"`
+	URL         string `json:"url"`
+	ContentType string `json:"content_type,omitempty"`
+	Size        int64  `json:"size"`
+	// Width and Height are the size of an image in pixels
+	Width  int `json:"width,omitempty"`
+	Height int `json:"height,omitempty"`
+	// Variants are the resized copies of an image, ordered by width
+	Variants []variant `json:"variants,omitempty"`
+	// Srcset lists the variants for the srcset attribute of an img element
+	Srcset string `json:"srcset,omitempty"`
+}
+
+// variant is a resized image with the URL it is served at
+type variant struct {
+	URL         string `json:"url"`
+	Width       int    `json:"width"`
+	Height      int    `json:"height"`
+	ContentType string `json:"content_type,omitempty"`
+	Size        int64  `json:"size"`
+}
+
+// searchResults is a page of search hits
+type searchResults struct {
+	Hits  []searchHit `json:"hits"`
+	Total int         `json:"total"`
+	Page  int         `json:"page"`
+	Limit int         `json:"limit"`
+}
+
+// searchHit is a post matching a search query
+type searchHit struct {
+	Section   string    `json:"section"`
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Title     string    `json:"title"`
+	Language  string    `json:"language,omitempty"`
+	Tags      []string  `json:"tags"`
+	CreatedAt time.Time `json:"created_at"`
+	Rank      float32   `json:"rank"`
+	// Snippet is an HTML excerpt with the matched words in <mark> tags
+	Snippet string `json:"snippet"`
+}
+
+// links builds the URLs of the resources of a collection
+type links struct {
+	// base is the URL of the collection, e.g. https://example.com/api/v1/posts
+	base string
+}
+
+// post returns the URL of a post
+func (l links) post(id string) string {
+	return l.base + "/" + url.PathEscape(id)
+}
+
+// resource returns the URL of a post resource
+func (l links) resource(id, name string) string {
+	return l.post(id) + "/resources/" + (&url.URL{Path: name}).EscapedPath()
+}
+
+// variant returns the URL of a resized image resource of a post
+func (l links) variant(id, name string) string {
+	return l.post(id) + "/variants/" + (&url.URL{Path: name}).EscapedPath()
+}
+
+// toResource converts a resource of a post
+func toResource(id string, r blog.Resource, l links) resource {
+	converted := resource{
+		Name:        r.Name,
+		URL:         l.resource(id, r.Name),
+		ContentType: r.ContentType,
+		Size:        r.Size,
+		Width:       r.Width,
+		Height:      r.Height,
+	}
+	srcset := make([]string, 0, len(r.Variants))
+	for _, v := range r.Variants {
+		converted.Variants = append(converted.Variants, variant{
+			URL:         l.variant(id, v.Name),
+			Width:       v.Width,
+			Height:      v.Height,
+			ContentType: v.ContentType,
+			Size:        v.Size,
+		})
+		if v.Width > 0 {
+			srcset = append(srcset, l.variant(id, v.Name)+" "+strconv.Itoa(v.Width)+"w")
+		}
+	}
+	converted.Srcset = strings.Join(srcset, ", ")
+	return converted
+}
+
+// toPostSummary converts a post to its list representation
+func toPostSummary(post blog.Post, l links) postSummary {
+	summary := postSummary{
+		ID:          post.ID,
+		Title:       post.Title,
+		Summary:     post.Summary,
+		Language:    post.Language,
+		Tags:        post.Tags,
+		CreatedAt:   post.CreatedAt,
+		UpdatedAt:   post.UpdatedAt,
+		Excerpt:     post.Excerpt,
+		WordCount:   post.WordCount,
+		ReadingTime: post.ReadingTime,
+	}
+	if summary.Tags == nil {
+		summary.Tags = []string{}
+	}
+	if post.Cover != "" {
+		summary.Image = l.resource(post.ID, post.Cover)
+	}
+	return summary
+}
+
+// toPostDetail converts a post to its full representation
+func toPostDetail(post blog.Post, l links) postDetail {
+	detail := postDetail{
+		postSummary: toPostSummary(post, l),
+		Content:     post.Content,
+		HTML:        post.HTML,
+		TOC:         post.TOC,
+		Metadata:    post.Metadata,
+		Resources:   []resource{},
+	}
+	if detail.Metadata == nil {
+		detail.Metadata = map[string]interface{}{}
+	}
+	if detail.TOC == nil {
+		detail.TOC = []markdown.Heading{}
+	}
+	for _, r := range post.Resources {
+		detail.Resources = append(detail.Resources, toResource(post.ID, r, l))
+	}
+	return detail
+}
+
+// toIntro converts the intro page
+func toIntro(post blog.Post, l links) intro {
+	converted := intro{
+		Name:       metadataString(post.Metadata, "name"),
+		Profession: metadataString(post.Metadata, "profession"),
+		About:      metadataString(post.Metadata, "about"),
+	}
+	if converted.Name == "" {
+		converted.Name = post.Title
+	}
+	if converted.About == "" {
+		converted.About = post.Excerpt
+	}
+	if post.Cover != "" {
+		converted.Image = l.resource(post.ID, post.Cover)
+	}
+	return converted
+}
+
+// metadataString returns a frontmatter field as a string, empty when it is
+// missing or not a scalar
+func metadataString(metadata map[string]interface{}, key string) string {
+	switch value := metadata[key].(type) {
+	case string:
+		return value
+	case int, int64, float64, bool:
+		return fmt.Sprint(value)
+	default:
+		return ""
+	}
+}
+
+// toSearchResults converts search results, linking every hit with the
+// URL builder of its section
+func toSearchResults(results blog.SearchResults, sectionLinks func(section string) links) searchResults {
+	converted := searchResults{
+		Hits:  make([]searchHit, 0, len(results.Hits)),
+		Total: results.Total,
+		Page:  results.Page,
+		Limit: results.Limit,
+	}
+	for _, hit := range results.Hits {
+		tags := hit.Tags
+		if tags == nil {
+			tags = []string{}
+		}
+		converted.Hits = append(converted.Hits, searchHit{
+			Section:   hit.Section,
+			ID:        hit.ID,
+			URL:       sectionLinks(hit.Section).post(hit.ID),
+			Title:     hit.Title,
+			Language:  hit.Language,
+			Tags:      tags,
+			CreatedAt: hit.CreatedAt,
+			Rank:      hit.Rank,
+			Snippet:   hit.Snippet,
+		})
+	}
+	return converted
+}
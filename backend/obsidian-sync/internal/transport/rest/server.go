@@ -0,0 +1,361 @@
+package rest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/savabush/obsidian-sync/internal/blog"
+	"github.com/savabush/obsidian-sync/internal/config"
+	"github.com/savabush/obsidian-sync/internal/database/minio"
+)
+
+// apiPrefix is the path all endpoints are served under
+const apiPrefix = "/api/v1"
+
+// Server serves the blog read API.
+type Server struct {
+	content   *blog.Content
+	publicURL string
+	origins   []string
+	logger    config.LoggerInterface
+}
+
+// NewServer creates a blog API server for the content.
+func NewServer(cfg config.APIConfig, content *blog.Content, logger config.LoggerInterface) *Server {
+	return &Server{
+		content:   content,
+		publicURL: strings.TrimRight(cfg.PUBLIC_URL, "/"),
+		origins:   cfg.OriginList(),
+		logger:    config.ForPackage(logger, "api"),
+	}
+}
+
+// Serve serves the API on lis until the listener fails or the returned
+// server is shut down.
+func (s *Server) Serve(lis net.Listener) (*http.Server, <-chan error) {
+	srv := &http.Server{
+		Handler:           s.Handler(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		s.logger.Infof("Serving blog API on %s", lis.Addr())
+		errc <- srv.Serve(lis)
+	}()
+	return srv, errc
+}
+
+// Handler returns the HTTP handler of the API.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET "+apiPrefix+"/health", s.health)
+	mux.HandleFunc("GET "+apiPrefix+"/search", s.search)
+	for name, collection := range map[string]*blog.Collection{
+		blog.PostsSection:    s.content.Posts,
+		blog.ArticlesSection: s.content.Articles,
+	} {
+		mux.HandleFunc("GET "+apiPrefix+"/"+name, s.list(name, collection))
+		mux.HandleFunc("GET "+apiPrefix+"/"+name+"/{id}", s.get(name, collection))
+		mux.HandleFunc("GET "+apiPrefix+"/"+name+"/{id}/resources/{name...}", s.resource(name, collection))
+		mux.HandleFunc("GET "+apiPrefix+"/"+name+"/{id}/variants/{name...}", s.variant(name, collection))
+	}
+	mux.HandleFunc("GET "+apiPrefix+"/intro", s.intro)
+	mux.HandleFunc("GET "+apiPrefix+"/aboutMe", s.page(blog.AboutMePage))
+	mux.HandleFunc("GET "+apiPrefix+"/pages/{id}/resources/{name...}", s.resource("pages", s.content.Pages))
+	mux.HandleFunc("GET "+apiPrefix+"/pages/{id}/variants/{name...}", s.variant("pages", s.content.Pages))
+	return s.cors(s.logRequests(mux))
+}
+
+// list serves the published posts of a collection, sorted, filtered and
+// paginated by the query parameters
+func (s *Server) list(name string, collection *blog.Collection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		params := r.URL.Query()
+		opts := blog.ListOptions{
+			Sort:     params.Get("sort"),
+			Order:    params.Get("order"),
+			Tag:      params.Get("tag"),
+			Language: params.Get("language"),
+			Cursor:   params.Get("cursor"),
+		}
+		var err error
+		if opts.Limit, err = positiveParam(params, "limit"); err != nil {
+			s.write(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+			return
+		}
+
+		page, err := collection.Query(r.Context(), opts)
+		if errors.Is(err, blog.ErrInvalidQuery) {
+			s.write(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+			return
+		}
+		if err != nil {
+			s.fail(w, r, err)
+			return
+		}
+		l := s.links(r, name)
+		summaries := make([]postSummary, 0, len(page.Posts))
+		for _, post := range page.Posts {
+			summaries = append(summaries, toPostSummary(post, l))
+		}
+		s.write(w, http.StatusOK, response{Result: summaries, NextCursor: page.NextCursor})
+	}
+}
+
+// get serves a single post of a collection
+func (s *Server) get(name string, collection *blog.Collection) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.post(w, r, name, collection, r.PathValue("id"))
+	}
+}
+
+// intro serves the intro page in the shape of the home page
+func (s *Server) intro(w http.ResponseWriter, r *http.Request) {
+	post, err := s.content.Pages.Get(r.Context(), blog.IntroPage)
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	s.write(w, http.StatusOK, response{Result: toIntro(post, s.links(r, "pages"))})
+}
+
+// page serves a page of the pages bucket
+func (s *Server) page(id string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		s.post(w, r, "pages", s.content.Pages, id)
+	}
+}
+
+// post writes a post of a collection with its content. A post requested
+// by a former ID is redirected to; the pages have fixed IDs and no {id}.
+func (s *Server) post(w http.ResponseWriter, r *http.Request, name string, collection *blog.Collection, id string) {
+	post, err := collection.Get(r.Context(), id)
+	if errors.Is(err, blog.ErrNotFound) && r.PathValue("id") != "" && s.moved(w, r, name, collection, "") {
+		return
+	}
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	s.write(w, http.StatusOK, response{Result: toPostDetail(post, s.links(r, name))})
+}
+
+// resource streams a resource of a post. The resources of a post requested
+// by a former ID are redirected to.
+func (s *Server) resource(name string, collection *blog.Collection) http.HandlerFunc {
+	return s.file(name, "resources", collection, collection.OpenResource)
+}
+
+// variant streams a resized image resource of a post, redirecting like
+// resource
+func (s *Server) variant(name string, collection *blog.Collection) http.HandlerFunc {
+	return s.file(name, "variants", collection, collection.OpenVariant)
+}
+
+// file streams a file of a post opened by open, served under folder
+func (s *Server) file(name, folder string, collection *blog.Collection,
+	open func(ctx context.Context, id, name string) (io.ReadCloser, minio.Object, error)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reader, object, err := open(r.Context(), r.PathValue("id"), r.PathValue("name"))
+		if errors.Is(err, blog.ErrNotFound) &&
+			s.moved(w, r, name, collection, "/"+folder+"/"+(&url.URL{Path: r.PathValue("name")}).EscapedPath()) {
+			return
+		}
+		if err != nil {
+			s.fail(w, r, err)
+			return
+		}
+		defer reader.Close()
+
+		etag := `"` + object.ETag + `"`
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Last-Modified", object.LastModified.UTC().Format(http.TimeFormat))
+		w.Header().Set("Cache-Control", "public, max-age=3600")
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		if object.ContentType != "" {
+			w.Header().Set("Content-Type", object.ContentType)
+		}
+		w.Header().Set("Content-Length", strconv.FormatInt(object.Size, 10))
+		if _, err := io.Copy(w, reader); err != nil {
+			s.logger.Warnf("Failed to send resource %s: %v", r.URL.Path, err)
+		}
+	}
+}
+
+// moved answers a request for a post that was renamed with a permanent
+// redirect to the same path, rest, under its current ID and reports
+// whether it did
+func (s *Server) moved(w http.ResponseWriter, r *http.Request, name string, collection *blog.Collection, rest string) bool {
+	to, err := collection.Redirect(r.Context(), r.PathValue("id"))
+	if err != nil {
+		if !errors.Is(err, blog.ErrNotFound) {
+			s.logger.WithField("path", r.URL.Path).Warnf("Failed to read the redirects: %v", err)
+		}
+		return false
+	}
+	location := apiPrefix + "/" + name + "/" + url.PathEscape(to) + rest
+	if r.URL.RawQuery != "" {
+		location += "?" + r.URL.RawQuery
+	}
+	http.Redirect(w, r, location, http.StatusMovedPermanently)
+	return true
+}
+
+// search serves a page of the posts and articles matching the q parameter
+func (s *Server) search(w http.ResponseWriter, r *http.Request) {
+	params := r.URL.Query()
+	q := blog.SearchQuery{
+		Text:     strings.TrimSpace(params.Get("q")),
+		Section:  params.Get("section"),
+		Language: params.Get("language"),
+	}
+	if q.Text == "" {
+		s.write(w, http.StatusBadRequest, errorResponse{Error: "missing query parameter q"})
+		return
+	}
+	if q.Section != "" && q.Section != blog.PostsSection && q.Section != blog.ArticlesSection {
+		s.write(w, http.StatusBadRequest, errorResponse{Error: "section must be posts or articles"})
+		return
+	}
+	var err error
+	if q.Page, err = positiveParam(params, "page"); err != nil {
+		s.write(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+	if q.Limit, err = positiveParam(params, "limit"); err != nil {
+		s.write(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+		return
+	}
+
+	results, err := s.content.Search(r.Context(), q)
+	if errors.Is(err, blog.ErrNoIndex) {
+		s.write(w, http.StatusServiceUnavailable, errorResponse{Error: err.Error()})
+		return
+	}
+	if err != nil {
+		s.fail(w, r, err)
+		return
+	}
+	s.write(w, http.StatusOK, response{Result: toSearchResults(results, func(section string) links {
+		return s.links(r, section)
+	})})
+}
+
+// positiveParam parses an optional positive integer query parameter, zero when absent
+func positiveParam(params url.Values, name string) (int, error) {
+	raw := params.Get(name)
+	if raw == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(raw)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%s must be a positive integer", name)
+	}
+	return n, nil
+}
+
+// health reports whether every bucket of the blog is reachable
+func (s *Server) health(w http.ResponseWriter, r *http.Request) {
+	for _, collection := range s.content.Collections() {
+		if err := collection.Ping(); err != nil {
+			s.logger.Errorf("Health check failed: %v", err)
+			s.write(w, http.StatusServiceUnavailable, map[string]string{"status": "unavailable", "error": err.Error()})
+			return
+		}
+	}
+	s.write(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// links returns the URL builder of a collection for the request
+func (s *Server) links(r *http.Request, name string) links {
+	base := s.publicURL
+	if base == "" {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		base = scheme + "://" + r.Host
+	}
+	return links{base: base + apiPrefix + "/" + name}
+}
+
+// fail writes the error of a request, hiding internal errors from the client
+func (s *Server) fail(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, blog.ErrNotFound) {
+		s.write(w, http.StatusNotFound, errorResponse{Error: "not found"})
+		return
+	}
+	s.logger.WithField("path", r.URL.Path).Errorf("Request failed: %v", err)
+	s.write(w, http.StatusInternalServerError, errorResponse{Error: "internal error"})
+}
+
+// write writes v as the JSON body of the response
+func (s *Server) write(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		s.logger.Warnf("Failed to write response: %v", err)
+	}
+}
+
+// cors allows the configured origins to call the API from a browser
+func (s *Server) cors(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		switch {
+		case origin == "":
+		case slices.Contains(s.origins, "*"):
+			w.Header().Set("Access-Control-Allow-Origin", "*")
+		case slices.Contains(s.origins, origin):
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			w.Header().Add("Vary", "Origin")
+		}
+		if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, If-None-Match")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// statusRecorder keeps the status code written to a response
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// logRequests logs every request with its status and duration
+func (s *Server) logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		s.logger.WithFields(config.Fields{
+			"method":   r.Method,
+			"path":     r.URL.Path,
+			"status":   rec.status,
+			"duration": time.Since(start).String(),
+		}).Debugf("%s %s %d", r.Method, r.URL.Path, rec.status)
+	})
+}
@@ -0,0 +1,373 @@
+package rest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/savabush/obsidian-sync/internal/blog"
+	"github.com/savabush/obsidian-sync/internal/config"
+	"github.com/savabush/obsidian-sync/internal/database/minio"
+	"github.com/savabush/obsidian-sync/internal/database/postgres"
+	"github.com/savabush/obsidian-sync/internal/lib"
+	"github.com/savabush/obsidian-sync/internal/markdown"
+)
+
+// fakeBucket is an in-memory section bucket
+type fakeBucket struct {
+	objects  map[string]string
+	metadata map[string]map[string]string
+	missing  bool
+}
+
+func (b *fakeBucket) object(key string) minio.Object {
+	return minio.Object{
+		Key:          key,
+		Size:         int64(len(b.objects[key])),
+		ETag:         "etag-" + key,
+		LastModified: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC),
+		ContentType:  "image/png",
+		Metadata:     b.metadata[key],
+	}
+}
+
+func (b *fakeBucket) ListObjectsContext(ctx context.Context, prefix string, withMetadata bool) ([]minio.Object, error) {
+	var objects []minio.Object
+	for key := range b.objects {
+		if strings.HasPrefix(key, prefix) {
+			objects = append(objects, b.object(key))
+		}
+	}
+	return objects, nil
+}
+
+func (b *fakeBucket) ReadObject(ctx context.Context, key string) ([]byte, minio.Object, error) {
+	content, ok := b.objects[key]
+	if !ok {
+		return nil, minio.Object{}, minio.ErrObjectNotFound
+	}
+	return []byte(content), b.object(key), nil
+}
+
+func (b *fakeBucket) OpenObject(ctx context.Context, key string) (io.ReadCloser, minio.Object, error) {
+	content, ok := b.objects[key]
+	if !ok {
+		return nil, minio.Object{}, minio.ErrObjectNotFound
+	}
+	return io.NopCloser(strings.NewReader(content)), b.object(key), nil
+}
+
+func (b *fakeBucket) StatObject(ctx context.Context, key string) (minio.Object, error) {
+	if _, ok := b.objects[key]; !ok {
+		return minio.Object{}, minio.ErrObjectNotFound
+	}
+	return b.object(key), nil
+}
+
+func (b *fakeBucket) BucketExists() (bool, error) {
+	return !b.missing, nil
+}
+
+// newTestServer serves a blog with a post, an article and the pages
+func newTestServer(t *testing.T, cfg config.APIConfig) (*httptest.Server, *fakeBucket) {
+	return newSearchServer(t, cfg, nil)
+}
+
+// newSearchServer serves the test blog searched in index, without search
+// when index is nil
+func newSearchServer(t *testing.T, cfg config.APIConfig, index blog.SearchIndex) (*httptest.Server, *fakeBucket) {
+	posts := &fakeBucket{objects: map[string]string{
+		"My Post/My Post.md":                        "---\ntitle: My post\ntags: [go]\ncreated: 2024-05-01\n---\n![[cover image.png]]\nText",
+		"My Post/My Post.html":                      "<p>Text</p>\n",
+		"My Post/My Post.json":                      `{"toc":[],"word_count":1,"reading_time":1,"excerpt":"Text"}`,
+		"My Post/Resources/cover image.png":         "png",
+		"My Post/Variants/cover image.png/480w.png": "small",
+		"Draft/Draft.md":                            "---\ndraft: true\n---\n",
+		"redirects.json":                            `{"posts":{"My Post":"My Post"},"redirects":{"old-post":"My Post"}}`,
+	}, metadata: map[string]map[string]string{
+		"My Post/Resources/cover image.png":         {"Image-Width": "960", "Image-Height": "540"},
+		"My Post/Variants/cover image.png/480w.png": {"Image-Width": "480", "Image-Height": "270"},
+	}}
+	articles := &fakeBucket{objects: map[string]string{"Article/Article.md": "# Article"}}
+	pages := &fakeBucket{objects: map[string]string{
+		"intro/intro.md":            "---\nname: Jane\nprofession: backend developer\n---\nHello",
+		"intro/Resources/photo.jpg": "jpg",
+		"about-me/about-me.md":      "# About me",
+		"redirects.json":            `{"posts":{"Intro":"intro"},"redirects":{"Intro":"intro"}}`,
+	}}
+	content := &blog.Content{
+		Posts:    blog.NewCollection("blog", posts, lib.TestLog),
+		Articles: blog.NewCollection("articles", articles, lib.TestLog),
+		Pages:    blog.NewCollection("pages", pages, lib.TestLog),
+	}
+	if index != nil {
+		content.SetIndex(index)
+	}
+	srv := httptest.NewServer(NewServer(cfg, content, lib.TestLog).Handler())
+	t.Cleanup(srv.Close)
+	return srv, pages
+}
+
+// getJSON requests path and decodes the JSON response
+func getJSON(t *testing.T, srv *httptest.Server, path string, v interface{}) int {
+	resp, err := http.Get(srv.URL + path)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, "application/json; charset=utf-8", resp.Header.Get("Content-Type"))
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(v))
+	return resp.StatusCode
+}
+
+func TestPosts(t *testing.T) {
+	srv, _ := newTestServer(t, config.APIConfig{})
+
+	var list struct{ Result []postSummary }
+	require.Equal(t, http.StatusOK, getJSON(t, srv, "/api/v1/posts", &list))
+	require.Len(t, list.Result, 1, "drafts are not listed")
+	post := list.Result[0]
+	assert.Equal(t, "My Post", post.ID)
+	assert.Equal(t, "My post", post.Title)
+	assert.Equal(t, []string{"go"}, post.Tags)
+	assert.Equal(t, srv.URL+"/api/v1/posts/My%20Post/resources/cover%20image.png", post.Image)
+
+	var raw struct{ Result []map[string]interface{} }
+	getJSON(t, srv, "/api/v1/posts", &raw)
+	for _, field := range []string{"name", "img", "summary", "updated_date"} {
+		assert.Contains(t, raw.Result[0], field, "the frontend reads %s", field)
+	}
+	assert.Equal(t, "", raw.Result[0]["summary"], "an empty summary is sent")
+	assert.Equal(t, time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC), post.CreatedAt)
+	assert.Equal(t, "Text", post.Excerpt, "the cover embed is left out")
+	assert.Equal(t, 1, post.WordCount)
+	assert.Equal(t, 1, post.ReadingTime)
+
+	var detail struct{ Result postDetail }
+	require.Equal(t, http.StatusOK, getJSON(t, srv, "/api/v1/posts/My%20Post", &detail))
+	assert.Equal(t, "![[cover image.png]]\nText", detail.Result.Content)
+	assert.Equal(t, "<p>Text</p>\n", detail.Result.HTML)
+	assert.Equal(t, []markdown.Heading{}, detail.Result.TOC)
+	assert.Equal(t, "My post", detail.Result.Metadata["title"])
+	require.Len(t, detail.Result.Resources, 1)
+	assert.Equal(t, post.Image, detail.Result.Resources[0].URL)
+
+	var failed errorResponse
+	assert.Equal(t, http.StatusNotFound, getJSON(t, srv, "/api/v1/posts/Draft", &failed))
+	assert.Equal(t, "not found", failed.Error)
+
+	require.Equal(t, http.StatusOK, getJSON(t, srv, "/api/v1/articles", &list))
+	require.Len(t, list.Result, 1)
+	assert.Equal(t, "Article", list.Result[0].Title)
+}
+
+func TestListOptions(t *testing.T) {
+	srv, _ := newTestServer(t, config.APIConfig{})
+
+	var page struct {
+		Result     []postSummary
+		NextCursor string `json:"next_cursor"`
+	}
+	require.Equal(t, http.StatusOK, getJSON(t, srv, "/api/v1/posts?sort=title&order=asc&tag=go&language=&limit=1", &page))
+	require.Len(t, page.Result, 1)
+	assert.Equal(t, "My Post", page.Result[0].ID)
+	assert.Empty(t, page.NextCursor)
+
+	require.Equal(t, http.StatusOK, getJSON(t, srv, "/api/v1/posts?tag=rust", &page))
+	assert.Empty(t, page.Result)
+
+	var failed errorResponse
+	assert.Equal(t, http.StatusBadRequest, getJSON(t, srv, "/api/v1/posts?sort=size", &failed))
+	assert.Equal(t, "invalid query: sort must be created, updated or title", failed.Error)
+	assert.Equal(t, http.StatusBadRequest, getJSON(t, srv, "/api/v1/articles?limit=0", &failed))
+	assert.Equal(t, "limit must be a positive integer", failed.Error)
+}
+
+func TestPages(t *testing.T) {
+	srv, _ := newTestServer(t, config.APIConfig{PUBLIC_URL: "https://api.example.com/"})
+
+	var intro struct{ Result map[string]string }
+	require.Equal(t, http.StatusOK, getJSON(t, srv, "/api/v1/intro", &intro))
+	assert.Equal(t, map[string]string{
+		"name":       "Jane",
+		"profession": "backend developer",
+		"about":      "Hello",
+		"img":        "https://api.example.com/api/v1/pages/intro/resources/photo.jpg",
+	}, intro.Result)
+
+	var about struct{ Result postDetail }
+	require.Equal(t, http.StatusOK, getJSON(t, srv, "/api/v1/aboutMe", &about))
+	assert.Equal(t, "About me", about.Result.Title)
+}
+
+func TestResources(t *testing.T) {
+	srv, _ := newTestServer(t, config.APIConfig{})
+
+	resp, err := http.Get(srv.URL + "/api/v1/posts/My%20Post/resources/cover%20image.png")
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "png", string(body))
+	assert.Equal(t, "image/png", resp.Header.Get("Content-Type"))
+	etag := resp.Header.Get("ETag")
+	assert.NotEmpty(t, etag)
+
+	req, _ := http.NewRequest(http.MethodGet, srv.URL+"/api/v1/posts/My%20Post/resources/cover%20image.png", nil)
+	req.Header.Set("If-None-Match", etag)
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotModified, resp.StatusCode)
+
+	resp, err = http.Get(srv.URL + "/api/v1/posts/Draft/resources/cover%20image.png")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestVariants(t *testing.T) {
+	srv, _ := newTestServer(t, config.APIConfig{PUBLIC_URL: "https://api.example.com"})
+
+	var detail struct{ Result postDetail }
+	require.Equal(t, http.StatusOK, getJSON(t, srv, "/api/v1/posts/My%20Post", &detail))
+	require.Len(t, detail.Result.Resources, 1)
+	cover := detail.Result.Resources[0]
+	assert.Equal(t, [2]int{960, 540}, [2]int{cover.Width, cover.Height})
+	url := "https://api.example.com/api/v1/posts/My%20Post/variants/cover%20image.png/480w.png"
+	assert.Equal(t, []variant{{URL: url, Width: 480, Height: 270, ContentType: "image/png", Size: 5}}, cover.Variants)
+	assert.Equal(t, url+" 480w", cover.Srcset)
+
+	resp, err := http.Get(srv.URL + "/api/v1/posts/My%20Post/variants/cover%20image.png/480w.png")
+	require.NoError(t, err)
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "small", string(body))
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err = client.Get(srv.URL + "/api/v1/posts/old-post/variants/cover%20image.png/480w.png")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode)
+	assert.Equal(t, "/api/v1/posts/My%20Post/variants/cover%20image.png/480w.png", resp.Header.Get("Location"))
+
+	resp, err = http.Get(srv.URL + "/api/v1/posts/My%20Post/variants/cover%20image.png/960w.png")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+}
+
+func TestRedirects(t *testing.T) {
+	srv, _ := newTestServer(t, config.APIConfig{})
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	for path, location := range map[string]string{
+		"/api/v1/posts/old-post":                             "/api/v1/posts/My%20Post",
+		"/api/v1/posts/old-post?lang=en":                     "/api/v1/posts/My%20Post?lang=en",
+		"/api/v1/posts/old-post/resources/cover%20image.png": "/api/v1/posts/My%20Post/resources/cover%20image.png",
+		"/api/v1/pages/Intro/resources/photo.jpg":            "/api/v1/pages/intro/resources/photo.jpg",
+	} {
+		resp, err := client.Get(srv.URL + path)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusMovedPermanently, resp.StatusCode, path)
+		assert.Equal(t, location, resp.Header.Get("Location"), path)
+	}
+
+	var failed errorResponse
+	assert.Equal(t, http.StatusNotFound, getJSON(t, srv, "/api/v1/posts/other-post", &failed))
+	assert.Equal(t, http.StatusNotFound, getJSON(t, srv, "/api/v1/articles/old-post", &failed),
+		"redirects are kept per section")
+	assert.Equal(t, http.StatusNotFound, getJSON(t, srv, "/api/v1/posts/My%20Post/resources/missing.png", &failed))
+
+	var post struct{ Result postDetail }
+	resp, err := http.Get(srv.URL + "/api/v1/posts/old-post")
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&post))
+	assert.Equal(t, "My post", post.Result.Title, "clients follow the redirect")
+}
+
+// fakeIndex returns one hit per query
+type fakeIndex struct {
+	query postgres.SearchQuery
+}
+
+func (f *fakeIndex) SearchPosts(ctx context.Context, q postgres.SearchQuery) (postgres.SearchResults, error) {
+	f.query = q
+	created := time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	return postgres.SearchResults{Total: 1, Hits: []postgres.SearchHit{{
+		Post:    postgres.Post{Bucket: "blog", Slug: "My Post", Title: "My post", Language: "en", CreatedAt: &created},
+		Rank:    0.5,
+		Snippet: "<mark>Text</mark>",
+	}}}, nil
+}
+
+func TestSearch(t *testing.T) {
+	srv, _ := newTestServer(t, config.APIConfig{})
+	var failed errorResponse
+	assert.Equal(t, http.StatusServiceUnavailable, getJSON(t, srv, "/api/v1/search?q=text", &failed))
+	assert.Equal(t, "search is not available", failed.Error)
+
+	index := &fakeIndex{}
+	srv, _ = newSearchServer(t, config.APIConfig{}, index)
+	var results struct{ Result searchResults }
+	require.Equal(t, http.StatusOK, getJSON(t, srv, "/api/v1/search?q=text&section=posts&language=en&page=2&limit=5", &results))
+	assert.Equal(t, postgres.SearchQuery{Text: "text", Buckets: []string{"blog"}, Language: "en", Limit: 5, Offset: 5},
+		index.query)
+	assert.Equal(t, 1, results.Result.Total)
+	assert.Equal(t, 2, results.Result.Page)
+	assert.Equal(t, 5, results.Result.Limit)
+	require.Len(t, results.Result.Hits, 1)
+	hit := results.Result.Hits[0]
+	assert.Equal(t, "posts", hit.Section)
+	assert.Equal(t, "My Post", hit.ID)
+	assert.Equal(t, srv.URL+"/api/v1/posts/My%20Post", hit.URL)
+	assert.Equal(t, "<mark>Text</mark>", hit.Snippet)
+	assert.Equal(t, []string{}, hit.Tags)
+
+	for query, message := range map[string]string{
+		"":                     "missing query parameter q",
+		"q=+":                  "missing query parameter q",
+		"q=text&section=pages": "section must be posts or articles",
+		"q=text&page=0":        "page must be a positive integer",
+		"q=text&limit=ten":     "limit must be a positive integer",
+	} {
+		assert.Equal(t, http.StatusBadRequest, getJSON(t, srv, "/api/v1/search?"+query, &failed), query)
+		assert.Equal(t, message, failed.Error, query)
+	}
+}
+
+func TestHealthAndCORS(t *testing.T) {
+	srv, pages := newTestServer(t, config.APIConfig{CORS_ORIGINS: "http://localhost:5173"})
+
+	var health map[string]string
+	assert.Equal(t, http.StatusOK, getJSON(t, srv, "/api/v1/health", &health))
+	assert.Equal(t, "ok", health["status"])
+	pages.missing = true
+	assert.Equal(t, http.StatusServiceUnavailable, getJSON(t, srv, "/api/v1/health", &health))
+	assert.Equal(t, "bucket pages does not exist", health["error"])
+
+	req, _ := http.NewRequest(http.MethodOptions, srv.URL+"/api/v1/posts", nil)
+	req.Header.Set("Origin", "http://localhost:5173")
+	req.Header.Set("Access-Control-Request-Method", "GET")
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, "http://localhost:5173", resp.Header.Get("Access-Control-Allow-Origin"))
+
+	req, _ = http.NewRequest(http.MethodGet, srv.URL+"/api/v1/posts", bytes.NewReader(nil))
+	req.Header.Set("Origin", "https://evil.example.com")
+	resp, err = http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Empty(t, resp.Header.Get("Access-Control-Allow-Origin"))
+}